@@ -2,7 +2,10 @@ package api
 
 import (
 	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
 	"luismatosgarcia.dev/video-sharing-go/internal/videos"
 	"time"
 )
@@ -14,13 +17,19 @@ var (
 type API struct {
 	Logger            *jsonlog.Logger
 	BackgroundRoutine background.Routine
+	filestore         filestore.FileStore
 	videos            videos.Videos
+	uploads           uploads.Uploads
+	users             users.Users
 }
 
-func NewService(l *jsonlog.Logger, bg background.Routine, v videos.Videos) (*API, error) {
+func NewService(l *jsonlog.Logger, bg background.Routine, fs filestore.FileStore, v videos.Videos, u uploads.Uploads, us users.Users) (*API, error) {
 	return &API{
 		Logger:            l,
+		filestore:         fs,
 		videos:            v,
+		uploads:           u,
+		users:             us,
 		BackgroundRoutine: bg,
 	}, nil
 }
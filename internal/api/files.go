@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"net/url"
+)
+
+// VerifySignedFile checks a presigned URL minted by a backend that relies on the API server to serve its
+// objects. Backends with native presigning never route through here, so their URLs are not found.
+func (api *API) VerifySignedFile(method, key string, query url.Values) error {
+	verifier, ok := api.filestore.(filestore.SignedURLVerifier)
+	if !ok {
+		return filestore.ErrObjectNotFound
+	}
+
+	return verifier.VerifySignedURL(method, key, query)
+}
+
+// AcceptSignedWrite checks the object of a presigned PUT URL still waits for its content, the URL expires
+// once the direct upload it was minted for is completed.
+func (api *API) AcceptSignedWrite(ctx context.Context, key string) error {
+	err, validationErrors := api.videos.AcceptDirectUpload(ctx, key)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return err
+	}
+
+	return nil
+}
+
+func (api *API) StatFile(ctx context.Context, key string) (*filestore.ObjectInfo, error) {
+	info, err := api.filestore.Stat(ctx, key)
+	if err != nil {
+		api.Logger.PrintError(err, nil)
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (api *API) ReadFile(ctx context.Context, key string, offset, length int64) (*filestore.Object, error) {
+	obj, err := api.filestore.GetRange(ctx, key, offset, length)
+	if err != nil {
+		api.Logger.PrintError(err, nil)
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (api *API) WriteFile(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	err := api.filestore.Put(ctx, key, r, size, contentType)
+	if err != nil {
+		api.Logger.PrintError(err, nil)
+		return err
+	}
+
+	return nil
+}
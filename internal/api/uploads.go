@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+)
+
+func (api *API) CreateUpload(ctx context.Context, ownerId, length int64, metadata map[string]string) (*uploads.Upload, error, map[string]string) {
+	u, err, validationErrors := api.uploads.CreateUpload(ctx, ownerId, length, metadata)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return u, nil, nil
+}
+
+func (api *API) ReadUpload(ctx context.Context, actor videos.Actor, uploadId string) (*uploads.Upload, error, map[string]string) {
+	u, err, validationErrors := api.uploads.ReadUpload(ctx, actor, uploadId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return u, nil, nil
+}
+
+func (api *API) WriteUploadChunk(ctx context.Context, actor videos.Actor, uploadId string, offset int64, body io.Reader) (*uploads.Upload, error, map[string]string) {
+	u, err, validationErrors := api.uploads.WriteChunk(ctx, actor, uploadId, offset, body)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return u, nil, nil
+}
+
+func (api *API) TerminateUpload(ctx context.Context, actor videos.Actor, uploadId string) (error, map[string]string) {
+	err, validationErrors := api.uploads.TerminateUpload(ctx, actor, uploadId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return err, validationErrors
+	}
+
+	return nil, nil
+}
+
+func (api *API) UploadMaxSize() int64 {
+	return api.uploads.MaxSize()
+}
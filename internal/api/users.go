@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+)
+
+func (api *API) RegisterUser(ctx context.Context, input *users.UserInput) (*users.User, error, map[string]string) {
+	u, err, validationErrors := api.users.RegisterUser(ctx, input)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return u, nil, nil
+}
+
+func (api *API) ActivateUser(ctx context.Context, tokenPlaintext string) (*users.User, error, map[string]string) {
+	u, err, validationErrors := api.users.ActivateUser(ctx, tokenPlaintext)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return u, nil, nil
+}
+
+func (api *API) CreateAuthenticationToken(ctx context.Context, email, password string) (*users.Token, error, map[string]string) {
+	t, err, validationErrors := api.users.CreateAuthenticationToken(ctx, email, password)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return t, nil, nil
+}
+
+func (api *API) AuthenticateToken(ctx context.Context, tokenPlaintext string) (*users.User, error, map[string]string) {
+	u, err, validationErrors := api.users.AuthenticateToken(ctx, tokenPlaintext)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return u, nil, nil
+}
+
+func (api *API) ReadPermissions(ctx context.Context, userId int64) (users.Permissions, error, map[string]string) {
+	p, err, validationErrors := api.users.ReadPermissions(ctx, userId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return p, nil, nil
+}
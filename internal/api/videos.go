@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
 	"luismatosgarcia.dev/video-sharing-go/internal/videos"
 	"mime/multipart"
 )
@@ -17,8 +19,8 @@ func (api *API) CreateVideo(ctx context.Context, v *videos.Video) (*videos.Video
 	return v, nil, nil
 }
 
-func (api *API) UploadVideo(ctx context.Context, videoFile *io.Reader, fileHeader *multipart.FileHeader) (*videos.Video, error, map[string]string) {
-	v, err, validationErrors := api.videos.UploadVideo(ctx, videoFile, fileHeader)
+func (api *API) UploadVideo(ctx context.Context, actor videos.Actor, videoFile *io.Reader, fileHeader *multipart.FileHeader) (*videos.Video, error, map[string]string) {
+	v, err, validationErrors := api.videos.UploadVideo(ctx, actor, videoFile, fileHeader)
 	if err != nil {
 		api.Logger.PrintError(err, validationErrors)
 		return nil, err, validationErrors
@@ -37,8 +39,38 @@ func (api *API) ReadVideo(ctx context.Context, videoId int64) (*videos.Video, er
 	return v, nil, nil
 }
 
-func (api *API) UpdateVideo(ctx context.Context, videoId int64, videoInput *videos.VideoInput) (*videos.Video, error, map[string]string) {
-	v, err, validatorErrors := api.videos.UpdateVideo(ctx, videoId, videoInput)
+func (api *API) ListVideos(ctx context.Context, filters videos.VideoFilters) ([]*videos.Video, datastore.Metadata, error, map[string]string) {
+	v, metadata, err, validationErrors := api.videos.ListVideos(ctx, filters)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, datastore.Metadata{}, err, validationErrors
+	}
+
+	return v, metadata, nil, nil
+}
+
+func (api *API) SearchVideos(ctx context.Context, filters videos.SearchFilters) ([]*videos.SearchResult, datastore.Metadata, error, map[string]string) {
+	results, metadata, err, validationErrors := api.videos.SearchVideos(ctx, filters)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, datastore.Metadata{}, err, validationErrors
+	}
+
+	return results, metadata, nil, nil
+}
+
+func (api *API) UpdateVideo(ctx context.Context, actor videos.Actor, videoId int64, videoInput *videos.VideoInput) (*videos.Video, error, map[string]string) {
+	v, err, validatorErrors := api.videos.UpdateVideo(ctx, actor, videoId, videoInput)
+	if err != nil {
+		api.Logger.PrintError(err, validatorErrors)
+		return nil, err, validatorErrors
+	}
+
+	return v, nil, nil
+}
+
+func (api *API) UpdateVideoStatus(ctx context.Context, actor videos.Actor, videoId int64, status videos.Status) (*videos.Video, error, map[string]string) {
+	v, err, validatorErrors := api.videos.UpdateVideoStatus(ctx, actor, videoId, status)
 	if err != nil {
 		api.Logger.PrintError(err, validatorErrors)
 		return nil, err, validatorErrors
@@ -46,3 +78,133 @@ func (api *API) UpdateVideo(ctx context.Context, videoId int64, videoInput *vide
 
 	return v, nil, nil
 }
+
+func (api *API) StatVideoContent(ctx context.Context, videoId int64) (*videos.Video, *filestore.ObjectInfo, error, map[string]string) {
+	v, info, err, validationErrors := api.videos.StatVideoContent(ctx, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, info, nil, nil
+}
+
+func (api *API) ReadVideoContent(ctx context.Context, video *videos.Video, offset, length int64) (*filestore.Object, error, map[string]string) {
+	obj, err, validationErrors := api.videos.ReadVideoContent(ctx, video, offset, length)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return obj, nil, nil
+}
+
+func (api *API) HLSMasterPlaylist(ctx context.Context, videoId int64) (*videos.Video, []byte, error, map[string]string) {
+	v, playlist, err, validationErrors := api.videos.HLSMasterPlaylist(ctx, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, playlist, nil, nil
+}
+
+func (api *API) StatHLSFile(ctx context.Context, videoId int64, name string) (*videos.Video, *filestore.ObjectInfo, error, map[string]string) {
+	v, info, err, validationErrors := api.videos.StatHLSFile(ctx, videoId, name)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, info, nil, nil
+}
+
+func (api *API) DASHManifest(ctx context.Context, videoId int64) (*videos.Video, []byte, error, map[string]string) {
+	v, manifest, err, validationErrors := api.videos.DASHManifest(ctx, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, manifest, nil, nil
+}
+
+func (api *API) StatDASHFile(ctx context.Context, videoId int64, name string) (*videos.Video, *filestore.ObjectInfo, error, map[string]string) {
+	v, info, err, validationErrors := api.videos.StatDASHFile(ctx, videoId, name)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, info, nil, nil
+}
+
+func (api *API) ReadPackagedFile(ctx context.Context, video *videos.Video, key string, offset, length int64) (*filestore.Object, error, map[string]string) {
+	obj, err, validationErrors := api.videos.ReadPackagedFile(ctx, video, key, offset, length)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return obj, nil, nil
+}
+
+func (api *API) CreateDirectUpload(ctx context.Context, actor videos.Actor, filename, contentType string) (*videos.Video, *filestore.PresignedURL, error, map[string]string) {
+	v, presigned, err, validationErrors := api.videos.CreateDirectUpload(ctx, actor, filename, contentType)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, presigned, nil, nil
+}
+
+func (api *API) CompleteDirectUpload(ctx context.Context, actor videos.Actor, videoId int64) (*videos.Video, error, map[string]string) {
+	v, err, validationErrors := api.videos.CompleteDirectUpload(ctx, actor, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return v, nil, nil
+}
+
+func (api *API) PresignVideoDownload(ctx context.Context, videoId int64) (*videos.Video, *filestore.PresignedURL, error, map[string]string) {
+	v, presigned, err, validationErrors := api.videos.PresignVideoDownload(ctx, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, nil, err, validationErrors
+	}
+
+	return v, presigned, nil, nil
+}
+
+func (api *API) DeleteVideo(ctx context.Context, actor videos.Actor, videoId int64) (error, map[string]string) {
+	err, validationErrors := api.videos.DeleteVideo(ctx, actor, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return err, validationErrors
+	}
+
+	return nil, nil
+}
+
+func (api *API) RestoreVideo(ctx context.Context, actor videos.Actor, videoId int64) (*videos.Video, error, map[string]string) {
+	v, err, validationErrors := api.videos.RestoreVideo(ctx, actor, videoId)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, err, validationErrors
+	}
+
+	return v, nil, nil
+}
+
+func (api *API) ListDeletedVideos(ctx context.Context, actor videos.Actor, filters datastore.Filters) ([]*videos.Video, datastore.Metadata, error, map[string]string) {
+	v, metadata, err, validationErrors := api.videos.ListDeletedVideos(ctx, actor, filters)
+	if err != nil {
+		api.Logger.PrintError(err, validationErrors)
+		return nil, datastore.Metadata{}, err, validationErrors
+	}
+
+	return v, metadata, nil, nil
+}
@@ -1,19 +1,42 @@
 package background
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var (
 	ArgsTypeMismatchError = errors.New("background args types mistmatched")
+	ErrUnknownJobKind     = errors.New("no handler registered for job kind")
 )
 
+type Config struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	LockTimeout  time.Duration
+	JobTimeout   time.Duration
+}
+
 type Routine interface {
 	Dispatch(fn func(args []any), args []any)
+	Register(kind JobKind, handler JobHandler)
+	Enqueue(ctx context.Context, kind JobKind, payload any) (*Job, error)
+	EnqueueTx(ctx context.Context, tx *sql.Tx, kind JobKind, payload any) (*Job, error)
+	Schedule(kind JobKind, every time.Duration, payload any)
+	Start()
 	Wait()
+	RegisterMetrics(reg *metrics.Registry)
 	PrintInfo(message string, properties map[string]string)
 	PrintError(err error, properties map[string]string)
 }
@@ -21,6 +44,20 @@ type Routine interface {
 type RoutineImpl struct {
 	Wg     sync.WaitGroup
 	Logger *jsonlog.Logger
+
+	cfg       Config
+	store     store
+	mu        sync.RWMutex
+	handlers  map[JobKind]JobHandler
+	schedules []schedule
+	workers   sync.WaitGroup
+	cancel    context.CancelFunc
+}
+
+type schedule struct {
+	kind    JobKind
+	every   time.Duration
+	payload any
 }
 
 func (br *RoutineImpl) Dispatch(fn func(args []any), args []any) {
@@ -39,6 +76,239 @@ func (br *RoutineImpl) Dispatch(fn func(args []any), args []any) {
 	}(args)
 }
 
+// Register binds a handler to a job kind. Workers only claim jobs whose kind has a handler, so handlers
+// must be registered before Start is called.
+func (br *RoutineImpl) Register(kind JobKind, handler JobHandler) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	br.handlers[kind] = handler
+}
+
+// Enqueue persists a job so that it survives process restarts. The payload is stored as JSON and must
+// only carry data that can be reloaded by the handler (ids, keys, paths), never in-memory readers.
+func (br *RoutineImpl) Enqueue(ctx context.Context, kind JobKind, payload any) (*Job, error) {
+	job, err := br.newJob(kind, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = br.store.Insert(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// EnqueueTx persists a job as part of tx, for jobs that must only exist when the rows they refer to were
+// committed. tx must run on the database the jobs are stored in.
+func (br *RoutineImpl) EnqueueTx(ctx context.Context, tx *sql.Tx, kind JobKind, payload any) (*Job, error) {
+	job, err := br.newJob(kind, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = br.store.InsertTx(ctx, tx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (br *RoutineImpl) newJob(kind JobKind, payload any) (*Job, error) {
+	br.mu.RLock()
+	_, exists := br.handlers[kind]
+	br.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobKind, kind)
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		Kind:        kind,
+		Payload:     js,
+		MaxAttempts: br.cfg.MaxAttempts,
+		RunAt:       time.Now(),
+	}, nil
+}
+
+// Schedule enqueues a job of the given kind when the pool starts and then every interval. A new job is
+// only enqueued once the previous one has finished, so slow jobs never overlap. Schedules must be added
+// before Start is called.
+func (br *RoutineImpl) Schedule(kind JobKind, every time.Duration, payload any) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	br.schedules = append(br.schedules, schedule{kind: kind, every: every, payload: payload})
+}
+
+// Start launches the worker pool and the schedules. Workers poll for runnable jobs until Wait is called.
+func (br *RoutineImpl) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	br.cancel = cancel
+
+	for i := 0; i < br.cfg.Workers; i++ {
+		br.workers.Add(1)
+		go br.work(ctx)
+	}
+
+	br.mu.RLock()
+	for _, sc := range br.schedules {
+		br.workers.Add(1)
+		go br.tick(ctx, sc)
+	}
+	br.mu.RUnlock()
+
+	br.PrintInfo("background workers started", map[string]string{
+		"workers": strconv.Itoa(br.cfg.Workers),
+	})
+}
+
+func (br *RoutineImpl) work(ctx context.Context) {
+	defer br.workers.Done()
+
+	ticker := time.NewTicker(br.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain every runnable job before going back to sleep
+		for ctx.Err() == nil {
+			job, err := br.store.Claim(ctx, br.kinds(), br.cfg.LockTimeout)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					br.PrintError(err, nil)
+				}
+				break
+			}
+
+			if job == nil {
+				break
+			}
+
+			br.run(job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := br.store.KillExpired(ctx, br.cfg.LockTimeout)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				br.PrintError(err, nil)
+			}
+		}
+	}
+}
+
+func (br *RoutineImpl) tick(ctx context.Context, sc schedule) {
+	defer br.workers.Done()
+
+	ticker := time.NewTicker(sc.every)
+	defer ticker.Stop()
+
+	for {
+		err := br.enqueueScheduled(ctx, sc)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			br.PrintError(err, map[string]string{"job_kind": string(sc.kind)})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (br *RoutineImpl) enqueueScheduled(ctx context.Context, sc schedule) error {
+	js, err := json.Marshal(sc.payload)
+	if err != nil {
+		return err
+	}
+
+	job := &Job{
+		Kind:        sc.kind,
+		Payload:     js,
+		MaxAttempts: br.cfg.MaxAttempts,
+		RunAt:       time.Now(),
+	}
+
+	_, err = br.store.InsertUnlessQueued(ctx, job)
+
+	return err
+}
+
+// run executes a claimed job and records the outcome. Jobs are not tied to the worker context so an
+// in-flight job finishes even while the pool is shutting down.
+func (br *RoutineImpl) run(job *Job) {
+	properties := map[string]string{
+		"job_id":   strconv.FormatInt(job.ID, 10),
+		"job_kind": string(job.Kind),
+		"attempt":  strconv.Itoa(job.Attempts),
+	}
+
+	br.mu.RLock()
+	handler := br.handlers[job.Kind]
+	br.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), br.cfg.JobTimeout)
+	defer cancel()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s", r)
+			}
+		}()
+
+		return handler(ctx, job)
+	}()
+
+	if err == nil {
+		err = br.store.Complete(context.Background(), job)
+		if err != nil {
+			br.PrintError(err, properties)
+		}
+		return
+	}
+
+	br.PrintError(err, properties)
+
+	if IsPermanent(err) || job.FinalAttempt() {
+		err = br.store.Kill(context.Background(), job, err.Error())
+		if err != nil {
+			br.PrintError(err, properties)
+		}
+		return
+	}
+
+	runAt := time.Now().Add(backoff(job.Attempts, br.cfg.BaseBackoff, br.cfg.MaxBackoff))
+
+	err = br.store.Retry(context.Background(), job, runAt, err.Error())
+	if err != nil {
+		br.PrintError(err, properties)
+	}
+}
+
+func (br *RoutineImpl) kinds() []JobKind {
+	br.mu.RLock()
+	defer br.mu.RUnlock()
+
+	kinds := make([]JobKind, 0, len(br.handlers))
+	for kind := range br.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	return kinds
+}
+
 func (br *RoutineImpl) PrintInfo(message string, properties map[string]string) {
 	br.Logger.PrintInfo(message, properties)
 }
@@ -47,19 +317,56 @@ func (br *RoutineImpl) PrintError(err error, properties map[string]string) {
 	br.Logger.PrintError(err, properties)
 }
 
+// Wait stops the worker pool from claiming new jobs and blocks until in-flight jobs and dispatched
+// routines have finished.
 func (br *RoutineImpl) Wait() {
+	if br.cancel != nil {
+		br.cancel()
+	}
+
+	br.workers.Wait()
 	br.Wg.Wait()
 }
 
-func NewService(l *jsonlog.Logger) (Routine, error) {
+// RegisterMetrics exposes the number of persisted jobs by kind and status, counted on every scrape.
+func (br *RoutineImpl) RegisterMetrics(reg *metrics.Registry) {
+	jobs := reg.Gauge("background_jobs", "Number of background jobs by kind and status.", "kind", "status")
+
+	reg.OnScrape(func(ctx context.Context) error {
+		counts, err := br.store.CountByStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		jobs.Reset()
+		for _, c := range counts {
+			jobs.With(string(c.Kind), string(c.Status)).Set(float64(c.Count))
+		}
+
+		return nil
+	})
+}
+
+func NewService(l *jsonlog.Logger, db *sql.DB, cfg Config) (Routine, error) {
+	s, err := newStore(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return &RoutineImpl{
-		Logger: l,
+		Logger:   l,
+		cfg:      cfg,
+		store:    s,
+		handlers: make(map[JobKind]JobHandler),
 	}, nil
 }
 
 // RoutineMock mock for testing purposes
 type RoutineMock struct {
 	Wg sync.WaitGroup
+
+	mu       sync.Mutex
+	handlers map[JobKind]JobHandler
 }
 
 func (r *RoutineMock) Dispatch(fn func(args []any), args []any) {
@@ -77,10 +384,64 @@ func (r *RoutineMock) Dispatch(fn func(args []any), args []any) {
 	}(args)
 }
 
+func (r *RoutineMock) Register(kind JobKind, handler JobHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.handlers == nil {
+		r.handlers = make(map[JobKind]JobHandler)
+	}
+
+	r.handlers[kind] = handler
+}
+
+// Enqueue runs the registered handler right away on a goroutine, a single attempt with no persistence.
+func (r *RoutineMock) Enqueue(ctx context.Context, kind JobKind, payload any) (*Job, error) {
+	r.mu.Lock()
+	handler, exists := r.handlers[kind]
+	r.mu.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobKind, kind)
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		Kind:        kind,
+		Payload:     js,
+		Status:      JobRunning,
+		Attempts:    1,
+		MaxAttempts: 1,
+		RunAt:       time.Now(),
+	}
+
+	r.Dispatch(func(args []any) {
+		_ = handler(context.Background(), job)
+	}, nil)
+
+	return job, nil
+}
+
+// EnqueueTx ignores tx and behaves like Enqueue.
+func (r *RoutineMock) EnqueueTx(ctx context.Context, tx *sql.Tx, kind JobKind, payload any) (*Job, error) {
+	return r.Enqueue(ctx, kind, payload)
+}
+
+// Schedule is a no-op, tests enqueue scheduled kinds directly.
+func (r *RoutineMock) Schedule(kind JobKind, every time.Duration, payload any) {}
+
+func (r *RoutineMock) Start() {}
+
 func (r *RoutineMock) Wait() {
 	r.Wg.Wait()
 }
 
+func (r *RoutineMock) RegisterMetrics(reg *metrics.Registry) {}
+
 func (r *RoutineMock) PrintInfo(message string, properties map[string]string) {}
 
 func (r *RoutineMock) PrintError(err error, properties map[string]string) {}
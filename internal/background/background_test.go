@@ -0,0 +1,145 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	testsMap := []struct {
+		name     string
+		attempts int
+		wants    time.Duration
+	}{
+		{name: "First Attempt", attempts: 1, wants: time.Second},
+		{name: "Doubles", attempts: 3, wants: 4 * time.Second},
+		{name: "Capped", attempts: 10, wants: time.Minute},
+		{name: "Overflow Capped", attempts: 100, wants: time.Minute},
+		{name: "Zero Attempts", attempts: 0, wants: time.Second},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, backoff(tt.attempts, time.Second, time.Minute), tt.wants)
+		})
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	err := errors.New("boom")
+
+	assert.Equal(t, IsPermanent(Permanent(err)), true)
+	assert.Equal(t, IsPermanent(err), false)
+	assert.Equal(t, errors.Is(Permanent(err), err), true)
+	assert.NilError(t, Permanent(nil))
+}
+
+func TestRoutineMock_Enqueue(t *testing.T) {
+	type payload struct {
+		ID int64 `json:"id"`
+	}
+
+	r := &RoutineMock{}
+
+	var received payload
+	r.Register("tests:job", func(ctx context.Context, job *Job) error {
+		return job.Decode(&received)
+	})
+
+	_, err := r.Enqueue(context.Background(), "tests:job", payload{ID: 7})
+	assert.NilError(t, err)
+
+	r.Wait()
+	assert.Equal(t, received.ID, 7)
+
+	_, err = r.Enqueue(context.Background(), "tests:unknown", payload{})
+	assert.Equal(t, errors.Is(err, ErrUnknownJobKind), true)
+}
+
+// scheduleStore counts scheduled inserts, only the first one finds no queued job.
+type scheduleStore struct {
+	store
+
+	mu       sync.Mutex
+	inserts  int
+	inserted chan *Job
+}
+
+func (s *scheduleStore) InsertUnlessQueued(ctx context.Context, job *Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inserts++
+	if s.inserts > 1 {
+		return false, nil
+	}
+
+	s.inserted <- job
+
+	return true, nil
+}
+
+func TestRoutineImpl_Schedule(t *testing.T) {
+	s := &scheduleStore{inserted: make(chan *Job, 1)}
+
+	br := &RoutineImpl{
+		Logger:   jsonlog.New(io.Discard, jsonlog.LevelError),
+		cfg:      Config{MaxAttempts: 3},
+		store:    s,
+		handlers: make(map[JobKind]JobHandler),
+	}
+
+	br.Schedule("test:scheduled", time.Millisecond, map[string]int{"n": 1})
+	br.Start()
+
+	select {
+	case job := <-s.inserted:
+		assert.Equal(t, job.Kind, JobKind("test:scheduled"))
+		assert.Equal(t, string(job.Payload), `{"n":1}`)
+		assert.Equal(t, job.MaxAttempts, 3)
+	case <-time.After(time.Second):
+		t.Fatal("scheduled job was not enqueued")
+	}
+
+	br.Wait()
+}
+
+// countStore returns a fixed set of job counts.
+type countStore struct {
+	store
+	counts []JobCount
+}
+
+func (s *countStore) CountByStatus(ctx context.Context) ([]JobCount, error) {
+	return s.counts, nil
+}
+
+func TestRoutineImpl_RegisterMetrics(t *testing.T) {
+	s := &countStore{counts: []JobCount{
+		{Kind: "video:process", Status: JobPending, Count: 3},
+		{Kind: "video:process", Status: JobDead, Count: 1},
+	}}
+
+	br := &RoutineImpl{store: s}
+
+	reg := metrics.NewRegistry()
+	br.RegisterMetrics(reg)
+
+	var sb strings.Builder
+	assert.NilError(t, reg.Write(context.Background(), &sb))
+	assert.StringContains(t, sb.String(), `background_jobs{kind="video:process",status="pending"} 3`)
+	assert.StringContains(t, sb.String(), `background_jobs{kind="video:process",status="dead"} 1`)
+
+	s.counts = s.counts[:1]
+	sb.Reset()
+	assert.NilError(t, reg.Write(context.Background(), &sb))
+	assert.Equal(t, strings.Contains(sb.String(), `status="dead"`), false)
+}
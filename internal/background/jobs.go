@@ -0,0 +1,104 @@
+package background
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// JobKind identifies which registered handler runs a job. Kinds are declared by the package that owns
+// the work, e.g. videos.JobUploadVideo.
+type JobKind string
+
+// JobStatus is the lifecycle state of a persisted job.
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobDead      JobStatus = "dead"
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        JobKind         `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      JobStatus       `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"-"`
+	UpdatedAt   time.Time       `json:"-"`
+}
+
+// JobCount is the number of jobs of a kind in a given status.
+type JobCount struct {
+	Kind   JobKind
+	Status JobStatus
+	Count  int64
+}
+
+// FinalAttempt reports whether a failure of the current run moves the job to the dead-letter state.
+func (j *Job) FinalAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Decode unmarshals the job payload into dst.
+func (j *Job) Decode(dst any) error {
+	return json.Unmarshal(j.Payload, dst)
+}
+
+// JobHandler executes a claimed job. Returning an error schedules a retry unless the job is on its final
+// attempt or the error was wrapped with Permanent.
+type JobHandler func(ctx context.Context, job *Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p permanentError) Unwrap() error {
+	return p.err
+}
+
+// Permanent marks err as non-retryable, the job goes straight to the dead-letter state.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// backoff returns the delay before the next attempt: base * 2^(attempts-1), capped at max.
+func backoff(attempts int, base, max time.Duration) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
@@ -0,0 +1,227 @@
+package background
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+type store interface {
+	Insert(ctx context.Context, job *Job) error
+	InsertTx(ctx context.Context, tx *sql.Tx, job *Job) error
+	InsertUnlessQueued(ctx context.Context, job *Job) (bool, error)
+	Claim(ctx context.Context, kinds []JobKind, lockTimeout time.Duration) (*Job, error)
+	Complete(ctx context.Context, job *Job) error
+	Retry(ctx context.Context, job *Job, runAt time.Time, lastError string) error
+	Kill(ctx context.Context, job *Job, lastError string) error
+	KillExpired(ctx context.Context, lockTimeout time.Duration) (int64, error)
+	CountByStatus(ctx context.Context) ([]JobCount, error)
+}
+
+type jobStore struct {
+	db *sql.DB
+}
+
+func (s *jobStore) Insert(ctx context.Context, job *Job) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return insertJob(dbCtx, s.db.QueryRowContext, job)
+}
+
+// InsertTx inserts the job as part of tx, so it only becomes claimable once tx commits.
+func (s *jobStore) InsertTx(ctx context.Context, tx *sql.Tx, job *Job) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return insertJob(dbCtx, tx.QueryRowContext, job)
+}
+
+func insertJob(ctx context.Context, queryRow func(ctx context.Context, query string, args ...any) *sql.Row, job *Job) error {
+	query := `INSERT INTO jobs (kind, payload, max_attempts, run_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, status, attempts, created_at, updated_at`
+
+	args := []any{job.Kind, string(job.Payload), job.MaxAttempts, job.RunAt}
+
+	return queryRow(ctx, query, args...).Scan(&job.ID, &job.Status, &job.Attempts, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// InsertUnlessQueued inserts the job only when no job of the same kind is pending or running, so several
+// instances running the same schedule do not pile up duplicate jobs. It reports whether the job was
+// inserted.
+func (s *jobStore) InsertUnlessQueued(ctx context.Context, job *Job) (bool, error) {
+	query := `INSERT INTO jobs (kind, payload, max_attempts, run_at)
+			SELECT $1, $2, $3, $4
+			WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE kind = $1 AND status IN ('pending', 'running'))
+			RETURNING id, status, attempts, created_at, updated_at`
+
+	args := []any{job.Kind, string(job.Payload), job.MaxAttempts, job.RunAt}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, args...).Scan(&job.ID, &job.Status, &job.Attempts, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Claim locks the next runnable job of one of the given kinds and marks it as running. Jobs left running
+// by a crashed worker become claimable again once their lock is older than lockTimeout. It returns
+// nil, nil when there is nothing to do.
+func (s *jobStore) Claim(ctx context.Context, kinds []JobKind, lockTimeout time.Duration) (*Job, error) {
+	query := `UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_at = now(), updated_at = now()
+			  WHERE id = (
+				  SELECT id FROM jobs
+				  WHERE kind = ANY($1)
+					AND ((status = 'pending' AND run_at <= now())
+					  OR (status = 'running' AND attempts < max_attempts AND locked_at < now() - make_interval(secs => $2)))
+				  ORDER BY run_at
+				  LIMIT 1
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING id, kind, payload, status, attempts, max_attempts, run_at, coalesce(last_error, ''), created_at, updated_at`
+
+	names := make([]string, len(kinds))
+	for i, kind := range kinds {
+		names[i] = string(kind)
+	}
+
+	var job Job
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, pq.Array(names), lockTimeout.Seconds()).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+func (s *jobStore) Complete(ctx context.Context, job *Job) error {
+	query := `UPDATE jobs SET status = 'completed', locked_at = NULL, last_error = NULL, updated_at = now()
+			  WHERE id = $1`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(dbCtx, query, job.ID)
+	if err != nil {
+		return err
+	}
+
+	job.Status = JobCompleted
+
+	return nil
+}
+
+func (s *jobStore) Retry(ctx context.Context, job *Job, runAt time.Time, lastError string) error {
+	query := `UPDATE jobs SET status = 'pending', run_at = $1, last_error = $2, locked_at = NULL, updated_at = now()
+			  WHERE id = $3`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(dbCtx, query, runAt, lastError, job.ID)
+	if err != nil {
+		return err
+	}
+
+	job.Status = JobPending
+	job.RunAt = runAt
+	job.LastError = lastError
+
+	return nil
+}
+
+func (s *jobStore) Kill(ctx context.Context, job *Job, lastError string) error {
+	query := `UPDATE jobs SET status = 'dead', last_error = $1, locked_at = NULL, updated_at = now()
+			  WHERE id = $2`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(dbCtx, query, lastError, job.ID)
+	if err != nil {
+		return err
+	}
+
+	job.Status = JobDead
+	job.LastError = lastError
+
+	return nil
+}
+
+// KillExpired dead-letters jobs whose worker disappeared while they were on their final attempt.
+func (s *jobStore) KillExpired(ctx context.Context, lockTimeout time.Duration) (int64, error) {
+	query := `UPDATE jobs SET status = 'dead', last_error = 'worker lock expired', locked_at = NULL, updated_at = now()
+			  WHERE status = 'running' AND attempts >= max_attempts AND locked_at < now() - make_interval(secs => $1)`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.ExecContext(dbCtx, query, lockTimeout.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// CountByStatus returns the number of jobs of every kind in every status present in the table.
+func (s *jobStore) CountByStatus(ctx context.Context) ([]JobCount, error) {
+	query := `SELECT kind, status, count(*) FROM jobs GROUP BY kind, status ORDER BY kind, status`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(dbCtx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []JobCount
+	for rows.Next() {
+		var c JobCount
+		if err := rows.Scan(&c.Kind, &c.Status, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// Initialize Store
+func newStore(db *sql.DB) (*jobStore, error) {
+	return &jobStore{
+		db: db,
+	}, nil
+}
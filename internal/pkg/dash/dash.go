@@ -0,0 +1,136 @@
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// ContentType is the media type of MPD manifests.
+	ContentType = "application/dash+xml"
+	// Namespace is the namespace of the MPD schema, ISO/IEC 23009-1.
+	Namespace = "urn:mpeg:dash:schema:mpd:2011"
+	// ProfileLive is the profile of on demand presentations addressed with segment templates.
+	ProfileLive = "urn:mpeg:dash:profile:isoff-live:2011"
+)
+
+// MPD is a static media presentation description. Fields are declared in the element and attribute order
+// of the schema, encoding/xml writes them in that order.
+type MPD struct {
+	XMLName                   xml.Name `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                  string   `xml:"profiles,attr"`
+	Type                      string   `xml:"type,attr"`
+	MediaPresentationDuration Duration `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             Duration `xml:"minBufferTime,attr"`
+	Periods                   []Period `xml:"Period"`
+}
+
+type Period struct {
+	ID             string          `xml:"id,attr"`
+	Start          Duration        `xml:"start,attr"`
+	AdaptationSets []AdaptationSet `xml:"AdaptationSet"`
+}
+
+// AdaptationSet groups the interchangeable representations of one media type.
+type AdaptationSet struct {
+	ID               int              `xml:"id,attr"`
+	ContentType      string           `xml:"contentType,attr"`
+	MimeType         string           `xml:"mimeType,attr"`
+	SegmentAlignment bool             `xml:"segmentAlignment,attr"`
+	StartWithSAP     int              `xml:"startWithSAP,attr,omitempty"`
+	MaxWidth         int              `xml:"maxWidth,attr,omitempty"`
+	MaxHeight        int              `xml:"maxHeight,attr,omitempty"`
+	Representations  []Representation `xml:"Representation"`
+}
+
+// Representation is one encoding of the media, Bandwidth is in bits per second and Codecs an RFC 6381
+// codecs parameter.
+type Representation struct {
+	ID                        string                     `xml:"id,attr"`
+	Bandwidth                 int64                      `xml:"bandwidth,attr"`
+	Codecs                    string                     `xml:"codecs,attr,omitempty"`
+	Width                     int                        `xml:"width,attr,omitempty"`
+	Height                    int                        `xml:"height,attr,omitempty"`
+	AudioSamplingRate         int                        `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannelConfiguration *AudioChannelConfiguration `xml:"AudioChannelConfiguration"`
+	SegmentTemplate           *SegmentTemplate           `xml:"SegmentTemplate"`
+}
+
+// AudioChannelConfiguration describes the channels of an audio representation with the scheme of
+// ISO/IEC 23003-3, Value being the number of channels.
+type AudioChannelConfiguration struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+// ChannelConfiguration is the scheme of AudioChannelConfiguration values counting channels.
+const ChannelConfiguration = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+
+// SegmentTemplate addresses segments by number, Duration is the duration of every segment but the last one
+// in Timescale units per second. Media may use the $Number$ identifier with a printf width, like
+// segment_$Number%05d$.m4s.
+type SegmentTemplate struct {
+	Timescale      int    `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	StartNumber    int    `xml:"startNumber,attr"`
+	Initialization string `xml:"initialization,attr"`
+	Media          string `xml:"media,attr"`
+}
+
+// Encode writes the manifest as an indented XML document.
+func (m *MPD) Encode(w io.Writer) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+// Duration is written as an xs:duration in seconds, like PT1M4.5S is written PT64.5S.
+type Duration time.Duration
+
+func (d Duration) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: "PT" + strconv.FormatFloat(time.Duration(d).Seconds(), 'f', -1, 64) + "S"}, nil
+}
+
+var durationRX = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?$`)
+
+// UnmarshalXMLAttr reads the hour, minute and second designators of an xs:duration, the only ones a
+// presentation of this service needs.
+func (d *Duration) UnmarshalXMLAttr(attr xml.Attr) error {
+	m := durationRX.FindStringSubmatch(attr.Value)
+	if m == nil || attr.Value == "PT" {
+		return fmt.Errorf("dash: invalid duration %q", attr.Value)
+	}
+
+	hours, _ := strconv.ParseInt(zero(m[1]), 10, 64)
+	minutes, _ := strconv.ParseInt(zero(m[2]), 10, 64)
+	seconds, _ := strconv.ParseFloat(zero(m[3]), 64)
+
+	*d = Duration(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)))
+
+	return nil
+}
+
+func zero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,348 @@
+package dash
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got to testdata/name, or writes it there with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		err := os.WriteFile(path, got, 0o644)
+		assert.NilError(t, err)
+	}
+
+	want, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), string(want))
+}
+
+func sampleMPD() *MPD {
+	template := func(rendition, track string) *SegmentTemplate {
+		return &SegmentTemplate{
+			Timescale:      1000,
+			Duration:       6000,
+			StartNumber:    0,
+			Initialization: rendition + "/" + track + "/init.mp4",
+			Media:          rendition + "/" + track + "/segment_$Number%05d$.m4s",
+		}
+	}
+
+	return &MPD{
+		Profiles:                  ProfileLive,
+		Type:                      "static",
+		MediaPresentationDuration: Duration(63500 * time.Millisecond),
+		MinBufferTime:             Duration(2 * time.Second),
+		Periods: []Period{{
+			ID: "0",
+			AdaptationSets: []AdaptationSet{
+				{
+					ID: 0, ContentType: "video", MimeType: "video/mp4", SegmentAlignment: true, StartWithSAP: 1,
+					MaxWidth: 1280, MaxHeight: 720,
+					Representations: []Representation{
+						{ID: "720p", Bandwidth: 2_800_000, Codecs: "avc1.64001f", Width: 1280, Height: 720, SegmentTemplate: template("720p", "video")},
+						{ID: "480p", Bandwidth: 1_400_000, Codecs: "avc1.64001e", Width: 854, Height: 480, SegmentTemplate: template("480p", "video")},
+					},
+				},
+				{
+					ID: 1, ContentType: "audio", MimeType: "audio/mp4", SegmentAlignment: true, StartWithSAP: 1,
+					Representations: []Representation{
+						{
+							ID: "720p-audio", Bandwidth: 128_000, Codecs: "mp4a.40.2",
+							AudioChannelConfiguration: &AudioChannelConfiguration{SchemeIDURI: ChannelConfiguration, Value: "2"},
+							SegmentTemplate:           template("720p", "audio"),
+						},
+					},
+				},
+			},
+		}},
+	}
+}
+
+func TestMPD_Encode(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := sampleMPD().Encode(&buf)
+	assert.NilError(t, err)
+
+	golden(t, "manifest.mpd", buf.Bytes())
+
+	err = checkSchema(buf.Bytes())
+	assert.NilError(t, err)
+
+	var decoded MPD
+	err = xml.Unmarshal(buf.Bytes(), &decoded)
+	assert.NilError(t, err)
+	assert.Equal(t, decoded.MediaPresentationDuration, Duration(63500*time.Millisecond))
+	assert.Equal(t, len(decoded.Periods[0].AdaptationSets), 2)
+	assert.Equal(t, *decoded.Periods[0].AdaptationSets[1].Representations[0].SegmentTemplate,
+		*sampleMPD().Periods[0].AdaptationSets[1].Representations[0].SegmentTemplate)
+}
+
+func TestCheckSchema(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := sampleMPD().Encode(&buf)
+	assert.NilError(t, err)
+
+	valid := buf.String()
+
+	testsMap := []struct {
+		name    string
+		old     string
+		new     string
+		wantErr string
+	}{
+		{name: "Missing Bandwidth", old: ` bandwidth="1400000"`, new: "", wantErr: "requires bandwidth"},
+		{name: "Bad Duration", old: `minBufferTime="PT2S"`, new: `minBufferTime="2s"`, wantErr: "minBufferTime"},
+		{name: "Repeated Channel Configuration", old: `</AudioChannelConfiguration>`, new: `</AudioChannelConfiguration><AudioChannelConfiguration schemeIdUri="x" value="2"></AudioChannelConfiguration>`},
+		{name: "Children Out Of Order", old: `</SegmentTemplate>`, new: `</SegmentTemplate><AudioChannelConfiguration schemeIdUri="x"></AudioChannelConfiguration>`, wantErr: "not allowed"},
+		{name: "Repeated Template", old: `</SegmentTemplate>`, new: `</SegmentTemplate><SegmentTemplate></SegmentTemplate>`, wantErr: "repeated"},
+		{name: "Bad Template Identifier", old: `$Number%05d$`, new: `$Segment$`, wantErr: "media"},
+		{name: "Static Without Duration", old: ` mediaPresentationDuration="PT63.5S"`, new: "", wantErr: "mediaPresentationDuration"},
+		{name: "Missing Mime Type", old: ` mimeType="audio/mp4"`, new: "", wantErr: "mimeType"},
+		{name: "Unknown Element", old: `<Period`, new: `<Chapter></Chapter><Period`, wantErr: "Chapter"},
+		{name: "Duplicate Representation", old: `id="480p"`, new: `id="720p"`, wantErr: "duplicate"},
+		{name: "Wrong Namespace", old: Namespace, new: "urn:example", wantErr: "namespace"},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, strings.Contains(valid, tt.old), true)
+
+			err := checkSchema([]byte(strings.Replace(valid, tt.old, tt.new, 1)))
+
+			if tt.wantErr == "" {
+				assert.NilError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+			assert.StringContains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	attr, err := Duration(90500 * time.Millisecond).MarshalXMLAttr(xml.Name{Local: "d"})
+	assert.NilError(t, err)
+	assert.Equal(t, attr.Value, "PT90.5S")
+
+	for value, want := range map[string]time.Duration{
+		"PT90.5S":   90500 * time.Millisecond,
+		"PT1H2M3S":  time.Hour + 2*time.Minute + 3*time.Second,
+		"PT10M":     10 * time.Minute,
+		"PT0.040S":  40 * time.Millisecond,
+		"PT0S":      0,
+		"PT2H0.25S": 2*time.Hour + 250*time.Millisecond,
+	} {
+		var d Duration
+		err = d.UnmarshalXMLAttr(xml.Attr{Value: value})
+		assert.NilError(t, err)
+		assert.Equal(t, time.Duration(d), want)
+	}
+
+	for _, value := range []string{"PT", "P1D", "10S", "PT-1S"} {
+		var d Duration
+		assert.Error(t, d.UnmarshalXMLAttr(xml.Attr{Value: value}))
+	}
+}
+
+// element is the part of the MPD schema, ISO/IEC 23009-1 DASH-MPD.xsd, this package writes. Children
+// lists the allowed child elements in the order of the schema sequence, each at most once unless
+// repeatable.
+type element struct {
+	required   []string
+	attributes map[string]*regexp.Regexp
+	children   []string
+	repeatable map[string]bool
+}
+
+var (
+	xsDuration      = regexp.MustCompile(`^-?P(?:\d+Y)?(?:\d+M)?(?:\d+D)?(?:T(?:\d+H)?(?:\d+M)?(?:\d+(?:\.\d+)?S)?)?$`)
+	xsUnsignedInt   = regexp.MustCompile(`^\d+$`)
+	xsBoolean       = regexp.MustCompile(`^(?:true|false|1|0)$`)
+	noWhitespace    = regexp.MustCompile(`^\S+$`)
+	anyString       = regexp.MustCompile(`^.*$`)
+	conditionalUInt = regexp.MustCompile(`^(?:true|false|\d+)$`)
+	template        = regexp.MustCompile(`^(?:[^$]|\$(?:RepresentationID|Number|Bandwidth|Time)(?:%0\d+d)?\$|\$\$)*$`)
+)
+
+var schema = map[string]element{
+	"MPD": {
+		required: []string{"profiles", "minBufferTime"},
+		attributes: map[string]*regexp.Regexp{
+			"profiles": anyString, "type": regexp.MustCompile(`^(?:static|dynamic)$`),
+			"mediaPresentationDuration": xsDuration, "minBufferTime": xsDuration,
+		},
+		children:   []string{"Period"},
+		repeatable: map[string]bool{"Period": true},
+	},
+	"Period": {
+		attributes: map[string]*regexp.Regexp{"id": anyString, "start": xsDuration, "duration": xsDuration},
+		children:   []string{"AdaptationSet"},
+		repeatable: map[string]bool{"AdaptationSet": true},
+	},
+	"AdaptationSet": {
+		attributes: map[string]*regexp.Regexp{
+			"id": xsUnsignedInt, "contentType": regexp.MustCompile(`^(?:video|audio|text|image|application)$`),
+			"mimeType": anyString, "segmentAlignment": conditionalUInt, "startWithSAP": regexp.MustCompile(`^[0-6]$`),
+			"maxWidth": xsUnsignedInt, "maxHeight": xsUnsignedInt,
+		},
+		children:   []string{"Representation"},
+		repeatable: map[string]bool{"Representation": true},
+	},
+	"Representation": {
+		required: []string{"id", "bandwidth"},
+		attributes: map[string]*regexp.Regexp{
+			"id": noWhitespace, "bandwidth": xsUnsignedInt, "codecs": anyString, "width": xsUnsignedInt,
+			"height": xsUnsignedInt, "audioSamplingRate": anyString, "mimeType": anyString,
+		},
+		children:   []string{"AudioChannelConfiguration", "SegmentTemplate"},
+		repeatable: map[string]bool{"AudioChannelConfiguration": true},
+	},
+	"AudioChannelConfiguration": {
+		required:   []string{"schemeIdUri"},
+		attributes: map[string]*regexp.Regexp{"schemeIdUri": noWhitespace, "value": anyString},
+	},
+	"SegmentTemplate": {
+		attributes: map[string]*regexp.Regexp{
+			"timescale": xsUnsignedInt, "duration": xsUnsignedInt, "startNumber": xsUnsignedInt,
+			"initialization": template, "media": template,
+		},
+	},
+}
+
+// checkSchema validates an MPD against the subset of the schema in schema: element nesting and order,
+// required attributes and attribute types. It also checks the constraints the schema states in prose, a
+// static presentation needs its duration, every representation a mime type and representation ids are
+// unique in a period.
+func checkSchema(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	type frame struct {
+		name     string
+		next     int
+		seen     map[string]bool
+		mimeType bool
+	}
+
+	var stack []*frame
+	var ids map[string]bool
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			name := tok.Name.Local
+
+			if tok.Name.Space != Namespace {
+				return fmt.Errorf("%s: namespace %q, want %q", name, tok.Name.Space, Namespace)
+			}
+
+			el, ok := schema[name]
+			if !ok {
+				return fmt.Errorf("unexpected element %s", name)
+			}
+
+			if len(stack) == 0 && name != "MPD" {
+				return fmt.Errorf("root element %s, want MPD", name)
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				children := schema[parent.name].children
+
+				i := parent.next
+				for i < len(children) && children[i] != name {
+					i++
+				}
+				if i == len(children) {
+					return fmt.Errorf("element %s not allowed in %s here", name, parent.name)
+				}
+				if parent.seen[name] && !schema[parent.name].repeatable[name] {
+					return fmt.Errorf("element %s repeated in %s", name, parent.name)
+				}
+				parent.next = i
+				parent.seen[name] = true
+			}
+
+			attrs := make(map[string]string)
+			for _, a := range tok.Attr {
+				if a.Name.Space != "" || a.Name.Local == "xmlns" {
+					continue
+				}
+
+				pattern, ok := el.attributes[a.Name.Local]
+				if !ok {
+					return fmt.Errorf("%s: unexpected attribute %s", name, a.Name.Local)
+				}
+				if !pattern.MatchString(a.Value) {
+					return fmt.Errorf("%s: invalid %s %q", name, a.Name.Local, a.Value)
+				}
+				attrs[a.Name.Local] = a.Value
+			}
+
+			for _, r := range el.required {
+				if _, ok := attrs[r]; !ok {
+					return fmt.Errorf("%s requires %s", name, r)
+				}
+			}
+
+			f := &frame{name: name, seen: make(map[string]bool)}
+			_, f.mimeType = attrs["mimeType"]
+
+			switch name {
+			case "MPD":
+				if attrs["type"] != "dynamic" && attrs["mediaPresentationDuration"] == "" {
+					return fmt.Errorf("static MPD requires mediaPresentationDuration")
+				}
+			case "Period":
+				ids = make(map[string]bool)
+			case "Representation":
+				if ids[attrs["id"]] {
+					return fmt.Errorf("duplicate Representation id %q", attrs["id"])
+				}
+				ids[attrs["id"]] = true
+
+				if !f.mimeType && !stack[len(stack)-1].mimeType {
+					return fmt.Errorf("Representation %q has no mimeType", attrs["id"])
+				}
+			}
+
+			stack = append(stack, f)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return fmt.Errorf("unexpected text %q", tok)
+			}
+		}
+	}
+
+	return nil
+}
@@ -44,3 +44,16 @@ func NewService(cfg *Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// Checker reports whether the database accepts connections and answers queries.
+type Checker struct {
+	db *sql.DB
+}
+
+func NewChecker(db *sql.DB) Checker {
+	return Checker{db: db}
+}
+
+func (c Checker) Check(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
@@ -0,0 +1,51 @@
+package datastore
+
+import (
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/validator"
+	"testing"
+)
+
+func TestValidateFilters(t *testing.T) {
+	safelist := []string{"id", "title", "-id", "-title"}
+
+	testsMap := []struct {
+		name      string
+		filters   Filters
+		errorKeys []string
+	}{
+		{name: "Valid Filters", filters: Filters{Page: 1, PageSize: 20, Sort: "-title"}},
+		{name: "Page Zero", filters: Filters{Page: 0, PageSize: 20, Sort: "id"}, errorKeys: []string{"page"}},
+		{name: "Page Size Too Large", filters: Filters{Page: 1, PageSize: 101, Sort: "id"}, errorKeys: []string{"page_size"}},
+		{name: "Unsafe Sort", filters: Filters{Page: 1, PageSize: 20, Sort: "id; DROP TABLE videos"}, errorKeys: []string{"sort"}},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			tt.filters.SortSafelist = safelist
+
+			ValidateFilters(v, tt.filters)
+
+			assert.Equal(t, len(v.Errors), len(tt.errorKeys))
+			for _, key := range tt.errorKeys {
+				_, exists := v.Errors[key]
+				assert.Equal(t, exists, true)
+			}
+		})
+	}
+}
+
+func TestFilters_Sort(t *testing.T) {
+	f := Filters{Page: 3, PageSize: 20, Sort: "-title", SortSafelist: []string{"title", "-title"}}
+
+	assert.Equal(t, f.SortColumn(), "title")
+	assert.Equal(t, f.SortDirection(), "DESC")
+	assert.Equal(t, f.Limit(), 20)
+	assert.Equal(t, f.Offset(), 40)
+}
+
+func TestCalculateMetadata(t *testing.T) {
+	assert.Equal(t, CalculateMetadata(0, 1, 20), Metadata{})
+	assert.Equal(t, CalculateMetadata(41, 2, 20), Metadata{CurrentPage: 2, PageSize: 20, FirstPage: 1, LastPage: 3, TotalRecords: 41})
+}
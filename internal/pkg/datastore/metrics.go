@@ -0,0 +1,34 @@
+package datastore
+
+import (
+	"database/sql"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+)
+
+// RegisterMetrics exposes the connection pool statistics of db.
+func RegisterMetrics(reg *metrics.Registry, db *sql.DB) {
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			return fn(db.Stats())
+		}
+	}
+
+	reg.GaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.GaugeFunc("db_open_connections", "Number of established connections, in use and idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.GaugeFunc("db_in_use_connections", "Number of connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.GaugeFunc("db_idle_connections", "Number of idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.CounterFunc("db_wait_count_total", "Total number of connections waited for.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.CounterFunc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.CounterFunc("db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.CounterFunc("db_max_idle_time_closed_total", "Total number of connections closed due to SetConnMaxIdleTime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	reg.CounterFunc("db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
@@ -2,13 +2,24 @@ package filestore
 
 import (
 	"context"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"errors"
+	"fmt"
 	"io"
-	"luismatosgarcia.dev/video-sharing-go/internal/tests"
-	"mime/multipart"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrObjectNotFound   = errors.New("object not found")
+	ErrInvalidRange     = errors.New("invalid object range")
+	ErrUnknownBackend   = errors.New("unknown filestore backend")
+	ErrInvalidSignature = errors.New("invalid or expired URL signature")
 )
 
 type Config struct {
@@ -17,114 +28,251 @@ type Config struct {
 	AwsBucketName  string
 	AwsRegion      string
 	AwsEndpoint    string
+	LocalRoot      string
+	SigningSecret  string
+	PublicURL      string
+
+	// Multipart uploads, used by the s3 backend for objects of AwsMultipartThreshold bytes or more and
+	// for objects of unknown size
+	AwsMultipartThreshold int64
+	AwsPartSize           int64
+	AwsPartConcurrency    int
+	AwsPartRetries        int
 }
 
 type FileStore interface {
-	Set(id int64, file *io.Reader, fileHeader *multipart.FileHeader) (string, error)
-	Get()
-}
-
-type S3Bucket struct {
-	region         string
-	bucketName     string
-	endpoint       string
-	awsAccessKeyId string
-	awsSecretKey   string
-}
-
-func (s S3Bucket) Set(id int64, file *io.Reader, fileHeader *multipart.FileHeader) (string, error) {
-	//Config: Region, Credentials, Config.EndpointResolverWithOptions
-
-	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		return aws.Endpoint{
-			PartitionID:   "aws",
-			URL:           s.endpoint,
-			SigningRegion: s.region,
-		}, nil
-	})
-
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithEndpointResolverWithOptions(customResolver),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s.awsAccessKeyId, s.awsSecretKey, "")),
-	)
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (*Object, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]*ObjectInfo, error)
+	PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (*PresignedURL, error)
+	PresignGet(ctx context.Context, key string, expires time.Duration) (*PresignedURL, error)
+	// Check reports whether the backend is reachable and usable.
+	Check(ctx context.Context) error
+}
+
+// SignedURLVerifier is implemented by backends without native presigning. Their presigned URLs point
+// at the API server, which verifies them before serving the object.
+type SignedURLVerifier interface {
+	VerifySignedURL(method, key string, query url.Values) error
+}
+
+// PresignedURL grants time limited access to a single object without further credentials. Clients must
+// send Headers along with the request.
+type PresignedURL struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// ObjectInfo describes a stored object. Size is always the size of the whole object.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Object is a streaming read of a stored object, or of the Length bytes starting at Offset for ranged
+// reads. Callers must Close it.
+type Object struct {
+	Body   io.ReadCloser
+	Info   ObjectInfo
+	Offset int64
+	Length int64
+}
+
+func (o *Object) Read(p []byte) (int, error) {
+	return o.Body.Read(p)
+}
+
+func (o *Object) Close() error {
+	return o.Body.Close()
+}
+
+// resolveRange clamps a requested range to an object of the given size. A negative length reads to the
+// end of the object.
+func resolveRange(size, offset, length int64) (int64, int64, error) {
+	if offset < 0 || (offset >= size && !(offset == 0 && size == 0)) {
+		return 0, 0, ErrInvalidRange
+	}
+
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+
+	return offset, length, nil
+}
+
+// ReaderAt reads an object with a ranged read per call, for readers like media probes that only need a few
+// parts of a large object.
+type ReaderAt struct {
+	ctx context.Context
+	fs  FileStore
+	key string
+}
+
+func NewReaderAt(ctx context.Context, fs FileStore, key string) *ReaderAt {
+	return &ReaderAt{ctx: ctx, fs: fs, key: key}
+}
+
+func (r *ReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	obj, err := r.fs.GetRange(r.ctx, r.key, offset, int64(len(p)))
 	if err != nil {
-		return "", err
+		if errors.Is(err, ErrInvalidRange) {
+			return 0, io.EOF
+		}
+		return 0, err
 	}
+	defer obj.Close()
 
-	s3client := s3.NewFromConfig(cfg)
-	_, err = s.UploadFile(s3client, file, fileHeader)
+	n, err := io.ReadFull(obj, p[:obj.Length])
 	if err != nil {
-		return "", err
+		return n, err
+	}
+
+	if n < len(p) {
+		return n, io.EOF
 	}
 
-	return "videos/" + fileHeader.Filename, nil
+	return n, nil
 }
 
-func (s S3Bucket) UploadFile(client *s3.Client, file *io.Reader, fileHeader *multipart.FileHeader) (*s3.PutObjectOutput, error) {
-	uploadOutput, err := client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:        &s.bucketName,
-		Key:           aws.String("videos/" + fileHeader.Filename),
-		Body:          *file,
-		ContentLength: fileHeader.Size,
-	})
-	if err != nil {
-		return nil, err
+// detectContentType guesses a content type from the key extension.
+func detectContentType(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
 	}
 
-	return uploadOutput, nil
+	return "application/octet-stream"
 }
 
-func (s S3Bucket) Get() {
-	//TODO implement me
-	panic("implement me")
+// VideoKey builds the key of a video object from the video id and a name, normally the SHA-256 of the
+// content. The extension of the client filename is kept so backends can derive the content type, the rest
+// of the filename is never used. Keys are spread over directories by id so no single directory grows
+// unbounded.
+func VideoKey(id int64, name, filename string) string {
+	ext := strings.ToLower(path.Ext(path.Base("/" + filename)))
+	if !validExtension(ext) {
+		ext = ""
+	}
+
+	return fmt.Sprintf("videos/%02x/%02x/%d/%s%s", id%256, (id/256)%256, id, name, ext)
 }
 
-func NewFileStore(fileStoreType string, cfg Config) (FileStore, error) {
-	//TODO Change to registry
-	switch fileStoreType {
-	case "s3":
-		return S3Bucket{
-			region:         cfg.AwsRegion,
-			bucketName:     cfg.AwsBucketName,
-			awsAccessKeyId: cfg.AwsAccessKeyId,
-			awsSecretKey:   cfg.AwsSecretKey,
-			endpoint:       cfg.AwsEndpoint,
-		}, nil
-	default:
-		return S3Bucket{
-			region:         cfg.AwsRegion,
-			bucketName:     cfg.AwsBucketName,
-			awsAccessKeyId: cfg.AwsAccessKeyId,
-			awsSecretKey:   cfg.AwsSecretKey,
-			endpoint:       cfg.AwsEndpoint,
-		}, nil
+// VideoIDFromKey returns the id of the video a key built by VideoKey belongs to.
+func VideoIDFromKey(key string) (int64, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 5 || parts[0] != "videos" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || id <= 0 || !strings.HasPrefix(key, VideoKey(id, "", "")) {
+		return 0, false
 	}
+
+	return id, true
+}
+
+// RenditionKey builds the key of a transcoded rendition of a video, next to the objects of the video.
+// The name comes from the rendition ladder, never from a client.
+func RenditionKey(id int64, name string) string {
+	return fmt.Sprintf("videos/%02x/%02x/%d/renditions/%s.mp4", id%256, (id/256)%256, id, name)
+}
+
+// HLSPrefix is the prefix of the keys of every HLS file of a video.
+func HLSPrefix(id int64) string {
+	return fmt.Sprintf("videos/%02x/%02x/%d/hls/", id%256, (id/256)%256, id)
+}
+
+// HLSKey builds the key of a playlist or segment of a packaged rendition. The rendition and file names
+// are chosen by the server, never by a client.
+func HLSKey(id int64, rendition, file string) string {
+	return HLSPrefix(id) + rendition + "/" + file
+}
+
+// DASHPrefix is the prefix of the keys of every DASH file of a video.
+func DASHPrefix(id int64) string {
+	return fmt.Sprintf("videos/%02x/%02x/%d/dash/", id%256, (id/256)%256, id)
+}
+
+// DASHKey builds the key of an init section or a segment of one track of a packaged rendition. The names
+// are chosen by the server, never by a client.
+func DASHKey(id int64, rendition, track, file string) string {
+	return DASHPrefix(id) + rendition + "/" + track + "/" + file
 }
 
-// Mocks
+func validExtension(ext string) bool {
+	if len(ext) < 2 || len(ext) > 10 {
+		return false
+	}
+
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
 
-type Mock struct {
-	FnCalls map[string]int
-	Str     string
-	Err     error
+	return true
 }
 
-func (f Mock) Set(id int64, file *io.Reader, fileHeader *multipart.FileHeader) (string, error) {
-	tests.Called(f.FnCalls, "Set")
-	return f.Str, f.Err
+// Factory builds a backend from the shared filestore configuration.
+type Factory func(cfg Config) (FileStore, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+// Register makes a backend available by name to NewFileStore. Backends register themselves from an init
+// function. It panics if the name is registered twice or the factory is nil.
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if factory == nil {
+		panic("filestore: Register factory is nil")
+	}
+
+	if _, exists := backends[name]; exists {
+		panic("filestore: Register called twice for backend " + name)
+	}
+
+	backends[name] = factory
 }
 
-func (f Mock) Get() {
-	tests.Called(f.FnCalls, "Get")
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
 }
 
-func (f Mock) GetFnCalls(fnName string) int {
-	value, exists := f.FnCalls[fnName]
+func NewFileStore(fileStoreType string, cfg Config) (FileStore, error) {
+	backendsMu.RLock()
+	factory, exists := backends[fileStoreType]
+	backendsMu.RUnlock()
 
 	if !exists {
-		return 0
+		return nil, fmt.Errorf("%w %q (available: %v)", ErrUnknownBackend, fileStoreType, Backends())
 	}
 
-	return value
+	return factory(cfg)
 }
@@ -0,0 +1,254 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFileStore(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		backend     string
+		shouldError bool
+	}{
+		{name: "S3", backend: "s3"},
+		{name: "Local", backend: "local"},
+		{name: "Memory", backend: "memory"},
+		{name: "Unknown Backend", backend: "ftp", shouldError: true},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileStore(tt.backend, Config{LocalRoot: t.TempDir()})
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Equal(t, errors.Is(err, ErrUnknownBackend), true)
+			}
+		})
+	}
+}
+
+func TestBackends_RoundTrip(t *testing.T) {
+	for _, backend := range []string{"local", "memory"} {
+		t.Run(backend, func(t *testing.T) {
+			fs, err := NewFileStore(backend, Config{LocalRoot: t.TempDir()})
+			assert.NilError(t, err)
+
+			ctx := context.Background()
+			content := "video bytes"
+
+			assert.NilError(t, fs.Check(ctx))
+
+			err = fs.Put(ctx, "uploads/abc/0.mp4", strings.NewReader(content), int64(len(content)), "video/mp4")
+			assert.NilError(t, err)
+
+			obj, err := fs.Get(ctx, "uploads/abc/0.mp4")
+			assert.NilError(t, err)
+
+			data, err := io.ReadAll(obj)
+			obj.Close()
+			assert.NilError(t, err)
+			assert.Equal(t, string(data), content)
+			assert.Equal(t, obj.Info.Size, int64(len(content)))
+			assert.Equal(t, obj.Info.ContentType, "video/mp4")
+
+			obj, err = fs.GetRange(ctx, "uploads/abc/0.mp4", 6, 3)
+			assert.NilError(t, err)
+
+			data, err = io.ReadAll(obj)
+			obj.Close()
+			assert.NilError(t, err)
+			assert.Equal(t, string(data), "byt")
+			assert.Equal(t, obj.Offset, int64(6))
+			assert.Equal(t, obj.Info.Size, int64(len(content)))
+
+			obj, err = fs.GetRange(ctx, "uploads/abc/0.mp4", 6, -1)
+			assert.NilError(t, err)
+			assert.Equal(t, obj.Length, int64(5))
+			obj.Close()
+
+			_, err = fs.GetRange(ctx, "uploads/abc/0.mp4", 100, 1)
+			assert.Equal(t, errors.Is(err, ErrInvalidRange), true)
+
+			info, err := fs.Stat(ctx, "uploads/abc/0.mp4")
+			assert.NilError(t, err)
+			assert.Equal(t, info.Size, int64(len(content)))
+			assert.Equal(t, info.ETag != "", true)
+
+			err = fs.Put(ctx, "uploads/abc/1", strings.NewReader(content), 3, "")
+			assert.Error(t, err)
+
+			err = fs.Put(ctx, "uploads/abd/0", strings.NewReader(content), -1, "")
+			assert.NilError(t, err)
+
+			objects, err := fs.List(ctx, "uploads/abc/")
+			assert.NilError(t, err)
+			assert.Equal(t, len(objects), 1)
+			assert.Equal(t, objects[0].Key, "uploads/abc/0.mp4")
+
+			objects, err = fs.List(ctx, "uploads/ab")
+			assert.NilError(t, err)
+			assert.Equal(t, len(objects), 2)
+
+			assert.NilError(t, fs.Delete(ctx, "uploads/abc/0.mp4"))
+			assert.NilError(t, fs.Delete(ctx, "uploads/abc/0.mp4"))
+
+			_, err = fs.Get(ctx, "uploads/abc/0.mp4")
+			assert.Equal(t, errors.Is(err, ErrObjectNotFound), true)
+
+			_, err = fs.Stat(ctx, "uploads/abc/0.mp4")
+			assert.Equal(t, errors.Is(err, ErrObjectNotFound), true)
+		})
+	}
+}
+
+func TestLocalDisk_Check(t *testing.T) {
+	root := t.TempDir()
+
+	fs, err := NewFileStore("local", Config{LocalRoot: root})
+	assert.NilError(t, err)
+	assert.NilError(t, fs.Check(context.Background()))
+
+	assert.NilError(t, os.RemoveAll(root))
+	assert.Error(t, fs.Check(context.Background()))
+}
+
+func TestReaderAt(t *testing.T) {
+	fs := NewMemory()
+	ctx := context.Background()
+
+	err := fs.Put(ctx, "videos/1/video.mp4", strings.NewReader("0123456789"), 10, "video/mp4")
+	assert.NilError(t, err)
+
+	r := NewReaderAt(ctx, fs, "videos/1/video.mp4")
+
+	p := make([]byte, 4)
+	n, err := r.ReadAt(p, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, string(p[:n]), "3456")
+
+	n, err = r.ReadAt(p, 8)
+	assert.Equal(t, errors.Is(err, io.EOF), true)
+	assert.Equal(t, string(p[:n]), "89")
+
+	n, err = r.ReadAt(p, 10)
+	assert.Equal(t, errors.Is(err, io.EOF), true)
+	assert.Equal(t, n, 0)
+}
+
+func TestVideoKey(t *testing.T) {
+	assert.Equal(t, VideoKey(258, "abc", "../video.MP4"), "videos/02/01/258/abc.mp4")
+	assert.Equal(t, VideoKey(1, "abc", "video"), "videos/01/00/1/abc")
+	assert.Equal(t, VideoKey(1, "abc", "video.mp4?x=/y"), "videos/01/00/1/abc")
+}
+
+func TestVideoIDFromKey(t *testing.T) {
+	id, ok := VideoIDFromKey(VideoKey(258, "source", "video.mp4"))
+	assert.Equal(t, ok, true)
+	assert.Equal(t, id, int64(258))
+
+	for _, key := range []string{"videos/01/00/258/source.mp4", "videos/02/01/258/hls/720p/index.m3u8", "staging/02/01/258/upload", "videos/02/01/x/source"} {
+		_, ok = VideoIDFromKey(key)
+		assert.Equal(t, ok, false)
+	}
+}
+
+func TestHLSKey(t *testing.T) {
+	assert.Equal(t, HLSKey(258, "720p", "index.m3u8"), "videos/02/01/258/hls/720p/index.m3u8")
+	assert.Equal(t, strings.HasPrefix(HLSKey(258, "720p", "init.mp4"), HLSPrefix(258)), true)
+}
+
+func TestDASHKey(t *testing.T) {
+	assert.Equal(t, DASHKey(258, "720p", "audio", "init.mp4"), "videos/02/01/258/dash/720p/audio/init.mp4")
+	assert.Equal(t, strings.HasPrefix(DASHKey(258, "720p", "video", "segment_00000.m4s"), DASHPrefix(258)), true)
+}
+
+func TestLocalDisk_PathStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	l := LocalDisk{root: root}
+
+	err := l.Put(context.Background(), "../../escape", strings.NewReader("x"), 1, "")
+	assert.NilError(t, err)
+
+	_, err = os.Stat(filepath.Join(root, "escape"))
+	assert.NilError(t, err)
+
+	entries, err := os.ReadDir(root)
+	assert.NilError(t, err)
+	for _, e := range entries {
+		assert.Equal(t, strings.HasPrefix(e.Name(), ".tmp-"), false)
+	}
+}
+
+func TestURLSigner(t *testing.T) {
+	signer := newURLSigner(Config{SigningSecret: "secret", PublicURL: "http://localhost:4000/v1/files/"})
+
+	presigned, err := signer.sign(http.MethodPut, "videos/1/my video.mp4", "video/mp4", time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, presigned.Headers["Content-Type"], "video/mp4")
+
+	u, err := url.Parse(presigned.URL)
+	assert.NilError(t, err)
+	assert.Equal(t, u.Path, "/v1/files/videos/1/my video.mp4")
+
+	query := u.Query()
+	assert.NilError(t, signer.verify(http.MethodPut, "videos/1/my video.mp4", query))
+	assert.Equal(t, errors.Is(signer.verify(http.MethodGet, "videos/1/my video.mp4", query), ErrInvalidSignature), true)
+	assert.Equal(t, errors.Is(signer.verify(http.MethodPut, "videos/2/my video.mp4", query), ErrInvalidSignature), true)
+
+	tampered, _ := url.ParseQuery(query.Encode())
+	tampered.Set("content_type", "text/html")
+	assert.Equal(t, errors.Is(signer.verify(http.MethodPut, "videos/1/my video.mp4", tampered), ErrInvalidSignature), true)
+
+	expired, err := signer.sign(http.MethodGet, "videos/1/video.mp4", "", -time.Minute)
+	assert.NilError(t, err)
+	u, _ = url.Parse(expired.URL)
+	assert.Equal(t, errors.Is(signer.verify(http.MethodHead, "videos/1/video.mp4", u.Query()), ErrInvalidSignature), true)
+
+	other := newURLSigner(Config{SigningSecret: "other", PublicURL: "http://localhost:4000/v1/files"})
+	presigned, err = signer.sign(http.MethodGet, "videos/1/video.mp4", "", time.Minute)
+	assert.NilError(t, err)
+	u, _ = url.Parse(presigned.URL)
+	assert.NilError(t, signer.verify(http.MethodHead, "videos/1/video.mp4", u.Query()))
+	assert.Equal(t, errors.Is(other.verify(http.MethodGet, "videos/1/video.mp4", u.Query()), ErrInvalidSignature), true)
+
+	_, err = newURLSigner(Config{}).sign(http.MethodGet, "videos/1/video.mp4", "", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+
+	fs, err := NewFileStore("memory", Config{SigningSecret: "secret"})
+	assert.NilError(t, err)
+
+	reg := metrics.NewRegistry()
+	instrumented := Instrument(fs, reg, "memory")
+
+	_, ok := instrumented.(SignedURLVerifier)
+	assert.Equal(t, ok, true)
+
+	assert.NilError(t, instrumented.Put(ctx, "videos/1/video.mp4", strings.NewReader("video"), 5, "video/mp4"))
+
+	obj, err := fs.Get(ctx, "videos/1/video.mp4")
+	assert.NilError(t, err)
+	obj.Body.Close()
+
+	var out bytes.Buffer
+	assert.NilError(t, reg.Write(ctx, &out))
+	assert.StringContains(t, out.String(), `filestore_upload_bytes_total{backend="memory"} 5`)
+	assert.StringContains(t, out.String(), `filestore_upload_duration_seconds_count{backend="memory",result="ok"} 1`)
+}
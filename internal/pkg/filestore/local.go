@@ -0,0 +1,266 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("local", newLocalDisk)
+}
+
+// LocalDisk stores objects as files below a root directory. Writes go to a temporary file in the target
+// directory that is renamed into place, so readers never observe a partially written object.
+type LocalDisk struct {
+	root   string
+	signer urlSigner
+}
+
+// Put writes the object. Content types are derived from the key extension on read, contentType is not
+// persisted.
+func (l LocalDisk) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p := l.path(key)
+
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-"+filepath.Base(p)+"-*")
+	if err != nil {
+		return err
+	}
+
+	// Removing after a successful rename is a no-op
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("filestore: wrote %d bytes, expected %d", n, size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l LocalDisk) Get(ctx context.Context, key string) (*Object, error) {
+	return l.GetRange(ctx, key, 0, -1)
+}
+
+func (l LocalDisk) GetRange(ctx context.Context, key string, offset, length int64) (*Object, error) {
+	f, err := os.Open(l.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	offset, length, err = resolveRange(fi.Size(), offset, length)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Object{
+		Body: readCloser{
+			Reader: io.LimitReader(f, length),
+			Closer: f,
+		},
+		Info:   l.info(key, fi),
+		Offset: offset,
+		Length: length,
+	}, nil
+}
+
+func (l LocalDisk) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	fi, err := os.Stat(l.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return nil, ErrObjectNotFound
+	}
+
+	info := l.info(key, fi)
+
+	return &info, nil
+}
+
+// Check makes sure the root directory still exists and is a directory.
+func (l LocalDisk) Check(ctx context.Context) error {
+	fi, err := os.Stat(l.root)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("filestore root %s is not a directory", l.root)
+	}
+
+	return nil
+}
+
+func (l LocalDisk) Delete(ctx context.Context, key string) error {
+	err := os.Remove(l.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// List walks the directory holding prefix and returns the objects whose key starts with it, sorted
+// by key. Temporary files of in-flight writes are skipped.
+func (l LocalDisk) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	dir := l.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = l.path(prefix[:i])
+	}
+
+	objects := []*ObjectInfo{}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		info := l.info(key, fi)
+		objects = append(objects, &info)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// PresignPut returns a URL served by the API server that accepts PUTs of the object until it expires. The
+// API server refuses them earlier once the object is no longer waiting for its content.
+func (l LocalDisk) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (*PresignedURL, error) {
+	return l.signer.sign(http.MethodPut, key, contentType, expires)
+}
+
+func (l LocalDisk) PresignGet(ctx context.Context, key string, expires time.Duration) (*PresignedURL, error) {
+	return l.signer.sign(http.MethodGet, key, "", expires)
+}
+
+func (l LocalDisk) VerifySignedURL(method, key string, query url.Values) error {
+	return l.signer.verify(method, key, query)
+}
+
+func (l LocalDisk) info(key string, fi fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  detectContentType(key),
+		ETag:         fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()),
+		LastModified: fi.ModTime(),
+	}
+}
+
+// path maps a key onto the filesystem. Keys are cleaned as rooted paths so they can never escape root.
+func (l LocalDisk) path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops a copy once the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+func newLocalDisk(cfg Config) (FileStore, error) {
+	if cfg.LocalRoot == "" {
+		return nil, errors.New("filestore: local backend requires a root directory")
+	}
+
+	root, err := filepath.Abs(cfg.LocalRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return LocalDisk{root: root, signer: newURLSigner(cfg)}, nil
+}
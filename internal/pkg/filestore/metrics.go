@@ -0,0 +1,70 @@
+package filestore
+
+import (
+	"context"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// uploadBuckets are histogram buckets, in seconds, for uploads from a few KB up to several GB.
+var uploadBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// instrumented records the bytes and duration of the uploads made through Put.
+type instrumented struct {
+	FileStore
+	backend  string
+	bytes    *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func (i *instrumented) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	start := time.Now()
+	cr := &countingReader{r: r}
+
+	err := i.FileStore.Put(ctx, key, cr, size, contentType)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	i.bytes.With(i.backend).Add(float64(cr.n.Load()))
+	i.duration.With(i.backend, result).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// instrumentedVerifier keeps backends without native presigning usable as a SignedURLVerifier.
+type instrumentedVerifier struct {
+	*instrumented
+	SignedURLVerifier
+}
+
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Instrument wraps fs so the uploads it stores are counted in reg, labelled with the backend name.
+func Instrument(fs FileStore, reg *metrics.Registry, backend string) FileStore {
+	i := &instrumented{
+		FileStore: fs,
+		backend:   backend,
+		bytes:     reg.Counter("filestore_upload_bytes_total", "Bytes uploaded to the filestore.", "backend"),
+		duration:  reg.Histogram("filestore_upload_duration_seconds", "Time taken to upload an object to the filestore.", uploadBuckets, "backend", "result"),
+	}
+
+	if verifier, ok := fs.(SignedURLVerifier); ok {
+		return &instrumentedVerifier{instrumented: i, SignedURLVerifier: verifier}
+	}
+
+	return i
+}
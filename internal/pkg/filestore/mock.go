@@ -0,0 +1,118 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests"
+	"net/url"
+	"time"
+)
+
+// Mock for testing purposes
+type Mock struct {
+	FnCalls map[string]int
+	Err     error
+	Body    []byte
+	Info    ObjectInfo
+	Objects []*ObjectInfo
+	URL     *PresignedURL
+}
+
+// Put reads the whole content like a backend would, unless it fails.
+func (f Mock) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	tests.Called(f.FnCalls, "Put")
+	if f.Err != nil {
+		return f.Err
+	}
+
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func (f Mock) Get(ctx context.Context, key string) (*Object, error) {
+	tests.Called(f.FnCalls, "Get")
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	return f.object(0, int64(len(f.Body))), nil
+}
+
+func (f Mock) GetRange(ctx context.Context, key string, offset, length int64) (*Object, error) {
+	tests.Called(f.FnCalls, "GetRange")
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	offset, length, err := resolveRange(int64(len(f.Body)), offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.object(offset, length), nil
+}
+
+func (f Mock) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	tests.Called(f.FnCalls, "Stat")
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	info := f.Info
+	info.Size = int64(len(f.Body))
+
+	return &info, nil
+}
+
+func (f Mock) Check(ctx context.Context) error {
+	tests.Called(f.FnCalls, "Check")
+	return f.Err
+}
+
+func (f Mock) Delete(ctx context.Context, key string) error {
+	tests.Called(f.FnCalls, "Delete")
+	return f.Err
+}
+
+func (f Mock) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	tests.Called(f.FnCalls, "List")
+	return f.Objects, f.Err
+}
+
+func (f Mock) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (*PresignedURL, error) {
+	tests.Called(f.FnCalls, "PresignPut")
+	return f.URL, f.Err
+}
+
+func (f Mock) PresignGet(ctx context.Context, key string, expires time.Duration) (*PresignedURL, error) {
+	tests.Called(f.FnCalls, "PresignGet")
+	return f.URL, f.Err
+}
+
+func (f Mock) VerifySignedURL(method, key string, query url.Values) error {
+	tests.Called(f.FnCalls, "VerifySignedURL")
+	return f.Err
+}
+
+func (f Mock) object(offset, length int64) *Object {
+	info := f.Info
+	info.Size = int64(len(f.Body))
+
+	return &Object{
+		Body:   io.NopCloser(bytes.NewReader(f.Body[offset : offset+length])),
+		Info:   info,
+		Offset: offset,
+		Length: length,
+	}
+}
+
+func (f Mock) GetFnCalls(fnName string) int {
+	value, exists := f.FnCalls[fnName]
+
+	if !exists {
+		return 0
+	}
+
+	return value
+}
@@ -0,0 +1,552 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("s3", newS3Bucket)
+}
+
+const (
+	defaultMultipartThreshold = 64 << 20
+	defaultPartSize           = 16 << 20
+	defaultPartConcurrency    = 4
+
+	// S3 limits, every part but the last must be at least minPartSize and an upload has at most maxParts
+	minPartSize = 5 << 20
+	maxParts    = 10000
+)
+
+// s3API is the subset of the S3 client the backend uses, it lets tests swap in a fake.
+type s3API interface {
+	s3.ListObjectsV2APIClient
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+type S3Bucket struct {
+	region             string
+	bucketName         string
+	endpoint           string
+	awsAccessKeyId     string
+	awsSecretKey       string
+	client             s3API
+	presign            *s3.PresignClient
+	multipartThreshold int64
+	partSize           int64
+	partConcurrency    int
+	partRetries        int
+	retryBackoff       time.Duration
+}
+
+// Put stores the object with a single PutObject below the multipart threshold. Larger objects, and
+// objects of unknown size, are sent as a multipart upload.
+func (s S3Bucket) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size >= 0 && size < s.multipartThreshold {
+		return s.putObject(ctx, key, r, size, contentType)
+	}
+
+	return s.putMultipart(ctx, key, r, size, contentType)
+}
+
+// putObject stores an object below the multipart threshold. Over plain HTTP the SDK hashes the payload to
+// sign it and rewinds it afterwards, bodies that can't seek are buffered first, their size is bounded by
+// the threshold.
+func (s S3Bucket) putObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		data := make([]byte, size)
+
+		_, err := io.ReadFull(contextReader{ctx: ctx, r: r}, data)
+		if err != nil {
+			return fmt.Errorf("filestore: buffering %s: %w", key, err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &s.bucketName,
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: size,
+		ContentType:   aws.String(contentType),
+	})
+
+	return err
+}
+
+// putMultipart reads the body into parts and uploads up to partConcurrency of them at once, so at most
+// partConcurrency+1 parts are held in memory. A part that keeps failing after partRetries retries aborts
+// the whole upload, which makes S3 drop the parts already stored.
+func (s S3Bucket) putMultipart(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	partSize := s.partSizeFor(size)
+
+	first := make([]byte, partSize)
+	n, err := io.ReadFull(contextReader{ctx: ctx, r: r}, first)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// A body of unknown size that fits in a single part does not need a multipart upload
+	if int64(n) < partSize {
+		if size >= 0 && int64(n) != size {
+			return fmt.Errorf("filestore: wrote %d bytes, expected %d", n, size)
+		}
+		return s.putObject(ctx, key, bytes.NewReader(first[:n]), int64(n), contentType)
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      &s.bucketName,
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return err
+	}
+
+	parts, err := s.uploadParts(ctx, key, created.UploadId, r, first, size)
+	if err == nil {
+		_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          &s.bucketName,
+			Key:             aws.String(key),
+			UploadId:        created.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err != nil {
+		// The request context may be what failed the upload, the abort must still go through
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, abortErr := s.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   &s.bucketName,
+			Key:      aws.String(key),
+			UploadId: created.UploadId,
+		})
+		if abortErr != nil {
+			return fmt.Errorf("%w (aborting multipart upload %s: %v)", err, aws.ToString(created.UploadId), abortErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s S3Bucket) uploadParts(ctx context.Context, key string, uploadId *string, r io.Reader, first []byte, size int64) ([]types.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []types.CompletedPart
+		firstErr error
+	)
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return firstErr != nil
+	}
+
+	sem := make(chan struct{}, s.partConcurrency)
+	data := first
+	total := int64(0)
+
+	for number := int32(1); !failed(); number++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			continue
+		}
+
+		total += int64(len(data))
+
+		wg.Add(1)
+		go func(number int32, data []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			etag, err := s.uploadPart(ctx, key, uploadId, number, data)
+			if err != nil {
+				fail(fmt.Errorf("filestore: uploading part %d: %w", number, err))
+				return
+			}
+
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{ETag: etag, PartNumber: number})
+			mu.Unlock()
+		}(number, data)
+
+		if int64(len(data)) < int64(len(first)) {
+			break
+		}
+
+		data = make([]byte, len(first))
+		n, err := io.ReadFull(contextReader{ctx: ctx, r: r}, data)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			fail(err)
+			break
+		}
+
+		data = data[:n]
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if size >= 0 && total != size {
+		return nil, fmt.Errorf("filestore: wrote %d bytes, expected %d", total, size)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+
+	return parts, nil
+}
+
+// uploadPart sends a single part, retrying with exponential backoff on failure.
+func (s S3Bucket) uploadPart(ctx context.Context, key string, uploadId *string, number int32, data []byte) (*string, error) {
+	var err error
+
+	for attempt := 0; attempt <= s.partRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.retryBackoff << (attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		var output *s3.UploadPartOutput
+
+		output, err = s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &s.bucketName,
+			Key:           aws.String(key),
+			UploadId:      uploadId,
+			PartNumber:    number,
+			Body:          bytes.NewReader(data),
+			ContentLength: int64(len(data)),
+		})
+		if err == nil {
+			return output.ETag, nil
+		}
+	}
+
+	return nil, err
+}
+
+// partSizeFor grows the configured part size when an object of the given size would not fit in maxParts.
+func (s S3Bucket) partSizeFor(size int64) int64 {
+	partSize := s.partSize
+	if size > partSize*maxParts {
+		partSize = (size + maxParts - 1) / maxParts
+	}
+
+	return partSize
+}
+
+func (s S3Bucket) Get(ctx context.Context, key string) (*Object, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucketName,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return &Object{
+		Body: output.Body,
+		Info: ObjectInfo{
+			Key:          key,
+			Size:         output.ContentLength,
+			ContentType:  aws.ToString(output.ContentType),
+			ETag:         aws.ToString(output.ETag),
+			LastModified: aws.ToTime(output.LastModified),
+		},
+		Offset: 0,
+		Length: output.ContentLength,
+	}, nil
+}
+
+func (s S3Bucket) GetRange(ctx context.Context, key string, offset, length int64) (*Object, error) {
+	if offset < 0 || length == 0 {
+		return nil, ErrInvalidRange
+	}
+
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucketName,
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	size, err := contentRangeSize(aws.ToString(output.ContentRange))
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+
+	return &Object{
+		Body: output.Body,
+		Info: ObjectInfo{
+			Key:          key,
+			Size:         size,
+			ContentType:  aws.ToString(output.ContentType),
+			ETag:         aws.ToString(output.ETag),
+			LastModified: aws.ToTime(output.LastModified),
+		},
+		Offset: offset,
+		Length: output.ContentLength,
+	}, nil
+}
+
+func (s S3Bucket) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &s.bucketName,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         output.ContentLength,
+		ContentType:  aws.ToString(output.ContentType),
+		ETag:         aws.ToString(output.ETag),
+		LastModified: aws.ToTime(output.LastModified),
+	}, nil
+}
+
+// Check issues a HeadBucket, which fails when the bucket is missing or the credentials can't access it.
+func (s S3Bucket) Check(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: &s.bucketName,
+	})
+
+	return err
+}
+
+func (s S3Bucket) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.bucketName,
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+func (s S3Bucket) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: &s.bucketName,
+		Prefix: aws.String(prefix),
+	})
+
+	objects := []*ObjectInfo{}
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range page.Contents {
+			key := aws.ToString(o.Key)
+
+			objects = append(objects, &ObjectInfo{
+				Key:          key,
+				Size:         o.Size,
+				ContentType:  detectContentType(key),
+				ETag:         aws.ToString(o.ETag),
+				LastModified: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// PresignPut returns a SigV4 presigned URL that uploads the object straight to the bucket. The content
+// type is part of the signature, the client must send the same Content-Type header.
+func (s S3Bucket) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (*PresignedURL, error) {
+	input := &s3.PutObjectInput{
+		Bucket: &s.bucketName,
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	req, err := s.presign.PresignPutObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, err
+	}
+
+	return presignedURL(req, expires), nil
+}
+
+func (s S3Bucket) PresignGet(ctx context.Context, key string, expires time.Duration) (*PresignedURL, error) {
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucketName,
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, err
+	}
+
+	return presignedURL(req, expires), nil
+}
+
+// presignedURL converts a presigned request, the Host header is set by every HTTP client so it is left
+// out of the headers the client is asked to send.
+func presignedURL(req *v4.PresignedHTTPRequest, expires time.Duration) *PresignedURL {
+	headers := map[string]string{}
+	for name, values := range req.SignedHeader {
+		if !strings.EqualFold(name, "Host") && len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+
+	return &PresignedURL{
+		URL:       req.URL,
+		Method:    req.Method,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(expires),
+	}
+}
+
+// s3Error maps missing object errors to ErrObjectNotFound. HeadObject has no body so S3 reports those
+// as a generic NotFound instead of NoSuchKey.
+func s3Error(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+
+	switch {
+	case errors.As(err, &noSuchKey), errors.As(err, &notFound):
+		return ErrObjectNotFound
+	case strings.Contains(err.Error(), "InvalidRange"):
+		return ErrInvalidRange
+	default:
+		return err
+	}
+}
+
+// contentRangeSize reads the complete length from a "bytes start-end/size" header.
+func contentRangeSize(contentRange string) (int64, error) {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("filestore: malformed Content-Range %q", contentRange)
+	}
+
+	return strconv.ParseInt(contentRange[i+1:], 10, 64)
+}
+
+func newS3Bucket(cfg Config) (FileStore, error) {
+	//Config: Region, Credentials, Config.EndpointResolverWithOptions
+
+	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			PartitionID:   "aws",
+			URL:           cfg.AwsEndpoint,
+			SigningRegion: cfg.AwsRegion,
+		}, nil
+	})
+
+	awsCfg, err := config.LoadDefaultConfig(
+		context.Background(),
+		config.WithRegion(cfg.AwsRegion),
+		config.WithEndpointResolverWithOptions(customResolver),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AwsAccessKeyId, cfg.AwsSecretKey, "")),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsCfg)
+
+	bucket := S3Bucket{
+		region:             cfg.AwsRegion,
+		bucketName:         cfg.AwsBucketName,
+		awsAccessKeyId:     cfg.AwsAccessKeyId,
+		awsSecretKey:       cfg.AwsSecretKey,
+		endpoint:           cfg.AwsEndpoint,
+		client:             client,
+		presign:            s3.NewPresignClient(client),
+		multipartThreshold: cfg.AwsMultipartThreshold,
+		partSize:           cfg.AwsPartSize,
+		partConcurrency:    cfg.AwsPartConcurrency,
+		partRetries:        cfg.AwsPartRetries,
+		retryBackoff:       500 * time.Millisecond,
+	}
+
+	if bucket.multipartThreshold <= 0 {
+		bucket.multipartThreshold = defaultMultipartThreshold
+	}
+	if bucket.partSize <= 0 {
+		bucket.partSize = defaultPartSize
+	}
+	if bucket.partSize < minPartSize {
+		return nil, fmt.Errorf("filestore: s3 part size must be at least %d bytes", minPartSize)
+	}
+	if bucket.partConcurrency <= 0 {
+		bucket.partConcurrency = defaultPartConcurrency
+	}
+	if bucket.partRetries < 0 {
+		bucket.partRetries = 0
+	}
+
+	return bucket, nil
+}
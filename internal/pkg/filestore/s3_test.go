@@ -0,0 +1,204 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// s3Fake records the calls of a multipart upload. Parts listed in failParts fail that many times before
+// succeeding.
+type s3Fake struct {
+	s3API
+
+	mu        sync.Mutex
+	putBodies [][]byte
+	parts     map[int32][]byte
+	failParts map[int32]int
+	completed *s3.CompleteMultipartUploadInput
+	aborted   int
+}
+
+func (f *s3Fake) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.putBodies = append(f.putBodies, data)
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *s3Fake) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if aws.ToString(params.Bucket) != "videos" {
+		return nil, errors.New("NotFound")
+	}
+
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *s3Fake) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (f *s3Fake) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failParts[params.PartNumber] > 0 {
+		f.failParts[params.PartNumber]--
+		return nil, errors.New("connection reset")
+	}
+
+	f.parts[params.PartNumber] = data
+
+	return &s3.UploadPartOutput{ETag: aws.String(string(data[:1]))}, nil
+}
+
+func (f *s3Fake) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.completed = params
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *s3Fake) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestS3Bucket_Put(t *testing.T) {
+	content := "abcdefghijklmnopqrstuvwxyz"
+
+	testsMap := []struct {
+		name        string
+		size        int64
+		failParts   map[int32]int
+		shouldError bool
+		puts        int
+		parts       int
+		aborted     int
+	}{
+		{name: "Below Threshold", size: 9, puts: 1},
+		{name: "Multipart", size: int64(len(content)), parts: 6},
+		{name: "Unknown Size", size: -1, parts: 6},
+		{name: "Part Retried", size: int64(len(content)), failParts: map[int32]int{3: 2}, parts: 6},
+		{name: "Part Fails", size: int64(len(content)), failParts: map[int32]int{3: 3}, shouldError: true, aborted: 1},
+		{name: "Short Body", size: 100, shouldError: true, aborted: 1},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &s3Fake{parts: map[int32][]byte{}, failParts: tt.failParts}
+
+			bucket := S3Bucket{
+				bucketName:         "bucket",
+				client:             fake,
+				multipartThreshold: 10,
+				partSize:           5,
+				partConcurrency:    2,
+				partRetries:        2,
+			}
+
+			body := content
+			if tt.size >= 0 && tt.size < int64(len(content)) {
+				body = content[:tt.size]
+			}
+
+			err := bucket.Put(context.Background(), "videos/1/video.mp4", strings.NewReader(body), tt.size, "video/mp4")
+
+			if tt.shouldError {
+				assert.Error(t, err)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			assert.Equal(t, len(fake.putBodies), tt.puts)
+			assert.Equal(t, fake.aborted, tt.aborted)
+
+			if tt.parts > 0 {
+				assert.Equal(t, len(fake.completed.MultipartUpload.Parts), tt.parts)
+
+				var uploaded bytes.Buffer
+				for i, part := range fake.completed.MultipartUpload.Parts {
+					assert.Equal(t, part.PartNumber, int32(i+1))
+					uploaded.Write(fake.parts[part.PartNumber])
+				}
+				assert.Equal(t, uploaded.String(), content)
+			}
+		})
+	}
+}
+
+func TestS3Bucket_Check(t *testing.T) {
+	fake := &s3Fake{}
+
+	bucket := S3Bucket{bucketName: "videos", client: fake}
+	assert.NilError(t, bucket.Check(context.Background()))
+
+	bucket.bucketName = "missing"
+	assert.Error(t, bucket.Check(context.Background()))
+}
+
+func TestS3Bucket_PartSizeFor(t *testing.T) {
+	bucket := S3Bucket{partSize: 16 << 20}
+
+	assert.Equal(t, bucket.partSizeFor(-1), int64(16<<20))
+	assert.Equal(t, bucket.partSizeFor(1<<30), int64(16<<20))
+	assert.Equal(t, bucket.partSizeFor(200<<30)*maxParts >= 200<<30, true)
+}
+
+func TestS3Bucket_PutOverHTTP(t *testing.T) {
+	var mu sync.Mutex
+	stored := map[string]string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil || r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		stored[r.URL.Path] = string(body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// The real client signs the payload, path style keeps the bucket out of the host name of the test server
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("test", "test", ""),
+		EndpointResolver: s3.EndpointResolverFromURL(srv.URL),
+		UsePathStyle:     true,
+	})
+
+	bucket := S3Bucket{bucketName: "videos", client: client, multipartThreshold: defaultMultipartThreshold}
+
+	// A playlist rendered into a buffer can't be rewound
+	playlist := bytes.NewBufferString("#EXTM3U\n")
+
+	err := bucket.Put(context.Background(), "videos/1/index.m3u8", playlist, int64(playlist.Len()), "application/vnd.apple.mpegurl")
+	assert.NilError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, stored["/videos/videos/1/index.m3u8"], "#EXTM3U\n")
+}
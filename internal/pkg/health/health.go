@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a check that doesn't set its own timeout.
+const DefaultTimeout = 2 * time.Second
+
+// Checker is implemented by the dependencies the service can't work without, Check returns an error when
+// the dependency is unreachable or unusable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check is a named Checker. The service is not ready while a Critical check fails, other checks are only
+// reported.
+type Check struct {
+	Name     string
+	Checker  Checker
+	Timeout  time.Duration
+	Critical bool
+}
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    Status  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Run runs the checks concurrently, each bounded by its own timeout, and returns their results in the
+// order of checks. ready is false when any critical check failed.
+func Run(ctx context.Context, checks []Check) (results []Result, ready bool) {
+	results = make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Add(1)
+
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	ready = true
+	for _, result := range results {
+		if result.Critical && result.Status != StatusUp {
+			ready = false
+		}
+	}
+
+	return results, ready
+}
+
+func run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// The check runs on its own goroutine so one ignoring its context still can't hold the response
+	// past its timeout.
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	up := CheckerFunc(func(ctx context.Context) error { return nil })
+	down := CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") })
+	hangs := CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	testsMap := []struct {
+		name        string
+		checks      []Check
+		wantsReady  bool
+		wantsStatus []Status
+	}{
+		{name: "No Checks", wantsReady: true, wantsStatus: []Status{}},
+		{
+			name:        "All Up",
+			checks:      []Check{{Name: "db", Checker: up, Critical: true}, {Name: "files", Checker: up, Critical: true}},
+			wantsReady:  true,
+			wantsStatus: []Status{StatusUp, StatusUp},
+		},
+		{
+			name:        "Critical Down",
+			checks:      []Check{{Name: "db", Checker: down, Critical: true}, {Name: "files", Checker: up, Critical: true}},
+			wantsReady:  false,
+			wantsStatus: []Status{StatusDown, StatusUp},
+		},
+		{
+			name:        "Non Critical Down",
+			checks:      []Check{{Name: "db", Checker: up, Critical: true}, {Name: "mail", Checker: down}},
+			wantsReady:  true,
+			wantsStatus: []Status{StatusUp, StatusDown},
+		},
+		{
+			name:        "Timeout",
+			checks:      []Check{{Name: "db", Checker: hangs, Timeout: 10 * time.Millisecond, Critical: true}},
+			wantsReady:  false,
+			wantsStatus: []Status{StatusDown},
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+
+			results, ready := Run(context.Background(), tt.checks)
+
+			assert.Equal(t, ready, tt.wantsReady)
+			assert.Equal(t, len(results), len(tt.wantsStatus))
+			assert.Equal(t, time.Since(start) < 500*time.Millisecond, true)
+
+			for i, result := range results {
+				assert.Equal(t, result.Name, tt.checks[i].Name)
+				assert.Equal(t, result.Status, tt.wantsStatus[i])
+				assert.Equal(t, result.Error != "", result.Status == StatusDown)
+			}
+		})
+	}
+}
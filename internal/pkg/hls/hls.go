@@ -0,0 +1,230 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ContentType is the media type of playlists.
+	ContentType = "application/vnd.apple.mpegurl"
+	// SegmentContentType is the media type of fragmented MP4 media segments.
+	SegmentContentType = "video/iso.segment"
+)
+
+// version is the protocol version of the written playlists, 7 is the first allowing EXT-X-MAP in playlists
+// without I-frames only segments.
+const version = 7
+
+var ErrInvalidPlaylist = errors.New("invalid playlist")
+
+// Variant is one rendition of a master playlist. Bandwidth is the peak segment bitrate and
+// AverageBandwidth the average one, both in bits per second. Codecs is an RFC 6381 codecs parameter, it and
+// the resolution are left out when empty.
+type Variant struct {
+	URI              string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Width            int
+	Height           int
+	Codecs           string
+}
+
+// MasterPlaylist lists the variants of a presentation, players pick one according to their bandwidth.
+type MasterPlaylist struct {
+	Variants []Variant
+}
+
+// Encode writes the playlist in the order of its variants.
+func (p *MasterPlaylist) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw)
+	bw.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	for _, v := range p.Variants {
+		attrs := []string{"BANDWIDTH=" + strconv.FormatInt(v.Bandwidth, 10)}
+
+		if v.AverageBandwidth > 0 {
+			attrs = append(attrs, "AVERAGE-BANDWIDTH="+strconv.FormatInt(v.AverageBandwidth, 10))
+		}
+		if v.Codecs != "" {
+			attrs = append(attrs, "CODECS="+strconv.Quote(v.Codecs))
+		}
+		if v.Width > 0 && v.Height > 0 {
+			attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", v.Width, v.Height))
+		}
+
+		fmt.Fprintf(bw, "#EXT-X-STREAM-INF:%s\n%s\n", strings.Join(attrs, ","), v.URI)
+	}
+
+	return bw.Flush()
+}
+
+// Segment is a media segment, Duration is in seconds.
+type Segment struct {
+	URI      string
+	Duration float64
+}
+
+// MediaPlaylist is a video on demand playlist of fragmented MP4 segments sharing the Map initialization
+// section.
+type MediaPlaylist struct {
+	Map      string
+	Segments []Segment
+}
+
+// TargetDuration returns the longest segment duration rounded to the nearest second, as the EXTINF of
+// every segment rounded the same way must not exceed it.
+func (p *MediaPlaylist) TargetDuration() int {
+	target := 1
+
+	for _, s := range p.Segments {
+		if d := int(math.Round(s.Duration)); d > target {
+			target = d
+		}
+	}
+
+	return target
+}
+
+// Encode writes the complete playlist, ending with EXT-X-ENDLIST as no segment will be added.
+func (p *MediaPlaylist) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw)
+	fmt.Fprintf(bw, "#EXT-X-TARGETDURATION:%d\n", p.TargetDuration())
+	bw.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	bw.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	bw.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	if p.Map != "" {
+		fmt.Fprintf(bw, "#EXT-X-MAP:URI=%s\n", strconv.Quote(p.Map))
+	}
+
+	for _, s := range p.Segments {
+		fmt.Fprintf(bw, "#EXTINF:%s,\n%s\n", strconv.FormatFloat(s.Duration, 'f', 3, 64), s.URI)
+	}
+
+	bw.WriteString("#EXT-X-ENDLIST\n")
+
+	return bw.Flush()
+}
+
+// Bandwidth returns the peak and average bitrates, in bits per second, of segments of the given sizes in
+// bytes. sizes holds one entry per segment.
+func (p *MediaPlaylist) Bandwidth(sizes []int64) (peak, average int64) {
+	var total int64
+	var duration float64
+
+	for i, s := range p.Segments {
+		if i >= len(sizes) || s.Duration <= 0 {
+			continue
+		}
+
+		if bps := int64(math.Ceil(float64(sizes[i]*8) / s.Duration)); bps > peak {
+			peak = bps
+		}
+
+		total += sizes[i]
+		duration += s.Duration
+	}
+
+	if duration > 0 {
+		average = int64(math.Ceil(float64(total*8) / duration))
+	}
+
+	return peak, average
+}
+
+// ParseMediaPlaylist reads the initialization section and the segments of a media playlist, like the ones
+// written by ffmpeg. Other tags are ignored.
+func ParseMediaPlaylist(r io.Reader) (*MediaPlaylist, error) {
+	p := &MediaPlaylist{}
+
+	scanner := bufio.NewScanner(r)
+
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "#EXTM3U" {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: missing #EXTM3U", ErrInvalidPlaylist)
+	}
+
+	duration := -1.0
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("%w: bad segment duration %q", ErrInvalidPlaylist, value)
+			}
+			duration = d
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			uri, ok := attribute(strings.TrimPrefix(line, "#EXT-X-MAP:"), "URI")
+			if !ok {
+				return nil, fmt.Errorf("%w: EXT-X-MAP without URI", ErrInvalidPlaylist)
+			}
+			p.Map = uri
+		case strings.HasPrefix(line, "#"):
+		default:
+			if duration < 0 {
+				return nil, fmt.Errorf("%w: segment %q without EXTINF", ErrInvalidPlaylist, line)
+			}
+			p.Segments = append(p.Segments, Segment{URI: line, Duration: duration})
+			duration = -1
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "#EXTM3U\n#EXT-X-VERSION:%d\n", version)
+}
+
+// attribute returns the value of name in an attribute list, quoted string values are unquoted.
+func attribute(list, name string) (string, bool) {
+	for list != "" {
+		var key, value string
+		var ok bool
+
+		key, list, ok = strings.Cut(list, "=")
+		if !ok {
+			return "", false
+		}
+
+		if strings.HasPrefix(list, `"`) {
+			end := strings.IndexByte(list[1:], '"')
+			if end < 0 {
+				return "", false
+			}
+			value, list = list[1:end+1], list[end+2:]
+		} else {
+			value, list, _ = strings.Cut(list, ",")
+		}
+
+		list = strings.TrimPrefix(list, ",")
+
+		if strings.TrimSpace(key) == name {
+			return value, true
+		}
+	}
+
+	return "", false
+}
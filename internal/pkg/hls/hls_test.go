@@ -0,0 +1,124 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got to testdata/name, or writes it there with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		err := os.WriteFile(path, got, 0o644)
+		assert.NilError(t, err)
+	}
+
+	want, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), string(want))
+}
+
+func TestMasterPlaylist_Encode(t *testing.T) {
+	p := MasterPlaylist{Variants: []Variant{
+		{URI: "1080p/index.m3u8", Bandwidth: 5_612_000, AverageBandwidth: 5_180_000, Width: 1920, Height: 1080, Codecs: "avc1.640028,mp4a.40.2"},
+		{URI: "720p/index.m3u8", Bandwidth: 3_104_000, AverageBandwidth: 2_911_000, Width: 1280, Height: 720, Codecs: "avc1.64001f,mp4a.40.2"},
+		{URI: "480p/index.m3u8", Bandwidth: 1_598_000},
+	}}
+
+	var buf bytes.Buffer
+	err := p.Encode(&buf)
+	assert.NilError(t, err)
+
+	golden(t, "master.m3u8", buf.Bytes())
+}
+
+func TestMediaPlaylist_Encode(t *testing.T) {
+	p := MediaPlaylist{
+		Map: "init.mp4",
+		Segments: []Segment{
+			{URI: "segment_00000.m4s", Duration: 6.006},
+			{URI: "segment_00001.m4s", Duration: 6.006},
+			{URI: "segment_00002.m4s", Duration: 2.4},
+		},
+	}
+
+	assert.Equal(t, p.TargetDuration(), 6)
+
+	var buf bytes.Buffer
+	err := p.Encode(&buf)
+	assert.NilError(t, err)
+
+	golden(t, "media.m3u8", buf.Bytes())
+
+	parsed, err := ParseMediaPlaylist(&buf)
+	assert.NilError(t, err)
+	assert.Equal(t, parsed.Map, p.Map)
+	assert.Equal(t, len(parsed.Segments), len(p.Segments))
+	for i := range p.Segments {
+		assert.Equal(t, parsed.Segments[i], p.Segments[i])
+	}
+}
+
+func TestMediaPlaylist_Bandwidth(t *testing.T) {
+	p := MediaPlaylist{Segments: []Segment{
+		{URI: "segment_00000.m4s", Duration: 4},
+		{URI: "segment_00001.m4s", Duration: 2},
+	}}
+
+	peak, average := p.Bandwidth([]int64{1_000_000, 750_000})
+	assert.Equal(t, peak, int64(3_000_000))
+	assert.Equal(t, average, int64(2_333_334))
+
+	peak, average = (&MediaPlaylist{}).Bandwidth(nil)
+	assert.Equal(t, peak, int64(0))
+	assert.Equal(t, average, int64(0))
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	testsMap := []struct {
+		name          string
+		playlist      string
+		wantsMap      string
+		wantsSegments int
+		wantsErr      bool
+	}{
+		{
+			name: "FFmpeg Output",
+			playlist: "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:0\n" +
+				"#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MAP:URI=\"init.mp4\",BYTERANGE=\"812@0\"\n" +
+				"#EXTINF:6.000000,\nsegment_00000.m4s\n#EXTINF:3.500000,\nsegment_00001.m4s\n#EXT-X-ENDLIST\n",
+			wantsMap:      "init.mp4",
+			wantsSegments: 2,
+		},
+		{name: "Not A Playlist", playlist: "<html>", wantsErr: true},
+		{name: "Segment Without Duration", playlist: "#EXTM3U\nsegment_00000.m4s\n", wantsErr: true},
+		{name: "Bad Duration", playlist: "#EXTM3U\n#EXTINF:six,\nsegment_00000.m4s\n", wantsErr: true},
+		{name: "Map Without URI", playlist: "#EXTM3U\n#EXT-X-MAP:BYTERANGE=\"812@0\"\n", wantsErr: true},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseMediaPlaylist(strings.NewReader(tt.playlist))
+
+			if tt.wantsErr {
+				assert.Equal(t, errors.Is(err, ErrInvalidPlaylist), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, p.Map, tt.wantsMap)
+			assert.Equal(t, len(p.Segments), tt.wantsSegments)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File writes every message to its own .eml file instead of sending it, for local development. The files
+// open in any mail client.
+type File struct {
+	dir    string
+	sender string
+}
+
+func (f *File) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	msg, err := render(f.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", msg.Date.Format("20060102T150405.000000000"), sanitize(recipient))
+
+	return os.WriteFile(filepath.Join(f.dir, name), body, 0o600)
+}
+
+// sanitize keeps the characters of an address that are safe in a filename.
+func sanitize(address string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, address)
+}
+
+func newFile(cfg Config) (*File, error) {
+	err := os.MkdirAll(cfg.Dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{dir: cfg.Dir, sender: cfg.Sender}, nil
+}
@@ -0,0 +1,162 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+var ErrUnknownBackend = errors.New("unknown mailer backend")
+
+type Config struct {
+	Sender string
+
+	// SMTP backend
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Timeout  time.Duration
+
+	// File backend, every message is written to its own .eml file in Dir
+	Dir string
+}
+
+// Mailer sends emails rendered from the templates embedded in the package. A template defines a
+// "subject", a "plainBody" and an "htmlBody" template, data is passed to all three.
+type Mailer interface {
+	Send(ctx context.Context, recipient, templateFile string, data any) error
+}
+
+// Message is a rendered email.
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+	Date      time.Time
+}
+
+// Backends returns the names accepted by New.
+func Backends() []string {
+	return []string{"file", "memory", "smtp"}
+}
+
+func New(backend string, cfg Config) (Mailer, error) {
+	switch backend {
+	case "smtp":
+		return newSMTP(cfg), nil
+	case "file":
+		return newFile(cfg)
+	case "memory":
+		return NewMemory(cfg.Sender), nil
+	default:
+		return nil, fmt.Errorf("%w %q (available: %v)", ErrUnknownBackend, backend, Backends())
+	}
+}
+
+// render executes the templates of templateFile for a message from sender to recipient.
+func render(sender, recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The HTML body is parsed again with html/template so data is escaped
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:      sender,
+		To:        recipient,
+		Subject:   strings.TrimSpace(subject.String()),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+		Date:      time.Now(),
+	}, nil
+}
+
+// Bytes encodes the message as a multipart/alternative MIME message with a plain text and an HTML part.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", m.Date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain; charset=utf-8", body: m.PlainBody},
+		{contentType: "text/html; charset=utf-8", body: m.HTMLBody},
+	}
+
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+
+		_, err = qp.Write([]byte(p.body))
+		if err != nil {
+			return nil, err
+		}
+
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
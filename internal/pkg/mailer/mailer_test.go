@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type welcomeData struct {
+	Name            string
+	ActivationToken string
+	Expiry          string
+}
+
+func TestNew(t *testing.T) {
+	for _, backend := range Backends() {
+		t.Run(backend, func(t *testing.T) {
+			_, err := New(backend, Config{Dir: t.TempDir()})
+			assert.NilError(t, err)
+		})
+	}
+
+	_, err := New("pigeon", Config{})
+	assert.Equal(t, errors.Is(err, ErrUnknownBackend), true)
+}
+
+func TestMemory_Send(t *testing.T) {
+	m := NewMemory("Video Sharing <no-reply@example.com>")
+
+	data := welcomeData{Name: "<Alice>", ActivationToken: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", Expiry: "tomorrow"}
+
+	err := m.Send(context.Background(), "alice@example.com", "user_welcome.tmpl", data)
+	assert.NilError(t, err)
+
+	messages := m.Messages()
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].To, "alice@example.com")
+	assert.Equal(t, messages[0].Subject, "Welcome to Video Sharing!")
+	assert.Equal(t, strings.Contains(messages[0].PlainBody, "Hi <Alice>,"), true)
+	assert.Equal(t, strings.Contains(messages[0].HTMLBody, "Hi &lt;Alice&gt;,"), true)
+	assert.Equal(t, strings.Contains(messages[0].PlainBody, data.ActivationToken), true)
+
+	err = m.Send(context.Background(), "alice@example.com", "missing.tmpl", data)
+	assert.Error(t, err)
+}
+
+func TestFile_Send(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := newFile(Config{Dir: dir, Sender: "Video Sharing <no-reply@example.com>"})
+	assert.NilError(t, err)
+
+	err = f.Send(context.Background(), "bob@example.com", "user_welcome.tmpl", welcomeData{Name: "Bob", ActivationToken: "TOKEN"})
+	assert.NilError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-bob@example.com.eml"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+
+	raw, err := os.Open(files[0])
+	assert.NilError(t, err)
+	defer raw.Close()
+
+	msg, err := mail.ReadMessage(raw)
+	assert.NilError(t, err)
+	assert.Equal(t, msg.Header.Get("To"), "bob@example.com")
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NilError(t, err)
+	assert.Equal(t, mediaType, "multipart/alternative")
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	var types []string
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+
+		body, err := io.ReadAll(part)
+		assert.NilError(t, err)
+		assert.Equal(t, strings.Contains(string(body), "TOKEN"), true)
+
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+
+	assert.Equal(t, strings.Join(types, ","), "text/plain; charset=utf-8,text/html; charset=utf-8")
+}
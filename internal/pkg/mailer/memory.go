@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory keeps the messages it is asked to send in memory. It is meant for tests and local development.
+type Memory struct {
+	mu       sync.Mutex
+	sender   string
+	messages []Message
+}
+
+func (m *Memory) Send(ctx context.Context, recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+func NewMemory(sender string) *Memory {
+	return &Memory{sender: sender}
+}
@@ -0,0 +1,664 @@
+package mediaprobe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported media container")
+	ErrMalformed   = errors.New("malformed media file")
+)
+
+// maxMoovSize bounds the movie box read into memory. The sample tables of a feature length movie take a
+// few tens of MiB, larger boxes are not worth the memory.
+const maxMoovSize = 64 << 20
+
+// maxSmallBoxSize bounds the top level boxes other than moov that are read, like ftyp.
+const maxSmallBoxSize = 4 << 10
+
+// topLevelBoxes are the boxes an ISO-BMFF or QuickTime file may start with. Files starting with anything
+// else are not probed any further.
+var topLevelBoxes = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true, "wide": true, "pnot": true,
+}
+
+// codecs maps sample entry formats onto codec names.
+var codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264",
+	"hvc1": "hevc", "hev1": "hevc",
+	"av01": "av1",
+	"vp08": "vp8", "vp09": "vp9",
+	"mp4v": "mpeg4",
+	"apch": "prores", "apcn": "prores", "apcs": "prores", "apco": "prores", "ap4h": "prores",
+	"mp4a": "aac",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+}
+
+// Info is the technical metadata of a media file. Bitrate is the average over the whole file, in bits
+// per second. Codecs is the RFC 6381 codecs parameter of the video and audio track, avc1.64001f,mp4a.40.2
+// for instance, it is empty when a track has a codec without a known parameter form.
+type Info struct {
+	Container  string
+	DurationMs int64
+	Width      int
+	Height     int
+	VideoCodec string
+	AudioCodec string
+	Codecs     string
+	Bitrate    int64
+}
+
+// IsInvalid reports whether err means the content itself can't be probed, as opposed to a failure to
+// read it.
+func IsInvalid(err error) bool {
+	return errors.Is(err, ErrUnsupported) || errors.Is(err, ErrMalformed)
+}
+
+// Probe reads the box structure of an MP4 or QuickTime file of size bytes. Only the box headers and the
+// movie box are read, the media data is skipped, so r can be backed by remote storage.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	var brand string
+	var moov []byte
+
+	for offset := int64(0); offset < size; {
+		h, err := readHeader(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+
+		if offset == 0 && !topLevelBoxes[h.typ] {
+			return nil, ErrUnsupported
+		}
+
+		if !printable(h.typ) {
+			return nil, fmt.Errorf("%w: invalid box type at %d", ErrMalformed, offset)
+		}
+
+		if h.size < h.length || h.size > size-offset {
+			return nil, fmt.Errorf("%w: %s box size out of range", ErrMalformed, h.typ)
+		}
+
+		switch h.typ {
+		case "ftyp":
+			data, err := readPayload(r, h, maxSmallBoxSize)
+			if err != nil {
+				return nil, err
+			}
+			if len(data) >= 4 {
+				brand = string(data[:4])
+			}
+		case "moov":
+			moov, err = readPayload(r, h, maxMoovSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		offset += h.size
+	}
+
+	if moov == nil {
+		return nil, fmt.Errorf("%w: no moov box", ErrMalformed)
+	}
+
+	info, err := parseMoov(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Container = container(brand)
+
+	if info.DurationMs > 0 {
+		info.Bitrate = size * 8 * 1000 / info.DurationMs
+	}
+
+	return info, nil
+}
+
+// container names the container after the major brand of the ftyp box. QuickTime files predating ftyp
+// have none.
+func container(brand string) string {
+	switch {
+	case brand == "" || brand == "qt  ":
+		return "mov"
+	case strings.HasPrefix(brand, "3g"):
+		return "3gp"
+	default:
+		return "mp4"
+	}
+}
+
+type header struct {
+	typ    string
+	offset int64
+	size   int64
+	// length of the header, 8 bytes or 16 with a 64 bit size
+	length int64
+}
+
+// readHeader reads the header of the box at offset, a size of 0 extends the box to the end of the file.
+func readHeader(r io.ReaderAt, offset, fileSize int64) (header, error) {
+	buf := make([]byte, 16)
+
+	n, err := r.ReadAt(buf, offset)
+	if n < 8 {
+		if err == nil || errors.Is(err, io.EOF) {
+			return header{}, fmt.Errorf("%w: truncated box header at %d", ErrMalformed, offset)
+		}
+		return header{}, err
+	}
+
+	h := header{
+		typ:    string(buf[4:8]),
+		offset: offset,
+		size:   int64(binary.BigEndian.Uint32(buf)),
+		length: 8,
+	}
+
+	switch h.size {
+	case 0:
+		h.size = fileSize - offset
+	case 1:
+		if n < 16 {
+			return header{}, fmt.Errorf("%w: truncated %s box header", ErrMalformed, h.typ)
+		}
+		h.size = int64(binary.BigEndian.Uint64(buf[8:]))
+		h.length = 16
+	}
+
+	return h, nil
+}
+
+func readPayload(r io.ReaderAt, h header, limit int64) ([]byte, error) {
+	length := h.size - h.length
+	if length > limit {
+		return nil, fmt.Errorf("%w: %s box of %d bytes is too large", ErrUnsupported, h.typ, length)
+	}
+
+	data := make([]byte, length)
+
+	n, err := r.ReadAt(data, h.offset+h.length)
+	if n < len(data) {
+		if err == nil || errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: truncated %s box", ErrMalformed, h.typ)
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func printable(typ string) bool {
+	for i := 0; i < len(typ); i++ {
+		if typ[i] < 0x20 || typ[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// box is a box read into memory, data is its payload.
+type box struct {
+	typ  string
+	data []byte
+}
+
+// children splits the payload of a container box into its child boxes.
+func children(data []byte) ([]box, error) {
+	var boxes []box
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: truncated box header", ErrMalformed)
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		length := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("%w: truncated %s box header", ErrMalformed, typ)
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			length = 16
+		}
+
+		if size < length || size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: %s box size out of range", ErrMalformed, typ)
+		}
+
+		boxes = append(boxes, box{typ: typ, data: data[length:size]})
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+// child returns the first child of type typ following path, a list of nested box types.
+func child(data []byte, path ...string) ([]byte, bool, error) {
+	for _, typ := range path {
+		boxes, err := children(data)
+		if err != nil {
+			return nil, false, err
+		}
+
+		found := false
+		for _, b := range boxes {
+			if b.typ == typ {
+				data, found = b.data, true
+				break
+			}
+		}
+
+		if !found {
+			return nil, false, nil
+		}
+	}
+
+	return data, true, nil
+}
+
+func parseMoov(moov []byte) (*Info, error) {
+	boxes, err := children(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	tracks := 0
+
+	var params trackParams
+
+	for _, b := range boxes {
+		switch b.typ {
+		case "mvhd":
+			info.DurationMs, err = parseMvhd(b.data)
+			if err != nil {
+				return nil, err
+			}
+		case "mvex":
+			// Fragmented files may leave the mvhd duration empty and carry the total in mehd
+			if info.DurationMs == 0 {
+				info.DurationMs, err = parseMehd(b.data, moov)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "trak":
+			err = parseTrak(b.data, info, &params)
+			if err != nil {
+				return nil, err
+			}
+			tracks++
+		}
+	}
+
+	if tracks == 0 {
+		return nil, fmt.Errorf("%w: no tracks", ErrMalformed)
+	}
+
+	info.Codecs = params.join(info)
+
+	return info, nil
+}
+
+// movieTimescale is read by mvhd, mehd durations are expressed in it as well.
+func movieTimescale(moov []byte) (uint32, error) {
+	mvhd, found, err := child(moov, "mvhd")
+	if err != nil || !found {
+		return 0, err
+	}
+
+	timescale, _, err := mvhdFields(mvhd)
+	return timescale, err
+}
+
+func mvhdFields(data []byte) (timescale uint32, duration uint64, err error) {
+	if len(data) < 4 {
+		return 0, 0, fmt.Errorf("%w: truncated mvhd box", ErrMalformed)
+	}
+
+	switch data[0] {
+	case 0:
+		if len(data) < 20 {
+			return 0, 0, fmt.Errorf("%w: truncated mvhd box", ErrMalformed)
+		}
+		return binary.BigEndian.Uint32(data[12:]), uint64(binary.BigEndian.Uint32(data[16:])), nil
+	case 1:
+		if len(data) < 32 {
+			return 0, 0, fmt.Errorf("%w: truncated mvhd box", ErrMalformed)
+		}
+		return binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint64(data[24:]), nil
+	default:
+		return 0, 0, fmt.Errorf("%w: mvhd version %d", ErrUnsupported, data[0])
+	}
+}
+
+func parseMvhd(data []byte) (int64, error) {
+	timescale, duration, err := mvhdFields(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return milliseconds(duration, timescale), nil
+}
+
+func parseMehd(mvex, moov []byte) (int64, error) {
+	mehd, found, err := child(mvex, "mehd")
+	if err != nil || !found {
+		return 0, err
+	}
+
+	if len(mehd) < 8 {
+		return 0, fmt.Errorf("%w: truncated mehd box", ErrMalformed)
+	}
+
+	duration := uint64(binary.BigEndian.Uint32(mehd[4:]))
+	if mehd[0] == 1 {
+		if len(mehd) < 12 {
+			return 0, fmt.Errorf("%w: truncated mehd box", ErrMalformed)
+		}
+		duration = binary.BigEndian.Uint64(mehd[4:])
+	}
+
+	timescale, err := movieTimescale(moov)
+	if err != nil {
+		return 0, err
+	}
+
+	return milliseconds(duration, timescale), nil
+}
+
+// milliseconds converts a duration in timescale units, a zero timescale or the all ones "unknown"
+// duration give 0.
+func milliseconds(duration uint64, timescale uint32) int64 {
+	if timescale == 0 || duration == 0xffffffff || duration == 0xffffffffffffffff {
+		return 0
+	}
+
+	return int64(duration/uint64(timescale)*1000 + duration%uint64(timescale)*1000/uint64(timescale))
+}
+
+// parseTrak records the codec of the first video and the first audio track, and the dimensions of the
+// video track. Other tracks, like subtitles and timecodes, are ignored.
+func parseTrak(trak []byte, info *Info, params *trackParams) error {
+	hdlr, found, err := child(trak, "mdia", "hdlr")
+	if err != nil || !found {
+		return err
+	}
+
+	if len(hdlr) < 12 {
+		return fmt.Errorf("%w: truncated hdlr box", ErrMalformed)
+	}
+
+	handler := string(hdlr[8:12])
+	if handler != "vide" && handler != "soun" {
+		return nil
+	}
+
+	stsd, found, err := child(trak, "mdia", "minf", "stbl", "stsd")
+	if err != nil {
+		return err
+	}
+	if !found || len(stsd) < 8 {
+		return fmt.Errorf("%w: %s track without sample description", ErrMalformed, handler)
+	}
+
+	entries, err := children(stsd[8:])
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: empty sample description", ErrMalformed)
+	}
+
+	entry := entries[0]
+
+	codec, known := codecs[entry.typ]
+	if !known {
+		codec = strings.TrimSpace(entry.typ)
+	}
+
+	if handler == "soun" {
+		if info.AudioCodec == "" {
+			info.AudioCodec = codec
+			params.audio = audioCodecParam(entry)
+		}
+		return nil
+	}
+
+	if info.VideoCodec != "" {
+		return nil
+	}
+
+	info.VideoCodec = codec
+	params.video = videoCodecParam(entry)
+
+	tkhd, found, err := child(trak, "tkhd")
+	if err != nil {
+		return err
+	}
+	if found {
+		info.Width, info.Height, err = parseTkhd(tkhd)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Some muxers leave the track header dimensions empty, the coded size of the sample entry is used
+	// instead.
+	if (info.Width == 0 || info.Height == 0) && len(entry.data) >= 28 {
+		info.Width = int(binary.BigEndian.Uint16(entry.data[24:]))
+		info.Height = int(binary.BigEndian.Uint16(entry.data[26:]))
+	}
+
+	return nil
+}
+
+// parseTkhd returns the presentation width and height of a track, stored as 16.16 fixed point numbers at
+// the end of the box.
+func parseTkhd(data []byte) (int, int, error) {
+	if len(data) < 4 {
+		return 0, 0, fmt.Errorf("%w: truncated tkhd box", ErrMalformed)
+	}
+
+	offset := 76
+	if data[0] == 1 {
+		offset = 88
+	}
+
+	if len(data) < offset+8 {
+		return 0, 0, fmt.Errorf("%w: truncated tkhd box", ErrMalformed)
+	}
+
+	width := binary.BigEndian.Uint32(data[offset:]) >> 16
+	height := binary.BigEndian.Uint32(data[offset+4:]) >> 16
+
+	return int(width), int(height), nil
+}
+
+// trackParams holds the RFC 6381 codec parameters of the tracks recorded in Info.
+type trackParams struct {
+	video string
+	audio string
+}
+
+// join returns the codecs parameter of the recorded tracks, empty when one of them is unknown.
+func (p trackParams) join(info *Info) string {
+	var codecs []string
+
+	for _, track := range []struct{ codec, param string }{{info.VideoCodec, p.video}, {info.AudioCodec, p.audio}} {
+		if track.codec == "" {
+			continue
+		}
+		if track.param == "" {
+			return ""
+		}
+		codecs = append(codecs, track.param)
+	}
+
+	return strings.Join(codecs, ",")
+}
+
+// visualEntrySize is the size of the fields of a visual sample entry, its child boxes follow.
+const visualEntrySize = 78
+
+// videoCodecParam builds the codecs parameter of an H.264 sample entry from the profile, constraints and
+// level of its avcC box. Other codecs return an empty string.
+func videoCodecParam(entry box) string {
+	if (entry.typ != "avc1" && entry.typ != "avc3") || len(entry.data) < visualEntrySize {
+		return ""
+	}
+
+	avcC, found, err := child(entry.data[visualEntrySize:], "avcC")
+	if err != nil || !found || len(avcC) < 4 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s.%02x%02x%02x", entry.typ, avcC[1], avcC[2], avcC[3])
+}
+
+// audioCodecParam builds the codecs parameter of an audio sample entry. MPEG-4 audio is identified by the
+// object type of its esds box, and the audio object type for AAC.
+func audioCodecParam(entry box) string {
+	switch entry.typ {
+	case "Opus":
+		return "opus"
+	case "fLaC":
+		return "flac"
+	case "ac-3", "ec-3":
+		return entry.typ
+	case "mp4a":
+	default:
+		return ""
+	}
+
+	// The QuickTime sound sample entry versions 1 and 2 carry 16 and 36 more bytes than the ISO one
+	size := 28
+	if len(entry.data) >= 10 {
+		switch binary.BigEndian.Uint16(entry.data[8:]) {
+		case 1:
+			size += 16
+		case 2:
+			size += 36
+		}
+	}
+
+	if len(entry.data) < size {
+		return ""
+	}
+
+	esds, found, err := child(entry.data[size:], "esds")
+	if err != nil || !found || len(esds) < 4 {
+		// QuickTime files may nest esds in a wave box
+		esds, found, err = child(entry.data[size:], "wave", "esds")
+		if err != nil || !found || len(esds) < 4 {
+			return ""
+		}
+	}
+
+	objectType, audioObjectType, ok := parseESDescriptor(esds[4:])
+	if !ok {
+		return ""
+	}
+
+	if objectType == 0x40 && audioObjectType > 0 {
+		return fmt.Sprintf("mp4a.40.%d", audioObjectType)
+	}
+
+	return fmt.Sprintf("mp4a.%02x", objectType)
+}
+
+// parseESDescriptor reads the object type indication of the decoder configuration of an ES descriptor
+// and, when present, the audio object type of its decoder specific info.
+func parseESDescriptor(data []byte) (objectType byte, audioObjectType int, ok bool) {
+	tag, es, _, ok := descriptor(data)
+	if !ok || tag != 0x03 || len(es) < 3 {
+		return 0, 0, false
+	}
+
+	flags := es[2]
+	es = es[3:]
+
+	// Optional fields announced by the flags: the depended on stream id, a URL and the OCR stream id
+	if flags&0x80 != 0 {
+		if len(es) < 2 {
+			return 0, 0, false
+		}
+		es = es[2:]
+	}
+	if flags&0x40 != 0 {
+		if len(es) < 1 || len(es) < 1+int(es[0]) {
+			return 0, 0, false
+		}
+		es = es[1+int(es[0]):]
+	}
+	if flags&0x20 != 0 {
+		if len(es) < 2 {
+			return 0, 0, false
+		}
+		es = es[2:]
+	}
+
+	tag, config, _, ok := descriptor(es)
+	if !ok || tag != 0x04 || len(config) < 13 {
+		return 0, 0, false
+	}
+
+	objectType = config[0]
+
+	tag, specific, _, ok := descriptor(config[13:])
+	if !ok || tag != 0x05 || len(specific) < 1 {
+		return objectType, 0, true
+	}
+
+	audioObjectType = int(specific[0] >> 3)
+	if audioObjectType == 31 && len(specific) >= 2 {
+		audioObjectType = 32 + int(specific[0]&0x07)<<3 | int(specific[1]>>5)
+	}
+
+	return objectType, audioObjectType, true
+}
+
+// descriptor splits an MPEG-4 descriptor into its tag and payload, the size is encoded on up to four
+// bytes of seven bits.
+func descriptor(data []byte) (tag byte, payload, rest []byte, ok bool) {
+	if len(data) < 2 {
+		return 0, nil, nil, false
+	}
+
+	tag = data[0]
+	size := 0
+	i := 1
+
+	for ; i < len(data) && i <= 4; i++ {
+		size = size<<7 | int(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			break
+		}
+	}
+
+	if i >= len(data) || data[i]&0x80 != 0 {
+		return 0, nil, nil, false
+	}
+
+	i++
+	if len(data) < i+size {
+		return 0, nil, nil, false
+	}
+
+	return tag, data[i : i+size], data[i+size:], true
+}
@@ -0,0 +1,195 @@
+package mediaprobe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"os"
+	"testing"
+)
+
+func newBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	b = append(b, typ...)
+
+	return append(b, body...)
+}
+
+func newFullBox(typ string, version byte, payload ...[]byte) []byte {
+	return newBox(typ, append([][]byte{{version, 0, 0, 0}}, payload...)...)
+}
+
+func u32(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func u64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func mvhd(timescale, duration uint32) []byte {
+	return newFullBox("mvhd", 0, u32(0, 0, timescale, duration), make([]byte, 80))
+}
+
+func tkhd(width, height uint32) []byte {
+	return newFullBox("tkhd", 0, u32(0, 0, 1, 0, 0), make([]byte, 52), u32(width<<16, height<<16))
+}
+
+func trak(handler string, entry []byte, header []byte) []byte {
+	hdlr := newFullBox("hdlr", 0, u32(0), []byte(handler), make([]byte, 13))
+	stsd := newFullBox("stsd", 0, u32(1), entry)
+
+	return newBox("trak", header, newBox("mdia", hdlr, newBox("minf", newBox("stbl", stsd))))
+}
+
+// visualEntry is a sample entry with the coded width and height at their offset, followed by children.
+func visualEntry(format string, width, height uint16, children ...[]byte) []byte {
+	b := make([]byte, 78)
+	binary.BigEndian.PutUint16(b[24:], width)
+	binary.BigEndian.PutUint16(b[26:], height)
+	return newBox(format, append([][]byte{b}, children...)...)
+}
+
+func audioEntry(format string, children ...[]byte) []byte {
+	return newBox(format, append([][]byte{make([]byte, 28)}, children...)...)
+}
+
+func avcC(profile, compat, level byte) []byte {
+	return newBox("avcC", []byte{1, profile, compat, level, 0xff, 0xe0, 0})
+}
+
+// esds is an ES descriptor of an objectType stream, with an AAC AudioSpecificConfig of audioObjectType.
+func esds(objectType, audioObjectType byte) []byte {
+	specific := []byte{0x05, 0x02, audioObjectType << 3, 0x10}
+	config := append([]byte{0x04, byte(13 + len(specific)), objectType, 0x15}, make([]byte, 11)...)
+	config = append(config, specific...)
+	// The ES descriptor size uses the four bytes form some muxers write
+	es := append([]byte{0x03, 0x80, 0x80, 0x80, byte(3 + len(config)), 0, 1, 0}, config...)
+	return newFullBox("esds", 0, es)
+}
+
+func TestProbe(t *testing.T) {
+	ftyp := newBox("ftyp", []byte("isom"), u32(512), []byte("isomavc1"))
+	mdat := newBox("mdat", make([]byte, 992))
+	video := trak("vide", visualEntry("hvc1", 0, 0), tkhd(1920, 1080))
+	audio := trak("soun", audioEntry("Opus"), tkhd(0, 0))
+
+	testsMap := []struct {
+		name      string
+		file      []byte
+		wantsErr  error
+		wantsInfo Info
+	}{
+		{
+			name:      "Moov At End",
+			file:      bytes.Join([][]byte{ftyp, mdat, newBox("moov", mvhd(600, 1500), video, audio)}, nil),
+			wantsInfo: Info{Container: "mp4", DurationMs: 2500, Width: 1920, Height: 1080, VideoCodec: "hevc", AudioCodec: "opus"},
+		},
+		{
+			name:      "QuickTime Without Ftyp",
+			file:      bytes.Join([][]byte{newBox("moov", mvhd(1000, 4000), video), mdat}, nil),
+			wantsInfo: Info{Container: "mov", DurationMs: 4000, Width: 1920, Height: 1080, VideoCodec: "hevc"},
+		},
+		{
+			name: "Sample Entry Dimensions",
+			file: bytes.Join([][]byte{ftyp, newBox("moov", mvhd(1000, 1000),
+				trak("vide", visualEntry("av01", 640, 360), tkhd(0, 0)))}, nil),
+			wantsInfo: Info{Container: "mp4", DurationMs: 1000, Width: 640, Height: 360, VideoCodec: "av1"},
+		},
+		{
+			name: "Fragmented Duration",
+			file: bytes.Join([][]byte{ftyp, newBox("moov", mvhd(1000, 0), newBox("mvex", newFullBox("mehd", 1, u64(9000))),
+				trak("vide", visualEntry("avc1", 0, 0), tkhd(320, 240)))}, nil),
+			wantsInfo: Info{Container: "mp4", DurationMs: 9000, Width: 320, Height: 240, VideoCodec: "h264"},
+		},
+		{
+			name: "Codecs Parameter",
+			file: bytes.Join([][]byte{ftyp, newBox("moov", mvhd(1000, 1000),
+				trak("vide", visualEntry("avc1", 0, 0, avcC(0x4d, 0x40, 0x1e)), tkhd(1280, 720)),
+				trak("soun", audioEntry("mp4a", esds(0x40, 5)), tkhd(0, 0)))}, nil),
+			wantsInfo: Info{Container: "mp4", DurationMs: 1000, Width: 1280, Height: 720, VideoCodec: "h264",
+				AudioCodec: "aac", Codecs: "avc1.4d401e,mp4a.40.5"},
+		},
+		{
+			name: "Codecs Parameter Of Opus",
+			file: bytes.Join([][]byte{ftyp, newBox("moov", mvhd(1000, 1000),
+				trak("vide", visualEntry("avc1", 0, 0, avcC(0x64, 0, 0x28)), tkhd(1920, 1080)), audio)}, nil),
+			wantsInfo: Info{Container: "mp4", DurationMs: 1000, Width: 1920, Height: 1080, VideoCodec: "h264",
+				AudioCodec: "opus", Codecs: "avc1.640028,opus"},
+		},
+		{
+			name: "Large Size Box",
+			file: bytes.Join([][]byte{ftyp, u32(1), []byte("mdat"), u64(24), make([]byte, 8),
+				newBox("moov", mvhd(1000, 1000), video)}, nil),
+			wantsInfo: Info{Container: "mp4", DurationMs: 1000, Width: 1920, Height: 1080, VideoCodec: "hevc"},
+		},
+		{
+			name:     "Not An MP4",
+			file:     []byte("RIFF\x00\x00\x00\x00AVI LIST"),
+			wantsErr: ErrUnsupported,
+		},
+		{
+			name:     "No Moov",
+			file:     bytes.Join([][]byte{ftyp, mdat}, nil),
+			wantsErr: ErrMalformed,
+		},
+		{
+			name:     "Truncated",
+			file:     bytes.Join([][]byte{ftyp, newBox("moov", mvhd(1000, 1000), video)}, nil)[:100],
+			wantsErr: ErrMalformed,
+		},
+		{
+			name:     "No Tracks",
+			file:     bytes.Join([][]byte{ftyp, newBox("moov", mvhd(1000, 1000))}, nil),
+			wantsErr: ErrMalformed,
+		},
+		{
+			name:     "Empty",
+			file:     []byte{},
+			wantsErr: ErrMalformed,
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(tt.file), int64(len(tt.file)))
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				assert.Equal(t, IsInvalid(err), true)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			tt.wantsInfo.Bitrate = int64(len(tt.file)) * 8 * 1000 / tt.wantsInfo.DurationMs
+			assert.Equal(t, *info, tt.wantsInfo)
+		})
+	}
+}
+
+func TestProbe_Sample(t *testing.T) {
+	data, err := os.ReadFile("../../tests/testdata/sample.mp4")
+	assert.NilError(t, err)
+
+	info, err := Probe(bytes.NewReader(data), int64(len(data)))
+	assert.NilError(t, err)
+
+	assert.Equal(t, *info, Info{
+		Container:  "mp4",
+		DurationMs: 10000,
+		Width:      1280,
+		Height:     720,
+		VideoCodec: "h264",
+		AudioCodec: "aac",
+		Codecs:     "avc1.64001f,mp4a.40.2",
+		Bitrate:    int64(len(data)) * 8 / 10,
+	})
+}
@@ -0,0 +1,113 @@
+package mediaprobe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path"
+	"strings"
+)
+
+// SniffLen is the number of leading bytes Sniff looks at.
+const SniffLen = 1024
+
+const (
+	MimeMP4       = "video/mp4"
+	MimeQuickTime = "video/quicktime"
+	Mime3GPP      = "video/3gpp"
+	MimeWebM      = "video/webm"
+	MimeMatroska  = "video/x-matroska"
+	MimeMPEGTS    = "video/mp2t"
+)
+
+// extensions lists the file extensions accepted for every detected type. The ISO-BMFF family shares its
+// extensions, muxers routinely write QuickTime brands into .mp4 files and the other way around.
+var extensions = map[string][]string{
+	MimeMP4:       {".mp4", ".m4v", ".mov", ".qt", ".3gp"},
+	MimeQuickTime: {".mp4", ".m4v", ".mov", ".qt", ".3gp"},
+	Mime3GPP:      {".mp4", ".m4v", ".mov", ".qt", ".3gp"},
+	MimeWebM:      {".webm", ".mkv"},
+	MimeMatroska:  {".mkv", ".webm"},
+	MimeMPEGTS:    {".ts", ".m2ts", ".mts"},
+}
+
+// ebmlMagic starts every EBML document, WebM and Matroska files included.
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+// Sniff detects the container of a video from its leading bytes, at most SniffLen are looked at. It
+// returns an empty string for anything that isn't an MP4, QuickTime, WebM, Matroska or MPEG-TS video.
+func Sniff(head []byte) string {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+
+	switch {
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		brand := string(head[8:12])
+		switch {
+		case brand == "qt  ":
+			return MimeQuickTime
+		case strings.HasPrefix(brand, "3g"):
+			return Mime3GPP
+		default:
+			return MimeMP4
+		}
+	case len(head) >= 8 && topLevelBoxes[string(head[4:8])] && binary.BigEndian.Uint32(head) >= 8:
+		// QuickTime files written before ftyp existed start with one of the other top level boxes
+		return MimeQuickTime
+	case bytes.HasPrefix(head, ebmlMagic):
+		// The DocType element, 0x4282, names the flavour of Matroska in the EBML header
+		if i := bytes.Index(head, []byte{0x42, 0x82}); i >= 0 && bytes.HasPrefix(head[i+2:], []byte{0x84, 'w', 'e', 'b', 'm'}) {
+			return MimeWebM
+		}
+		return MimeMatroska
+	case isMPEGTS(head):
+		return MimeMPEGTS
+	}
+
+	return ""
+}
+
+// isMPEGTS looks for the sync byte at the start of three consecutive 188 byte packets, a single one is too
+// common in arbitrary data. Files shorter than that need the sync byte on every packet they hold.
+func isMPEGTS(head []byte) bool {
+	const packetSize = 188
+
+	if len(head) < packetSize {
+		return false
+	}
+
+	for i := 0; i < 3*packetSize && i < len(head); i += packetSize {
+		if head[i] != 0x47 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CanProbe reports whether Probe reads videos of mimeType, an unknown type is assumed to be ISO-BMFF.
+func CanProbe(mimeType string) bool {
+	switch mimeType {
+	case "", MimeMP4, MimeQuickTime, Mime3GPP:
+		return true
+	default:
+		return false
+	}
+}
+
+// MatchesExtension reports whether the extension of filename is one used for videos of mimeType. Files
+// without an extension match any type.
+func MatchesExtension(filename, mimeType string) bool {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == "" {
+		return true
+	}
+
+	for _, allowed := range extensions[mimeType] {
+		if ext == allowed {
+			return true
+		}
+	}
+
+	return false
+}
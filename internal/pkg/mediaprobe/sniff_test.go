@@ -0,0 +1,70 @@
+package mediaprobe
+
+import (
+	"bytes"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"os"
+	"testing"
+)
+
+func tsPackets(n int) []byte {
+	packet := append([]byte{0x47}, make([]byte, 187)...)
+	return bytes.Repeat(packet, n)
+}
+
+func TestSniff(t *testing.T) {
+	sample, err := os.ReadFile("../../tests/testdata/sample.mp4")
+	assert.NilError(t, err)
+
+	ebml := func(docType string) []byte {
+		return append([]byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86, 0x81, 0x01, 0x42, 0x82, 0x84}, docType...)
+	}
+
+	testsMap := []struct {
+		name      string
+		head      []byte
+		wantsMime string
+	}{
+		{name: "MP4", head: sample, wantsMime: MimeMP4},
+		{name: "QuickTime Brand", head: newBox("ftyp", []byte("qt  "), u32(0)), wantsMime: MimeQuickTime},
+		{name: "3GPP Brand", head: newBox("ftyp", []byte("3gp5"), u32(0)), wantsMime: Mime3GPP},
+		{name: "QuickTime Without Ftyp", head: newBox("moov", mvhd(1000, 1000)), wantsMime: MimeQuickTime},
+		{name: "WebM", head: ebml("webm"), wantsMime: MimeWebM},
+		{name: "Matroska", head: ebml("matroska"), wantsMime: MimeMatroska},
+		{name: "MPEG-TS", head: tsPackets(6), wantsMime: MimeMPEGTS},
+		{name: "MPEG-TS Single Packet", head: tsPackets(1), wantsMime: MimeMPEGTS},
+		{name: "MPEG-TS Lost Sync", head: append(tsPackets(1), 0x00), wantsMime: ""},
+		{name: "Sync Byte Only", head: []byte{0x47, 'I', 'F', '8', '9', 'a'}, wantsMime: ""},
+		{name: "PNG", head: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), wantsMime: ""},
+		{name: "Text", head: []byte("definitely not a video"), wantsMime: ""},
+		{name: "Empty", head: []byte{}, wantsMime: ""},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Sniff(tt.head), tt.wantsMime)
+		})
+	}
+}
+
+func TestMatchesExtension(t *testing.T) {
+	testsMap := []struct {
+		name     string
+		filename string
+		mimeType string
+		wants    bool
+	}{
+		{name: "Matching", filename: "holidays.mp4", mimeType: MimeMP4, wants: true},
+		{name: "Upper Case", filename: "HOLIDAYS.MOV", mimeType: MimeQuickTime, wants: true},
+		{name: "Same Family", filename: "holidays.mov", mimeType: MimeMP4, wants: true},
+		{name: "No Extension", filename: "holidays", mimeType: MimeWebM, wants: true},
+		{name: "Different Container", filename: "holidays.mp4", mimeType: MimeWebM, wants: false},
+		{name: "Not A Video", filename: "holidays.exe", mimeType: MimeMP4, wants: false},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, MatchesExtension(tt.filename, tt.mimeType), tt.wants)
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format written by Registry.Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are histogram buckets, in seconds, suited to the latency of API requests.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a family of samples sharing a name, written in the order it was registered.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics of the process and writes them in the Prometheus text format. Hooks run
+// before every scrape so metrics read from elsewhere, like the database, are fresh.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+	hooks   []func(ctx context.Context) error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %q registered twice", name))
+	}
+
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Counter registers a counter, a value that only goes up, with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// Gauge registers a gauge, a value that goes up and down, with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// Histogram registers a histogram counting observations in buckets with the given upper bounds.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+
+	h := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: bounds}
+	r.register(name, h)
+	return h
+}
+
+// CounterFunc registers a counter whose value is read from fn on every scrape.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, kind: "counter", fn: fn})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn on every scrape.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+// OnScrape adds a hook run before the metrics are written. A failing hook is reported by Write, the
+// metrics are still written with the values they had.
+func (r *Registry) OnScrape(fn func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hooks = append(r.hooks, fn)
+}
+
+// Write runs the scrape hooks and writes every metric to w.
+func (r *Registry) Write(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	hooks := append([]func(ctx context.Context) error(nil), r.hooks...)
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	var hookErr error
+
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil && hookErr == nil {
+			hookErr = err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return hookErr
+}
+
+// vec holds the children of a metric family by their label values.
+type vec struct {
+	mu       sync.Mutex
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	children map[string]any
+	values   map[string][]string
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		children: make(map[string]any),
+		values:   make(map[string][]string),
+	}
+}
+
+// child returns the child for the label values, created by newChild on first use.
+func (v *vec) child(values []string, newChild func() any) any {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, exists := v.children[key]
+	if !exists {
+		c = newChild()
+		v.children[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+
+	return c
+}
+
+// Reset drops every child, label combinations that are not set again disappear from the output.
+func (v *vec) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.children = make(map[string]any)
+	v.values = make(map[string][]string)
+}
+
+// sortedKeys returns the keys of the children ordered by label values so the output is stable.
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.kind)
+}
+
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter, negative values are ignored since counters never go down.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.value
+}
+
+type CounterVec struct {
+	vec
+}
+
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.child(values, func() any { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range c.sortedKeys() {
+		writeSample(w, c.name, c.labels, c.values[key], "", "", c.children[key].(*Counter).get())
+	}
+}
+
+type Gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	g.value = value
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.value += delta
+	g.mu.Unlock()
+}
+
+func (g *Gauge) get() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.value
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.child(values, func() any { return &Gauge{} }).(*Gauge)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w)
+	for _, key := range g.sortedKeys() {
+		writeSample(w, g.name, g.labels, g.values[key], "", "", g.children[key].(*Gauge).get())
+	}
+}
+
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe adds a value to the first bucket whose upper bound is not below it.
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.bounds, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += value
+	h.count++
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.child(values, func() any {
+		return &Histogram{bounds: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+// write writes the cumulative bucket counts followed by the sum and count of every child.
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range h.sortedKeys() {
+		child := h.children[key].(*Histogram)
+		values := h.values[key]
+
+		child.mu.Lock()
+
+		var cumulative uint64
+		for i, bound := range child.bounds {
+			cumulative += child.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, values, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, values, "le", "+Inf", float64(child.count))
+		writeSample(w, h.name+"_sum", h.labels, values, "", "", child.sum)
+		writeSample(w, h.name+"_count", h.labels, values, "", "", float64(child.count))
+
+		child.mu.Unlock()
+	}
+}
+
+type funcMetric struct {
+	name string
+	help string
+	kind string
+	fn   func() float64
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, f.name, f.help, f.kind)
+	writeSample(w, f.name, nil, nil, "", "", f.fn())
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpReplacer.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// writeSample writes a sample line, extraName and extraValue add a label after the regular ones, like
+// the le label of histogram buckets.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, labelReplacer.Replace(values[i]))
+		}
+
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraName, extraValue)
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
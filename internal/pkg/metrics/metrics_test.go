@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.Counter("http_requests_total", "Requests served.", "method", "status")
+	requests.With("GET", "200").Inc()
+	requests.With("GET", "200").Add(2)
+	requests.With("POST", "201").Inc()
+
+	jobs := r.Gauge("jobs", "Jobs by status.", "status")
+	jobs.With("pending").Set(4)
+
+	duration := r.Histogram("duration_seconds", "Request duration.", []float64{1, 0.1}, "route")
+	duration.With("/v1/videos").Observe(0.05)
+	duration.With("/v1/videos").Observe(0.5)
+	duration.With("/v1/videos").Observe(3)
+
+	r.GaugeFunc("open_connections", "Open connections.", func() float64 { return 7 })
+
+	var buf bytes.Buffer
+	assert.NilError(t, r.Write(context.Background(), &buf))
+
+	wants := `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",status="200"} 3
+http_requests_total{method="POST",status="201"} 1
+# HELP jobs Jobs by status.
+# TYPE jobs gauge
+jobs{status="pending"} 4
+# HELP duration_seconds Request duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/v1/videos",le="0.1"} 1
+duration_seconds_bucket{route="/v1/videos",le="1"} 2
+duration_seconds_bucket{route="/v1/videos",le="+Inf"} 3
+duration_seconds_sum{route="/v1/videos"} 3.55
+duration_seconds_count{route="/v1/videos"} 3
+# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 7
+`
+
+	assert.Equal(t, buf.String(), wants)
+}
+
+func TestRegistry_OnScrape(t *testing.T) {
+	r := NewRegistry()
+
+	jobs := r.Gauge("jobs", "Jobs by status.", "status")
+	jobs.With("failed").Set(1)
+
+	r.OnScrape(func(ctx context.Context) error {
+		jobs.Reset()
+		jobs.With("done").Set(2)
+		return nil
+	})
+
+	var buf bytes.Buffer
+	assert.NilError(t, r.Write(context.Background(), &buf))
+	assert.Equal(t, buf.String(), "# HELP jobs Jobs by status.\n# TYPE jobs gauge\njobs{status=\"done\"} 2\n")
+
+	hookErr := errors.New("database unavailable")
+	r.OnScrape(func(ctx context.Context) error { return hookErr })
+
+	buf.Reset()
+	assert.Equal(t, errors.Is(r.Write(context.Background(), &buf), hookErr), true)
+	assert.StringContains(t, buf.String(), `jobs{status="done"} 2`)
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+
+	r.Counter("errors_total", "Errors\nby message.", "message").With("bad \"quote\"\n").Inc()
+
+	var buf bytes.Buffer
+	assert.NilError(t, r.Write(context.Background(), &buf))
+	assert.StringContains(t, buf.String(), `# HELP errors_total Errors\nby message.`)
+	assert.StringContains(t, buf.String(), `errors_total{message="bad \"quote\"\n"} 1`)
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps the buckets in process memory, every instance limits its clients on its own.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current *bucket
+	if b, exists := m.buckets[key]; exists {
+		current = &b
+	}
+
+	b, res := take(current, limit, now)
+	m.buckets[key] = b
+
+	return res, nil
+}
+
+func (m *Memory) Evict(ctx context.Context, idleSince time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.buckets {
+		if b.updatedAt.Before(idleSince) {
+			delete(m.buckets, key)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of buckets kept.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.buckets)
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]bucket)}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Postgres keeps the buckets in the rate_limit_buckets table so every instance shares them. The bucket
+// row is locked while a token is taken, concurrent requests of the same client are serialized.
+type Postgres struct {
+	db *sql.DB
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT tokens, updated_at FROM rate_limit_buckets
+			  WHERE key = $1
+			  FOR UPDATE`
+
+	var current *bucket
+	var b bucket
+
+	err = tx.QueryRowContext(dbCtx, query, key).Scan(&b.tokens, &b.updatedAt)
+	switch {
+	case err == nil:
+		current = &b
+	case !errors.Is(err, sql.ErrNoRows):
+		return Result{}, err
+	}
+
+	next, res := take(current, limit, now)
+
+	// Two first requests of a client may both miss the row, the later write wins and the client gets
+	// one extra token once.
+	query = `INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+			 VALUES ($1, $2, $3)
+			 ON CONFLICT (key) DO UPDATE SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at`
+
+	_, err = tx.ExecContext(dbCtx, query, key, next.tokens, next.updatedAt)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+func (p *Postgres) Evict(ctx context.Context, idleSince time.Time) error {
+	query := `DELETE FROM rate_limit_buckets
+			  WHERE updated_at < $1`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := p.db.ExecContext(dbCtx, query, idleSince)
+
+	return err
+}
+
+func newPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
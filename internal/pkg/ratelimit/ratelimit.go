@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrUnknownBackend = errors.New("unknown rate limiter backend")
+
+// Limit is a token bucket refilled at Rate tokens per second that holds at most Burst tokens. Every request
+// takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token. Reset is the time until the bucket is full again and
+// RetryAfter, only set when the request is not allowed, the time until the next token is available.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps a token bucket per key. Stores shared by several instances, like Postgres, limit a client
+// across all of them.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// Evict drops the buckets not used since idleSince, a bucket that was not used for a while is full
+	// again and equivalent to a missing one.
+	Evict(ctx context.Context, idleSince time.Time) error
+}
+
+// bucket is the state of a token bucket at updatedAt.
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take refills the bucket for the time passed since its last update and takes a token when one is
+// available. A nil bucket is a new, full one.
+func take(b *bucket, limit Limit, now time.Time) (bucket, Result) {
+	burst := float64(limit.Burst)
+
+	tokens := burst
+	if b != nil {
+		tokens = b.tokens
+
+		if elapsed := now.Sub(b.updatedAt).Seconds(); elapsed > 0 {
+			tokens = math.Min(burst, tokens+elapsed*limit.Rate)
+		}
+	}
+
+	res := Result{Limit: limit.Burst}
+
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = limit.duration(1 - tokens)
+	}
+
+	res.Remaining = int(tokens)
+	res.Reset = limit.duration(burst - tokens)
+
+	return bucket{tokens: tokens, updatedAt: now}, res
+}
+
+// duration returns the time it takes to refill the given number of tokens.
+func (l Limit) duration(tokens float64) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
+
+// Backends returns the names accepted by New.
+func Backends() []string {
+	return []string{"memory", "postgres"}
+}
+
+// New returns the store of the named backend, db is only used by the postgres backend.
+func New(backend string, db *sql.DB) (Store, error) {
+	switch backend {
+	case "memory":
+		return NewMemory(), nil
+	case "postgres":
+		return newPostgres(db), nil
+	default:
+		return nil, fmt.Errorf("%w %q (available: %v)", ErrUnknownBackend, backend, Backends())
+	}
+}
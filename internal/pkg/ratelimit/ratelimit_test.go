@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	for _, backend := range Backends() {
+		t.Run(backend, func(t *testing.T) {
+			_, err := New(backend, nil)
+			assert.NilError(t, err)
+		})
+	}
+
+	_, err := New("redis", nil)
+	assert.Equal(t, errors.Is(err, ErrUnknownBackend), true)
+}
+
+func TestMemory_Take(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Rate: 2, Burst: 3}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewMemory()
+
+	for i := 2; i >= 0; i-- {
+		res, err := m.Take(ctx, "ip:192.0.2.1", limit, now)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Allowed, true)
+		assert.Equal(t, res.Remaining, i)
+		assert.Equal(t, res.Limit, 3)
+	}
+
+	res, err := m.Take(ctx, "ip:192.0.2.1", limit, now)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, false)
+	assert.Equal(t, res.RetryAfter, 500*time.Millisecond)
+	assert.Equal(t, res.Reset, 1500*time.Millisecond)
+
+	// Other clients have their own bucket
+	res, err = m.Take(ctx, "ip:192.0.2.2", limit, now)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+
+	// A token is refilled every 500ms
+	res, err = m.Take(ctx, "ip:192.0.2.1", limit, now.Add(500*time.Millisecond))
+	assert.NilError(t, err)
+	assert.Equal(t, res.Allowed, true)
+	assert.Equal(t, res.Remaining, 0)
+
+	// The bucket never holds more than the burst
+	res, err = m.Take(ctx, "ip:192.0.2.1", limit, now.Add(time.Hour))
+	assert.NilError(t, err)
+	assert.Equal(t, res.Remaining, 2)
+}
+
+func TestMemory_Evict(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+
+	m := NewMemory()
+
+	_, err := m.Take(ctx, "ip:192.0.2.1", limit, now.Add(-time.Hour))
+	assert.NilError(t, err)
+	_, err = m.Take(ctx, "ip:192.0.2.2", limit, now)
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.Evict(ctx, now.Add(-time.Minute)))
+	assert.Equal(t, m.Len(), 1)
+}
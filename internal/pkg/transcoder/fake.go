@@ -0,0 +1,139 @@
+package transcoder
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Fake writes small deterministic files instead of videos and segments, their content only depends on the
+// source content and the request. It is meant for tests and for local development without ffmpeg.
+type Fake struct {
+	mu       sync.Mutex
+	err      error
+	requests []Request
+}
+
+func (f *Fake) Transcode(ctx context.Context, req Request, progress func(Progress)) (*Result, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	err := f.err
+	f.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := hashFile(req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := req.Rendition.Fit(req.Width, req.Height)
+
+	// Progress is reported at the start, half way and the end of the source
+	if progress != nil {
+		for _, processed := range []time.Duration{0, req.Duration / 2, req.Duration} {
+			progress(Progress{Processed: processed, Percent: percent(processed, req.Duration), Speed: 1})
+		}
+	}
+
+	content := fmt.Sprintf("fake %s %dx%d v=%d a=%d source=%x\n", req.Rendition.Name, width, height,
+		req.Rendition.VideoBitrate, req.Rendition.AudioBitrate, sum)
+
+	err = os.WriteFile(req.Output, []byte(content), 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Width: width, Height: height, Size: int64(len(content))}, nil
+}
+
+// Package writes an init file and one segment per started SegmentDuration of the rendition, the last one
+// holding the remainder. A rendition of unknown duration gets a single segment.
+func (f *Fake) Package(ctx context.Context, req PackageRequest) (*Package, error) {
+	f.mu.Lock()
+	err := f.err
+	f.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := hashFile(req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{Init: "init.mp4"}
+
+	err = os.WriteFile(filepath.Join(req.Dir, pkg.Init), []byte(fmt.Sprintf("fake init %s source=%x\n", req.Track, sum)), 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := 1
+	if req.SegmentDuration > 0 && req.Duration > 0 {
+		segments = int((req.Duration + req.SegmentDuration - 1) / req.SegmentDuration)
+	}
+
+	for i := 0; i < segments; i++ {
+		duration := req.SegmentDuration
+		if i == segments-1 && req.Duration > 0 {
+			duration = req.Duration - time.Duration(i)*req.SegmentDuration
+		}
+
+		segment := Segment{Path: fmt.Sprintf("segment_%05d.m4s", i), Duration: duration}
+
+		err = os.WriteFile(filepath.Join(req.Dir, segment.Path), []byte(fmt.Sprintf("fake segment %d %s %s source=%x\n", i, req.Track, duration, sum)), 0o644)
+		if err != nil {
+			return nil, err
+		}
+
+		pkg.Segments = append(pkg.Segments, segment)
+	}
+
+	return pkg, nil
+}
+
+// Fail makes every following Transcode call return err, nil restores normal behaviour.
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+// Requests returns the requests received so far, oldest first.
+func (f *Fake) Requests() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Request(nil), f.requests...)
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func hashFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,271 @@
+package transcoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/hls"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stderrTail is the number of bytes of ffmpeg's stderr kept for the error of a failed run.
+const stderrTail = 4096
+
+// FFmpeg transcodes by running a locally installed ffmpeg, one process per rendition. Progress is read from
+// the key=value report ffmpeg writes to stdout with -progress.
+type FFmpeg struct {
+	path   string
+	preset string
+}
+
+func NewFFmpeg(cfg Config) (*FFmpeg, error) {
+	name := cfg.FFmpegPath
+	if name == "" {
+		name = "ffmpeg"
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFFmpegNotFound, err)
+	}
+
+	preset := cfg.Preset
+	if preset == "" {
+		preset = "veryfast"
+	}
+
+	return &FFmpeg{path: path, preset: preset}, nil
+}
+
+func (f *FFmpeg) Transcode(ctx context.Context, req Request, progress func(Progress)) (*Result, error) {
+	width, height := req.Rendition.Fit(req.Width, req.Height)
+
+	cmd := exec.CommandContext(ctx, f.path, f.args(req, width, height)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr := &tailBuffer{max: stderrTail}
+	cmd.Stderr = stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	parseProgress(stdout, req.Duration, progress)
+
+	err = cmd.Wait()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("ffmpeg %s: %w: %s", req.Rendition.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	stat, err := os.Stat(req.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Width: width, Height: height, Size: stat.Size()}, nil
+}
+
+// packagePlaylist is the media playlist ffmpeg writes next to the segments, it is only read to list them.
+const packagePlaylist = "ffmpeg.m3u8"
+
+// Package remuxes the rendition, without re-encoding, into fragmented MP4 segments with ffmpeg's HLS muxer.
+// Segments start at keyframes so their duration follows the keyframe interval of the rendition.
+func (f *FFmpeg) Package(ctx context.Context, req PackageRequest) (*Package, error) {
+	cmd := exec.CommandContext(ctx, f.path, f.packageArgs(req)...)
+
+	stderr := &tailBuffer{max: stderrTail}
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("ffmpeg package %s: %w: %s", filepath.Base(req.Input), err, strings.TrimSpace(stderr.String()))
+	}
+
+	playlist, err := os.Open(filepath.Join(req.Dir, packagePlaylist))
+	if err != nil {
+		return nil, err
+	}
+	defer playlist.Close()
+
+	media, err := hls.ParseMediaPlaylist(playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	if media.Map == "" || len(media.Segments) == 0 {
+		return nil, fmt.Errorf("ffmpeg package %s: no segments written", filepath.Base(req.Input))
+	}
+
+	pkg := &Package{Init: filepath.Base(media.Map)}
+
+	for _, s := range media.Segments {
+		pkg.Segments = append(pkg.Segments, Segment{
+			Path:     filepath.Base(s.URI),
+			Duration: time.Duration(s.Duration * float64(time.Second)),
+		})
+	}
+
+	return pkg, nil
+}
+
+// args builds the ffmpeg command line. The output is an MP4 with its moov box first so players, and the
+// probe, can start reading it without seeking to the end.
+func (f *FFmpeg) args(req Request, width, height int) []string {
+	r := req.Rendition
+
+	var keyframes []string
+	if req.KeyframeInterval > 0 {
+		// Scene cut keyframes are disabled so every rendition has the same segment boundaries
+		keyframes = []string{
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%s)", seconds(req.KeyframeInterval)),
+			"-sc_threshold", "0",
+		}
+	}
+
+	return append(append([]string{
+		"-hide_banner", "-nostdin", "-nostats", "-loglevel", "error", "-y",
+		"-i", req.Input,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+		"-c:v", "libx264", "-preset", f.preset, "-profile:v", "high", "-pix_fmt", "yuv420p",
+	}, keyframes...), []string{
+		"-b:v", strconv.FormatInt(r.VideoBitrate, 10),
+		"-maxrate", strconv.FormatInt(r.VideoBitrate, 10),
+		"-bufsize", strconv.FormatInt(2*r.VideoBitrate, 10),
+		"-c:a", "aac", "-b:a", strconv.FormatInt(r.AudioBitrate, 10), "-ac", "2",
+		"-movflags", "+faststart",
+		"-progress", "pipe:1",
+		req.Output,
+	}...)
+}
+
+func (f *FFmpeg) packageArgs(req PackageRequest) []string {
+	streams := "0"
+	switch req.Track {
+	case TrackVideo:
+		streams = "0:v:0"
+	case TrackAudio:
+		streams = "0:a:0"
+	}
+
+	return []string{
+		"-hide_banner", "-nostdin", "-nostats", "-loglevel", "error", "-y",
+		"-i", req.Input,
+		"-map", streams, "-c", "copy",
+		"-f", "hls",
+		"-hls_time", seconds(req.SegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_list_size", "0",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_segment_filename", filepath.Join(req.Dir, "segment_%05d.m4s"),
+		"-hls_flags", "independent_segments",
+		filepath.Join(req.Dir, packagePlaylist),
+	}
+}
+
+// seconds formats d as a number of seconds for ffmpeg options.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// parseProgress reads the blocks of an ffmpeg -progress report, each ending with a progress=continue or
+// progress=end line, and calls fn once per block. The report is drained even when fn is nil so ffmpeg
+// never blocks on a full pipe.
+func parseProgress(r io.Reader, duration time.Duration, fn func(Progress)) {
+	var p Progress
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us":
+			// out_time_ms is in microseconds as well, out_time_us is the unambiguous one
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err == nil && us >= 0 {
+				p.Processed = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+			if err == nil {
+				p.Speed = speed
+			}
+		case "progress":
+			if value == "end" && duration > 0 {
+				p.Processed = duration
+			}
+
+			p.Percent = percent(p.Processed, duration)
+
+			if fn != nil {
+				fn(p)
+			}
+		}
+	}
+
+	io.Copy(io.Discard, r)
+}
+
+func percent(processed, duration time.Duration) float64 {
+	if duration <= 0 {
+		return -1
+	}
+
+	pct := float64(processed) / float64(duration) * 100
+	if pct > 100 {
+		return 100
+	}
+
+	return pct
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf.Write(p)
+
+	if extra := t.buf.Len() - t.max; extra > 0 {
+		t.buf.Next(extra)
+	}
+
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.buf.String()
+}
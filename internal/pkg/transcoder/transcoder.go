@@ -0,0 +1,253 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownBackend = errors.New("unknown transcoder backend")
+	ErrFFmpegNotFound = errors.New("ffmpeg executable not found")
+	ErrInvalidLadder  = errors.New("invalid rendition ladder")
+)
+
+// defaultAudioBitrate is used by ladder renditions that don't set their audio bitrate.
+const defaultAudioBitrate = 128_000
+
+type Config struct {
+	// FFmpeg backend
+	FFmpegPath string
+	Preset     string
+}
+
+// Rendition is one output of the ladder, an H.264 and AAC MP4 fitting in Width x Height. Bitrates are in
+// bits per second.
+type Rendition struct {
+	Name         string
+	Width        int
+	Height       int
+	VideoBitrate int64
+	AudioBitrate int64
+}
+
+// DefaultLadder is the H.264 ladder used when none is configured.
+var DefaultLadder = []Rendition{
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5_000_000, AudioBitrate: 192_000},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2_800_000, AudioBitrate: 128_000},
+	{Name: "480p", Width: 854, Height: 480, VideoBitrate: 1_400_000, AudioBitrate: 128_000},
+}
+
+// Request asks for Input, a local file, to be transcoded into Rendition at Output. The source dimensions
+// and duration are optional, they size the output and scale the progress. A KeyframeInterval forces a
+// keyframe at each of its multiples so the output can be cut into segments of that duration.
+type Request struct {
+	Input            string
+	Output           string
+	Rendition        Rendition
+	Width            int
+	Height           int
+	Duration         time.Duration
+	KeyframeInterval time.Duration
+}
+
+// Result describes a rendition written by a Transcoder.
+type Result struct {
+	Width  int
+	Height int
+	Size   int64
+}
+
+// Progress reports how much of the source has been transcoded. Percent is -1 when the source duration is
+// unknown.
+type Progress struct {
+	Processed time.Duration
+	Percent   float64
+	Speed     float64
+}
+
+// Track selects the streams of a rendition written by Package.
+type Track string
+
+const (
+	// TrackAll keeps the video and audio streams together in the segments, as HLS expects them.
+	TrackAll Track = ""
+	// TrackVideo and TrackAudio write a single stream, DASH keeps every media type in its own segments.
+	TrackVideo Track = "video"
+	TrackAudio Track = "audio"
+)
+
+// PackageRequest asks for Input, a rendition written by Transcode, to be cut into fragmented MP4 segments
+// of about SegmentDuration written to Dir. Duration is the rendition duration, if known.
+type PackageRequest struct {
+	Input           string
+	Dir             string
+	Track           Track
+	SegmentDuration time.Duration
+	Duration        time.Duration
+}
+
+// Package is a rendition cut into segments, Init is its initialization section. Paths are relative to the
+// directory of the request.
+type Package struct {
+	Init     string
+	Segments []Segment
+}
+
+type Segment struct {
+	Path     string
+	Duration time.Duration
+}
+
+// Transcoder turns a source video into a rendition and packages renditions for adaptive streaming.
+// progress may be nil, it is called from the goroutine running Transcode.
+type Transcoder interface {
+	Transcode(ctx context.Context, req Request, progress func(Progress)) (*Result, error)
+	Package(ctx context.Context, req PackageRequest) (*Package, error)
+}
+
+// Backends returns the names accepted by New.
+func Backends() []string {
+	return []string{"fake", "ffmpeg"}
+}
+
+func New(backend string, cfg Config) (Transcoder, error) {
+	switch backend {
+	case "ffmpeg":
+		return NewFFmpeg(cfg)
+	case "fake":
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("%w %q (available: %v)", ErrUnknownBackend, backend, Backends())
+	}
+}
+
+// Fit returns the output dimensions of a width x height source in the rendition. The aspect ratio is kept,
+// sources are never upscaled and both dimensions are even as H.264 with 4:2:0 chroma requires. Unknown
+// source dimensions get the rendition box.
+func (r Rendition) Fit(width, height int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return r.Width, r.Height
+	}
+
+	scale := math.Min(1, math.Min(float64(r.Width)/float64(width), float64(r.Height)/float64(height)))
+
+	return even(float64(width) * scale), even(float64(height) * scale)
+}
+
+func even(v float64) int {
+	n := int(math.Round(v/2)) * 2
+	if n < 2 {
+		return 2
+	}
+	return n
+}
+
+// Select returns the renditions of ladder worth producing for a width x height source, the ones that don't
+// upscale it. A source smaller than every rendition gets the smallest one at its own size. Unknown source
+// dimensions select the whole ladder.
+func Select(ladder []Rendition, width, height int) []Rendition {
+	if width <= 0 || height <= 0 || len(ladder) == 0 {
+		return ladder
+	}
+
+	var selected []Rendition
+	smallest := ladder[0]
+
+	for _, r := range ladder {
+		if r.Height <= height || r.Width <= width {
+			selected = append(selected, r)
+		}
+		if r.Height < smallest.Height {
+			smallest = r
+		}
+	}
+
+	if len(selected) == 0 {
+		selected = append(selected, smallest)
+	}
+
+	return selected
+}
+
+var (
+	renditionRX = regexp.MustCompile(`^([a-z0-9][a-z0-9-]*)=(\d+)x(\d+)@(\d+[kM]?)(?:/(\d+[kM]?))?$`)
+	bitrateRX   = regexp.MustCompile(`^(\d+)([kM]?)$`)
+)
+
+// ParseLadder parses a space separated list of renditions written as name=WIDTHxHEIGHT@VIDEO[/AUDIO],
+// bitrates take an optional k or M suffix, 720p=1280x720@2800k/128k for instance. The audio bitrate
+// defaults to 128k. Renditions are returned from the largest to the smallest.
+func ParseLadder(s string) ([]Rendition, error) {
+	var ladder []Rendition
+	seen := make(map[string]bool)
+
+	for _, field := range strings.Fields(s) {
+		m := renditionRX.FindStringSubmatch(field)
+		if m == nil {
+			return nil, fmt.Errorf("%w: %q is not name=WIDTHxHEIGHT@VIDEO[/AUDIO]", ErrInvalidLadder, field)
+		}
+
+		if seen[m[1]] {
+			return nil, fmt.Errorf("%w: duplicate rendition %q", ErrInvalidLadder, m[1])
+		}
+		seen[m[1]] = true
+
+		r := Rendition{Name: m[1], AudioBitrate: defaultAudioBitrate}
+		r.Width, _ = strconv.Atoi(m[2])
+		r.Height, _ = strconv.Atoi(m[3])
+		r.VideoBitrate = parseBitrate(m[4])
+
+		if m[5] != "" {
+			r.AudioBitrate = parseBitrate(m[5])
+		}
+
+		if r.Width < 2 || r.Height < 2 || r.VideoBitrate <= 0 || r.AudioBitrate <= 0 {
+			return nil, fmt.Errorf("%w: %q has a zero dimension or bitrate", ErrInvalidLadder, field)
+		}
+
+		ladder = append(ladder, r)
+	}
+
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("%w: no renditions", ErrInvalidLadder)
+	}
+
+	sort.SliceStable(ladder, func(i, j int) bool {
+		return ladder[i].Height > ladder[j].Height
+	})
+
+	return ladder, nil
+}
+
+func parseBitrate(s string) int64 {
+	m := bitrateRX.FindStringSubmatch(s)
+
+	n, _ := strconv.ParseInt(m[1], 10, 64)
+
+	switch m[2] {
+	case "k":
+		n *= 1_000
+	case "M":
+		n *= 1_000_000
+	}
+
+	return n
+}
+
+// FormatLadder writes a ladder in the syntax ParseLadder reads.
+func FormatLadder(ladder []Rendition) string {
+	fields := make([]string, len(ladder))
+
+	for i, r := range ladder {
+		fields[i] = fmt.Sprintf("%s=%dx%d@%dk/%dk", r.Name, r.Width, r.Height, r.VideoBitrate/1_000, r.AudioBitrate/1_000)
+	}
+
+	return strings.Join(fields, " ")
+}
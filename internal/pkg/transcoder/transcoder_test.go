@@ -0,0 +1,322 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New("fake", Config{})
+	assert.NilError(t, err)
+
+	_, err = New("ffmpeg", Config{FFmpegPath: filepath.Join(t.TempDir(), "ffmpeg")})
+	assert.Equal(t, errors.Is(err, ErrFFmpegNotFound), true)
+
+	_, err = New("handbrake", Config{})
+	assert.Equal(t, errors.Is(err, ErrUnknownBackend), true)
+}
+
+func TestParseLadder(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		ladder      string
+		wantsLadder []Rendition
+		wantsErr    bool
+	}{
+		{
+			name:   "Sorted Largest First",
+			ladder: "480p=854x480@1400k 1080p=1920x1080@5M/192k",
+			wantsLadder: []Rendition{
+				{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5_000_000, AudioBitrate: 192_000},
+				{Name: "480p", Width: 854, Height: 480, VideoBitrate: 1_400_000, AudioBitrate: 128_000},
+			},
+		},
+		{
+			name:        "Round Trips The Default",
+			ladder:      FormatLadder(DefaultLadder),
+			wantsLadder: DefaultLadder,
+		},
+		{name: "Empty", ladder: " ", wantsErr: true},
+		{name: "Missing Bitrate", ladder: "720p=1280x720", wantsErr: true},
+		{name: "Zero Height", ladder: "720p=1280x0@2800k", wantsErr: true},
+		{name: "Invalid Name", ladder: "../720p=1280x720@2800k", wantsErr: true},
+		{name: "Duplicate Name", ladder: "720p=1280x720@2800k 720p=1280x720@1400k", wantsErr: true},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			ladder, err := ParseLadder(tt.ladder)
+
+			if tt.wantsErr {
+				assert.Equal(t, errors.Is(err, ErrInvalidLadder), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(ladder), len(tt.wantsLadder))
+			for i := range ladder {
+				assert.Equal(t, ladder[i], tt.wantsLadder[i])
+			}
+		})
+	}
+}
+
+func TestRendition_Fit(t *testing.T) {
+	r720 := DefaultLadder[1]
+
+	testsMap := []struct {
+		name          string
+		width, height int
+		wantsWidth    int
+		wantsHeight   int
+	}{
+		{name: "Same Aspect", width: 1920, height: 1080, wantsWidth: 1280, wantsHeight: 720},
+		{name: "Portrait", width: 1080, height: 1920, wantsWidth: 406, wantsHeight: 720},
+		{name: "Wider", width: 2560, height: 1080, wantsWidth: 1280, wantsHeight: 540},
+		{name: "Never Upscales", width: 640, height: 360, wantsWidth: 640, wantsHeight: 360},
+		{name: "Odd Source", width: 641, height: 359, wantsWidth: 642, wantsHeight: 360},
+		{name: "Unknown Source", wantsWidth: 1280, wantsHeight: 720},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height := r720.Fit(tt.width, tt.height)
+			assert.Equal(t, width, tt.wantsWidth)
+			assert.Equal(t, height, tt.wantsHeight)
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	names := func(ladder []Rendition) string {
+		var n []string
+		for _, r := range ladder {
+			n = append(n, r.Name)
+		}
+		return strings.Join(n, " ")
+	}
+
+	assert.Equal(t, names(Select(DefaultLadder, 1920, 1080)), "1080p 720p 480p")
+	assert.Equal(t, names(Select(DefaultLadder, 1280, 720)), "720p 480p")
+	assert.Equal(t, names(Select(DefaultLadder, 720, 1280)), "1080p 720p 480p")
+	assert.Equal(t, names(Select(DefaultLadder, 320, 240)), "480p")
+	assert.Equal(t, names(Select(DefaultLadder, 0, 0)), "1080p 720p 480p")
+}
+
+func TestParseProgress(t *testing.T) {
+	report := strings.Join([]string{
+		"frame=120", "out_time_us=4000000", "out_time=00:00:04.000000", "speed=2.5x", "progress=continue",
+		"frame=240", "out_time_us=N/A", "speed=N/A", "progress=continue",
+		"frame=300", "out_time_us=9800000", "speed=2.4x", "progress=end",
+	}, "\n")
+
+	var got []Progress
+	parseProgress(strings.NewReader(report), 10*time.Second, func(p Progress) {
+		got = append(got, p)
+	})
+
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[0], Progress{Processed: 4 * time.Second, Percent: 40, Speed: 2.5})
+	assert.Equal(t, got[1], Progress{Processed: 4 * time.Second, Percent: 40, Speed: 2.5})
+	assert.Equal(t, got[2], Progress{Processed: 10 * time.Second, Percent: 100, Speed: 2.4})
+
+	got = nil
+	parseProgress(strings.NewReader(report), 0, func(p Progress) {
+		got = append(got, p)
+	})
+
+	assert.Equal(t, got[2].Percent, float64(-1))
+	assert.Equal(t, got[2].Processed, 9800*time.Millisecond)
+}
+
+// stubFFmpeg writes a shell script standing in for ffmpeg. It records its arguments, reports progress and
+// writes its last argument, the output, or fails when the input is named "broken". Asked for HLS it writes
+// a playlist of two segments instead.
+func stubFFmpeg(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ffmpeg")
+
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+for last; do :; done
+case "$*" in *broken*) echo "broken: Invalid data found when processing input" >&2; exit 1;; esac
+case "$*" in *"-f hls"*)
+	dir=$(dirname "$last")
+	printf 'init' > "$dir/init.mp4"
+	printf 'one' > "$dir/segment_00000.m4s"
+	printf 'two' > "$dir/segment_00001.m4s"
+	printf '#EXTM3U\n#EXT-X-MAP:URI="init.mp4"\n#EXTINF:6.000000,\nsegment_00000.m4s\n#EXTINF:1.500000,\nsegment_00001.m4s\n#EXT-X-ENDLIST\n' > "$last"
+	exit 0;;
+esac
+printf 'out_time_us=1000000\nspeed=1.0x\nprogress=continue\nout_time_us=2000000\nspeed=1.0x\nprogress=end\n'
+printf 'rendition' > "$last"
+`
+
+	err := os.WriteFile(path, []byte(script), 0o755)
+	assert.NilError(t, err)
+
+	return path
+}
+
+func TestFFmpeg_Transcode(t *testing.T) {
+	path := stubFFmpeg(t)
+
+	f, err := NewFFmpeg(Config{FFmpegPath: path})
+	assert.NilError(t, err)
+
+	dir := t.TempDir()
+	req := Request{
+		Input:            filepath.Join(dir, "source.mp4"),
+		Output:           filepath.Join(dir, "720p.mp4"),
+		Rendition:        DefaultLadder[1],
+		Width:            1920,
+		Height:           1080,
+		Duration:         2 * time.Second,
+		KeyframeInterval: 6 * time.Second,
+	}
+
+	var percents []float64
+
+	result, err := f.Transcode(context.Background(), req, func(p Progress) {
+		percents = append(percents, p.Percent)
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, *result, Result{Width: 1280, Height: 720, Size: int64(len("rendition"))})
+	assert.Equal(t, len(percents), 2)
+	assert.Equal(t, percents[0], float64(50))
+	assert.Equal(t, percents[1], float64(100))
+
+	args, err := os.ReadFile(filepath.Join(filepath.Dir(path), "args"))
+	assert.NilError(t, err)
+	assert.StringContains(t, string(args), "-vf scale=1280:720")
+	assert.StringContains(t, string(args), "-c:v libx264 -preset veryfast")
+	assert.StringContains(t, string(args), "-b:v 2800000")
+	assert.StringContains(t, string(args), "-movflags +faststart")
+	assert.StringContains(t, string(args), "-force_key_frames expr:gte(t,n_forced*6) -sc_threshold 0")
+
+	req.Input = filepath.Join(dir, "broken.mp4")
+
+	_, err = f.Transcode(context.Background(), req, nil)
+	assert.Error(t, err)
+	assert.StringContains(t, err.Error(), "Invalid data found when processing input")
+}
+
+func TestFFmpeg_Package(t *testing.T) {
+	path := stubFFmpeg(t)
+
+	f, err := NewFFmpeg(Config{FFmpegPath: path})
+	assert.NilError(t, err)
+
+	dir := t.TempDir()
+
+	pkg, err := f.Package(context.Background(), PackageRequest{
+		Input:           filepath.Join(dir, "720p.mp4"),
+		Dir:             dir,
+		SegmentDuration: 6 * time.Second,
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, pkg.Init, "init.mp4")
+	assert.Equal(t, len(pkg.Segments), 2)
+	assert.Equal(t, pkg.Segments[0], Segment{Path: "segment_00000.m4s", Duration: 6 * time.Second})
+	assert.Equal(t, pkg.Segments[1], Segment{Path: "segment_00001.m4s", Duration: 1500 * time.Millisecond})
+
+	args, err := os.ReadFile(filepath.Join(filepath.Dir(path), "args"))
+	assert.NilError(t, err)
+	assert.StringContains(t, string(args), "-map 0 -c copy -f hls -hls_time 6")
+	assert.StringContains(t, string(args), "-hls_segment_type fmp4")
+
+	_, err = f.Package(context.Background(), PackageRequest{Input: filepath.Join(dir, "720p.mp4"), Dir: dir, Track: TrackAudio})
+	assert.NilError(t, err)
+
+	args, err = os.ReadFile(filepath.Join(filepath.Dir(path), "args"))
+	assert.NilError(t, err)
+	assert.StringContains(t, string(args), "-map 0:a:0 -c copy")
+
+	_, err = f.Package(context.Background(), PackageRequest{Input: filepath.Join(dir, "broken.mp4"), Dir: dir})
+	assert.Error(t, err)
+	assert.StringContains(t, err.Error(), "Invalid data found when processing input")
+}
+
+func TestFake_Transcode(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "source.mp4")
+
+	err := os.WriteFile(input, []byte("source"), 0o644)
+	assert.NilError(t, err)
+
+	f := NewFake()
+
+	transcode := func(output string) []byte {
+		var calls int
+
+		result, err := f.Transcode(context.Background(), Request{
+			Input:     input,
+			Output:    output,
+			Rendition: DefaultLadder[2],
+			Width:     1280,
+			Height:    720,
+			Duration:  time.Second,
+		}, func(p Progress) { calls++ })
+		assert.NilError(t, err)
+		assert.Equal(t, result.Width, 854)
+		assert.Equal(t, result.Height, 480)
+		assert.Equal(t, calls, 3)
+
+		content, err := os.ReadFile(output)
+		assert.NilError(t, err)
+		assert.Equal(t, result.Size, int64(len(content)))
+
+		return content
+	}
+
+	first := transcode(filepath.Join(dir, "first.mp4"))
+	second := transcode(filepath.Join(dir, "second.mp4"))
+
+	assert.Equal(t, string(first), string(second))
+	assert.Equal(t, len(f.Requests()), 2)
+
+	f.Fail(errors.New("encoder crashed"))
+
+	_, err = f.Transcode(context.Background(), Request{Input: input, Output: filepath.Join(dir, "third.mp4")}, nil)
+	assert.Error(t, err)
+}
+
+func TestFake_Package(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "720p.mp4")
+
+	err := os.WriteFile(input, []byte("rendition"), 0o644)
+	assert.NilError(t, err)
+
+	f := NewFake()
+
+	pkg, err := f.Package(context.Background(), PackageRequest{
+		Input:           input,
+		Dir:             dir,
+		SegmentDuration: 4 * time.Second,
+		Duration:        10 * time.Second,
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, pkg.Init, "init.mp4")
+	assert.Equal(t, len(pkg.Segments), 3)
+	assert.Equal(t, pkg.Segments[1].Duration, 4*time.Second)
+	assert.Equal(t, pkg.Segments[2], Segment{Path: "segment_00002.m4s", Duration: 2 * time.Second})
+
+	for _, name := range []string{pkg.Init, pkg.Segments[0].Path, pkg.Segments[2].Path} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		assert.NilError(t, err)
+	}
+
+	pkg, err = f.Package(context.Background(), PackageRequest{Input: input, Dir: dir, SegmentDuration: 4 * time.Second})
+	assert.NilError(t, err)
+	assert.Equal(t, len(pkg.Segments), 1)
+}
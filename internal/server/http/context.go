@@ -0,0 +1,66 @@
+package http
+
+import (
+	"context"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	userContextKey        = contextKey("user")
+	permissionsContextKey = contextKey("permissions")
+	requestIDContextKey   = contextKey("request_id")
+)
+
+// contextSetUser returns a copy of the request carrying user.
+func contextSetUser(r *http.Request, user *users.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser returns the user set by the authenticate middleware. Every request passes through it, a
+// missing user is a programming error.
+func contextGetUser(r *http.Request) *users.User {
+	user, ok := r.Context().Value(userContextKey).(*users.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// contextSetPermissions returns a copy of the request carrying the permissions of its user.
+func contextSetPermissions(r *http.Request, permissions users.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions returns the permissions loaded by requirePermission, none when the route doesn't
+// check permissions.
+func contextGetPermissions(r *http.Request) users.Permissions {
+	permissions, _ := r.Context().Value(permissionsContextKey).(users.Permissions)
+	return permissions
+}
+
+// contextGetVideoActor returns the user of the request as the actor of video operations.
+func contextGetVideoActor(r *http.Request) videos.Actor {
+	return videos.Actor{
+		UserID:    contextGetUser(r).ID,
+		Moderator: contextGetPermissions(r).Include(users.PermissionVideosModerate),
+	}
+}
+
+// contextSetRequestID returns a copy of the request carrying its request ID.
+func contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the ID set by the requestID middleware, empty outside of it.
+func contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -13,6 +13,7 @@ type ErrorHandler struct {
 
 func (e *ErrorHandler) logError(r *http.Request, err error) {
 	e.api.Logger.PrintError(err, map[string]string{
+		"request_id":     contextGetRequestID(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
@@ -58,6 +59,82 @@ func (e *ErrorHandler) editConflictResponse(w http.ResponseWriter, r *http.Reque
 	e.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (e *ErrorHandler) goneResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource is no longer available"
+	e.errorResponse(w, r, http.StatusGone, message)
+}
+
+func (e *ErrorHandler) contentTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request content is larger than the server is willing to accept"
+	e.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+func (e *ErrorHandler) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request content type is not supported for this resource"
+	e.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// unsupportedVideoResponse reports content that isn't a supported video, with the validation errors
+// explaining why.
+func (e *ErrorHandler) unsupportedVideoResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	e.errorResponse(w, r, http.StatusUnsupportedMediaType, errors)
+}
+
+func (e *ErrorHandler) tusVersionMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the Tus-Resumable version is not supported"
+	e.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (e *ErrorHandler) uploadOffsetConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the Upload-Offset does not match the current offset of the upload"
+	e.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (e *ErrorHandler) videoNotStreamableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the video is not available for streaming yet"
+	e.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// rangeNotSatisfiableResponse reports the object size in Content-Range when it is known (size >= 0).
+func (e *ErrorHandler) rangeNotSatisfiableResponse(w http.ResponseWriter, r *http.Request, size int64) {
+	if size >= 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	}
+
+	message := "the requested range is not satisfiable, only a single byte range is supported"
+	e.errorResponse(w, r, http.StatusRequestedRangeNotSatisfiable, message)
+}
+
+func (e *ErrorHandler) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource does not match the If-Match precondition"
+	e.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (e *ErrorHandler) videoNotUploadingResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the video is not waiting for a direct upload"
+	e.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (e *ErrorHandler) invalidTransitionResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the video cannot move to the requested status from its current status"
+	e.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (e *ErrorHandler) uploadIncompleteResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the video content has not been uploaded yet"
+	e.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (e *ErrorHandler) invalidSignatureResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the URL signature is invalid or has expired"
+	e.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (e *ErrorHandler) lengthRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the Content-Length header is required"
+	e.errorResponse(w, r, http.StatusLengthRequired, message)
+}
+
 func (e *ErrorHandler) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	e.errorResponse(w, r, http.StatusTooManyRequests, message)
@@ -3,13 +3,25 @@ package http
 import (
 	"github.com/julienschmidt/httprouter"
 	"luismatosgarcia.dev/video-sharing-go/internal/api"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/health"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/ratelimit"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
 	"net/http"
+	"net/netip"
 )
 
 type Handlers struct {
-	api          *api.API
-	httpHelper   *Helper
-	errorHandler *ErrorHandler
+	api            *api.API
+	httpHelper     *Helper
+	errorHandler   *ErrorHandler
+	cfg            *Config
+	limiter        ratelimit.Store
+	trustedProxies []netip.Prefix
+	trustedOrigins []originPattern
+	metrics        *metrics.Registry
+	requestMetrics *requestMetrics
+	checks         []health.Check
 }
 
 func (h *Handlers) routes() http.Handler {
@@ -18,27 +30,61 @@ func (h *Handlers) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(h.errorHandler.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(h.errorHandler.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", h.healthCheckHandler)
+	handle := func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, withRoute(pattern, handler))
+	}
+
+	handle(http.MethodGet, "/metrics", h.metricsHandler)
+
+	// Health Routes, /v1/healthcheck is kept as an alias of the liveness check
+	handle(http.MethodGet, "/v1/healthcheck", h.HealthCheckLive)
+	handle(http.MethodGet, "/v1/healthcheck/live", h.HealthCheckLive)
+	handle(http.MethodGet, "/v1/healthcheck/ready", h.HealthCheckReady)
 
 	// Video Routes
-	router.HandlerFunc(http.MethodPost, "/v1/videos", h.UploadVideo)
-	router.HandlerFunc(http.MethodGet, "/v1/videos/:id", h.ReadVideo)
-	router.HandlerFunc(http.MethodPatch, "/v1/videos/:id", h.UpdateVideo)
+	handle(http.MethodGet, "/v1/videos", h.ListVideos)
+	handle(http.MethodPost, "/v1/videos", h.requirePermission(users.PermissionVideosWrite, h.UploadVideo))
+	handle(http.MethodGet, "/v1/videos/:id", h.ReadVideo)
+	handle(http.MethodPatch, "/v1/videos/:id", h.requirePermission(users.PermissionVideosWrite, h.UpdateVideo))
+	handle(http.MethodDelete, "/v1/videos/:id", h.requirePermission(users.PermissionVideosWrite, h.DeleteVideo))
+	handle(http.MethodPut, "/v1/videos/:id/status", h.requirePermission(users.PermissionVideosWrite, h.UpdateVideoStatus))
+	handle(http.MethodPost, "/v1/videos/:id/restore", h.requirePermission(users.PermissionVideosWrite, h.RestoreVideo))
+	handle(http.MethodGet, "/v1/videos/:id/stream", h.StreamVideo)
+	handle(http.MethodHead, "/v1/videos/:id/stream", h.StreamVideo)
+	handle(http.MethodGet, "/v1/videos/:id/hls/*filepath", h.StreamHLS)
+	handle(http.MethodHead, "/v1/videos/:id/hls/*filepath", h.StreamHLS)
+	handle(http.MethodGet, "/v1/videos/:id/dash/*filepath", h.StreamDASH)
+	handle(http.MethodHead, "/v1/videos/:id/dash/*filepath", h.StreamDASH)
+	handle(http.MethodGet, "/v1/videos/:id/download", h.DownloadVideo)
+	handle(http.MethodPost, "/v1/videos/:id/complete", h.requirePermission(users.PermissionVideosWrite, h.CompleteDirectUpload))
 
-	return router
-}
+	// User Routes
+	handle(http.MethodPost, "/v1/users", h.RegisterUser)
+	handle(http.MethodPut, "/v1/users/activated", h.ActivateUser)
 
-func (h *Handlers) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	env := envelope{
-		"status": "available",
-		"system_info": map[string]string{
-			"environment": "Testing",
-			"version":     "1.0.0",
-		},
-	}
+	// Token Routes
+	handle(http.MethodPost, "/v1/tokens/authentication", h.CreateAuthenticationToken)
 
-	err := h.httpHelper.writeJSON(w, http.StatusOK, env, nil)
-	if err != nil {
-		h.errorHandler.serverErrorResponse(w, r, err)
-	}
+	// Search Routes, kept out of /v1/videos where a static segment would clash with :id
+	handle(http.MethodGet, "/v1/search/videos", h.SearchVideos)
+
+	// Trash Routes
+	handle(http.MethodGet, "/v1/trash/videos", h.requirePermission(users.PermissionVideosRead, h.ListDeletedVideos))
+
+	// Direct Upload Routes
+	handle(http.MethodPost, "/v1/direct-uploads", h.requirePermission(users.PermissionVideosWrite, h.CreateDirectUpload))
+
+	// Signed File Routes, only used by backends without native presigning
+	handle(http.MethodGet, "/v1/files/*key", h.ReadSignedFile)
+	handle(http.MethodHead, "/v1/files/*key", h.ReadSignedFile)
+	handle(http.MethodPut, "/v1/files/*key", h.WriteSignedFile)
+
+	// Resumable Upload Routes (tus 1.0)
+	handle(http.MethodOptions, "/v1/uploads", h.UploadsOptions)
+	handle(http.MethodPost, "/v1/uploads", h.requirePermission(users.PermissionVideosWrite, h.CreateUpload))
+	handle(http.MethodHead, "/v1/uploads/:id", h.requirePermission(users.PermissionVideosWrite, h.ReadUploadOffset))
+	handle(http.MethodPatch, "/v1/uploads/:id", h.requirePermission(users.PermissionVideosWrite, h.WriteUploadChunk))
+	handle(http.MethodDelete, "/v1/uploads/:id", h.requirePermission(users.PermissionVideosWrite, h.TerminateUpload))
+
+	return chain(router, h.requestID, h.accessLog, h.instrument, h.recoverPanic, h.enableCORS, h.rateLimitClient, h.authenticate, h.rateLimitUser)
 }
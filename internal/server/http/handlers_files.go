@@ -0,0 +1,106 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"net/http"
+	"time"
+)
+
+// signedPutTimeout is the time a client has to send the body of a presigned PUT, a whole video.
+const signedPutTimeout = time.Hour
+
+// ReadSignedFile serves an object through a presigned GET URL of a backend without native presigning.
+func (h *Handlers) ReadSignedFile(w http.ResponseWriter, r *http.Request) {
+	key, err := h.httpHelper.readFileKeyParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	err = h.api.VerifySignedFile(r.Method, key, r.URL.Query())
+	if err != nil {
+		h.signedFileErrorResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	info, err := h.api.StatFile(ctx, key)
+	if err != nil {
+		h.signedFileErrorResponse(w, r, err)
+		return
+	}
+
+	h.serveContent(w, r, info, info.ETag, func(offset, length int64) (*filestore.Object, error) {
+		return h.api.ReadFile(r.Context(), key, offset, length)
+	})
+}
+
+// WriteSignedFile stores the request body through a presigned PUT URL of a backend without native
+// presigning. The content type signed into the URL wins over the request header.
+func (h *Handlers) WriteSignedFile(w http.ResponseWriter, r *http.Request) {
+	key, err := h.httpHelper.readFileKeyParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	err = h.api.VerifySignedFile(r.Method, key, query)
+	if err != nil {
+		h.signedFileErrorResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	err = h.api.AcceptSignedWrite(ctx, key)
+	if err != nil {
+		h.signedFileErrorResponse(w, r, err)
+		return
+	}
+
+	if r.ContentLength < 0 {
+		h.errorHandler.lengthRequiredResponse(w, r)
+		return
+	}
+
+	if maxSize := h.api.UploadMaxSize(); maxSize > 0 && r.ContentLength > maxSize {
+		h.errorHandler.contentTooLargeResponse(w, r)
+		return
+	}
+
+	contentType := query.Get("content_type")
+	if contentType == "" {
+		contentType = r.Header.Get("Content-Type")
+	}
+
+	// The body is read, and the response written, past the timeouts of the server, within the time a whole
+	// video takes
+	h.httpHelper.extendDeadlines(w, signedPutTimeout)
+
+	err = h.api.WriteFile(r.Context(), key, r.Body, r.ContentLength, contentType)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) signedFileErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, filestore.ErrInvalidSignature), errors.Is(err, videos.ErrVideoNotUploading):
+		h.errorHandler.invalidSignatureResponse(w, r)
+	case errors.Is(err, filestore.ErrObjectNotFound):
+		h.errorHandler.notFoundResponse(w, r)
+	default:
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/api"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSignedFile(t *testing.T) {
+	key := filestore.VideoKey(1, "source", "video.mp4")
+
+	testsMap := []struct {
+		name        string
+		videosMock  videos.Mock
+		tamper      bool
+		wantsStatus int
+		wantsStored bool
+	}{
+		{name: "Stores Waiting Upload", wantsStatus: http.StatusOK, wantsStored: true},
+		{name: "Expired Once Completed", videosMock: videos.Mock{Err: videos.ErrVideoNotUploading}, wantsStatus: http.StatusForbidden},
+		{name: "Invalid Signature", tamper: true, wantsStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := filestore.NewFileStore("memory", filestore.Config{SigningSecret: "secret", PublicURL: "http://localhost/v1/files"})
+			assert.NilError(t, err)
+
+			a, err := api.NewService(jsonlog.New(io.Discard, jsonlog.LevelOff), &background.RoutineMock{}, fs, tt.videosMock, uploads.Mock{}, users.Mock{})
+			assert.NilError(t, err)
+
+			helper := &Helper{api: a}
+			h := &Handlers{api: a, httpHelper: helper, errorHandler: &ErrorHandler{api: a, httpHelper: helper}, cfg: &Config{}}
+
+			presigned, err := fs.PresignPut(context.Background(), key, "video/mp4", time.Minute)
+			assert.NilError(t, err)
+
+			u, err := url.Parse(presigned.URL)
+			assert.NilError(t, err)
+			if tt.tamper {
+				query := u.Query()
+				query.Set("content_type", "text/html")
+				u.RawQuery = query.Encode()
+			}
+
+			r := httptest.NewRequest(http.MethodPut, u.String(), strings.NewReader("content"))
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "key", Value: "/" + key}}))
+
+			rr := httptest.NewRecorder()
+			h.WriteSignedFile(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantsStatus)
+
+			_, err = fs.Stat(context.Background(), key)
+			assert.Equal(t, err == nil, tt.wantsStored)
+		})
+	}
+}
+
+func TestWriteSignedFile_OutlivesWriteTimeout(t *testing.T) {
+	key := filestore.VideoKey(1, "source", "video.mp4")
+
+	fs, err := filestore.NewFileStore("memory", filestore.Config{SigningSecret: "secret", PublicURL: "http://localhost/v1/files"})
+	assert.NilError(t, err)
+
+	a, err := api.NewService(jsonlog.New(io.Discard, jsonlog.LevelOff), &background.RoutineMock{}, fs, videos.Mock{}, uploads.Mock{}, users.Mock{})
+	assert.NilError(t, err)
+
+	helper := &Helper{api: a}
+	h := &Handlers{api: a, httpHelper: helper, errorHandler: &ErrorHandler{api: a, httpHelper: helper}, cfg: &Config{}}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "key", Value: "/" + key}}))
+		h.WriteSignedFile(w, r)
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	presigned, err := fs.PresignPut(context.Background(), key, "video/mp4", time.Minute)
+	assert.NilError(t, err)
+
+	u, err := url.Parse(presigned.URL)
+	assert.NilError(t, err)
+
+	// The body takes longer to arrive than the server may take to answer
+	r, err := http.NewRequest(http.MethodPut, srv.URL+u.RequestURI(), &slowReader{content: []byte("0123"), delay: 50 * time.Millisecond})
+	assert.NilError(t, err)
+	r.ContentLength = 4
+
+	res, err := srv.Client().Do(r)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/health"
+	"net/http"
+	"time"
+)
+
+// HealthCheckLive reports that the process is up and serving requests, it doesn't touch any dependency so
+// an outage of one doesn't get the process restarted.
+func (h *Handlers) HealthCheckLive(w http.ResponseWriter, r *http.Request) {
+	env := envelope{
+		"status":      "available",
+		"system_info": h.systemInfo(),
+	}
+
+	err := h.httpHelper.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+// HealthCheckReady runs the dependency checks and answers 503 while a critical dependency is down, so the
+// instance is taken out of rotation until it recovers.
+func (h *Handlers) HealthCheckReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	results, ready := health.Run(ctx, h.checks)
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	env := envelope{
+		"status":      status,
+		"checks":      results,
+		"system_info": h.systemInfo(),
+	}
+
+	err := h.httpHelper.writeJSON(w, code, env, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) systemInfo() map[string]string {
+	return map[string]string{
+		"environment": h.cfg.Env,
+		"version":     h.cfg.Version,
+	}
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/health"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthCheckReady(t *testing.T) {
+	up := health.CheckerFunc(func(ctx context.Context) error { return nil })
+	down := health.CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") })
+
+	testsMap := []struct {
+		name        string
+		checks      []health.Check
+		wantsCode   int
+		wantsStatus string
+	}{
+		{name: "Ready", checks: []health.Check{{Name: "database", Checker: up, Critical: true}}, wantsCode: http.StatusOK, wantsStatus: "ready"},
+		{name: "Critical Down", checks: []health.Check{{Name: "database", Checker: down, Critical: true}}, wantsCode: http.StatusServiceUnavailable, wantsStatus: "unavailable"},
+		{name: "Optional Down", checks: []health.Check{{Name: "database", Checker: up, Critical: true}, {Name: "mailer", Checker: down}}, wantsCode: http.StatusOK, wantsStatus: "ready"},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, users.Mock{})
+			h.cfg = &Config{Env: "production", Version: "1.2.3"}
+			h.checks = tt.checks
+
+			rr := httptest.NewRecorder()
+			h.HealthCheckReady(rr, httptest.NewRequest(http.MethodGet, "/v1/healthcheck/ready", nil))
+
+			var body struct {
+				Status     string            `json:"status"`
+				Checks     []health.Result   `json:"checks"`
+				SystemInfo map[string]string `json:"system_info"`
+			}
+
+			assert.Equal(t, rr.Code, tt.wantsCode)
+			assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			assert.Equal(t, body.Status, tt.wantsStatus)
+			assert.Equal(t, len(body.Checks), len(tt.checks))
+			assert.Equal(t, body.SystemInfo["environment"], "production")
+			assert.Equal(t, body.SystemInfo["version"], "1.2.3")
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"net/http"
+	"time"
+)
+
+func (h *Handlers) CreateAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := h.httpHelper.readJSON(w, r, &input)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	token, err, validationErrors := h.api.CreateAuthenticationToken(ctx, input.Email, input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, users.UserValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		case errors.Is(err, users.ErrInvalidCredentials):
+			h.errorHandler.invalidCredentialsResponse(w, r)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"authentication_token": token,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// chunkTimeout is the time a client has to send a chunk of a resumable upload.
+const chunkTimeout = 10 * time.Minute
+
+// UploadsOptions answers tus capability discovery.
+func (h *Handlers) UploadsOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+
+	if maxSize := h.api.UploadMaxSize(); maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload implements the tus creation extension.
+func (h *Handlers) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !h.checkTusResumable(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, errors.New("Upload-Length header must be a non-negative integer"))
+		return
+	}
+
+	metadata, err := h.httpHelper.readUploadMetadata(r)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, err)
+		return
+	}
+
+	if maxSize := h.api.UploadMaxSize(); maxSize > 0 && length > maxSize {
+		h.errorHandler.contentTooLargeResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	upload, err, validationErrors := h.api.CreateUpload(ctx, contextGetUser(r).ID, length, metadata)
+	if err != nil {
+		switch {
+		case errors.Is(err, uploads.UploadValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/uploads/%s", upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ReadUploadOffset lets clients discover where to resume an interrupted upload.
+func (h *Handlers) ReadUploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !h.checkTusResumable(w, r) {
+		return
+	}
+
+	id, err := h.httpHelper.readUploadIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	upload, err, _ := h.api.ReadUpload(ctx, contextGetVideoActor(r), id)
+	if err != nil {
+		h.uploadErrorResponse(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+
+	// The video exists as soon as the last byte arrived, the upload completes once the content reached it
+	if upload.VideoID != 0 {
+		w.Header().Set("Location", fmt.Sprintf("/v1/videos/%d", upload.VideoID))
+	}
+	if !upload.Completed() {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// WriteUploadChunk appends the request body to the upload at Upload-Offset.
+func (h *Handlers) WriteUploadChunk(w http.ResponseWriter, r *http.Request) {
+	if !h.checkTusResumable(w, r) {
+		return
+	}
+
+	id, err := h.httpHelper.readUploadIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != tusChunkType {
+		h.errorHandler.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.errorHandler.badRequestResponse(w, r, errors.New("Upload-Offset header must be a non-negative integer"))
+		return
+	}
+
+	h.httpHelper.extendDeadlines(w, chunkTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), chunkTimeout)
+	defer cancel()
+
+	upload, err, validationErrors := h.api.WriteUploadChunk(ctx, contextGetVideoActor(r), id, offset, r.Body)
+	if err != nil {
+		h.uploadErrorResponse(w, r, err, validationErrors)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+
+	// The video exists as soon as the last byte arrived, the upload completes once the content reached it
+	if upload.VideoID != 0 {
+		w.Header().Set("Location", fmt.Sprintf("/v1/videos/%d", upload.VideoID))
+	}
+	if !upload.Completed() {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TerminateUpload implements the tus termination extension.
+func (h *Handlers) TerminateUpload(w http.ResponseWriter, r *http.Request) {
+	if !h.checkTusResumable(w, r) {
+		return
+	}
+
+	id, err := h.httpHelper.readUploadIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	err, validationErrors := h.api.TerminateUpload(ctx, contextGetVideoActor(r), id)
+	if err != nil {
+		h.uploadErrorResponse(w, r, err, validationErrors)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkTusResumable sets the protocol version on the response and rejects clients speaking another one.
+func (h *Handlers) checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		h.errorHandler.tusVersionMismatchResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handlers) uploadErrorResponse(w http.ResponseWriter, r *http.Request, err error, validationErrors map[string]string) {
+	switch {
+	case errors.Is(err, datastore.ErrRecordNotFound):
+		h.errorHandler.notFoundResponse(w, r)
+	case errors.Is(err, uploads.ErrUploadExpired):
+		h.errorHandler.goneResponse(w, r)
+	case errors.Is(err, uploads.ErrOffsetMismatch), errors.Is(err, uploads.ErrUploadCompleted):
+		h.errorHandler.uploadOffsetConflictResponse(w, r)
+	case errors.Is(err, uploads.ErrUploadTooLarge):
+		h.errorHandler.contentTooLargeResponse(w, r)
+	case errors.Is(err, uploads.UploadValidationError):
+		h.errorHandler.failedValidationResponse(w, r, validationErrors)
+	default:
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
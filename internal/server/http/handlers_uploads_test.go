@@ -0,0 +1,198 @@
+package http
+
+import (
+	"context"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/api"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUploadID = "0123456789abcdef0123456789abcdef"
+
+func newTestUploadHandlers(t *testing.T, u uploads.Uploads) *Handlers {
+	a, err := api.NewService(jsonlog.New(io.Discard, jsonlog.LevelOff), &background.RoutineMock{}, nil, nil, u, users.Mock{})
+	assert.NilError(t, err)
+
+	helper := &Helper{api: a}
+
+	return &Handlers{
+		api:          a,
+		httpHelper:   helper,
+		errorHandler: &ErrorHandler{api: a, httpHelper: helper},
+		cfg:          &Config{},
+	}
+}
+
+// newTusRequest builds a tus request for the test upload, as routed by the router.
+func newTusRequest(method string, headers map[string]string, body string) *http.Request {
+	r := httptest.NewRequest(method, "/v1/uploads/"+testUploadID, strings.NewReader(body))
+
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: testUploadID}})
+	return contextSetUser(r.WithContext(ctx), &users.User{ID: 1, Activated: true})
+}
+
+func TestWriteUploadChunk(t *testing.T) {
+	pending := &uploads.Upload{ID: testUploadID, Length: 10, Offset: 5, ExpiresAt: time.Now().Add(time.Hour)}
+	finished := &uploads.Upload{ID: testUploadID, Length: 10, Offset: 10, VideoID: 7, ExpiresAt: time.Now().Add(time.Hour)}
+	completed := &uploads.Upload{ID: testUploadID, Length: 10, Offset: 10, VideoID: 7, CompletedAt: time.Now()}
+
+	tusHeaders := map[string]string{"Tus-Resumable": tusVersion, "Content-Type": tusChunkType, "Upload-Offset": "0"}
+
+	testsMap := []struct {
+		name        string
+		headers     map[string]string
+		uploadsMock uploads.Mock
+		wantsStatus int
+		wantsHeader map[string]string
+	}{
+		{
+			name:        "Appends Chunk",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Upload: pending},
+			wantsStatus: http.StatusNoContent,
+			wantsHeader: map[string]string{"Upload-Offset": "5", "Tus-Resumable": tusVersion},
+		},
+		{
+			name:        "Last Chunk Points At Video Before It Completes",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Upload: finished},
+			wantsStatus: http.StatusNoContent,
+			wantsHeader: map[string]string{"Upload-Offset": "10", "Location": "/v1/videos/7"},
+		},
+		{
+			name:        "Last Chunk Points At Video",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Upload: completed},
+			wantsStatus: http.StatusNoContent,
+			wantsHeader: map[string]string{"Upload-Offset": "10", "Location": "/v1/videos/7"},
+		},
+		{
+			name:        "Missing Tus-Resumable",
+			headers:     map[string]string{"Content-Type": tusChunkType, "Upload-Offset": "0"},
+			uploadsMock: uploads.Mock{Upload: pending},
+			wantsStatus: http.StatusPreconditionFailed,
+			wantsHeader: map[string]string{"Tus-Version": tusVersion},
+		},
+		{
+			name:        "Wrong Content Type",
+			headers:     map[string]string{"Tus-Resumable": tusVersion, "Content-Type": "video/mp4", "Upload-Offset": "0"},
+			uploadsMock: uploads.Mock{Upload: pending},
+			wantsStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Offset Mismatch",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Err: uploads.ErrOffsetMismatch},
+			wantsStatus: http.StatusConflict,
+		},
+		{
+			name:        "Already Completed",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Err: uploads.ErrUploadCompleted},
+			wantsStatus: http.StatusConflict,
+		},
+		{
+			name:        "Expired",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Err: uploads.ErrUploadExpired},
+			wantsStatus: http.StatusGone,
+		},
+		{
+			name:        "Unknown Upload",
+			headers:     tusHeaders,
+			uploadsMock: uploads.Mock{Err: datastore.ErrRecordNotFound},
+			wantsStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestUploadHandlers(t, tt.uploadsMock)
+
+			rr := httptest.NewRecorder()
+			h.WriteUploadChunk(rr, newTusRequest(http.MethodPatch, tt.headers, "hello"))
+
+			assert.Equal(t, rr.Code, tt.wantsStatus)
+			for k, v := range tt.wantsHeader {
+				assert.Equal(t, rr.Header().Get(k), v)
+			}
+		})
+	}
+}
+
+func TestTerminateUpload(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		headers     map[string]string
+		uploadsMock uploads.Mock
+		wantsStatus int
+	}{
+		{name: "Terminates Upload", headers: map[string]string{"Tus-Resumable": tusVersion}, wantsStatus: http.StatusNoContent},
+		{name: "Missing Tus-Resumable", wantsStatus: http.StatusPreconditionFailed},
+		{name: "Unknown Upload", headers: map[string]string{"Tus-Resumable": tusVersion}, uploadsMock: uploads.Mock{Err: datastore.ErrRecordNotFound}, wantsStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestUploadHandlers(t, tt.uploadsMock)
+
+			rr := httptest.NewRecorder()
+			h.TerminateUpload(rr, newTusRequest(http.MethodDelete, tt.headers, ""))
+
+			assert.Equal(t, rr.Code, tt.wantsStatus)
+		})
+	}
+}
+
+// slowUploads takes delay to store each chunk, like a chunk that is slow to arrive.
+type slowUploads struct {
+	uploads.Mock
+	delay time.Duration
+}
+
+func (s slowUploads) WriteChunk(ctx context.Context, actor videos.Actor, uploadId string, offset int64, body io.Reader) (*uploads.Upload, error, map[string]string) {
+	time.Sleep(s.delay)
+	return s.Mock.WriteChunk(ctx, actor, uploadId, offset, body)
+}
+
+func TestWriteUploadChunk_OutlivesWriteTimeout(t *testing.T) {
+	pending := &uploads.Upload{ID: testUploadID, Length: 10, Offset: 5, ExpiresAt: time.Now().Add(time.Hour)}
+	h := newTestUploadHandlers(t, slowUploads{Mock: uploads.Mock{Upload: pending}, delay: 200 * time.Millisecond})
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: testUploadID}})
+		h.WriteUploadChunk(w, contextSetUser(r.WithContext(ctx), &users.User{ID: 1, Activated: true}))
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	r, err := http.NewRequest(http.MethodPatch, srv.URL, strings.NewReader("hello"))
+	assert.NilError(t, err)
+	r.Header.Set("Tus-Resumable", tusVersion)
+	r.Header.Set("Content-Type", tusChunkType)
+	r.Header.Set("Upload-Offset", "0")
+
+	res, err := srv.Client().Do(r)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, res.StatusCode, http.StatusNoContent)
+	assert.Equal(t, res.Header.Get("Upload-Offset"), "5")
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"net/http"
+	"time"
+)
+
+func (h *Handlers) RegisterUser(w http.ResponseWriter, r *http.Request) {
+	var input users.UserInput
+
+	err := h.httpHelper.readJSON(w, r, &input)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	user, err, validationErrors := h.api.RegisterUser(ctx, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, users.UserValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"user": user,
+	}
+
+	// The activation email is sent by a background job
+	err = h.httpHelper.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := h.httpHelper.readJSON(w, r, &input)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	user, err, validationErrors := h.api.ActivateUser(ctx, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, users.UserValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		case errors.Is(err, datastore.ErrEditConflict):
+			h.errorHandler.editConflictResponse(w, r)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"user": user,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
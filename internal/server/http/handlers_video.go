@@ -1,37 +1,70 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/dash"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/hls"
+	"luismatosgarcia.dev/video-sharing-go/internal/validator"
 	"luismatosgarcia.dev/video-sharing-go/internal/videos"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// multipartOverhead is the room left for the multipart boundaries and headers on top of the maximum
+// video size.
+const multipartOverhead = 1 << 20
+
+// uploadTimeout is the time a client has to send a whole video in a single request, and the time the
+// content then has to reach the filestore.
+const uploadTimeout = time.Hour
+
 func (h *Handlers) UploadVideo(w http.ResponseWriter, r *http.Request) {
+	if maxSize := h.api.UploadMaxSize(); maxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	}
+
+	h.httpHelper.extendDeadlines(w, uploadTimeout)
 
 	err := r.ParseMultipartForm(10 << 20)
 	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			h.errorHandler.contentTooLargeResponse(w, r)
+			return
+		}
 		h.errorHandler.badRequestResponse(w, r, err)
+		return
 	}
 
 	f, fileHeader, err := r.FormFile("video")
 	if err != nil {
 		h.errorHandler.badRequestResponse(w, r, err)
+		return
 	}
+	defer f.Close()
 
 	file := io.Reader(f)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
 	defer cancel()
 
-	videoId, err, validationErrors := h.api.UploadVideo(ctx, &file, fileHeader)
+	videoId, err, validationErrors := h.api.UploadVideo(ctx, contextGetVideoActor(r), &file, fileHeader)
 	if err != nil {
 		switch {
 		case errors.Is(err, videos.VideoValidationError):
 			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		case errors.Is(err, videos.ErrUnsupportedVideo):
+			h.errorHandler.unsupportedVideoResponse(w, r, validationErrors)
+		case errors.Is(err, videos.ErrVideoTooLarge):
+			h.errorHandler.contentTooLargeResponse(w, r)
 		default:
 			h.errorHandler.serverErrorResponse(w, r, err)
 		}
@@ -64,6 +97,8 @@ func (h *Handlers) ReadVideo(w http.ResponseWriter, r *http.Request) {
 	video, err, validationErrors := h.api.ReadVideo(ctx, id)
 	if err != nil {
 		switch {
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			h.errorHandler.notFoundResponse(w, r)
 		case errors.Is(err, videos.VideoValidationError):
 			h.errorHandler.failedValidationResponse(w, r, validationErrors)
 		default:
@@ -82,6 +117,93 @@ func (h *Handlers) ReadVideo(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handlers) ListVideos(w http.ResponseWriter, r *http.Request) {
+	var filters videos.VideoFilters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Title = h.httpHelper.readString(qs, "title", "")
+	filters.Statuses = h.httpHelper.readCSV(qs, "status", []string{})
+	filters.PublishedFrom = h.httpHelper.readTime(qs, "published_from", v)
+	filters.PublishedTo = h.httpHelper.readEndTime(qs, "published_to", v)
+
+	filters.Page = h.httpHelper.readInt(qs, "page", 1, v)
+	filters.PageSize = h.httpHelper.readInt(qs, "page_size", 20, v)
+	filters.Sort = h.httpHelper.readString(qs, "sort", "id")
+
+	if !v.Valid() {
+		h.errorHandler.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	list, metadata, err, validationErrors := h.api.ListVideos(ctx, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, videos.VideoValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"videos":   list,
+		"metadata": metadata,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) SearchVideos(w http.ResponseWriter, r *http.Request) {
+	var filters videos.SearchFilters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Query = h.httpHelper.readString(qs, "q", "")
+
+	filters.Page = h.httpHelper.readInt(qs, "page", 1, v)
+	filters.PageSize = h.httpHelper.readInt(qs, "page_size", 20, v)
+	filters.Sort = h.httpHelper.readString(qs, "sort", "relevance")
+
+	if !v.Valid() {
+		h.errorHandler.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	results, metadata, err, validationErrors := h.api.SearchVideos(ctx, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, videos.VideoValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"results":  results,
+		"metadata": metadata,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
 func (h *Handlers) UpdateVideo(w http.ResponseWriter, r *http.Request) {
 	id, err := h.httpHelper.readIDParam(r)
 	if err != nil {
@@ -100,9 +222,64 @@ func (h *Handlers) UpdateVideo(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
-	video, err, validatorErrors := h.api.UpdateVideo(ctx, id, &input)
+	video, err, validatorErrors := h.api.UpdateVideo(ctx, contextGetVideoActor(r), id, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			h.errorHandler.notFoundResponse(w, r)
+		case errors.Is(err, videos.ErrNotOwner):
+			h.errorHandler.notPermittedResponse(w, r)
+		case errors.Is(err, datastore.ErrEditConflict):
+			h.errorHandler.editConflictResponse(w, r)
+		case errors.Is(err, videos.VideoValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validatorErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"video": video,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) UpdateVideoStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status videos.Status `json:"status"`
+	}
+
+	err = h.httpHelper.readJSON(w, r, &input)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	video, err, validatorErrors := h.api.UpdateVideoStatus(ctx, contextGetVideoActor(r), id, input.Status)
 	if err != nil {
 		switch {
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			h.errorHandler.notFoundResponse(w, r)
+		case errors.Is(err, videos.ErrNotOwner):
+			h.errorHandler.notPermittedResponse(w, r)
+		case errors.Is(err, datastore.ErrEditConflict):
+			h.errorHandler.editConflictResponse(w, r)
+		case errors.Is(err, videos.ErrInvalidTransition):
+			h.errorHandler.invalidTransitionResponse(w, r)
 		case errors.Is(err, videos.VideoValidationError):
 			h.errorHandler.failedValidationResponse(w, r, validatorErrors)
 		default:
@@ -120,3 +297,450 @@ func (h *Handlers) UpdateVideo(w http.ResponseWriter, r *http.Request) {
 		h.errorHandler.serverErrorResponse(w, r, err)
 	}
 }
+
+func (h *Handlers) DeleteVideo(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	err, _ = h.api.DeleteVideo(ctx, contextGetVideoActor(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			h.errorHandler.notFoundResponse(w, r)
+		case errors.Is(err, videos.ErrNotOwner):
+			h.errorHandler.notPermittedResponse(w, r)
+		case errors.Is(err, datastore.ErrEditConflict):
+			h.errorHandler.editConflictResponse(w, r)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "video moved to trash",
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) RestoreVideo(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	video, err, _ := h.api.RestoreVideo(ctx, contextGetVideoActor(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			h.errorHandler.notFoundResponse(w, r)
+		case errors.Is(err, videos.ErrNotOwner):
+			h.errorHandler.notPermittedResponse(w, r)
+		case errors.Is(err, datastore.ErrEditConflict):
+			h.errorHandler.editConflictResponse(w, r)
+		case errors.Is(err, videos.ErrInvalidTransition):
+			h.errorHandler.invalidTransitionResponse(w, r)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"video": video,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) ListDeletedVideos(w http.ResponseWriter, r *http.Request) {
+	var filters datastore.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = h.httpHelper.readInt(qs, "page", 1, v)
+	filters.PageSize = h.httpHelper.readInt(qs, "page_size", 20, v)
+	filters.Sort = h.httpHelper.readString(qs, "sort", "-deleted_date")
+
+	if !v.Valid() {
+		h.errorHandler.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	list, metadata, err, validationErrors := h.api.ListDeletedVideos(ctx, contextGetVideoActor(r), filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, videos.VideoValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"videos":   list,
+		"metadata": metadata,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+// StreamVideo serves the video content with support for single byte ranges and conditional requests so
+// HTML5 players can seek.
+func (h *Handlers) StreamVideo(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	video, info, err, _ := h.api.StatVideoContent(ctx, id)
+	if err != nil {
+		h.streamErrorResponse(w, r, err)
+		return
+	}
+
+	etag := info.ETag
+	if etag == "" {
+		etag = fmt.Sprintf(`"%d-%d-%d"`, video.ID, video.Version, info.Size)
+	}
+
+	// The sniffed type wins over whatever the object was stored with
+	if video.MimeType != "" {
+		sniffed := *info
+		sniffed.ContentType = video.MimeType
+		info = &sniffed
+	}
+
+	// The body is streamed for as long as the client keeps reading, not within the metadata timeout nor
+	// the write timeout of the server
+	h.serveContent(w, r, info, etag, func(offset, length int64) (*filestore.Object, error) {
+		obj, err, _ := h.api.ReadVideoContent(r.Context(), video, offset, length)
+		return obj, err
+	})
+}
+
+// StreamHLS serves the HLS master playlist of a video, generated from its packaged renditions, and the
+// playlists, init sections and segments of the renditions below it.
+func (h *Handlers) StreamHLS(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	name, err := h.httpHelper.readFilepathParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if name == videos.HLSMaster {
+		_, playlist, err, _ := h.api.HLSMasterPlaylist(ctx, id)
+		if err != nil {
+			h.streamErrorResponse(w, r, err)
+			return
+		}
+
+		h.serveBytes(w, r, playlist, hls.ContentType)
+		return
+	}
+
+	video, info, err, _ := h.api.StatHLSFile(ctx, id, name)
+	if err != nil {
+		h.streamErrorResponse(w, r, err)
+		return
+	}
+
+	h.servePackagedFile(w, r, video, info)
+}
+
+// StreamDASH serves the DASH manifest of a video, generated from its packaged renditions, and the init
+// sections and segments of their tracks below it.
+func (h *Handlers) StreamDASH(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	name, err := h.httpHelper.readFilepathParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if name == videos.DASHManifest {
+		_, manifest, err, _ := h.api.DASHManifest(ctx, id)
+		if err != nil {
+			h.streamErrorResponse(w, r, err)
+			return
+		}
+
+		h.serveBytes(w, r, manifest, dash.ContentType)
+		return
+	}
+
+	video, info, err, _ := h.api.StatDASHFile(ctx, id, name)
+	if err != nil {
+		h.streamErrorResponse(w, r, err)
+		return
+	}
+
+	h.servePackagedFile(w, r, video, info)
+}
+
+// servePackagedFile serves a file of the HLS or DASH packaging of a video through serveContent.
+func (h *Handlers) servePackagedFile(w http.ResponseWriter, r *http.Request, video *videos.Video, info *filestore.ObjectInfo) {
+	etag := info.ETag
+	if etag == "" {
+		etag = fmt.Sprintf(`"%d-%d-%d"`, video.ID, info.LastModified.UnixNano(), info.Size)
+	}
+
+	h.serveContent(w, r, info, etag, func(offset, length int64) (*filestore.Object, error) {
+		obj, err, _ := h.api.ReadPackagedFile(r.Context(), video, info.Key, offset, length)
+		return obj, err
+	})
+}
+
+// serveBytes serves content generated by the server through serveContent, its ETag is derived from the
+// content.
+func (h *Handlers) serveBytes(w http.ResponseWriter, r *http.Request, content []byte, contentType string) {
+	sum := sha256.Sum256(content)
+	info := &filestore.ObjectInfo{Size: int64(len(content)), ContentType: contentType}
+
+	h.serveContent(w, r, info, fmt.Sprintf(`"%x"`, sum[:16]), func(offset, length int64) (*filestore.Object, error) {
+		body := io.NopCloser(bytes.NewReader(content[offset : offset+length]))
+		return &filestore.Object{Body: body, Info: *info, Offset: offset, Length: length}, nil
+	})
+}
+
+// serveContent writes an object honouring conditional and single byte Range requests. open is only called
+// when a body has to be sent.
+func (h *Handlers) serveContent(w http.ResponseWriter, r *http.Request, info *filestore.ObjectInfo, etag string, open func(offset, length int64) (*filestore.Object, error)) {
+	var err error
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	if !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if im := r.Header.Get("If-Match"); im != "" && !ifMatchMatches(im, etag) {
+		h.errorHandler.preconditionFailedResponse(w, r)
+		return
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	status := http.StatusOK
+	byteRange := &byteRange{Offset: 0, Length: info.Size}
+
+	if header := r.Header.Get("Range"); header != "" && ifRangeMatches(r.Header.Get("If-Range"), etag, info.LastModified) {
+		requested, err := parseByteRange(header, info.Size)
+		if err != nil {
+			h.errorHandler.rangeNotSatisfiableResponse(w, r, info.Size)
+			return
+		}
+
+		if requested != nil {
+			byteRange = requested
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", byteRange.Offset, byteRange.Offset+byteRange.Length-1, info.Size))
+		}
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(byteRange.Length, 10))
+
+	if r.Method == http.MethodHead || byteRange.Length == 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	obj, err := open(byteRange.Offset, byteRange.Length)
+	if err != nil {
+		w.Header().Del("Content-Range")
+		w.Header().Del("Content-Length")
+		h.streamErrorResponse(w, r, err)
+		return
+	}
+	defer obj.Close()
+
+	h.httpHelper.clearWriteDeadline(w)
+	w.WriteHeader(status)
+
+	_, err = io.Copy(w, obj)
+	if err != nil {
+		h.errorHandler.logError(r, err)
+	}
+}
+
+// CreateDirectUpload creates a video and returns a presigned URL the client uploads the content to
+// directly, the API server never sees the bytes.
+func (h *Handlers) CreateDirectUpload(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+	}
+
+	err := h.httpHelper.readJSON(w, r, &input)
+	if err != nil {
+		h.errorHandler.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	video, presigned, err, validationErrors := h.api.CreateDirectUpload(ctx, contextGetVideoActor(r), input.Filename, input.ContentType)
+	if err != nil {
+		switch {
+		case errors.Is(err, videos.VideoValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"video":  video,
+		"upload": presigned,
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/videos/%d", video.ID))
+
+	err = h.httpHelper.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+// CompleteDirectUpload is called by the client once the upload to the presigned URL finished.
+func (h *Handlers) CompleteDirectUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	video, err, validationErrors := h.api.CompleteDirectUpload(ctx, contextGetVideoActor(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, videos.VideoValidationError):
+			h.errorHandler.failedValidationResponse(w, r, validationErrors)
+		case errors.Is(err, videos.ErrUnsupportedVideo):
+			h.errorHandler.unsupportedVideoResponse(w, r, validationErrors)
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			h.errorHandler.notFoundResponse(w, r)
+		case errors.Is(err, videos.ErrNotOwner):
+			h.errorHandler.notPermittedResponse(w, r)
+		case errors.Is(err, videos.ErrVideoNotUploading):
+			h.errorHandler.videoNotUploadingResponse(w, r)
+		case errors.Is(err, videos.ErrUploadIncomplete):
+			h.errorHandler.uploadIncompleteResponse(w, r)
+		case errors.Is(err, datastore.ErrEditConflict):
+			h.errorHandler.editConflictResponse(w, r)
+		default:
+			h.errorHandler.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"video": video,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+// DownloadVideo returns a presigned URL players can fetch the video content from directly.
+func (h *Handlers) DownloadVideo(w http.ResponseWriter, r *http.Request) {
+	id, err := h.httpHelper.readIDParam(r)
+	if err != nil {
+		h.errorHandler.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	_, presigned, err, _ := h.api.PresignVideoDownload(ctx, id)
+	if err != nil {
+		h.streamErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"download": presigned,
+	}
+
+	err = h.httpHelper.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
+
+func (h *Handlers) streamErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrRecordNotFound), errors.Is(err, filestore.ErrObjectNotFound),
+		errors.Is(err, videos.ErrNotPackaged):
+		h.errorHandler.notFoundResponse(w, r)
+	case errors.Is(err, videos.ErrVideoNotStreamable):
+		h.errorHandler.videoNotStreamableResponse(w, r)
+	case errors.Is(err, filestore.ErrInvalidRange):
+		h.errorHandler.rangeNotSatisfiableResponse(w, r, -1)
+	default:
+		h.errorHandler.serverErrorResponse(w, r, err)
+	}
+}
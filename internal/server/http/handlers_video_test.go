@@ -0,0 +1,217 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/api"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeContent(t *testing.T) {
+	content := []byte("0123456789")
+	lastModified := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	etag := `"abc"`
+
+	testsMap := []struct {
+		name         string
+		headers      map[string]string
+		wantsStatus  int
+		wantsBody    string
+		wantsHeaders map[string]string
+	}{
+		{
+			name:         "Whole Content",
+			wantsStatus:  http.StatusOK,
+			wantsBody:    "0123456789",
+			wantsHeaders: map[string]string{"Content-Length": "10", "Accept-Ranges": "bytes", "ETag": etag},
+		},
+		{
+			name:         "Byte Range",
+			headers:      map[string]string{"Range": "bytes=2-5"},
+			wantsStatus:  http.StatusPartialContent,
+			wantsBody:    "2345",
+			wantsHeaders: map[string]string{"Content-Length": "4", "Content-Range": "bytes 2-5/10"},
+		},
+		{
+			name:         "Suffix Range",
+			headers:      map[string]string{"Range": "bytes=-3"},
+			wantsStatus:  http.StatusPartialContent,
+			wantsBody:    "789",
+			wantsHeaders: map[string]string{"Content-Range": "bytes 7-9/10"},
+		},
+		{
+			name:         "Other Range Unit Is Ignored",
+			headers:      map[string]string{"Range": "items=0-1"},
+			wantsStatus:  http.StatusOK,
+			wantsBody:    "0123456789",
+			wantsHeaders: map[string]string{"Content-Range": ""},
+		},
+		{
+			name:         "Unsatisfiable Range",
+			headers:      map[string]string{"Range": "bytes=20-"},
+			wantsStatus:  http.StatusRequestedRangeNotSatisfiable,
+			wantsHeaders: map[string]string{"Content-Range": "bytes */10"},
+		},
+		{
+			name:         "Multiple Ranges",
+			headers:      map[string]string{"Range": "bytes=0-1,4-5"},
+			wantsStatus:  http.StatusRequestedRangeNotSatisfiable,
+			wantsHeaders: map[string]string{"Content-Range": "bytes */10"},
+		},
+		{
+			name:        "Not Modified",
+			headers:     map[string]string{"If-None-Match": etag},
+			wantsStatus: http.StatusNotModified,
+		},
+		{
+			name:        "Modified",
+			headers:     map[string]string{"If-None-Match": `"def"`},
+			wantsStatus: http.StatusOK,
+			wantsBody:   "0123456789",
+		},
+		{
+			name:        "If-Match Fails",
+			headers:     map[string]string{"If-Match": `"def"`},
+			wantsStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:        "If-Match Holds",
+			headers:     map[string]string{"If-Match": etag, "Range": "bytes=0-0"},
+			wantsStatus: http.StatusPartialContent,
+			wantsBody:   "0",
+		},
+		{
+			name:        "If-Range Matching ETag",
+			headers:     map[string]string{"If-Range": etag, "Range": "bytes=0-1"},
+			wantsStatus: http.StatusPartialContent,
+			wantsBody:   "01",
+		},
+		{
+			name:        "If-Range Matching Date",
+			headers:     map[string]string{"If-Range": lastModified.Format(http.TimeFormat), "Range": "bytes=0-1"},
+			wantsStatus: http.StatusPartialContent,
+			wantsBody:   "01",
+		},
+		{
+			name:         "If-Range Stale Sends Everything",
+			headers:      map[string]string{"If-Range": `"def"`, "Range": "bytes=0-1"},
+			wantsStatus:  http.StatusOK,
+			wantsBody:    "0123456789",
+			wantsHeaders: map[string]string{"Content-Length": "10", "Content-Range": ""},
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, users.Mock{})
+			info := &filestore.ObjectInfo{Size: int64(len(content)), ContentType: "video/mp4", LastModified: lastModified}
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/videos/1/stream", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			rr := httptest.NewRecorder()
+			h.serveContent(rr, r, info, etag, func(offset, length int64) (*filestore.Object, error) {
+				body := io.NopCloser(bytes.NewReader(content[offset : offset+length]))
+				return &filestore.Object{Body: body, Info: *info, Offset: offset, Length: length}, nil
+			})
+
+			assert.Equal(t, rr.Code, tt.wantsStatus)
+			if tt.wantsBody != "" {
+				assert.Equal(t, rr.Body.String(), tt.wantsBody)
+			}
+			for k, v := range tt.wantsHeaders {
+				assert.Equal(t, rr.Header().Get(k), v)
+			}
+		})
+	}
+}
+
+// slowReader hands out its content one byte per delay.
+type slowReader struct {
+	content []byte
+	delay   time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if len(s.content) == 0 {
+		return 0, io.EOF
+	}
+
+	time.Sleep(s.delay)
+	p[0] = s.content[0]
+	s.content = s.content[1:]
+
+	return 1, nil
+}
+
+func TestServeContent_OutlivesWriteTimeout(t *testing.T) {
+	h := newTestHandlers(t, users.Mock{})
+	content := []byte("0123")
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &filestore.ObjectInfo{Size: int64(len(content)), ContentType: "video/mp4"}
+
+		h.serveContent(w, r, info, `"abc"`, func(offset, length int64) (*filestore.Object, error) {
+			body := io.NopCloser(&slowReader{content: content, delay: 50 * time.Millisecond})
+			return &filestore.Object{Body: body, Info: *info, Offset: offset, Length: length}, nil
+		})
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, string(body), "0123")
+}
+
+func TestRestoreVideo(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		err         error
+		wantsStatus int
+	}{
+		{name: "Restores Video", wantsStatus: http.StatusOK},
+		{name: "Unknown Video", err: datastore.ErrRecordNotFound, wantsStatus: http.StatusNotFound},
+		{name: "Other Owner", err: videos.ErrNotOwner, wantsStatus: http.StatusForbidden},
+		{name: "Edit Conflict", err: datastore.ErrEditConflict, wantsStatus: http.StatusConflict},
+		{name: "Not In Trash", err: videos.ErrInvalidTransition, wantsStatus: http.StatusConflict},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := api.NewService(jsonlog.New(io.Discard, jsonlog.LevelOff), &background.RoutineMock{}, nil, videos.Mock{Video: &videos.Video{ID: 1}, Err: tt.err}, nil, users.Mock{})
+			assert.NilError(t, err)
+
+			helper := &Helper{api: a}
+			h := &Handlers{api: a, httpHelper: helper, errorHandler: &ErrorHandler{api: a, httpHelper: helper}, cfg: &Config{}}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/videos/1/restore", nil)
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "1"}}))
+			r = contextSetUser(r, &users.User{ID: 1, Activated: true})
+
+			rr := httptest.NewRecorder()
+			h.RestoreVideo(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantsStatus)
+		})
+	}
+}
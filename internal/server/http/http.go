@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"luismatosgarcia.dev/video-sharing-go/internal/api"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/health"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/ratelimit"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,28 +16,39 @@ import (
 )
 
 type HTTP struct {
-	server *http.Server
-	cfg    *Config
-	api    *api.API
+	server   *http.Server
+	cfg      *Config
+	api      *api.API
+	handlers *Handlers
 }
 
 // TODO: Move config to where ii is being used DB, cache, etc...
 type Config struct {
 	Port    int
 	Env     string
+	Version string
 	Limiter struct {
 		Rps     float64
 		Burst   int
 		Enabled bool
+		// IdleTimeout is the time after which the bucket of a client that sent no request is evicted
+		IdleTimeout time.Duration
 	}
 	Cors struct {
 		TrustedOrigins []string
 	}
+	// TrustedProxies are the addresses and CIDR ranges of the proxies allowed to set X-Forwarded-For
+	TrustedProxies []string
 }
 
 func (h *HTTP) Start() {
 	shutdownError := make(chan error)
 
+	evictCtx, stopEviction := context.WithCancel(context.Background())
+	defer stopEviction()
+
+	go h.handlers.evictRateLimits(evictCtx)
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -81,7 +95,17 @@ func (h *HTTP) Start() {
 	})
 }
 
-func NewService(cfg *Config, a *api.API) (*HTTP, error) {
+func NewService(cfg *Config, a *api.API, limiter ratelimit.Store, reg *metrics.Registry, checks []health.Check) (*HTTP, error) {
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedOrigins, err := parseTrustedOrigins(cfg.Cors.TrustedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
 	helper := &Helper{
 		api: a,
 	}
@@ -92,9 +116,16 @@ func NewService(cfg *Config, a *api.API) (*HTTP, error) {
 	}
 
 	h := &Handlers{
-		api:          a,
-		httpHelper:   helper,
-		errorHandler: errHandler,
+		api:            a,
+		httpHelper:     helper,
+		errorHandler:   errHandler,
+		cfg:            cfg,
+		limiter:        limiter,
+		trustedProxies: trustedProxies,
+		trustedOrigins: trustedOrigins,
+		metrics:        reg,
+		requestMetrics: newRequestMetrics(reg),
+		checks:         checks,
 	}
 
 	httpServer := &http.Server{
@@ -106,9 +137,10 @@ func NewService(cfg *Config, a *api.API) (*HTTP, error) {
 	}
 
 	return &HTTP{
-		server: httpServer,
-		cfg:    cfg,
-		api:    a,
+		server:   httpServer,
+		cfg:      cfg,
+		api:      a,
+		handlers: h,
 	}, nil
 
 }
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	corsAllowedMethods = "OPTIONS, GET, HEAD, POST, PUT, PATCH, DELETE"
+	corsMaxAge         = "3600"
+)
+
+// corsAllowedHeaders are the request headers browsers may send cross origin, the tus headers are needed by
+// resumable upload clients and Range by players seeking through a stream.
+var corsAllowedHeaders = strings.Join([]string{
+	"Authorization",
+	"Content-Type",
+	"Range",
+	"If-Range",
+	"If-None-Match",
+	"Tus-Resumable",
+	"Upload-Length",
+	"Upload-Offset",
+	"Upload-Metadata",
+}, ", ")
+
+// corsExposedHeaders are the response headers scripts of trusted origins may read.
+var corsExposedHeaders = strings.Join([]string{
+	"Location",
+	"Content-Range",
+	"Accept-Ranges",
+	"ETag",
+	"Retry-After",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"Tus-Resumable",
+	"Tus-Version",
+	"Tus-Extension",
+	"Tus-Max-Size",
+	"Upload-Offset",
+	"Upload-Length",
+	"Upload-Expires",
+}, ", ")
+
+// originPattern is a trusted origin. A host starting with "*." matches every subdomain of the rest of the
+// host, at any depth, but not the domain itself.
+type originPattern struct {
+	scheme string
+	host   string
+	port   string
+	suffix bool
+}
+
+// parseTrustedOrigins parses origins like https://example.com, http://localhost:3000 and
+// https://*.example.com.
+func parseTrustedOrigins(origins []string) ([]originPattern, error) {
+	patterns := make([]originPattern, 0, len(origins))
+
+	for _, origin := range origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid trusted origin %q", origin)
+		}
+
+		p := originPattern{
+			scheme: strings.ToLower(u.Scheme),
+			host:   strings.ToLower(u.Hostname()),
+			port:   u.Port(),
+		}
+
+		if strings.HasPrefix(p.host, "*.") {
+			p.host = p.host[1:]
+			p.suffix = true
+		}
+
+		if strings.Contains(p.host, "*") {
+			return nil, fmt.Errorf("invalid trusted origin %q: only a leading \"*.\" wildcard is supported", origin)
+		}
+
+		patterns = append(patterns, p)
+	}
+
+	return patterns, nil
+}
+
+func (p originPattern) matches(u *url.URL) bool {
+	if strings.ToLower(u.Scheme) != p.scheme || u.Port() != p.port {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	if p.suffix {
+		return len(host) > len(p.host) && strings.HasSuffix(host, p.host)
+	}
+
+	return host == p.host
+}
+
+// isTrustedOrigin reports whether the value of an Origin header matches one of the trusted origins.
+func isTrustedOrigin(origin string, trusted []originPattern) bool {
+	if origin == "" || origin == "null" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, p := range trusted {
+		if p.matches(u) {
+			return true
+		}
+	}
+
+	return false
+}
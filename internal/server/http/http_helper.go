@@ -1,17 +1,20 @@
 package http
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io"
 	"luismatosgarcia.dev/video-sharing-go/internal/api"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
 	"luismatosgarcia.dev/video-sharing-go/internal/validator"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
@@ -31,6 +34,91 @@ func (h *Helper) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+func (h *Helper) readUploadIDParam(r *http.Request) (string, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id := params.ByName("id")
+	if !uploads.ValidUploadID(id) {
+		return "", errors.New("invalid upload id parameter")
+	}
+
+	return id, nil
+}
+
+// readFileKeyParam returns the object key of a signed file route, without the leading slash of the
+// catch-all parameter.
+func (h *Helper) readFileKeyParam(r *http.Request) (string, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	key := strings.TrimPrefix(params.ByName("key"), "/")
+	if key == "" {
+		return "", errors.New("invalid file key parameter")
+	}
+
+	return key, nil
+}
+
+// readFilepathParam returns the path below a route ending with a *filepath catch-all, without its leading
+// slash.
+func (h *Helper) readFilepathParam(r *http.Request) (string, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	name := strings.TrimPrefix(params.ByName("filepath"), "/")
+	if name == "" {
+		return "", errors.New("invalid filepath parameter")
+	}
+
+	return name, nil
+}
+
+// readUploadMetadata decodes the tus Upload-Metadata header: comma separated pairs of a key and an
+// optional base64 encoded value.
+func (h *Helper) readUploadMetadata(r *http.Request) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	header := r.Header.Get("Upload-Metadata")
+	if header == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("Upload-Metadata value for key %q is not valid base64", fields[0])
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("Upload-Metadata header is malformed")
+		}
+	}
+
+	return metadata, nil
+}
+
+// extendDeadlines lets the handler read the request body and write its response for up to d, the timeouts
+// of the server only fit small bodies. The write timeout counts from the request headers, it would drop
+// the response of a body that took long to send. Writers without deadlines, like test recorders, keep
+// the server timeouts.
+func (h *Helper) extendDeadlines(w http.ResponseWriter, d time.Duration) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(d)
+
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
+// clearWriteDeadline lets the handler write a response body for as long as the client keeps reading, the
+// write timeout of the server only fits small responses.
+func (h *Helper) clearWriteDeadline(w http.ResponseWriter) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
 func (h *Helper) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -103,6 +191,16 @@ func (h *Helper) readJSON(w http.ResponseWriter, r *http.Request, dst any) error
 	return nil
 }
 
+func (h *Helper) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
 func (h *Helper) readCSV(qs url.Values, key string, defaultValue []string) []string {
 	csv := qs.Get(key)
 
@@ -128,3 +226,45 @@ func (h *Helper) readInt(qs url.Values, key string, defaultValue int, v *validat
 
 	return i
 }
+
+// readTime accepts RFC 3339 timestamps and plain dates, which are read as midnight UTC.
+func (h *Helper) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	t, _ := h.parseTime(qs, key, v)
+
+	return t
+}
+
+// readEndTime reads an inclusive upper bound like readTime, a plain date covers the whole day. The bound is
+// the last microsecond of the day, the precision the database stores timestamps with.
+func (h *Helper) readEndTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	t, dateOnly := h.parseTime(qs, key, v)
+
+	if dateOnly {
+		return t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+
+	return t
+}
+
+// parseTime reads a timestamp or a plain date and reports whether it was a plain date.
+func (h *Helper) parseTime(qs url.Values, key string, v *validator.Validator) (time.Time, bool) {
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, false
+	}
+
+	t, err = time.Parse("2006-01-02", s)
+	if err == nil {
+		return t, true
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+
+	return time.Time{}, false
+}
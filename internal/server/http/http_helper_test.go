@@ -0,0 +1,44 @@
+package http
+
+import (
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/validator"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReadTime(t *testing.T) {
+	testsMap := []struct {
+		name       string
+		value      string
+		end        bool
+		wants      time.Time
+		wantsError bool
+	}{
+		{name: "Empty", value: "", wants: time.Time{}},
+		{name: "Timestamp", value: "2024-05-01T10:30:00Z", wants: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "Date", value: "2024-05-01", wants: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "End Timestamp Is Kept", value: "2024-05-01T10:30:00Z", end: true, wants: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "End Date Covers The Day", value: "2024-05-01", end: true, wants: time.Date(2024, 5, 1, 23, 59, 59, 999999000, time.UTC)},
+		{name: "Invalid", value: "01/05/2024", wantsError: true},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Helper{}
+			v := validator.New()
+			qs := url.Values{"published_to": {tt.value}}
+
+			var got time.Time
+			if tt.end {
+				got = h.readEndTime(qs, "published_to", v)
+			} else {
+				got = h.readTime(qs, "published_to", v)
+			}
+
+			assert.Equal(t, got.Equal(tt.wants), true)
+			assert.Equal(t, v.Valid(), !tt.wantsError)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"context"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const routeContextKey = contextKey("route")
+
+// unmatchedRoute labels the requests no route was registered for, so scanners probing random paths don't
+// create a series per path.
+const unmatchedRoute = "unmatched"
+
+type requestMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newRequestMetrics(reg *metrics.Registry) *requestMetrics {
+	return &requestMetrics{
+		requests: reg.Counter("http_requests_total", "Number of HTTP requests by route and status.",
+			"method", "route", "status"),
+		duration: reg.Histogram("http_request_duration_seconds", "Duration of HTTP requests by route and status.",
+			metrics.DefBuckets, "method", "route", "status"),
+	}
+}
+
+// withRoute records the pattern of the route a request matched in the holder set by the instrument
+// middleware, the router does not expose it.
+func withRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeContextKey).(*string); ok {
+			*route = pattern
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// instrument counts requests and observes their duration by method, route pattern and status.
+func (h *Handlers) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		route := unmatchedRoute
+		r = r.WithContext(context.WithValue(r.Context(), routeContextKey, &route))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		status := strconv.Itoa(rec.status)
+
+		h.requestMetrics.requests.With(r.Method, route, status).Inc()
+		h.requestMetrics.duration.With(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsHandler serves the metrics of the process in the Prometheus text format. A failing scrape hook
+// is logged and the remaining metrics are still served.
+func (h *Handlers) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+
+	err := h.metrics.Write(ctx, w)
+	if err != nil {
+		h.errorHandler.logError(r, err)
+	}
+}
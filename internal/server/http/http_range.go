@@ -0,0 +1,131 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errMultipleRanges     = errors.New("multiple ranges are not supported")
+	errUnsatisfiableRange = errors.New("range not satisfiable")
+)
+
+// byteRange is a single resolved range of Length bytes starting at Offset.
+type byteRange struct {
+	Offset int64
+	Length int64
+}
+
+// parseByteRange resolves a Range header against an object of the given size. Only single byte ranges
+// are supported, "bytes=a-b", "bytes=a-" and the suffix form "bytes=-n". Ranges in other units are
+// ignored as RFC 9110 asks, a nil range without error means the whole object is served.
+func parseByteRange(header string, size int64) (*byteRange, error) {
+	unit, spec, found := strings.Cut(header, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+
+	spec = strings.TrimSpace(spec)
+	if strings.Contains(spec, ",") {
+		return nil, errMultipleRanges
+	}
+
+	start, end, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, errUnsatisfiableRange
+	}
+
+	start = strings.TrimSpace(start)
+	end = strings.TrimSpace(end)
+
+	if start == "" {
+		// Suffix range, the last n bytes
+		n, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return nil, errUnsatisfiableRange
+		}
+
+		if n > size {
+			n = size
+		}
+
+		return &byteRange{Offset: size - n, Length: n}, nil
+	}
+
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || offset < 0 || offset >= size {
+		return nil, errUnsatisfiableRange
+	}
+
+	if end == "" {
+		return &byteRange{Offset: offset, Length: size - offset}, nil
+	}
+
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil || last < offset {
+		return nil, errUnsatisfiableRange
+	}
+
+	if last >= size {
+		last = size - 1
+	}
+
+	return &byteRange{Offset: offset, Length: last - offset + 1}, nil
+}
+
+// etagMatches reports whether any entity tag in an If-None-Match style list matches etag using the weak
+// comparison function.
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchMatches evaluates an If-Match precondition, entity tags use the strong comparison function.
+func ifMatchMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifRangeMatches evaluates an If-Range precondition. Entity tags use the strong comparison function so
+// weak tags never match, dates must equal the last modification time.
+func ifRangeMatches(header, etag string, lastModified time.Time) bool {
+	if header == "" {
+		return true
+	}
+
+	if strings.HasPrefix(header, `"`) {
+		return header == etag && !strings.HasPrefix(etag, "W/")
+	}
+
+	t, err := http.ParseTime(header)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+
+	return lastModified.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseByteRange(t *testing.T) {
+	testsMap := []struct {
+		name    string
+		header  string
+		size    int64
+		wants   byteRange
+		wantErr error
+	}{
+		{name: "Closed Range", header: "bytes=0-99", size: 1000, wants: byteRange{Offset: 0, Length: 100}},
+		{name: "Open Range", header: "bytes=900-", size: 1000, wants: byteRange{Offset: 900, Length: 100}},
+		{name: "Suffix Range", header: "bytes=-100", size: 1000, wants: byteRange{Offset: 900, Length: 100}},
+		{name: "Suffix Larger Than Size", header: "bytes=-5000", size: 1000, wants: byteRange{Offset: 0, Length: 1000}},
+		{name: "End Clamped To Size", header: "bytes=500-5000", size: 1000, wants: byteRange{Offset: 500, Length: 500}},
+		{name: "Multiple Ranges", header: "bytes=0-1,5-6", size: 1000, wantErr: errMultipleRanges},
+		{name: "Start Past End", header: "bytes=1000-", size: 1000, wantErr: errUnsatisfiableRange},
+		{name: "End Before Start", header: "bytes=10-5", size: 1000, wantErr: errUnsatisfiableRange},
+		{name: "Unit Is Case Insensitive", header: "Bytes=0-99", size: 1000, wants: byteRange{Offset: 0, Length: 100}},
+		{name: "Empty Suffix", header: "bytes=-0", size: 1000, wantErr: errUnsatisfiableRange},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseByteRange(tt.header, tt.size)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantErr), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, *r, tt.wants)
+		})
+	}
+}
+
+func TestParseByteRange_OtherUnits(t *testing.T) {
+	for _, header := range []string{"items=0-5", "0-5"} {
+		r, err := parseByteRange(header, 1000)
+
+		assert.NilError(t, err)
+		assert.Equal(t, r == nil, true)
+	}
+}
+
+func TestConditionalHeaders(t *testing.T) {
+	lastModified := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, etagMatches(`"abc"`, `"abc"`), true)
+	assert.Equal(t, etagMatches(`W/"abc", "def"`, `"abc"`), true)
+	assert.Equal(t, etagMatches(`"def"`, `"abc"`), false)
+	assert.Equal(t, etagMatches(`*`, `"abc"`), true)
+
+	assert.Equal(t, ifMatchMatches(`"abc"`, `"abc"`), true)
+	assert.Equal(t, ifMatchMatches(`"def", "abc"`, `"abc"`), true)
+	assert.Equal(t, ifMatchMatches(`"def"`, `"abc"`), false)
+	assert.Equal(t, ifMatchMatches(`W/"abc"`, `W/"abc"`), false)
+	assert.Equal(t, ifMatchMatches(`*`, `"abc"`), true)
+
+	assert.Equal(t, ifRangeMatches("", `"abc"`, lastModified), true)
+	assert.Equal(t, ifRangeMatches(`"abc"`, `"abc"`, lastModified), true)
+	assert.Equal(t, ifRangeMatches(`"def"`, `"abc"`, lastModified), false)
+	assert.Equal(t, ifRangeMatches(`W/"abc"`, `W/"abc"`, lastModified), false)
+	assert.Equal(t, ifRangeMatches(lastModified.Format(http.TimeFormat), `"abc"`, lastModified), true)
+	assert.Equal(t, ifRangeMatches(lastModified.Add(time.Hour).Format(http.TimeFormat), `"abc"`, lastModified), false)
+}
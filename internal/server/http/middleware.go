@@ -0,0 +1,345 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/ratelimit"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in the middlewares, the first one is the outermost and sees the request first.
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+// recoverPanic turns a panic in a handler into a 500 response and closes the connection. Panics with
+// http.ErrAbortHandler are left to the server, they abort the response on purpose.
+func (h *Handlers) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				w.Header().Set("Connection", "close")
+				h.errorHandler.serverErrorResponse(w, r, fmt.Errorf("%v", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxRequestIDLength bounds the X-Request-ID accepted from clients and proxies.
+const maxRequestIDLength = 128
+
+// requestID keeps the X-Request-ID of the request, or generates one, and echoes it in the response so
+// the log entries of a request can be correlated across services.
+func (h *Handlers) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+
+		if !validRequestID(requestID) {
+			b := make([]byte, 16)
+
+			_, err := rand.Read(b)
+			if err != nil {
+				h.errorHandler.serverErrorResponse(w, r, err)
+				return
+			}
+
+			requestID = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+
+		next.ServeHTTP(w, contextSetRequestID(r, requestID))
+	})
+}
+
+// validRequestID only accepts IDs made of printable ASCII without spaces so they can't forge log lines.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] <= ' ' || requestID[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusRecorder records the status and the number of bytes of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// accessLog writes a log entry for every request once its response has been written.
+func (h *Handlers) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		h.api.Logger.PrintInfo("request", map[string]string{
+			"request_id":     contextGetRequestID(r),
+			"request_method": r.Method,
+			"request_path":   r.URL.Path,
+			"remote_addr":    clientIP(r, h.trustedProxies),
+			"status":         strconv.Itoa(rec.status),
+			"bytes":          strconv.FormatInt(rec.bytes, 10),
+			"duration":       time.Since(start).String(),
+		})
+	})
+}
+
+// authenticate resolves the bearer token of the Authorization header into the user of the request.
+// Requests without the header continue as the anonymous user, a malformed, unknown or expired token is
+// rejected.
+func (h *Handlers) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			next.ServeHTTP(w, contextSetUser(r, users.AnonymousUser))
+			return
+		}
+
+		scheme, token, found := strings.Cut(authorizationHeader, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			h.errorHandler.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		user, err, _ := h.api.AuthenticateToken(ctx, strings.TrimSpace(token))
+		if err != nil {
+			switch {
+			case errors.Is(err, users.ErrInvalidToken):
+				h.errorHandler.invalidAuthenticationTokenResponse(w, r)
+			default:
+				h.errorHandler.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, contextSetUser(r, user))
+	})
+}
+
+func (h *Handlers) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contextGetUser(r).IsAnonymous() {
+			h.errorHandler.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (h *Handlers) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !contextGetUser(r).Activated {
+			h.errorHandler.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return h.requireAuthenticatedUser(fn)
+}
+
+// requirePermission only lets activated users holding the permission code through. The permissions are
+// loaded once per request and kept in the request context.
+func (h *Handlers) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := contextGetUser(r)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		permissions, err, _ := h.api.ReadPermissions(ctx, user.ID)
+		if err != nil {
+			h.errorHandler.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			h.errorHandler.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, contextSetPermissions(r, permissions))
+	}
+
+	return h.requireActivatedUser(fn)
+}
+
+// rateLimitClient takes a token from the bucket of the client IP address for every request. It runs before
+// authenticate, so clients guessing tokens are throttled before the token lookup like anyone else.
+func (h *Handlers) rateLimitClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.rateLimit(w, r, "ip:"+clientIP(r, h.trustedProxies), next)
+	})
+}
+
+// rateLimitUser takes a token from the bucket of the authenticated user, wherever they connect from.
+// Anonymous requests were already limited by rateLimitClient.
+func (h *Handlers) rateLimitUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contextGetUser(r)
+		if user.IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.rateLimit(w, r, "user:"+strconv.FormatInt(user.ID, 10), next)
+	})
+}
+
+// rateLimit takes a token from the bucket under key and only calls next when one was left. The RateLimit-*
+// headers tell clients how many requests they have left, a limiter failure lets the request through.
+func (h *Handlers) rateLimit(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	if !h.cfg.Limiter.Enabled {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	limit := ratelimit.Limit{Rate: h.cfg.Limiter.Rps, Burst: h.cfg.Limiter.Burst}
+
+	res, err := h.limiter.Take(r.Context(), key, limit, time.Now())
+	if err != nil {
+		h.errorHandler.logError(r, err)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+
+	if !res.Allowed {
+		w.Header().Set("Retry-After", seconds(res.RetryAfter))
+		h.errorHandler.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// seconds formats d as a whole number of seconds, rounded up so clients don't retry too early.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// evictRateLimits drops the buckets of clients that have been idle for the limiter idle timeout until
+// ctx is done.
+func (h *Handlers) evictRateLimits(ctx context.Context) {
+	if !h.cfg.Limiter.Enabled || h.cfg.Limiter.IdleTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := h.limiter.Evict(ctx, time.Now().Add(-h.cfg.Limiter.IdleTimeout))
+			if err != nil && ctx.Err() == nil {
+				h.api.Logger.PrintError(err, map[string]string{"task": "evict rate limits"})
+			}
+		}
+	}
+}
+
+// enableCORS lets the scripts of trusted origins call the API. Preflight requests of trusted origins are
+// answered here, everything else, including OPTIONS requests without Access-Control-Request-Method like
+// tus capability discovery, goes on to the router.
+func (h *Handlers) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if isTrustedOrigin(origin, h.trustedOrigins) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,17 +1,123 @@
 SET TIME ZONE 'UTC';
 
+create table if not exists blobs (
+                                     sha256 text primary key,
+                                     storage_key text not null unique,
+                                     size bigint not null,
+                                     ref_count integer not null default 0,
+                                     created_at timestamp(0) with time zone not null default now(),
+                                     updated_at timestamp(0) with time zone not null default now()
+);
+
 create table if not exists videos (
                                       id bigserial primary key,
                                       title text,
                                       description text,
                                       video_path text,
                                       thumbnail_path text,
-                                      status text not null,
+                                      status text not null check (status in ('uploading', 'processing', 'ready', 'failed', 'published', 'archived', 'deleted')),
+                                      failure_reason text,
                                       published_at timestamp(0) with time zone,
                                       created_at timestamp(0) with time zone not null default now(),
                                       updated_at timestamp(0) with time zone not null default now(),
-                                      version integer not null default 1
+                                      version integer not null default 1,
+                                      content_sha256 text references blobs (sha256),
+                                      deleted_at timestamp(0) with time zone,
+                                      search_vector tsvector generated always as (
+                                          setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+                                          setweight(to_tsvector('english', coalesce(description, '')), 'B')
+                                      ) stored
+);
+
+create index if not exists videos_search_vector_idx on videos using gin (search_vector);
+
+create table if not exists video_status_history (
+                                                    id bigserial primary key,
+                                                    video_id bigint not null references videos (id) on delete cascade,
+                                                    from_status text,
+                                                    to_status text not null,
+                                                    actor text not null,
+                                                    reason text,
+                                                    created_at timestamp(0) with time zone not null default now()
+);
+
+create table if not exists jobs (
+                                    id bigserial primary key,
+                                    kind text not null,
+                                    payload jsonb not null default '{}',
+                                    status text not null default 'pending',
+                                    attempts integer not null default 0,
+                                    max_attempts integer not null default 5,
+                                    run_at timestamp(0) with time zone not null default now(),
+                                    locked_at timestamp(0) with time zone,
+                                    last_error text,
+                                    created_at timestamp(0) with time zone not null default now(),
+                                    updated_at timestamp(0) with time zone not null default now()
+);
+
+create extension if not exists citext;
+
+create table if not exists users (
+                                     id bigserial primary key,
+                                     created_at timestamp(0) with time zone not null default now(),
+                                     name text not null,
+                                     email citext unique not null,
+                                     password_hash bytea not null,
+                                     activated bool not null,
+                                     version integer not null default 1
+);
+
+create table if not exists tokens (
+                                      hash bytea primary key,
+                                      user_id bigint not null references users (id) on delete cascade,
+                                      expiry timestamp(0) with time zone not null,
+                                      scope text not null
+);
+
+create table if not exists permissions (
+                                           id bigserial primary key,
+                                           code text unique not null
+);
+
+create table if not exists users_permissions (
+                                                 user_id bigint not null references users (id) on delete cascade,
+                                                 permission_id bigint not null references permissions (id) on delete cascade,
+                                                 primary key (user_id, permission_id)
+);
+
+insert into permissions (code) values ('videos:read'), ('videos:write'), ('videos:moderate');
+
+alter table videos add column if not exists owner_id bigint references users (id) on delete set null;
+
+alter table videos add column if not exists duration_ms bigint;
+alter table videos add column if not exists width integer;
+alter table videos add column if not exists height integer;
+alter table videos add column if not exists video_codec text;
+alter table videos add column if not exists audio_codec text;
+alter table videos add column if not exists bitrate bigint;
+alter table videos add column if not exists container text;
+alter table videos add column if not exists mime_type text;
+
+create table if not exists renditions (
+    id bigserial primary key,
+    video_id bigint not null references videos (id) on delete cascade,
+    name text not null,
+    storage_key text not null unique,
+    width integer not null,
+    height integer not null,
+    video_bitrate bigint not null,
+    audio_bitrate bigint not null,
+    size bigint not null,
+    created_at timestamp(0) with time zone not null default now(),
+    constraint renditions_video_id_name_key unique (video_id, name)
 );
+alter table renditions add column if not exists codecs text;
+alter table renditions add column if not exists bandwidth bigint;
+alter table renditions add column if not exists average_bandwidth bigint;
+alter table renditions add column if not exists playlist_key text;
+alter table renditions add column if not exists dash_prefix text;
+alter table renditions add column if not exists dash_audio boolean not null default false;
+alter table renditions add column if not exists segment_duration_ms integer;
 
 insert into videos (title, description, video_path, thumbnail_path, status, published_at)
-    values ('Video #0', 'Video Description', 'No Path', 'No Thumbnail', 'No Status', now());
+    values ('Video #0', 'Video Description', 'No Path', 'No Thumbnail', 'ready', now());
@@ -1 +1,9 @@
-DROP TABLE videos;
\ No newline at end of file
+DROP TABLE renditions;
+DROP TABLE video_status_history;
+DROP TABLE videos;
+DROP TABLE jobs;
+DROP TABLE blobs;
+DROP TABLE tokens;
+DROP TABLE users_permissions;
+DROP TABLE permissions;
+DROP TABLE users;
\ No newline at end of file
@@ -0,0 +1,117 @@
+package uploads
+
+import (
+	"context"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"time"
+)
+
+type Mock struct {
+	Upload    *Upload
+	Err       error
+	ErrorsMap map[string]string
+	Max       int64
+}
+
+func (m Mock) CreateUpload(ctx context.Context, ownerId, length int64, metadata map[string]string) (*Upload, error, map[string]string) {
+	return m.Upload, m.Err, m.ErrorsMap
+}
+
+func (m Mock) ReadUpload(ctx context.Context, actor videos.Actor, uploadId string) (*Upload, error, map[string]string) {
+	return m.Upload, m.Err, m.ErrorsMap
+}
+
+func (m Mock) WriteChunk(ctx context.Context, actor videos.Actor, uploadId string, offset int64, body io.Reader) (*Upload, error, map[string]string) {
+	return m.Upload, m.Err, m.ErrorsMap
+}
+
+func (m Mock) TerminateUpload(ctx context.Context, actor videos.Actor, uploadId string) (error, map[string]string) {
+	return m.Err, m.ErrorsMap
+}
+
+func (m Mock) MaxSize() int64 {
+	return m.Max
+}
+
+// Store
+
+type storeMock struct {
+	fnCalls map[string]int
+	upload  *Upload
+	chunks  []*Chunk
+	err     map[string]error
+}
+
+func (s storeMock) Insert(ctx context.Context, u *Upload) error {
+	tests.Called(s.fnCalls, "Insert")
+	return s.err["Insert"]
+}
+
+func (s storeMock) ReadById(ctx context.Context, uploadId string) (*Upload, error) {
+	tests.Called(s.fnCalls, "ReadById")
+	return s.upload, s.err["ReadById"]
+}
+
+func (s storeMock) AppendChunk(ctx context.Context, u *Upload, c *Chunk) error {
+	tests.Called(s.fnCalls, "AppendChunk")
+	if err := s.err["AppendChunk"]; err != nil {
+		return err
+	}
+
+	u.Offset += c.Size
+	return nil
+}
+
+func (s storeMock) Chunks(ctx context.Context, uploadId string) ([]*Chunk, error) {
+	tests.Called(s.fnCalls, "Chunks")
+	return s.chunks, s.err["Chunks"]
+}
+
+func (s storeMock) SetVideo(ctx context.Context, u *Upload, videoId int64) error {
+	tests.Called(s.fnCalls, "SetVideo")
+	if err := s.err["SetVideo"]; err != nil {
+		return err
+	}
+
+	u.VideoID = videoId
+	return nil
+}
+
+func (s storeMock) Complete(ctx context.Context, u *Upload) error {
+	tests.Called(s.fnCalls, "Complete")
+	if err := s.err["Complete"]; err != nil {
+		return err
+	}
+
+	u.CompletedAt = time.Now()
+	return nil
+}
+
+func (s storeMock) Delete(ctx context.Context, uploadId string) error {
+	tests.Called(s.fnCalls, "Delete")
+	return s.err["Delete"]
+}
+
+func (s storeMock) ListExpired(ctx context.Context, expiredBefore time.Time, limit int) ([]*Upload, error) {
+	tests.Called(s.fnCalls, "ListExpired")
+	if err := s.err["ListExpired"]; err != nil {
+		return nil, err
+	}
+
+	if s.upload == nil {
+		return []*Upload{}, nil
+	}
+	return []*Upload{s.upload}, nil
+}
+
+func (s storeMock) GetFnCalls(fnName string) int {
+	value, exists := s.fnCalls[fnName]
+
+	if !exists {
+		return 0
+	}
+
+	return value
+}
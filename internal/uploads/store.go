@@ -0,0 +1,272 @@
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"time"
+)
+
+type store interface {
+	Insert(ctx context.Context, u *Upload) error
+	ReadById(ctx context.Context, uploadId string) (*Upload, error)
+	AppendChunk(ctx context.Context, u *Upload, c *Chunk) error
+	Chunks(ctx context.Context, uploadId string) ([]*Chunk, error)
+	SetVideo(ctx context.Context, u *Upload, videoId int64) error
+	Complete(ctx context.Context, u *Upload) error
+	Delete(ctx context.Context, uploadId string) error
+	ListExpired(ctx context.Context, expiredBefore time.Time, limit int) ([]*Upload, error)
+}
+
+type uploadStore struct {
+	db *sql.DB
+}
+
+func (s *uploadStore) Insert(ctx context.Context, u *Upload) error {
+	query := `INSERT INTO uploads (id, owner_id, upload_length, metadata, expires_at)
+			VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+			RETURNING upload_offset, created_at`
+
+	metadata, err := json.Marshal(u.Metadata)
+	if err != nil {
+		return err
+	}
+
+	args := []any{u.ID, u.OwnerID, u.Length, string(metadata), u.ExpiresAt}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return s.db.QueryRowContext(dbCtx, query, args...).Scan(&u.Offset, &u.CreatedAt)
+}
+
+func (s *uploadStore) ReadById(ctx context.Context, uploadId string) (*Upload, error) {
+	query := `SELECT id, COALESCE(owner_id, 0), upload_length, upload_offset, metadata, video_id, expires_at, completed_at, created_at
+			  FROM uploads
+			  WHERE id = $1`
+
+	var u Upload
+	var metadata []byte
+	var videoId sql.NullInt64
+	var completedAt sql.NullTime
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, uploadId).Scan(
+		&u.ID,
+		&u.OwnerID,
+		&u.Length,
+		&u.Offset,
+		&metadata,
+		&videoId,
+		&u.ExpiresAt,
+		&completedAt,
+		&u.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, datastore.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(metadata, &u.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	u.VideoID = videoId.Int64
+	u.CompletedAt = completedAt.Time
+
+	return &u, nil
+}
+
+// AppendChunk records a stored chunk and advances the upload offset in one transaction. The offset only
+// moves if nobody else appended in the meantime, otherwise datastore.ErrEditConflict is returned.
+func (s *uploadStore) AppendChunk(ctx context.Context, u *Upload, c *Chunk) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE uploads SET upload_offset = upload_offset + $1, updated_at = now()
+			  WHERE id = $2 AND upload_offset = $3
+			  RETURNING upload_offset`
+
+	err = tx.QueryRowContext(dbCtx, query, c.Size, u.ID, c.Offset).Scan(&u.Offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `INSERT INTO upload_chunks (upload_id, chunk_offset, size, storage_key)
+			 VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(dbCtx, query, u.ID, c.Offset, c.Size, c.Key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *uploadStore) Chunks(ctx context.Context, uploadId string) ([]*Chunk, error) {
+	query := `SELECT chunk_offset, size, storage_key FROM upload_chunks
+			  WHERE upload_id = $1
+			  ORDER BY chunk_offset`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(dbCtx, query, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []*Chunk{}
+
+	for rows.Next() {
+		var c Chunk
+
+		err = rows.Scan(&c.Offset, &c.Size, &c.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// SetVideo records the video reserved for the upload. Only the first reservation is recorded, a later
+// one reports datastore.ErrEditConflict.
+func (s *uploadStore) SetVideo(ctx context.Context, u *Upload, videoId int64) error {
+	query := `UPDATE uploads SET video_id = $1, updated_at = now()
+			  WHERE id = $2 AND video_id IS NULL
+			  RETURNING video_id`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, videoId, u.ID).Scan(&u.VideoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Complete marks the upload as completed, its content was handed over to its video.
+func (s *uploadStore) Complete(ctx context.Context, u *Upload) error {
+	query := `UPDATE uploads SET completed_at = COALESCE(completed_at, now()), updated_at = now()
+			  WHERE id = $1
+			  RETURNING completed_at`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, u.ID).Scan(&u.CompletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *uploadStore) Delete(ctx context.Context, uploadId string) error {
+	query := `DELETE FROM uploads WHERE id = $1`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := s.db.ExecContext(dbCtx, query, uploadId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return datastore.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ListExpired returns up to limit uncompleted uploads that expired before expiredBefore, oldest first.
+// Only the fields discarding an upload needs are read.
+func (s *uploadStore) ListExpired(ctx context.Context, expiredBefore time.Time, limit int) ([]*Upload, error) {
+	query := `SELECT id, video_id, expires_at FROM uploads
+			  WHERE expires_at < $1 AND completed_at IS NULL
+			  ORDER BY expires_at
+			  LIMIT $2`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(dbCtx, query, expiredBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []*Upload{}
+
+	for rows.Next() {
+		var u Upload
+		var videoId sql.NullInt64
+
+		err = rows.Scan(&u.ID, &videoId, &u.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		u.VideoID = videoId.Int64
+		uploads = append(uploads, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// Initialize Store
+func newStore(db *sql.DB) (*uploadStore, error) {
+	return &uploadStore{
+		db: db,
+	}, nil
+}
@@ -0,0 +1,569 @@
+package uploads
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/mediaprobe"
+	"luismatosgarcia.dev/video-sharing-go/internal/validator"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"mime/multipart"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	// JobCompleteUpload hands the content of an upload whose last byte arrived over to its video.
+	JobCompleteUpload background.JobKind = "uploads:complete"
+	// JobExpireUploads discards the uploads that expired before they were completed.
+	JobExpireUploads background.JobKind = "uploads:expire"
+)
+
+// expireBatchSize is the number of expired uploads the expire job discards per round trip.
+const expireBatchSize = 100
+
+var (
+	UploadValidationError = errors.New("Upload data is not valid")
+	ErrOffsetMismatch     = errors.New("upload offset does not match")
+	ErrUploadExpired      = errors.New("upload has expired")
+	ErrUploadCompleted    = errors.New("upload is already completed")
+	ErrUploadTooLarge     = errors.New("upload exceeds declared length")
+
+	uploadIdRX = regexp.MustCompile("^[a-f0-9]{32}$")
+)
+
+// Upload is a resumable upload following the tus 1.0 protocol. Bytes are stored as chunks in the
+// filestore until Offset reaches Length, then the upload is handed off to the videos service.
+type Upload struct {
+	ID          string            `json:"id"`
+	OwnerID     int64             `json:"-"`
+	Length      int64             `json:"length"`
+	Offset      int64             `json:"offset"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	VideoID     int64             `json:"video_id,omitempty"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	CompletedAt time.Time         `json:"completed_at,omitempty"`
+	CreatedAt   time.Time         `json:"-"`
+}
+
+func (u *Upload) Completed() bool {
+	return !u.CompletedAt.IsZero()
+}
+
+// OwnedBy reports whether the actor started the upload. Uploads stay private to their owner until they
+// turned into a video, moderators included.
+func (u *Upload) OwnedBy(actor videos.Actor) bool {
+	return actor.UserID != 0 && u.OwnerID == actor.UserID
+}
+
+func (u *Upload) Expired() bool {
+	return !u.Completed() && time.Now().After(u.ExpiresAt)
+}
+
+// Filename returns the client supplied filename from the upload metadata.
+func (u *Upload) Filename() string {
+	if name := u.Metadata["filename"]; name != "" {
+		return name
+	}
+
+	return u.ID
+}
+
+type completeUploadPayload struct {
+	UploadID string `json:"upload_id"`
+}
+
+type Chunk struct {
+	Offset int64
+	Size   int64
+	Key    string
+}
+
+type Config struct {
+	MaxSize        int64
+	Expiration     time.Duration
+	ExpireInterval time.Duration
+	SpoolDir       string
+}
+
+type Uploads interface {
+	CreateUpload(ctx context.Context, ownerId, length int64, metadata map[string]string) (*Upload, error, map[string]string)
+	ReadUpload(ctx context.Context, actor videos.Actor, uploadId string) (*Upload, error, map[string]string)
+	WriteChunk(ctx context.Context, actor videos.Actor, uploadId string, offset int64, body io.Reader) (*Upload, error, map[string]string)
+	TerminateUpload(ctx context.Context, actor videos.Actor, uploadId string) (error, map[string]string)
+	MaxSize() int64
+}
+
+type Service struct {
+	store      store
+	filestore  filestore.FileStore
+	videos     videos.Videos
+	background background.Routine
+	cfg        Config
+}
+
+func ValidUploadID(uploadId string) bool {
+	return validator.Matches(uploadId, uploadIdRX)
+}
+
+func ValidateUpload(v *validator.Validator, upload *Upload, maxSize int64) {
+	v.Check(upload.Length > 0, "upload_length", "must be greater than zero")
+	v.Check(maxSize <= 0 || upload.Length <= maxSize, "upload_length", fmt.Sprintf("must not be more than %d bytes", maxSize))
+	v.Check(len(upload.Metadata["filename"]) <= 500, "filename", "must not be more than 500 bytes long")
+}
+
+// CreateUpload starts an upload of length bytes, the video it turns into is owned by ownerId.
+func (us *Service) CreateUpload(ctx context.Context, ownerId, length int64, metadata map[string]string) (*Upload, error, map[string]string) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	upload := &Upload{
+		ID:        id,
+		OwnerID:   ownerId,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(us.cfg.Expiration),
+	}
+
+	v := validator.New()
+
+	if ValidateUpload(v, upload, us.cfg.MaxSize); !v.Valid() {
+		return nil, UploadValidationError, v.Errors
+	}
+
+	err = us.store.Insert(ctx, upload)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return upload, nil, nil
+}
+
+// ReadUpload returns an upload of the actor, the uploads of others are not found.
+func (us *Service) ReadUpload(ctx context.Context, actor videos.Actor, uploadId string) (*Upload, error, map[string]string) {
+	upload, err := us.readOwned(ctx, actor, uploadId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if upload.Expired() {
+		us.discard(ctx, upload)
+		return nil, ErrUploadExpired, nil
+	}
+
+	return upload, nil, nil
+}
+
+// WriteChunk appends body at offset. Bytes received before the client went away are kept so the upload
+// can resume from there. Once the last byte arrives the upload is handed off to the videos service, the
+// upload points at its video but only completes once the content reached it.
+func (us *Service) WriteChunk(ctx context.Context, actor videos.Actor, uploadId string, offset int64, body io.Reader) (*Upload, error, map[string]string) {
+	upload, err, _ := us.ReadUpload(ctx, actor, uploadId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if upload.Completed() {
+		return nil, ErrUploadCompleted, nil
+	}
+
+	if upload.Offset != offset {
+		return nil, ErrOffsetMismatch, nil
+	}
+
+	remaining := upload.Length - upload.Offset
+
+	f, err := os.CreateTemp(us.cfg.SpoolDir, fmt.Sprintf("upload-%s-*.chunk", upload.ID))
+	if err != nil {
+		return nil, err, nil
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// Read one byte past the remaining length to detect clients sending more than they declared
+	n, readErr := io.Copy(f, io.LimitReader(body, remaining+1))
+	if n > remaining {
+		return nil, ErrUploadTooLarge, nil
+	}
+
+	if n > 0 {
+		err = us.storeChunk(ctx, upload, f, n)
+		if err != nil {
+			return nil, err, nil
+		}
+	}
+
+	if readErr != nil {
+		return nil, readErr, nil
+	}
+
+	if upload.Offset == upload.Length {
+		err, validationErrors := us.finish(ctx, upload)
+		if err != nil {
+			return nil, err, validationErrors
+		}
+	}
+
+	return upload, nil, nil
+}
+
+func (us *Service) storeChunk(ctx context.Context, upload *Upload, f *os.File, size int64) error {
+	_, err := f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	suffix, err := newUploadID()
+	if err != nil {
+		return err
+	}
+
+	chunk := &Chunk{
+		Offset: upload.Offset,
+		Size:   size,
+		Key:    fmt.Sprintf("uploads/%s/%020d-%s", upload.ID, upload.Offset, suffix[:8]),
+	}
+
+	err = us.filestore.Put(ctx, chunk.Key, f, size, "application/offset+octet-stream")
+	if err != nil {
+		return err
+	}
+
+	err = us.store.AppendChunk(ctx, upload, chunk)
+	if err != nil {
+		us.filestore.Delete(ctx, chunk.Key)
+
+		if errors.Is(err, datastore.ErrEditConflict) {
+			return ErrOffsetMismatch
+		}
+		return err
+	}
+
+	return nil
+}
+
+// finish checks the container of an upload whose last byte arrived, reserves the video it turns into and
+// enqueues the job that hands the content over. Handing over a whole video copies it, it doesn't fit the
+// request of the last chunk. The video is reserved and recorded on the upload first, a finish retried
+// after a failure enqueues the job for the same video instead of creating another one. Content the
+// videos service rejects discards the whole upload, it can't be fixed by resuming.
+func (us *Service) finish(ctx context.Context, upload *Upload) (error, map[string]string) {
+	if upload.VideoID == 0 {
+		err, validationErrors := us.validateContent(ctx, upload)
+		if err != nil {
+			return err, validationErrors
+		}
+
+		err = us.reserveVideo(ctx, upload, videos.Actor{UserID: upload.OwnerID})
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	_, err := us.background.Enqueue(ctx, JobCompleteUpload, completeUploadPayload{UploadID: upload.ID})
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, nil
+}
+
+// validateContent sniffs the leading bytes of the stored chunks like the videos service does once the
+// content is handed over, only the first chunks are read.
+func (us *Service) validateContent(ctx context.Context, upload *Upload) (error, map[string]string) {
+	chunks, err := us.store.Chunks(ctx, upload.ID)
+	if err != nil {
+		return err, nil
+	}
+
+	r := &chunkReader{ctx: ctx, fs: us.filestore, chunks: chunks}
+	defer r.Close()
+
+	head := make([]byte, mediaprobe.SniffLen)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err, nil
+	}
+
+	_, err, validationErrors := videos.ValidateContent(head[:n], upload.Filename())
+	if err != nil {
+		if errors.Is(err, videos.VideoValidationError) || errors.Is(err, videos.ErrUnsupportedVideo) {
+			discardErr := us.discard(ctx, upload)
+			if discardErr != nil {
+				return discardErr, nil
+			}
+			return UploadValidationError, validationErrors
+		}
+		return err, nil
+	}
+
+	return nil, nil
+}
+
+// completeUploadJob streams the stored chunks, in order, into the video reserved for the upload and then
+// drops the chunks. A video that already has the content is left as is, the upload is only marked
+// completed. Uploads terminated or discarded in the meantime have nothing left to hand over.
+func (us *Service) completeUploadJob(ctx context.Context, job *background.Job) error {
+	var payload completeUploadPayload
+
+	err := job.Decode(&payload)
+	if err != nil {
+		return background.Permanent(err)
+	}
+
+	upload, err := us.store.ReadById(ctx, payload.UploadID)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return background.Permanent(err)
+		}
+		return err
+	}
+
+	if upload.Completed() {
+		return nil
+	}
+
+	chunks, err := us.store.Chunks(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	r := &chunkReader{ctx: ctx, fs: us.filestore, chunks: chunks}
+	defer r.Close()
+
+	file := io.Reader(r)
+
+	_, err, _ = us.videos.UploadReservedVideo(ctx, videos.Actor{UserID: upload.OwnerID}, upload.VideoID, &file, &multipart.FileHeader{
+		Filename: upload.Filename(),
+		Size:     upload.Length,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, videos.VideoValidationError), errors.Is(err, videos.ErrUnsupportedVideo):
+			// Checked when the last byte arrived, only the rest of the content can't pass
+			discardErr := us.discard(ctx, upload)
+			if discardErr != nil {
+				return discardErr
+			}
+			return background.Permanent(err)
+		case errors.Is(err, datastore.ErrRecordNotFound):
+			return background.Permanent(err)
+		}
+		return err
+	}
+
+	err = us.store.Complete(ctx, upload)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		us.filestore.Delete(ctx, c.Key)
+	}
+
+	return nil
+}
+
+// reserveVideo creates the video the upload turns into and records it on the upload. The reservation is
+// dropped again when it can't be recorded, a concurrent completion may have recorded its own first.
+func (us *Service) reserveVideo(ctx context.Context, upload *Upload, actor videos.Actor) error {
+	video, err, _ := us.videos.ReserveVideo(ctx, actor)
+	if err != nil {
+		return err
+	}
+
+	err = us.store.SetVideo(ctx, upload, video.ID)
+	if err != nil {
+		us.videos.DiscardReservedVideo(ctx, video.ID)
+
+		if errors.Is(err, datastore.ErrEditConflict) {
+			return ErrOffsetMismatch
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (us *Service) TerminateUpload(ctx context.Context, actor videos.Actor, uploadId string) (error, map[string]string) {
+	upload, err := us.readOwned(ctx, actor, uploadId)
+	if err != nil {
+		return err, nil
+	}
+
+	err = us.discard(ctx, upload)
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, nil
+}
+
+func (us *Service) readOwned(ctx context.Context, actor videos.Actor, uploadId string) (*Upload, error) {
+	upload, err := us.store.ReadById(ctx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !upload.OwnedBy(actor) {
+		return nil, datastore.ErrRecordNotFound
+	}
+
+	return upload, nil
+}
+
+// discard removes the stored chunks, the upload record and the video reserved for the upload, unless the
+// content was handed over to it.
+func (us *Service) discard(ctx context.Context, upload *Upload) error {
+	chunks, err := us.store.Chunks(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		err = us.filestore.Delete(ctx, c.Key)
+		if err != nil && !errors.Is(err, filestore.ErrObjectNotFound) {
+			return err
+		}
+	}
+
+	if upload.VideoID != 0 && !upload.Completed() {
+		err, _ = us.videos.DiscardReservedVideo(ctx, upload.VideoID)
+		if err != nil && !errors.Is(err, datastore.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	return us.store.Delete(ctx, upload.ID)
+}
+
+// expireUploadsJob discards, in batches, the uploads that expired before they were completed. Uploads
+// touched after they expired are discarded right away, the job covers the ones clients abandoned.
+func (us *Service) expireUploadsJob(ctx context.Context, job *background.Job) error {
+	for {
+		expired, err := us.store.ListExpired(ctx, time.Now(), expireBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, upload := range expired {
+			err = us.discard(ctx, upload)
+			if err != nil {
+				if errors.Is(err, datastore.ErrRecordNotFound) {
+					// Discarded by its client or another worker in the meantime
+					continue
+				}
+				return err
+			}
+		}
+
+		if len(expired) < expireBatchSize {
+			return nil
+		}
+	}
+}
+
+func (us *Service) MaxSize() int64 {
+	return us.cfg.MaxSize
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// chunkReader reads chunks sequentially, opening each one only when the previous one is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	fs      filestore.FileStore
+	chunks  []*Chunk
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			body, err := c.fs.Get(c.ctx, c.chunks[0].Key)
+			if err != nil {
+				return 0, err
+			}
+
+			c.current = body
+			c.chunks = c.chunks[1:]
+		}
+
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current != nil {
+		return c.current.Close()
+	}
+
+	return nil
+}
+
+func (us *Service) registerJobs() {
+	us.background.Register(JobCompleteUpload, us.completeUploadJob)
+	us.background.Register(JobExpireUploads, us.expireUploadsJob)
+
+	if us.cfg.ExpireInterval > 0 {
+		us.background.Schedule(JobExpireUploads, us.cfg.ExpireInterval, nil)
+	}
+}
+
+func NewService(db *sql.DB, fs filestore.FileStore, bg background.Routine, v videos.Videos, cfg Config) (Uploads, error) {
+	s, err := newStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &Service{
+		store:      s,
+		filestore:  fs,
+		videos:     v,
+		background: bg,
+		cfg:        cfg,
+	}
+
+	service.registerJobs()
+
+	return service, nil
+}
@@ -0,0 +1,406 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"luismatosgarcia.dev/video-sharing-go/internal/videos"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_CreateUpload(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		length      int64
+		shouldError bool
+		inserts     int
+	}{
+		{name: "Can Create", length: 10, shouldError: false, inserts: 1},
+		{name: "Validate Empty Length", length: 0, shouldError: true, inserts: 0},
+		{name: "Validate Max Size", length: 101, shouldError: true, inserts: 0},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := storeMock{fnCalls: make(map[string]int)}
+
+			service := Service{
+				store: sm,
+				cfg:   Config{MaxSize: 100, Expiration: time.Hour},
+			}
+
+			u, err, _ := service.CreateUpload(context.Background(), 1, tt.length, map[string]string{"filename": "video.mp4"})
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+				assert.Equal(t, ValidUploadID(u.ID), true)
+				assert.Equal(t, u.Filename(), "video.mp4")
+			} else {
+				assert.Equal(t, errors.Is(err, UploadValidationError), true)
+			}
+
+			assert.Equal(t, sm.GetFnCalls("Insert"), tt.inserts)
+		})
+	}
+}
+
+// rejectingVideos rejects the content handed over to a reserved video.
+type rejectingVideos struct {
+	videos.Mock
+}
+
+func (r rejectingVideos) UploadReservedVideo(ctx context.Context, actor videos.Actor, videoId int64, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*videos.Video, error, map[string]string) {
+	return nil, videos.ErrUnsupportedVideo, map[string]string{"video": "must be an MP4, QuickTime, WebM, Matroska or MPEG-TS video"}
+}
+
+// owner started the uploads of the tests.
+var owner = videos.Actor{UserID: 2}
+
+// mp4Head is the start of an MP4 file, enough to pass the container sniffing.
+var mp4Head = []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2")
+
+func TestService_WriteChunk(t *testing.T) {
+	testsMap := []struct {
+		name     string
+		upload   Upload
+		offset   int64
+		body     string
+		content  []byte
+		storeErr map[string]error
+		wantsErr error
+		fnCalls  map[string]int
+	}{
+		{
+			name:   "Can Write Partial Chunk",
+			upload: Upload{Length: 10, Offset: 0},
+			offset: 0,
+			body:   "hello",
+			fnCalls: map[string]int{
+				"fsPut":         1,
+				"usAppendChunk": 1,
+				"usComplete":    0,
+			},
+		},
+		{
+			name:   "Completes Upload",
+			upload: Upload{Length: 10, Offset: 5},
+			offset: 5,
+			body:   "world",
+			fnCalls: map[string]int{
+				"fsPut":         1,
+				"usAppendChunk": 1,
+				"usSetVideo":    1,
+				"usComplete":    1,
+			},
+		},
+		{
+			// The last byte arrived before, the response to it was lost
+			name:   "Retried Completion Reuses Video",
+			upload: Upload{Length: 10, Offset: 10, VideoID: 1},
+			offset: 10,
+			body:   "",
+			fnCalls: map[string]int{
+				"fsPut":         0,
+				"usAppendChunk": 0,
+				"usSetVideo":    0,
+				"usComplete":    1,
+			},
+		},
+		{
+			name:     "Rejected Video Discards Upload",
+			upload:   Upload{Length: 10, Offset: 5},
+			offset:   5,
+			body:     "world",
+			content:  []byte("#!/bin/sh\necho not a video\n"),
+			wantsErr: UploadValidationError,
+			fnCalls: map[string]int{
+				"fsPut":         1,
+				"usAppendChunk": 1,
+				"usSetVideo":    0,
+				"usComplete":    0,
+				"usDelete":      1,
+			},
+		},
+		{
+			name:     "Concurrent Completion Reserved First",
+			upload:   Upload{Length: 10, Offset: 5},
+			offset:   5,
+			body:     "world",
+			storeErr: map[string]error{"SetVideo": datastore.ErrEditConflict},
+			wantsErr: ErrOffsetMismatch,
+			fnCalls: map[string]int{
+				"fsPut":         1,
+				"usAppendChunk": 1,
+				"usSetVideo":    1,
+				"usComplete":    0,
+			},
+		},
+		{
+			name:     "Offset Mismatch",
+			upload:   Upload{Length: 10, Offset: 5},
+			offset:   0,
+			body:     "hello",
+			wantsErr: ErrOffsetMismatch,
+			fnCalls: map[string]int{
+				"fsPut":         0,
+				"usAppendChunk": 0,
+				"usComplete":    0,
+			},
+		},
+		{
+			name:     "Body Larger Than Declared Length",
+			upload:   Upload{Length: 4, Offset: 0},
+			offset:   0,
+			body:     "hello",
+			wantsErr: ErrUploadTooLarge,
+			fnCalls: map[string]int{
+				"fsPut":         0,
+				"usAppendChunk": 0,
+				"usComplete":    0,
+			},
+		},
+		{
+			name:     "Expired Upload",
+			upload:   Upload{Length: 10, Offset: 0, ExpiresAt: time.Now().Add(-time.Minute)},
+			offset:   0,
+			body:     "hello",
+			wantsErr: ErrUploadExpired,
+			fnCalls: map[string]int{
+				"fsPut":         0,
+				"usAppendChunk": 0,
+				"usComplete":    0,
+				"usDelete":      1,
+			},
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			upload := tt.upload
+			upload.ID = "0123456789abcdef0123456789abcdef"
+			upload.OwnerID = owner.UserID
+			if upload.ExpiresAt.IsZero() {
+				upload.ExpiresAt = time.Now().Add(time.Hour)
+			}
+
+			content := tt.content
+			if content == nil {
+				content = mp4Head
+			}
+
+			chunks := []*Chunk{{Offset: 0, Size: int64(len(content)), Key: "uploads/a/chunk"}}
+			sm := storeMock{fnCalls: make(map[string]int), upload: &upload, chunks: chunks, err: tt.storeErr}
+			fs := filestore.Mock{FnCalls: make(map[string]int), Body: content}
+
+			service := Service{
+				store:      sm,
+				filestore:  fs,
+				videos:     videos.Mock{Video: &videos.Video{ID: 1}},
+				background: &background.RoutineMock{},
+				cfg:        Config{SpoolDir: t.TempDir()},
+			}
+			service.registerJobs()
+
+			u, err, validationErrors := service.WriteChunk(context.Background(), owner, upload.ID, tt.offset, strings.NewReader(tt.body))
+			service.background.Wait()
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, u.Offset, tt.offset+int64(len(tt.body)))
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			if errors.Is(err, UploadValidationError) {
+				assert.StringContains(t, validationErrors["video"], "must be")
+			}
+
+			assert.Equal(t, fs.GetFnCalls("Put"), tt.fnCalls["fsPut"])
+			assert.Equal(t, sm.GetFnCalls("AppendChunk"), tt.fnCalls["usAppendChunk"])
+			assert.Equal(t, sm.GetFnCalls("SetVideo"), tt.fnCalls["usSetVideo"])
+			assert.Equal(t, sm.GetFnCalls("Complete"), tt.fnCalls["usComplete"])
+			assert.Equal(t, sm.GetFnCalls("Delete"), tt.fnCalls["usDelete"])
+		})
+	}
+}
+
+func TestService_CompleteUploadJob(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		upload      Upload
+		videos      videos.Videos
+		storeErr    map[string]error
+		shouldError bool
+		fnCalls     map[string]int
+	}{
+		{
+			name:    "Hands Content Over",
+			upload:  Upload{Length: 10, Offset: 10, VideoID: 1},
+			fnCalls: map[string]int{"usComplete": 1, "usDelete": 0, "fsDelete": 1},
+		},
+		{
+			name:    "Completed Before",
+			upload:  Upload{Length: 10, Offset: 10, VideoID: 1, CompletedAt: time.Now()},
+			fnCalls: map[string]int{"usComplete": 0, "usDelete": 0, "fsDelete": 0},
+		},
+		{
+			name:        "Rejected Content Discards Upload",
+			upload:      Upload{Length: 10, Offset: 10, VideoID: 1},
+			videos:      rejectingVideos{videos.Mock{Video: &videos.Video{ID: 1}}},
+			shouldError: true,
+			fnCalls:     map[string]int{"usComplete": 0, "usDelete": 1, "fsDelete": 1},
+		},
+		{
+			name:        "Terminated Upload",
+			upload:      Upload{Length: 10, Offset: 10, VideoID: 1},
+			storeErr:    map[string]error{"ReadById": datastore.ErrRecordNotFound},
+			shouldError: true,
+			fnCalls:     map[string]int{"usComplete": 0, "usDelete": 0, "fsDelete": 0},
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			upload := tt.upload
+			upload.ID = "0123456789abcdef0123456789abcdef"
+			upload.OwnerID = owner.UserID
+
+			chunks := []*Chunk{{Offset: 0, Size: 10, Key: "uploads/a/chunk"}}
+			sm := storeMock{fnCalls: make(map[string]int), upload: &upload, chunks: chunks, err: tt.storeErr}
+			fs := filestore.Mock{FnCalls: make(map[string]int), Body: mp4Head}
+
+			vm := tt.videos
+			if vm == nil {
+				vm = videos.Mock{Video: &videos.Video{ID: 1}}
+			}
+
+			service := Service{store: sm, filestore: fs, videos: vm}
+
+			payload := fmt.Sprintf(`{"upload_id":%q}`, upload.ID)
+			err := service.completeUploadJob(context.Background(), &background.Job{Kind: JobCompleteUpload, Payload: []byte(payload)})
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Equal(t, background.IsPermanent(err), true)
+			}
+
+			assert.Equal(t, sm.GetFnCalls("Complete"), tt.fnCalls["usComplete"])
+			assert.Equal(t, sm.GetFnCalls("Delete"), tt.fnCalls["usDelete"])
+			assert.Equal(t, fs.GetFnCalls("Delete"), tt.fnCalls["fsDelete"])
+		})
+	}
+}
+
+func TestService_ExpireUploadsJob(t *testing.T) {
+	testsMap := []struct {
+		name        string
+		upload      *Upload
+		storeErr    map[string]error
+		shouldError bool
+		fnCalls     map[string]int
+	}{
+		{
+			name:    "Discards Expired Upload",
+			upload:  &Upload{ID: "a", ExpiresAt: time.Now().Add(-time.Minute)},
+			fnCalls: map[string]int{"usDelete": 1, "fsDelete": 1},
+		},
+		{
+			name:     "Discarded Meanwhile",
+			upload:   &Upload{ID: "a", ExpiresAt: time.Now().Add(-time.Minute)},
+			storeErr: map[string]error{"Delete": datastore.ErrRecordNotFound},
+			fnCalls:  map[string]int{"usDelete": 1, "fsDelete": 1},
+		},
+		{
+			name:    "Nothing Expired",
+			fnCalls: map[string]int{"usDelete": 0, "fsDelete": 0},
+		},
+		{
+			name:        "Store Returns Error",
+			storeErr:    map[string]error{"ListExpired": errors.New("connection refused")},
+			shouldError: true,
+			fnCalls:     map[string]int{"usDelete": 0, "fsDelete": 0},
+		},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := storeMock{
+				fnCalls: make(map[string]int),
+				upload:  tt.upload,
+				chunks:  []*Chunk{{Offset: 0, Size: 5, Key: "uploads/a/chunk"}},
+				err:     tt.storeErr,
+			}
+			fs := filestore.Mock{FnCalls: make(map[string]int)}
+
+			service := Service{store: sm, filestore: fs, videos: videos.Mock{}}
+
+			err := service.expireUploadsJob(context.Background(), nil)
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			assert.Equal(t, sm.GetFnCalls("Delete"), tt.fnCalls["usDelete"])
+			assert.Equal(t, fs.GetFnCalls("Delete"), tt.fnCalls["fsDelete"])
+		})
+	}
+}
+
+func TestService_UploadOwnership(t *testing.T) {
+	testsMap := []struct {
+		name      string
+		actor     videos.Actor
+		wantsErr  error
+		wantCalls int
+	}{
+		{name: "Owner", actor: owner, wantCalls: 1},
+		{name: "Other User", actor: videos.Actor{UserID: 3}, wantsErr: datastore.ErrRecordNotFound},
+		{name: "Moderator", actor: videos.Actor{UserID: 3, Moderator: true}, wantsErr: datastore.ErrRecordNotFound},
+		{name: "Anonymous", actor: videos.Actor{}, wantsErr: datastore.ErrRecordNotFound},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			upload := &Upload{ID: "0123456789abcdef0123456789abcdef", OwnerID: owner.UserID, Length: 10, ExpiresAt: time.Now().Add(time.Hour)}
+			sm := storeMock{fnCalls: make(map[string]int), upload: upload}
+			fs := filestore.Mock{FnCalls: make(map[string]int)}
+
+			service := Service{store: sm, filestore: fs, videos: videos.Mock{}, cfg: Config{SpoolDir: t.TempDir()}}
+			ctx := context.Background()
+
+			_, err, _ := service.ReadUpload(ctx, tt.actor, upload.ID)
+			assertOwnershipErr(t, err, tt.wantsErr)
+
+			_, err, _ = service.WriteChunk(ctx, tt.actor, upload.ID, 0, strings.NewReader("hello"))
+			assertOwnershipErr(t, err, tt.wantsErr)
+
+			err, _ = service.TerminateUpload(ctx, tt.actor, upload.ID)
+			assertOwnershipErr(t, err, tt.wantsErr)
+
+			assert.Equal(t, sm.GetFnCalls("AppendChunk"), tt.wantCalls)
+			assert.Equal(t, sm.GetFnCalls("Delete"), tt.wantCalls)
+		})
+	}
+}
+
+func assertOwnershipErr(t *testing.T, err, wantsErr error) {
+	t.Helper()
+
+	if wantsErr == nil {
+		assert.NilError(t, err)
+		return
+	}
+
+	assert.Equal(t, errors.Is(err, wantsErr), true)
+}
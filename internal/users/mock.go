@@ -0,0 +1,113 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests"
+)
+
+type Mock struct {
+	User        *User
+	Token       *Token
+	Permissions Permissions
+	Err         error
+	ErrorsMap   map[string]string
+}
+
+func (m Mock) RegisterUser(ctx context.Context, input *UserInput) (*User, error, map[string]string) {
+	return m.User, m.Err, m.ErrorsMap
+}
+
+func (m Mock) ActivateUser(ctx context.Context, tokenPlaintext string) (*User, error, map[string]string) {
+	return m.User, m.Err, m.ErrorsMap
+}
+
+func (m Mock) CreateAuthenticationToken(ctx context.Context, email, password string) (*Token, error, map[string]string) {
+	return m.Token, m.Err, m.ErrorsMap
+}
+
+func (m Mock) AuthenticateToken(ctx context.Context, tokenPlaintext string) (*User, error, map[string]string) {
+	return m.User, m.Err, m.ErrorsMap
+}
+
+func (m Mock) ReadPermissions(ctx context.Context, userId int64) (Permissions, error, map[string]string) {
+	return m.Permissions, m.Err, m.ErrorsMap
+}
+
+// Store
+
+type storeMock struct {
+	fnCalls     map[string]int
+	user        *User
+	tokens      *[]*Token
+	permissions Permissions
+	err         map[string]error
+}
+
+func (s storeMock) InsertWithPermissions(ctx context.Context, u *User, codes []string, then func(ctx context.Context, tx *sql.Tx) error) error {
+	tests.Called(s.fnCalls, "InsertWithPermissions")
+	if err := s.err["InsertWithPermissions"]; err != nil {
+		return err
+	}
+
+	u.ID = 1
+	return then(ctx, nil)
+}
+
+func (s storeMock) ReadById(ctx context.Context, userId int64) (*User, error) {
+	tests.Called(s.fnCalls, "ReadById")
+	return s.user, s.err["ReadById"]
+}
+
+func (s storeMock) ReadByEmail(ctx context.Context, email string) (*User, error) {
+	tests.Called(s.fnCalls, "ReadByEmail")
+	if s.user == nil && s.err["ReadByEmail"] == nil {
+		return nil, datastore.ErrRecordNotFound
+	}
+
+	return s.user, s.err["ReadByEmail"]
+}
+
+// ReadForToken reports a missing token unless a user is set
+func (s storeMock) ReadForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	tests.Called(s.fnCalls, "ReadForToken")
+	if s.user == nil && s.err["ReadForToken"] == nil {
+		return nil, datastore.ErrRecordNotFound
+	}
+
+	return s.user, s.err["ReadForToken"]
+}
+
+func (s storeMock) Update(ctx context.Context, u *User) error {
+	tests.Called(s.fnCalls, "Update")
+	return s.err["Update"]
+}
+
+func (s storeMock) InsertToken(ctx context.Context, t *Token) error {
+	tests.Called(s.fnCalls, "InsertToken")
+	if s.tokens != nil {
+		*s.tokens = append(*s.tokens, t)
+	}
+	return s.err["InsertToken"]
+}
+
+func (s storeMock) DeleteTokensForUser(ctx context.Context, scope string, userId int64) error {
+	tests.Called(s.fnCalls, "DeleteTokensForUser")
+	return s.err["DeleteTokensForUser"]
+}
+
+func (s storeMock) ReadPermissionsForUser(ctx context.Context, userId int64) (Permissions, error) {
+	tests.Called(s.fnCalls, "ReadPermissionsForUser")
+	return s.permissions, s.err["ReadPermissionsForUser"]
+}
+
+func (s storeMock) GetFnCalls(fnName string) int {
+	value, exists := s.fnCalls[fnName]
+
+	if !exists {
+		return 0
+	}
+
+	return value
+}
@@ -0,0 +1,23 @@
+package users
+
+const (
+	PermissionVideosRead     = "videos:read"
+	PermissionVideosWrite    = "videos:write"
+	PermissionVideosModerate = "videos:moderate"
+)
+
+// defaultPermissions are granted to every user on registration. Moderation is granted by an administrator.
+var defaultPermissions = []string{PermissionVideosRead, PermissionVideosWrite}
+
+// Permissions are the permission codes held by a user.
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+
+	return false
+}
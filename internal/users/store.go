@@ -0,0 +1,221 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"time"
+)
+
+type store interface {
+	InsertWithPermissions(ctx context.Context, u *User, codes []string, then func(ctx context.Context, tx *sql.Tx) error) error
+	ReadById(ctx context.Context, userId int64) (*User, error)
+	ReadByEmail(ctx context.Context, email string) (*User, error)
+	ReadForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error)
+	Update(ctx context.Context, u *User) error
+	InsertToken(ctx context.Context, t *Token) error
+	DeleteTokensForUser(ctx context.Context, scope string, userId int64) error
+	ReadPermissionsForUser(ctx context.Context, userId int64) (Permissions, error)
+}
+
+type userStore struct {
+	db *sql.DB
+}
+
+// InsertWithPermissions inserts the user and grants the permissions with the given codes in one transaction.
+// then runs inside the same transaction once the user has its id, the user is only committed if it succeeds.
+func (s *userStore) InsertWithPermissions(ctx context.Context, user *User, codes []string, then func(ctx context.Context, tx *sql.Tx) error) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO users (name, email, password_hash, activated)
+			  VALUES ($1, $2, $3, $4)
+			  RETURNING id, created_at, version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	err = tx.QueryRowContext(dbCtx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	query = `INSERT INTO users_permissions
+			 SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+			 ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(dbCtx, query, user.ID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	err = then(dbCtx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *userStore) ReadById(ctx context.Context, userId int64) (*User, error) {
+	query := `SELECT id, created_at, name, email, password_hash, activated, version
+			  FROM users
+			  WHERE id = $1`
+
+	return s.readUser(ctx, query, userId)
+}
+
+func (s *userStore) ReadByEmail(ctx context.Context, email string) (*User, error) {
+	query := `SELECT id, created_at, name, email, password_hash, activated, version
+			  FROM users
+			  WHERE email = $1`
+
+	return s.readUser(ctx, query, email)
+}
+
+// ReadForToken returns the user owning an unexpired token of the given scope.
+func (s *userStore) ReadForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	query := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+			  users.version
+			  FROM users
+			  INNER JOIN tokens ON users.id = tokens.user_id
+			  WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3`
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	return s.readUser(ctx, query, hash[:], scope, time.Now())
+}
+
+func (s *userStore) readUser(ctx context.Context, query string, args ...any) (*User, error) {
+	var user User
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, datastore.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (s *userStore) Update(ctx context.Context, user *User) error {
+	query := `UPDATE users
+			  SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
+			  WHERE id = $5 AND version = $6
+			  RETURNING version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(dbCtx, query, args...).Scan(&user.Version)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key":
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *userStore) InsertToken(ctx context.Context, token *Token) error {
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope)
+			  VALUES ($1, $2, $3, $4)`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(dbCtx, query, args...)
+
+	return err
+}
+
+func (s *userStore) DeleteTokensForUser(ctx context.Context, scope string, userId int64) error {
+	query := `DELETE FROM tokens
+			  WHERE scope = $1 AND user_id = $2`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(dbCtx, query, scope, userId)
+
+	return err
+}
+
+func (s *userStore) ReadPermissionsForUser(ctx context.Context, userId int64) (Permissions, error) {
+	query := `SELECT permissions.code
+			  FROM permissions
+			  INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+			  WHERE users_permissions.user_id = $1`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(dbCtx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err = rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Initialize Store
+func newStore(db *sql.DB) (*userStore, error) {
+	return &userStore{
+		db: db,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"luismatosgarcia.dev/video-sharing-go/internal/validator"
+	"time"
+)
+
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication"
+)
+
+// Token is a random secret handed to a user for a single scope. Only the SHA-256 of the plaintext is
+// stored, the plaintext is shown to the user once.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func newToken(userId int64, ttl time.Duration, scope string) (*Token, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	hash := sha256.Sum256([]byte(plaintext))
+
+	return &Token{
+		Plaintext: plaintext,
+		Hash:      hash[:],
+		UserID:    userId,
+		Expiry:    time.Now().Add(ttl),
+		Scope:     scope,
+	}, nil
+}
+
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
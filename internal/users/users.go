@@ -0,0 +1,334 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/mailer"
+	"luismatosgarcia.dev/video-sharing-go/internal/validator"
+	"strings"
+	"time"
+)
+
+var (
+	UserValidationError   = errors.New("User data is not valid")
+	ErrDuplicateEmail     = errors.New("duplicate email")
+	ErrInvalidCredentials = errors.New("invalid authentication credentials")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+const JobSendActivationEmail background.JobKind = "users:send-activation-email"
+
+type sendActivationEmailPayload struct {
+	UserID int64 `json:"user_id"`
+}
+
+type User struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Activated bool      `json:"activated"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"-"`
+}
+
+// AnonymousUser is the user of requests without an authentication token.
+var AnonymousUser = &User{}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// password holds the bcrypt hash of a password, and the plaintext while it is being validated.
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+func (p *password) Set(plaintext string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), 12)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintext
+	p.hash = hash
+
+	return nil
+}
+
+func (p *password) Matches(plaintext string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintext))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+type UserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	// bcrypt ignores everything past 72 bytes
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	ValidateEmail(v, user.Email)
+
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+}
+
+type Users interface {
+	RegisterUser(ctx context.Context, input *UserInput) (*User, error, map[string]string)
+	ActivateUser(ctx context.Context, tokenPlaintext string) (*User, error, map[string]string)
+	CreateAuthenticationToken(ctx context.Context, email, password string) (*Token, error, map[string]string)
+	AuthenticateToken(ctx context.Context, tokenPlaintext string) (*User, error, map[string]string)
+	ReadPermissions(ctx context.Context, userId int64) (Permissions, error, map[string]string)
+}
+
+type Config struct {
+	ActivationTTL     time.Duration
+	AuthenticationTTL time.Duration
+}
+
+type Service struct {
+	store      store
+	mailer     mailer.Mailer
+	background background.Routine
+	cfg        Config
+}
+
+// RegisterUser creates an inactive user with the default permissions and queues the welcome email carrying the activation token.
+func (us *Service) RegisterUser(ctx context.Context, input *UserInput) (*User, error, map[string]string) {
+	user := &User{
+		Name:  input.Name,
+		Email: strings.TrimSpace(input.Email),
+	}
+
+	v := validator.New()
+
+	// Validate the plaintext before paying for the hash
+	ValidateUser(v, user)
+	ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		return nil, UserValidationError, v.Errors
+	}
+
+	err := user.Password.Set(input.Password)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	err = us.store.InsertWithPermissions(ctx, user, defaultPermissions, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := us.background.EnqueueTx(ctx, tx, JobSendActivationEmail, sendActivationEmailPayload{UserID: user.ID})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrDuplicateEmail) {
+			v.AddError("email", "a user with this email address already exists")
+			return nil, UserValidationError, v.Errors
+		}
+		return nil, err, nil
+	}
+
+	return user, nil, nil
+}
+
+// ActivateUser activates the user the activation token belongs to and revokes the activation tokens of
+// that user.
+func (us *Service) ActivateUser(ctx context.Context, tokenPlaintext string) (*User, error, map[string]string) {
+	v := validator.New()
+
+	if ValidateTokenPlaintext(v, tokenPlaintext); !v.Valid() {
+		return nil, UserValidationError, v.Errors
+	}
+
+	user, err := us.store.ReadForToken(ctx, ScopeActivation, tokenPlaintext)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			v.AddError("token", "invalid or expired activation token")
+			return nil, UserValidationError, v.Errors
+		}
+		return nil, err, nil
+	}
+
+	user.Activated = true
+
+	err = us.store.Update(ctx, user)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	err = us.store.DeleteTokensForUser(ctx, ScopeActivation, user.ID)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return user, nil, nil
+}
+
+// CreateAuthenticationToken issues an authentication token for the user with the given email address and
+// password. An unknown email and a wrong password are both reported as ErrInvalidCredentials.
+func (us *Service) CreateAuthenticationToken(ctx context.Context, email, password string) (*Token, error, map[string]string) {
+	v := validator.New()
+
+	ValidateEmail(v, email)
+	ValidatePasswordPlaintext(v, password)
+
+	if !v.Valid() {
+		return nil, UserValidationError, v.Errors
+	}
+
+	user, err := us.store.ReadByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials, nil
+		}
+		return nil, err, nil
+	}
+
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if !match {
+		return nil, ErrInvalidCredentials, nil
+	}
+
+	token, err := newToken(user.ID, us.cfg.AuthenticationTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	err = us.store.InsertToken(ctx, token)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return token, nil, nil
+}
+
+// AuthenticateToken returns the user an unexpired authentication token belongs to.
+func (us *Service) AuthenticateToken(ctx context.Context, tokenPlaintext string) (*User, error, map[string]string) {
+	v := validator.New()
+
+	if ValidateTokenPlaintext(v, tokenPlaintext); !v.Valid() {
+		return nil, ErrInvalidToken, v.Errors
+	}
+
+	user, err := us.store.ReadForToken(ctx, ScopeAuthentication, tokenPlaintext)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return nil, ErrInvalidToken, nil
+		}
+		return nil, err, nil
+	}
+
+	return user, nil, nil
+}
+
+func (us *Service) ReadPermissions(ctx context.Context, userId int64) (Permissions, error, map[string]string) {
+	permissions, err := us.store.ReadPermissionsForUser(ctx, userId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return permissions, nil, nil
+}
+
+// sendActivationEmailJob creates a fresh activation token and emails it. The token is created by the job
+// rather than at registration so its plaintext is never persisted with the job, a retry replaces the
+// tokens of earlier attempts.
+func (us *Service) sendActivationEmailJob(ctx context.Context, job *background.Job) error {
+	var payload sendActivationEmailPayload
+
+	err := job.Decode(&payload)
+	if err != nil {
+		return background.Permanent(err)
+	}
+
+	user, err := us.store.ReadById(ctx, payload.UserID)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return background.Permanent(err)
+		}
+		return err
+	}
+
+	if user.Activated {
+		return nil
+	}
+
+	token, err := newToken(user.ID, us.cfg.ActivationTTL, ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	err = us.store.DeleteTokensForUser(ctx, ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = us.store.InsertToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]any{
+		"Name":            user.Name,
+		"ActivationToken": token.Plaintext,
+		"Expiry":          token.Expiry.UTC().Format(time.RFC1123),
+	}
+
+	return us.mailer.Send(ctx, user.Email, "user_welcome.tmpl", data)
+}
+
+func (us *Service) registerJobs() {
+	us.background.Register(JobSendActivationEmail, us.sendActivationEmailJob)
+}
+
+func NewService(db *sql.DB, m mailer.Mailer, bg background.Routine, cfg Config) (Users, error) {
+	s, err := newStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &Service{
+		store:      s,
+		mailer:     m,
+		background: bg,
+		cfg:        cfg,
+	}
+
+	service.registerJobs()
+
+	return service, nil
+}
@@ -0,0 +1,315 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/mailer"
+	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPassword(t *testing.T) {
+	var p password
+
+	assert.NilError(t, p.Set("pa55word"))
+
+	matches, err := p.Matches("pa55word")
+	assert.NilError(t, err)
+	assert.Equal(t, matches, true)
+
+	matches, err = p.Matches("password")
+	assert.NilError(t, err)
+	assert.Equal(t, matches, false)
+}
+
+func TestNewToken(t *testing.T) {
+	token, err := newToken(7, time.Hour, ScopeActivation)
+	assert.NilError(t, err)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+
+	assert.Equal(t, len(token.Plaintext), 26)
+	assert.Equal(t, string(token.Hash), string(hash[:]))
+	assert.Equal(t, token.UserID, int64(7))
+	assert.Equal(t, token.Scope, ScopeActivation)
+	assert.Equal(t, token.Expiry.After(time.Now()), true)
+}
+
+func TestPermissions_Include(t *testing.T) {
+	p := Permissions{PermissionVideosRead, PermissionVideosWrite}
+
+	assert.Equal(t, p.Include(PermissionVideosWrite), true)
+	assert.Equal(t, p.Include(PermissionVideosModerate), false)
+	assert.Equal(t, Permissions(nil).Include(PermissionVideosRead), false)
+}
+
+func TestService_RegisterUser(t *testing.T) {
+	testMaps := []struct {
+		name      string
+		input     UserInput
+		wantsErr  error
+		errorKey  string
+		storeMock storeMock
+		sent      int
+		inserts   int
+	}{
+		{
+			name:      "Can Register",
+			input:     UserInput{Name: "Alice", Email: "alice@example.com", Password: "pa55word"},
+			storeMock: storeMock{fnCalls: make(map[string]int), user: &User{ID: 1, Name: "Alice", Email: "alice@example.com"}, tokens: &[]*Token{}},
+			sent:      1,
+			inserts:   1,
+		},
+		{
+			name:      "Invalid Email",
+			input:     UserInput{Name: "Alice", Email: "alice", Password: "pa55word"},
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  UserValidationError,
+			errorKey:  "email",
+		},
+		{
+			name:      "Short Password",
+			input:     UserInput{Name: "Alice", Email: "alice@example.com", Password: "pass"},
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  UserValidationError,
+			errorKey:  "password",
+		},
+		{
+			name:  "Duplicate Email",
+			input: UserInput{Name: "Alice", Email: "alice@example.com", Password: "pa55word"},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				err:     map[string]error{"InsertWithPermissions": ErrDuplicateEmail},
+			},
+			wantsErr: UserValidationError,
+			errorKey: "email",
+			inserts:  1,
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mailer.NewMemory("Video Sharing <no-reply@example.com>")
+			bg := &background.RoutineMock{}
+
+			service := Service{
+				store:      tt.storeMock,
+				mailer:     m,
+				background: bg,
+				cfg:        Config{ActivationTTL: time.Hour},
+			}
+			service.registerJobs()
+
+			user, err, validationErrors := service.RegisterUser(context.Background(), &tt.input)
+			bg.Wait()
+
+			assert.Equal(t, tt.storeMock.GetFnCalls("InsertWithPermissions"), tt.inserts)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, user.Activated, false)
+				assert.Equal(t, len(*tt.storeMock.tokens), 1)
+
+				messages := m.Messages()
+				assert.Equal(t, len(messages), tt.sent)
+				assert.Equal(t, messages[0].To, tt.input.Email)
+				assert.Equal(t, strings.Contains(messages[0].PlainBody, (*tt.storeMock.tokens)[0].Plaintext), true)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				_, exists := validationErrors[tt.errorKey]
+				assert.Equal(t, exists, true)
+				assert.Equal(t, len(m.Messages()), 0)
+			}
+		})
+	}
+}
+
+func TestService_ActivateUser(t *testing.T) {
+	testMaps := []struct {
+		name      string
+		token     string
+		wantsErr  error
+		errorKey  string
+		storeMock storeMock
+		fnCalls   map[string]int
+	}{
+		{
+			name:      "Can Activate",
+			token:     "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+			storeMock: storeMock{fnCalls: make(map[string]int), user: &User{ID: 1}},
+			fnCalls:   map[string]int{"ReadForToken": 1, "Update": 1, "DeleteTokensForUser": 1},
+		},
+		{
+			name:      "Malformed Token",
+			token:     "ABC",
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  UserValidationError,
+			errorKey:  "token",
+			fnCalls:   map[string]int{"ReadForToken": 0, "Update": 0, "DeleteTokensForUser": 0},
+		},
+		{
+			name:      "Unknown Or Expired Token",
+			token:     "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  UserValidationError,
+			errorKey:  "token",
+			fnCalls:   map[string]int{"ReadForToken": 1, "Update": 0, "DeleteTokensForUser": 0},
+		},
+		{
+			name:  "Edit Conflict",
+			token: "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				user:    &User{ID: 1},
+				err:     map[string]error{"Update": datastore.ErrEditConflict},
+			},
+			wantsErr: datastore.ErrEditConflict,
+			fnCalls:  map[string]int{"ReadForToken": 1, "Update": 1, "DeleteTokensForUser": 0},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{store: tt.storeMock}
+
+			user, err, validationErrors := service.ActivateUser(context.Background(), tt.token)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, user.Activated, true)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				if tt.errorKey != "" {
+					_, exists := validationErrors[tt.errorKey]
+					assert.Equal(t, exists, true)
+				}
+			}
+
+			for fn, calls := range tt.fnCalls {
+				assert.Equal(t, tt.storeMock.GetFnCalls(fn), calls)
+			}
+		})
+	}
+}
+
+func TestService_CreateAuthenticationToken(t *testing.T) {
+	user := &User{ID: 1, Email: "alice@example.com"}
+	assert.NilError(t, user.Password.Set("pa55word"))
+
+	testMaps := []struct {
+		name      string
+		email     string
+		password  string
+		wantsErr  error
+		storeMock storeMock
+		fnCalls   map[string]int
+	}{
+		{
+			name:      "Can Create Token",
+			email:     "alice@example.com",
+			password:  "pa55word",
+			storeMock: storeMock{fnCalls: make(map[string]int), user: user, tokens: &[]*Token{}},
+			fnCalls:   map[string]int{"ReadByEmail": 1, "InsertToken": 1},
+		},
+		{
+			name:      "Invalid Input",
+			email:     "alice",
+			password:  "",
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  UserValidationError,
+			fnCalls:   map[string]int{"ReadByEmail": 0, "InsertToken": 0},
+		},
+		{
+			name:      "Unknown Email",
+			email:     "bob@example.com",
+			password:  "pa55word",
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  ErrInvalidCredentials,
+			fnCalls:   map[string]int{"ReadByEmail": 1, "InsertToken": 0},
+		},
+		{
+			name:      "Wrong Password",
+			email:     "alice@example.com",
+			password:  "wrongpassword",
+			storeMock: storeMock{fnCalls: make(map[string]int), user: user},
+			wantsErr:  ErrInvalidCredentials,
+			fnCalls:   map[string]int{"ReadByEmail": 1, "InsertToken": 0},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{store: tt.storeMock, cfg: Config{AuthenticationTTL: time.Hour}}
+
+			token, err, _ := service.CreateAuthenticationToken(context.Background(), tt.email, tt.password)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, token.Scope, ScopeAuthentication)
+				assert.Equal(t, token.UserID, user.ID)
+				assert.Equal(t, len(*tt.storeMock.tokens), 1)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			for fn, calls := range tt.fnCalls {
+				assert.Equal(t, tt.storeMock.GetFnCalls(fn), calls)
+			}
+		})
+	}
+}
+
+func TestService_AuthenticateToken(t *testing.T) {
+	testMaps := []struct {
+		name      string
+		token     string
+		wantsErr  error
+		storeMock storeMock
+		fnCalls   map[string]int
+	}{
+		{
+			name:      "Valid Token",
+			token:     "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+			storeMock: storeMock{fnCalls: make(map[string]int), user: &User{ID: 1, Activated: true}},
+			fnCalls:   map[string]int{"ReadForToken": 1},
+		},
+		{
+			name:      "Malformed Token",
+			token:     "ABC",
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  ErrInvalidToken,
+			fnCalls:   map[string]int{"ReadForToken": 0},
+		},
+		{
+			name:      "Unknown Or Expired Token",
+			token:     "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  ErrInvalidToken,
+			fnCalls:   map[string]int{"ReadForToken": 1},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{store: tt.storeMock}
+
+			user, err, _ := service.AuthenticateToken(context.Background(), tt.token)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, user.ID, int64(1))
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			for fn, calls := range tt.fnCalls {
+				assert.Equal(t, tt.storeMock.GetFnCalls(fn), calls)
+			}
+		})
+	}
+}
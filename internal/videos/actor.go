@@ -0,0 +1,33 @@
+package videos
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrNotOwner = errors.New("video is owned by another user")
+
+// Actor is the user a video operation is performed for. Users manage the videos they own, moderators
+// manage every video.
+type Actor struct {
+	UserID    int64
+	Moderator bool
+}
+
+func (a Actor) owns(video *Video) bool {
+	return a.Moderator || (a.UserID != 0 && video.OwnerID == a.UserID)
+}
+
+// ownerFilter is the owner store queries are restricted to, zero for moderators who see every video.
+func (a Actor) ownerFilter() int64 {
+	if a.Moderator {
+		return 0
+	}
+
+	return a.UserID
+}
+
+// String is the name recorded in the status history for changes made by the actor.
+func (a Actor) String() string {
+	return "user:" + strconv.FormatInt(a.UserID, 10)
+}
@@ -3,21 +3,40 @@ package videos
 import (
 	"context"
 	"io"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
 	"luismatosgarcia.dev/video-sharing-go/internal/tests"
 	"mime/multipart"
+	"time"
 )
 
 type Mock struct {
-	Video     *Video
-	Err       error
-	ErrorsMap map[string]string
+	Video      *Video
+	Videos     []*Video
+	Results    []*SearchResult
+	Metadata   datastore.Metadata
+	ObjectInfo *filestore.ObjectInfo
+	Object     *filestore.Object
+	Playlist   []byte
+	URL        *filestore.PresignedURL
+	Err        error
+	ErrorsMap  map[string]string
 }
 
-func (m Mock) UploadVideo(ctx context.Context, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string) {
+func (m Mock) UploadVideo(ctx context.Context, actor Actor, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string) {
 	return m.Video, m.Err, m.ErrorsMap
 }
 
-func (m Mock) uploadVideoBackground(ctx context.Context, video *Video, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) {
+func (m Mock) ReserveVideo(ctx context.Context, actor Actor) (*Video, error, map[string]string) {
+	return m.Video, m.Err, m.ErrorsMap
+}
+
+func (m Mock) UploadReservedVideo(ctx context.Context, actor Actor, videoId int64, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string) {
+	return m.Video, m.Err, m.ErrorsMap
+}
+
+func (m Mock) DiscardReservedVideo(ctx context.Context, videoId int64) (error, map[string]string) {
+	return m.Err, m.ErrorsMap
 }
 
 func (m Mock) CreateVideo(ctx context.Context, video *Video) (*Video, error, map[string]string) {
@@ -28,16 +47,90 @@ func (m Mock) ReadVideo(ctx context.Context, videoId int64) (*Video, error, map[
 	return m.Video, m.Err, m.ErrorsMap
 }
 
-func (m Mock) UpdateVideo(ctx context.Context, videoId int64, videoInput *VideoInput) (*Video, error, map[string]string) {
+func (m Mock) ListVideos(ctx context.Context, filters VideoFilters) ([]*Video, datastore.Metadata, error, map[string]string) {
+	return m.Videos, m.Metadata, m.Err, m.ErrorsMap
+}
+
+func (m Mock) SearchVideos(ctx context.Context, filters SearchFilters) ([]*SearchResult, datastore.Metadata, error, map[string]string) {
+	return m.Results, m.Metadata, m.Err, m.ErrorsMap
+}
+
+func (m Mock) UpdateVideo(ctx context.Context, actor Actor, videoId int64, videoInput *VideoInput) (*Video, error, map[string]string) {
+	return m.Video, m.Err, m.ErrorsMap
+}
+
+func (m Mock) UpdateVideoStatus(ctx context.Context, actor Actor, videoId int64, status Status) (*Video, error, map[string]string) {
+	return m.Video, m.Err, m.ErrorsMap
+}
+
+func (m Mock) DeleteVideo(ctx context.Context, actor Actor, videoId int64) (error, map[string]string) {
+	return m.Err, m.ErrorsMap
+}
+
+func (m Mock) RestoreVideo(ctx context.Context, actor Actor, videoId int64) (*Video, error, map[string]string) {
+	return m.Video, m.Err, m.ErrorsMap
+}
+
+func (m Mock) ListDeletedVideos(ctx context.Context, actor Actor, filters datastore.Filters) ([]*Video, datastore.Metadata, error, map[string]string) {
+	return m.Videos, m.Metadata, m.Err, m.ErrorsMap
+}
+
+func (m Mock) StatVideoContent(ctx context.Context, videoId int64) (*Video, *filestore.ObjectInfo, error, map[string]string) {
+	return m.Video, m.ObjectInfo, m.Err, m.ErrorsMap
+}
+
+func (m Mock) ReadVideoContent(ctx context.Context, video *Video, offset, length int64) (*filestore.Object, error, map[string]string) {
+	return m.Object, m.Err, m.ErrorsMap
+}
+
+func (m Mock) HLSMasterPlaylist(ctx context.Context, videoId int64) (*Video, []byte, error, map[string]string) {
+	return m.Video, m.Playlist, m.Err, m.ErrorsMap
+}
+
+func (m Mock) StatHLSFile(ctx context.Context, videoId int64, name string) (*Video, *filestore.ObjectInfo, error, map[string]string) {
+	return m.Video, m.ObjectInfo, m.Err, m.ErrorsMap
+}
+
+func (m Mock) DASHManifest(ctx context.Context, videoId int64) (*Video, []byte, error, map[string]string) {
+	return m.Video, m.Playlist, m.Err, m.ErrorsMap
+}
+
+func (m Mock) StatDASHFile(ctx context.Context, videoId int64, name string) (*Video, *filestore.ObjectInfo, error, map[string]string) {
+	return m.Video, m.ObjectInfo, m.Err, m.ErrorsMap
+}
+
+func (m Mock) ReadPackagedFile(ctx context.Context, video *Video, key string, offset, length int64) (*filestore.Object, error, map[string]string) {
+	return m.Object, m.Err, m.ErrorsMap
+}
+
+func (m Mock) CreateDirectUpload(ctx context.Context, actor Actor, filename, contentType string) (*Video, *filestore.PresignedURL, error, map[string]string) {
+	return m.Video, m.URL, m.Err, m.ErrorsMap
+}
+
+func (m Mock) CompleteDirectUpload(ctx context.Context, actor Actor, videoId int64) (*Video, error, map[string]string) {
 	return m.Video, m.Err, m.ErrorsMap
 }
 
+func (m Mock) AcceptDirectUpload(ctx context.Context, key string) (error, map[string]string) {
+	return m.Err, m.ErrorsMap
+}
+
+func (m Mock) PresignVideoDownload(ctx context.Context, videoId int64) (*Video, *filestore.PresignedURL, error, map[string]string) {
+	return m.Video, m.URL, m.Err, m.ErrorsMap
+}
+
 // Store
 
 type storeMock struct {
-	fnCalls map[string]int
-	video   *Video
-	err     map[string]error
+	fnCalls    map[string]int
+	video      *Video
+	videos     []*Video
+	results    []*SearchResult
+	expired    []int64
+	purged     []string
+	blob       *Blob
+	renditions []*Rendition
+	err        map[string]error
 }
 
 func (s storeMock) Insert(ctx context.Context, v *Video) error {
@@ -45,16 +138,120 @@ func (s storeMock) Insert(ctx context.Context, v *Video) error {
 	return s.err["Insert"]
 }
 
+func (s storeMock) InsertWithPath(ctx context.Context, v *Video, path func(id int64) string) error {
+	tests.Called(s.fnCalls, "InsertWithPath")
+	if err := s.err["InsertWithPath"]; err != nil {
+		return err
+	}
+
+	v.Path = path(v.ID)
+	return nil
+}
+
 func (s storeMock) Update(ctx context.Context, v *Video) error {
 	tests.Called(s.fnCalls, "Update")
 	return s.err["Update"]
 }
 
+func (s storeMock) Delete(ctx context.Context, videoId int64) error {
+	tests.Called(s.fnCalls, "Delete")
+	return s.err["Delete"]
+}
+
 func (s storeMock) ReadById(ctx context.Context, videoId int64) (*Video, error) {
 	tests.Called(s.fnCalls, "ReadById")
 	return s.video, s.err["ReadById"]
 }
 
+func (s storeMock) List(ctx context.Context, filters VideoFilters) ([]*Video, int, error) {
+	tests.Called(s.fnCalls, "List")
+	return s.videos, len(s.videos), s.err["List"]
+}
+
+func (s storeMock) Search(ctx context.Context, filters SearchFilters) ([]*SearchResult, int, error) {
+	tests.Called(s.fnCalls, "Search")
+	return s.results, len(s.results), s.err["Search"]
+}
+
+// AttachBlob references the set blob like stored content, without one a blob has to come with its key
+func (s storeMock) AttachBlob(ctx context.Context, v *Video, blob *Blob) error {
+	tests.Called(s.fnCalls, "AttachBlob")
+	if err := s.err["AttachBlob"]; err != nil {
+		return err
+	}
+
+	switch {
+	case s.blob != nil:
+		*blob = *s.blob
+	case blob.Key == "":
+		return datastore.ErrRecordNotFound
+	}
+
+	v.Path = blob.Key
+	v.ContentSHA256 = blob.SHA256
+
+	return nil
+}
+
+// SetStatus applies the transition table like the database store does
+func (s storeMock) SetStatus(ctx context.Context, v *Video, to Status, actor, reason string) error {
+	tests.Called(s.fnCalls, "SetStatus")
+	if err := s.err["SetStatus"]; err != nil {
+		return err
+	}
+
+	if !v.Status.CanTransitionTo(to) {
+		return ErrInvalidTransition
+	}
+
+	v.Status = to
+	if to == StatusFailed {
+		v.FailureReason = reason
+	}
+
+	return nil
+}
+
+func (s storeMock) SetMediaInfo(ctx context.Context, v *Video) error {
+	tests.Called(s.fnCalls, "SetMediaInfo")
+	return s.err["SetMediaInfo"]
+}
+
+func (s storeMock) SoftDelete(ctx context.Context, v *Video, actor string) error {
+	tests.Called(s.fnCalls, "SoftDelete")
+	return s.err["SoftDelete"]
+}
+
+func (s storeMock) Restore(ctx context.Context, videoId, ownerId int64, actor string) error {
+	tests.Called(s.fnCalls, "Restore")
+	return s.err["Restore"]
+}
+
+func (s storeMock) ListDeleted(ctx context.Context, ownerId int64, filters datastore.Filters) ([]*Video, int, error) {
+	tests.Called(s.fnCalls, "ListDeleted")
+	return s.videos, len(s.videos), s.err["ListDeleted"]
+}
+
+func (s storeMock) ListExpired(ctx context.Context, deletedBefore time.Time, limit int) ([]int64, error) {
+	tests.Called(s.fnCalls, "ListExpired")
+	return s.expired, s.err["ListExpired"]
+}
+
+func (s storeMock) Purge(ctx context.Context, videoId int64) ([]string, error) {
+	tests.Called(s.fnCalls, "Purge")
+	return s.purged, s.err["Purge"]
+}
+
+func (s storeMock) InsertRendition(ctx context.Context, r *Rendition) error {
+	tests.Called(s.fnCalls, "InsertRendition")
+	return s.err["InsertRendition"]
+}
+
+func (s storeMock) ListRenditions(ctx context.Context, videoId int64) ([]*Rendition, error) {
+	tests.Called(s.fnCalls, "ListRenditions")
+	return s.renditions, s.err["ListRenditions"]
+}
+
 func (s storeMock) GetFnCalls(fnName string) int {
 	value, exists := s.fnCalls[fnName]
 
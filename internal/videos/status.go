@@ -0,0 +1,64 @@
+package videos
+
+import (
+	"errors"
+)
+
+var ErrInvalidTransition = errors.New("video status transition is not allowed")
+
+// Status is the lifecycle state of a video. Every change is checked against the transition table and
+// recorded in the status history.
+type Status string
+
+const (
+	StatusUploading  Status = "uploading"
+	StatusProcessing Status = "processing"
+	StatusReady      Status = "ready"
+	StatusFailed     Status = "failed"
+	StatusPublished  Status = "published"
+	StatusArchived   Status = "archived"
+	StatusDeleted    Status = "deleted"
+)
+
+// actorUploadJob and actorProbeJob are recorded in the status history for changes made by the jobs.
+const (
+	actorUploadJob = "job:" + string(JobUploadVideo)
+	actorProbeJob  = "job:" + string(JobProbeVideo)
+)
+
+// transitions lists the statuses a video may move to from each status. Leaving StatusDeleted is only done
+// by a restore, which returns the video to the status it had before it was deleted.
+var transitions = map[Status][]Status{
+	StatusUploading:  {StatusProcessing, StatusFailed, StatusDeleted},
+	StatusProcessing: {StatusReady, StatusFailed, StatusDeleted},
+	StatusReady:      {StatusProcessing, StatusPublished, StatusArchived, StatusDeleted},
+	StatusFailed:     {StatusProcessing, StatusDeleted},
+	StatusPublished:  {StatusReady, StatusArchived, StatusDeleted},
+	StatusArchived:   {StatusReady, StatusPublished, StatusDeleted},
+	StatusDeleted:    {StatusUploading, StatusProcessing, StatusReady, StatusFailed, StatusPublished, StatusArchived},
+}
+
+// manualStatuses are the statuses a client may request, the others are set by the upload pipeline. Only
+// the pipeline marks a video ready, once its content was probed.
+var manualStatuses = []Status{StatusPublished, StatusArchived}
+
+// listableStatuses are the statuses a listing can be filtered on, deleted videos live in the trash.
+var listableStatuses = []string{
+	string(StatusUploading),
+	string(StatusProcessing),
+	string(StatusReady),
+	string(StatusFailed),
+	string(StatusPublished),
+	string(StatusArchived),
+}
+
+// CanTransitionTo reports whether the transition table allows moving from s to next.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,14 +4,39 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/lib/pq"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
+	"strings"
 	"time"
+	"unicode"
 )
 
+// videoSortColumns maps the sort fields of the API onto columns.
+var videoSortColumns = map[string]string{
+	"id":             "id",
+	"title":          "title",
+	"published_date": "published_at",
+}
+
 type store interface {
 	Insert(ctx context.Context, v *Video) error
+	InsertWithPath(ctx context.Context, v *Video, path func(id int64) string) error
 	Update(ctx context.Context, v *Video) error
+	Delete(ctx context.Context, videoId int64) error
 	ReadById(ctx context.Context, videoId int64) (*Video, error)
+	List(ctx context.Context, filters VideoFilters) ([]*Video, int, error)
+	Search(ctx context.Context, filters SearchFilters) ([]*SearchResult, int, error)
+	AttachBlob(ctx context.Context, v *Video, blob *Blob) error
+	SetStatus(ctx context.Context, v *Video, to Status, actor, reason string) error
+	SetMediaInfo(ctx context.Context, v *Video) error
+	SoftDelete(ctx context.Context, v *Video, actor string) error
+	Restore(ctx context.Context, videoId, ownerId int64, actor string) error
+	ListDeleted(ctx context.Context, ownerId int64, filters datastore.Filters) ([]*Video, int, error)
+	ListExpired(ctx context.Context, deletedBefore time.Time, limit int) ([]int64, error)
+	Purge(ctx context.Context, videoId int64) ([]string, error)
+	InsertRendition(ctx context.Context, r *Rendition) error
+	ListRenditions(ctx context.Context, videoId int64) ([]*Rendition, error)
 }
 
 type videoStore struct {
@@ -19,11 +44,11 @@ type videoStore struct {
 }
 
 func (v *videoStore) Insert(ctx context.Context, video *Video) error {
-	query := `INSERT INTO videos (status) 
-			VALUES ($1)
+	query := `INSERT INTO videos (status, owner_id, mime_type) 
+			VALUES ($1, NULLIF($2, 0), NULLIF($3, ''))
 			RETURNING id, status, created_at, version`
 
-	args := []any{"Uploading"}
+	args := []any{StatusUploading, video.OwnerID, video.MimeType}
 
 	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -31,19 +56,58 @@ func (v *videoStore) Insert(ctx context.Context, video *Video) error {
 	return v.db.QueryRowContext(dbCtx, query, args...).Scan(&video.ID, &video.Status, &video.CreatedAt, &video.Version)
 }
 
-func (v *videoStore) Update(ctx context.Context, video *Video) error {
-	query := `UPDATE videos SET title = $1, description = $2, video_path = $3, thumbnail_path = $4, status = $5, 
-                  published_at = $6, version = version + 1, updated_at = now()
+// InsertWithPath inserts a video together with the key of its content, derived from the id the insert
+// assigns. Both are written in one transaction so a video is never left without its key.
+func (v *videoStore) InsertWithPath(ctx context.Context, video *Video, path func(id int64) string) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := v.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO videos (status, owner_id, mime_type) 
+			VALUES ($1, NULLIF($2, 0), NULLIF($3, ''))
+			RETURNING id, status, created_at`
+
+	err = tx.QueryRowContext(dbCtx, query, StatusUploading, video.OwnerID, video.MimeType).Scan(&video.ID, &video.Status, &video.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE videos SET video_path = $1, version = version + 1 WHERE id = $2 RETURNING version`
+
+	err = tx.QueryRowContext(dbCtx, query, path(video.ID), video.ID).Scan(&video.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	video.Path = path(video.ID)
+
+	return nil
+}
+
+// updateVideoQuery leaves the status alone, it only changes through SetStatus, SoftDelete and Restore.
+const updateVideoQuery = `UPDATE videos SET title = $1, description = $2, video_path = $3, thumbnail_path = $4, 
+                  published_at = $5, mime_type = NULLIF($6, ''), version = version + 1, updated_at = now()
               	  WHERE id = $7 AND version = $8
                   RETURNING version`
 
+func (v *videoStore) Update(ctx context.Context, video *Video) error {
 	args := []any{
 		video.Title,
 		video.Description,
 		video.Path,
 		video.ImgPath,
-		video.Status,
-		video.PublishedDate.UTC(),
+		nullTime(video.PublishedDate.UTC()),
+		video.MimeType,
 		video.ID,
 		video.Version,
 	}
@@ -51,7 +115,7 @@ func (v *videoStore) Update(ctx context.Context, video *Video) error {
 	dbCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := v.db.QueryRowContext(dbCtx, query, args...).Scan(&video.Version)
+	err := v.db.QueryRowContext(dbCtx, updateVideoQuery, args...).Scan(&video.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -64,24 +128,51 @@ func (v *videoStore) Update(ctx context.Context, video *Video) error {
 	return nil
 }
 
+// Delete permanently removes a video still waiting for its content, one that never got any is not kept
+// around. It reports ErrRecordNotFound once the video moved on.
+func (v *videoStore) Delete(ctx context.Context, videoId int64) error {
+	query := `DELETE FROM videos WHERE id = $1 AND status = $2`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return expectAffected(v.db.ExecContext(dbCtx, query, videoId, StatusUploading))
+}
+
 func (v *videoStore) ReadById(ctx context.Context, videoId int64) (*Video, error) {
 
-	query := `SELECT id, title, description, video_path, thumbnail_path, status, published_at, version FROM videos 
-			  WHERE id = $1`
+	query := `SELECT id, COALESCE(owner_id, 0), COALESCE(title, ''), COALESCE(description, ''), COALESCE(video_path, ''),
+			  COALESCE(thumbnail_path, ''), status, COALESCE(failure_reason, ''), published_at, COALESCE(content_sha256, ''), 
+			  COALESCE(duration_ms, 0), COALESCE(width, 0), COALESCE(height, 0),
+			  COALESCE(video_codec, ''), COALESCE(audio_codec, ''), COALESCE(bitrate, 0), COALESCE(container, ''), COALESCE(mime_type, ''),
+			  version FROM videos 
+			  WHERE id = $1 AND deleted_at IS NULL`
 
 	var video Video
+	var publishedDate sql.NullTime
 
 	dbCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	err := v.db.QueryRowContext(dbCtx, query, videoId).Scan(
 		&video.ID,
+		&video.OwnerID,
 		&video.Title,
 		&video.Description,
 		&video.Path,
 		&video.ImgPath,
 		&video.Status,
-		&video.PublishedDate,
+		&video.FailureReason,
+		&publishedDate,
+		&video.ContentSHA256,
+		&video.DurationMs,
+		&video.Width,
+		&video.Height,
+		&video.VideoCodec,
+		&video.AudioCodec,
+		&video.Bitrate,
+		&video.Container,
+		&video.MimeType,
 		&video.Version,
 	)
 
@@ -94,9 +185,781 @@ func (v *videoStore) ReadById(ctx context.Context, videoId int64) (*Video, error
 		}
 	}
 
+	video.PublishedDate = publishedDate.Time
+
 	return &video, nil
 }
 
+// List returns a page of the videos matching filters together with the total number of matches. Ties are
+// broken by id so pages are stable.
+func (v *videoStore) List(ctx context.Context, filters VideoFilters) ([]*Video, int, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, COALESCE(owner_id, 0), COALESCE(title, ''), COALESCE(description, ''), 
+			  COALESCE(video_path, ''), COALESCE(thumbnail_path, ''), status, published_at, COALESCE(content_sha256, ''), 
+			  COALESCE(duration_ms, 0), COALESCE(width, 0), COALESCE(height, 0),
+			  COALESCE(video_codec, ''), COALESCE(audio_codec, ''), COALESCE(bitrate, 0), COALESCE(container, ''), COALESCE(mime_type, ''),
+			  version FROM videos
+			  WHERE deleted_at IS NULL
+			  AND (to_tsvector('simple', COALESCE(title, '')) @@ plainto_tsquery('simple', $1) OR $1 = '')
+			  AND (status = ANY($2) OR cardinality($2::text[]) = 0)
+			  AND ($3::timestamptz IS NULL OR published_at >= $3)
+			  AND ($4::timestamptz IS NULL OR published_at <= $4)
+			  ORDER BY %s %s, id ASC
+			  LIMIT $5 OFFSET $6`, videoSortColumns[filters.SortColumn()], filters.SortDirection())
+
+	statuses := filters.Statuses
+	if statuses == nil {
+		statuses = []string{}
+	}
+
+	args := []any{
+		filters.Title,
+		pq.Array(statuses),
+		nullTime(filters.PublishedFrom),
+		nullTime(filters.PublishedTo),
+		filters.Limit(),
+		filters.Offset(),
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := v.db.QueryContext(dbCtx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	videos := []*Video{}
+
+	for rows.Next() {
+		var video Video
+		var publishedDate sql.NullTime
+
+		err = rows.Scan(
+			&totalRecords,
+			&video.ID,
+			&video.OwnerID,
+			&video.Title,
+			&video.Description,
+			&video.Path,
+			&video.ImgPath,
+			&video.Status,
+			&publishedDate,
+			&video.ContentSHA256,
+			&video.DurationMs,
+			&video.Width,
+			&video.Height,
+			&video.VideoCodec,
+			&video.AudioCodec,
+			&video.Bitrate,
+			&video.Container,
+			&video.MimeType,
+			&video.Version,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		video.PublishedDate = publishedDate.Time
+		videos = append(videos, &video)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return videos, totalRecords, nil
+}
+
+// Search ranks the videos matching the query by ts_rank over the weighted title and description vector.
+// Headlines are only computed for the rows of the requested page.
+func (v *videoStore) Search(ctx context.Context, filters SearchFilters) ([]*SearchResult, int, error) {
+	webQuery, prefixQuery := parseSearchQuery(filters.Query)
+
+	order := "rank DESC, id ASC"
+	if filters.SortColumn() == "published_date" {
+		order = fmt.Sprintf("published_at %s NULLS LAST, id ASC", filters.SortDirection())
+	}
+
+	query := fmt.Sprintf(`SELECT total, id, owner_id, title, description, video_path, thumbnail_path, status, published_at,
+			  content_sha256, duration_ms, width, height, video_codec, audio_codec, bitrate, container, mime_type, version, rank,
+			  ts_headline('english', title, query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+			  ts_headline('english', description, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')
+			  FROM (
+				  SELECT count(*) OVER() AS total, id, COALESCE(owner_id, 0) AS owner_id, COALESCE(title, '') AS title, COALESCE(description, '') AS description,
+				  COALESCE(video_path, '') AS video_path, COALESCE(thumbnail_path, '') AS thumbnail_path, status, published_at,
+				  COALESCE(content_sha256, '') AS content_sha256, COALESCE(duration_ms, 0) AS duration_ms, COALESCE(width, 0) AS width,
+				  COALESCE(height, 0) AS height, COALESCE(video_codec, '') AS video_codec, COALESCE(audio_codec, '') AS audio_codec,
+				  COALESCE(bitrate, 0) AS bitrate, COALESCE(container, '') AS container, COALESCE(mime_type, '') AS mime_type, version, ts_rank(search_vector, q.query) AS rank, q.query
+				  FROM videos, (SELECT websearch_to_tsquery('english', $1) && to_tsquery('english', $2) AS query) q
+				  WHERE search_vector @@ q.query AND deleted_at IS NULL
+				  ORDER BY %s
+				  LIMIT $3 OFFSET $4
+			  ) results
+			  ORDER BY %s`, order, order)
+
+	args := []any{webQuery, prefixQuery, filters.Limit(), filters.Offset()}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := v.db.QueryContext(dbCtx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*SearchResult{}
+
+	for rows.Next() {
+		var video Video
+		var publishedDate sql.NullTime
+		var result SearchResult
+
+		err = rows.Scan(
+			&totalRecords,
+			&video.ID,
+			&video.OwnerID,
+			&video.Title,
+			&video.Description,
+			&video.Path,
+			&video.ImgPath,
+			&video.Status,
+			&publishedDate,
+			&video.ContentSHA256,
+			&video.DurationMs,
+			&video.Width,
+			&video.Height,
+			&video.VideoCodec,
+			&video.AudioCodec,
+			&video.Bitrate,
+			&video.Container,
+			&video.MimeType,
+			&video.Version,
+			&result.Rank,
+			&result.Highlights.Title,
+			&result.Highlights.Description,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		video.PublishedDate = publishedDate.Time
+		result.Video = &video
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return results, totalRecords, nil
+}
+
+// parseSearchQuery splits a user query into the part handed to websearch_to_tsquery, which understands
+// quoted phrases, "or" and "-" negation, and a to_tsquery expression for the words ending in "*", which
+// websearch_to_tsquery cannot express. Prefix words are reduced to letters and digits so the expression is
+// always valid, every run becomes its own prefix match.
+func parseSearchQuery(q string) (string, string) {
+	var web []string
+	var prefixes []string
+
+	for _, token := range searchTokens(q) {
+		if strings.Contains(token, `"`) || !strings.HasSuffix(token, "*") {
+			web = append(web, token)
+			continue
+		}
+
+		negate := strings.HasPrefix(token, "-")
+
+		for _, run := range strings.FieldsFunc(token, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			term := strings.ToLower(run) + ":*"
+			if negate {
+				term = "!" + term
+			}
+			prefixes = append(prefixes, term)
+		}
+	}
+
+	return strings.Join(web, " "), strings.Join(prefixes, " & ")
+}
+
+// searchTokens splits a query on whitespace, keeping quoted phrases together as a single token.
+func searchTokens(q string) []string {
+	var tokens []string
+	var current strings.Builder
+
+	inQuote := false
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens
+}
+
+// SetStatus moves the video to another status and records the change in the status history. The
+// transition must be allowed from the status the video was read with, a video whose status changed in the
+// meantime reports ErrEditConflict. The failure reason is only kept when the video moves to StatusFailed.
+func (v *videoStore) SetStatus(ctx context.Context, video *Video, to Status, actor, reason string) error {
+	if !video.Status.CanTransitionTo(to) {
+		return ErrInvalidTransition
+	}
+
+	failureReason := ""
+	if to == StatusFailed {
+		failureReason = reason
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := v.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE videos SET status = $1, failure_reason = NULLIF($2, ''), version = version + 1, updated_at = now()
+			  WHERE id = $3 AND status = $4 AND deleted_at IS NULL
+			  RETURNING version`
+
+	var version int32
+
+	err = tx.QueryRowContext(dbCtx, query, to, failureReason, video.ID, video.Status).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = insertStatusChange(dbCtx, tx, video.ID, video.Status, to, actor, reason)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	video.Status = to
+	video.FailureReason = failureReason
+	video.Version = version
+
+	return nil
+}
+
+// SetMediaInfo stores the technical metadata of the video content. The probe job is the only writer of
+// these columns, the update does not check the version.
+func (v *videoStore) SetMediaInfo(ctx context.Context, video *Video) error {
+	query := `UPDATE videos SET duration_ms = $1, width = $2, height = $3, video_codec = NULLIF($4, ''),
+			  audio_codec = NULLIF($5, ''), bitrate = $6, container = NULLIF($7, ''), version = version + 1, updated_at = now()
+			  WHERE id = $8 AND deleted_at IS NULL
+			  RETURNING version`
+
+	args := []any{
+		video.DurationMs,
+		video.Width,
+		video.Height,
+		video.VideoCodec,
+		video.AudioCodec,
+		video.Bitrate,
+		video.Container,
+		video.ID,
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := v.db.QueryRowContext(dbCtx, query, args...).Scan(&video.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SoftDelete moves the video to the trash. It reports ErrEditConflict when the video changed status or was
+// deleted since it was read.
+func (v *videoStore) SoftDelete(ctx context.Context, video *Video, actor string) error {
+	if !video.Status.CanTransitionTo(StatusDeleted) {
+		return ErrInvalidTransition
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := v.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE videos SET status = $1, deleted_at = now(), version = version + 1, updated_at = now()
+			  WHERE id = $2 AND status = $3 AND deleted_at IS NULL`
+
+	err = expectAffected(tx.ExecContext(dbCtx, query, StatusDeleted, video.ID, video.Status))
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return datastore.ErrEditConflict
+		}
+		return err
+	}
+
+	err = insertStatusChange(dbCtx, tx, video.ID, video.Status, StatusDeleted, actor, "")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore takes the video out of the trash and returns it to the status it had before it was deleted, as
+// recorded in the status history. A non zero ownerId restricts the restore to videos of that owner.
+func (v *videoStore) Restore(ctx context.Context, videoId, ownerId int64, actor string) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := v.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE videos SET status = h.from_status, deleted_at = NULL, version = version + 1, updated_at = now()
+			  FROM (
+				  SELECT from_status FROM video_status_history
+				  WHERE video_id = $1 AND to_status = $2
+				  ORDER BY id DESC
+				  LIMIT 1
+			  ) h
+			  WHERE id = $1 AND status = $2 AND (owner_id = $3 OR $3 = 0)
+			  RETURNING videos.status`
+
+	var restored Status
+
+	err = tx.QueryRowContext(dbCtx, query, videoId, StatusDeleted, ownerId).Scan(&restored)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if !StatusDeleted.CanTransitionTo(restored) {
+		return ErrInvalidTransition
+	}
+
+	err = insertStatusChange(dbCtx, tx, videoId, StatusDeleted, restored, actor, "restored from trash")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertStatusChange appends a status change to the history of a video.
+func insertStatusChange(ctx context.Context, tx *sql.Tx, videoId int64, from, to Status, actor, reason string) error {
+	query := `INSERT INTO video_status_history (video_id, from_status, to_status, actor, reason)
+			  VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
+
+	_, err := tx.ExecContext(ctx, query, videoId, from, to, actor, reason)
+
+	return err
+}
+
+// ListDeleted returns a page of the videos in the trash ordered by deletion time. A non zero ownerId
+// restricts the page to videos of that owner.
+func (v *videoStore) ListDeleted(ctx context.Context, ownerId int64, filters datastore.Filters) ([]*Video, int, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, COALESCE(owner_id, 0), COALESCE(title, ''), COALESCE(description, ''), 
+			  COALESCE(video_path, ''), COALESCE(thumbnail_path, ''), status, published_at, COALESCE(content_sha256, ''), 
+			  COALESCE(duration_ms, 0), COALESCE(width, 0), COALESCE(height, 0),
+			  COALESCE(video_codec, ''), COALESCE(audio_codec, ''), COALESCE(bitrate, 0), COALESCE(container, ''), COALESCE(mime_type, ''),
+			  version, deleted_at FROM videos
+			  WHERE deleted_at IS NOT NULL AND (owner_id = $1 OR $1 = 0)
+			  ORDER BY deleted_at %s, id ASC
+			  LIMIT $2 OFFSET $3`, filters.SortDirection())
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := v.db.QueryContext(dbCtx, query, ownerId, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	videos := []*Video{}
+
+	for rows.Next() {
+		var video Video
+		var publishedDate sql.NullTime
+
+		err = rows.Scan(
+			&totalRecords,
+			&video.ID,
+			&video.OwnerID,
+			&video.Title,
+			&video.Description,
+			&video.Path,
+			&video.ImgPath,
+			&video.Status,
+			&publishedDate,
+			&video.ContentSHA256,
+			&video.DurationMs,
+			&video.Width,
+			&video.Height,
+			&video.VideoCodec,
+			&video.AudioCodec,
+			&video.Bitrate,
+			&video.Container,
+			&video.MimeType,
+			&video.Version,
+			&video.DeletedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		video.PublishedDate = publishedDate.Time
+		videos = append(videos, &video)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return videos, totalRecords, nil
+}
+
+// ListExpired returns the ids of up to limit videos deleted before deletedBefore, oldest first.
+func (v *videoStore) ListExpired(ctx context.Context, deletedBefore time.Time, limit int) ([]int64, error) {
+	query := `SELECT id FROM videos
+			  WHERE deleted_at < $1
+			  ORDER BY deleted_at
+			  LIMIT $2`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := v.db.QueryContext(dbCtx, query, deletedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Purge permanently deletes a video in the trash and releases its reference on the content blob. It
+// returns the filestore keys nothing points at anymore, the caller deletes those objects once the
+// transaction has committed.
+func (v *videoStore) Purge(ctx context.Context, videoId int64) ([]string, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := v.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Renditions go with the video row, their keys are read first
+	keys, err := renditionKeys(dbCtx, tx, videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	var path, thumbnailPath, sha256 string
+
+	query := `DELETE FROM videos WHERE id = $1 AND deleted_at IS NOT NULL
+			  RETURNING COALESCE(video_path, ''), COALESCE(thumbnail_path, ''), COALESCE(content_sha256, '')`
+
+	err = tx.QueryRowContext(dbCtx, query, videoId).Scan(&path, &thumbnailPath, &sha256)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, datastore.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if thumbnailPath != "" {
+		keys = append(keys, thumbnailPath)
+	}
+
+	switch {
+	case sha256 != "":
+		var key string
+		var refCount int
+
+		// The row stays locked until commit, AttachBlob can't take a reference on content being released
+		query = `SELECT storage_key, ref_count FROM blobs WHERE sha256 = $1 FOR UPDATE`
+
+		err = tx.QueryRowContext(dbCtx, query, sha256).Scan(&key, &refCount)
+		if err != nil {
+			return nil, err
+		}
+
+		if refCount <= 1 {
+			_, err = tx.ExecContext(dbCtx, `DELETE FROM blobs WHERE sha256 = $1`, sha256)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, key)
+		} else {
+			_, err = tx.ExecContext(dbCtx, `UPDATE blobs SET ref_count = ref_count - 1, updated_at = now() WHERE sha256 = $1`, sha256)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case path != "":
+		// Direct uploads are not content addressed, the object belongs to this video alone
+		keys = append(keys, path)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func renditionKeys(ctx context.Context, tx *sql.Tx, videoId int64) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT storage_key FROM renditions WHERE video_id = $1 ORDER BY id`, videoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+
+	for rows.Next() {
+		var key string
+
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// InsertRendition records a transcoded rendition, a rendition of the video with the same name is
+// replaced.
+func (v *videoStore) InsertRendition(ctx context.Context, r *Rendition) error {
+	query := `INSERT INTO renditions (video_id, name, storage_key, width, height, video_bitrate, audio_bitrate, size,
+			  codecs, bandwidth, average_bandwidth, playlist_key, dash_prefix, dash_audio, segment_duration_ms)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, 0), NULLIF($11, 0), NULLIF($12, ''),
+			  NULLIF($13, ''), $14, NULLIF($15, 0))
+			  ON CONFLICT (video_id, name) DO UPDATE SET storage_key = EXCLUDED.storage_key, width = EXCLUDED.width,
+			  height = EXCLUDED.height, video_bitrate = EXCLUDED.video_bitrate, audio_bitrate = EXCLUDED.audio_bitrate,
+			  size = EXCLUDED.size, codecs = EXCLUDED.codecs, bandwidth = EXCLUDED.bandwidth,
+			  average_bandwidth = EXCLUDED.average_bandwidth, playlist_key = EXCLUDED.playlist_key,
+			  dash_prefix = EXCLUDED.dash_prefix, dash_audio = EXCLUDED.dash_audio,
+			  segment_duration_ms = EXCLUDED.segment_duration_ms, created_at = now()
+			  RETURNING id, created_at`
+
+	args := []any{r.VideoID, r.Name, r.Key, r.Width, r.Height, r.VideoBitrate, r.AudioBitrate, r.Size,
+		r.Codecs, r.Bandwidth, r.AverageBandwidth, r.PlaylistKey, r.DashPrefix, r.DashAudio, r.SegmentDurationMs}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return v.db.QueryRowContext(dbCtx, query, args...).Scan(&r.ID, &r.CreatedAt)
+}
+
+// ListRenditions returns the renditions of a video from the largest to the smallest.
+func (v *videoStore) ListRenditions(ctx context.Context, videoId int64) ([]*Rendition, error) {
+	query := `SELECT id, video_id, name, storage_key, width, height, video_bitrate, audio_bitrate, size,
+			  COALESCE(codecs, ''), COALESCE(bandwidth, 0), COALESCE(average_bandwidth, 0), COALESCE(playlist_key, ''),
+			  COALESCE(dash_prefix, ''), dash_audio, COALESCE(segment_duration_ms, 0), created_at
+			  FROM renditions
+			  WHERE video_id = $1
+			  ORDER BY height DESC, name ASC`
+
+	dbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := v.db.QueryContext(dbCtx, query, videoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renditions := []*Rendition{}
+
+	for rows.Next() {
+		var r Rendition
+
+		err = rows.Scan(&r.ID, &r.VideoID, &r.Name, &r.Key, &r.Width, &r.Height, &r.VideoBitrate, &r.AudioBitrate, &r.Size,
+			&r.Codecs, &r.Bandwidth, &r.AverageBandwidth, &r.PlaylistKey, &r.DashPrefix, &r.DashAudio, &r.SegmentDurationMs,
+			&r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		renditions = append(renditions, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return renditions, nil
+}
+
+// expectAffected maps an update that touched no rows to ErrRecordNotFound.
+func expectAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return datastore.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// AttachBlob takes a reference on the blob, inserting it when it is new, and points the video at it in a
+// single transaction. When a blob with the same hash already exists its key wins, the video and blob are
+// updated with the stored values. A blob without key only references stored content, ErrRecordNotFound
+// reports there is none yet. The reference is taken by the statement that finds the blob so a concurrent
+// Purge can't release the content in between.
+func (v *videoStore) AttachBlob(ctx context.Context, video *Video, blob *Blob) error {
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := v.db.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE blobs SET ref_count = ref_count + 1, updated_at = now()
+			  WHERE sha256 = $1
+			  RETURNING storage_key, size, ref_count`
+
+	err = tx.QueryRowContext(dbCtx, query, blob.SHA256).Scan(&blob.Key, &blob.Size, &blob.RefCount)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if blob.Key == "" {
+			return datastore.ErrRecordNotFound
+		}
+
+		// An identical upload may insert the blob concurrently, the first one wins
+		query = `INSERT INTO blobs (sha256, storage_key, size, ref_count)
+				 VALUES ($1, $2, $3, 1)
+				 ON CONFLICT (sha256) DO UPDATE SET ref_count = blobs.ref_count + 1, updated_at = now()
+				 RETURNING storage_key, size, ref_count`
+
+		err = tx.QueryRowContext(dbCtx, query, blob.SHA256, blob.Key, blob.Size).Scan(&blob.Key, &blob.Size, &blob.RefCount)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	args := []any{
+		video.Title,
+		video.Description,
+		blob.Key,
+		video.ImgPath,
+		nullTime(video.PublishedDate.UTC()),
+		video.MimeType,
+		video.ID,
+		video.Version,
+	}
+
+	var version int32
+
+	err = tx.QueryRowContext(dbCtx, updateVideoQuery, args...).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return datastore.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(dbCtx, `UPDATE videos SET content_sha256 = $1 WHERE id = $2`, blob.SHA256, video.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	video.Path = blob.Key
+	video.ContentSHA256 = blob.SHA256
+	video.Version = version
+
+	return nil
+}
+
 // Initialize Store
 func newStore(db *sql.DB) (*videoStore, error) {
 	return &videoStore{
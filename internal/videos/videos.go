@@ -1,34 +1,211 @@
 package videos
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/dash"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/hls"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/mediaprobe"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/transcoder"
 	"luismatosgarcia.dev/video-sharing-go/internal/validator"
 	"mime/multipart"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	VideoValidationError = errors.New("Video data is not valid")
+	VideoValidationError  = errors.New("Video data is not valid")
+	ErrVideoNotStreamable = errors.New("video is not available for streaming")
+	ErrVideoNotUploading  = errors.New("video is not waiting for a direct upload")
+	ErrUploadIncomplete   = errors.New("video content has not been uploaded")
+	ErrNoVideoTrack       = errors.New("media file has no video track")
+	ErrUnsupportedVideo   = errors.New("video content type is not supported")
+	ErrVideoTooLarge      = errors.New("video content is larger than the maximum size")
+	ErrNotPackaged        = errors.New("video has no renditions packaged for streaming")
 )
 
+const (
+	JobUploadVideo    background.JobKind = "videos:upload"
+	JobProbeVideo     background.JobKind = "videos:probe"
+	JobTranscodeVideo background.JobKind = "videos:transcode"
+	JobPurgeDeleted   background.JobKind = "videos:purge-deleted"
+)
+
+// HLSMaster and DASHManifest are the names the generated manifests are served at, next to the directories
+// of the renditions.
+const (
+	HLSMaster    = "master.m3u8"
+	DASHManifest = "manifest.mpd"
+)
+
+// Names of the files of a packaged rendition, segments are numbered from zero. dashMedia is segmentName
+// as a DASH segment template.
+const (
+	hlsPlaylist = "index.m3u8"
+	initSection = "init.mp4"
+	segmentName = "segment_%05d.m4s"
+	dashMedia   = "segment_$Number%05d$.m4s"
+)
+
+// mimeAudioMP4 is the type of the audio only tracks of DASH renditions.
+const mimeAudioMP4 = "audio/mp4"
+
+// dashMinBufferTime is the buffer DASH players need to play a rendition at its bitrate, the VBV buffer of
+// the encoder holds two seconds.
+const dashMinBufferTime = 2 * time.Second
+
+// purgeBatchSize is the number of expired videos the purge job deletes per round trip.
+const purgeBatchSize = 100
+
+type uploadVideoPayload struct {
+	VideoID  int64  `json:"video_id"`
+	Key      string `json:"key"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+type probeVideoPayload struct {
+	VideoID int64 `json:"video_id"`
+}
+
+// transcodeVideoPayload names the rendition a transcode job produces, a job without rendition enqueues one
+// job per rendition the video is missing.
+type transcodeVideoPayload struct {
+	VideoID   int64  `json:"video_id"`
+	Rendition string `json:"rendition,omitempty"`
+}
+
 type Video struct {
 	ID            int64     `json:"id"`
+	OwnerID       int64     `json:"owner_id,omitempty"`
 	Title         string    `json:"title,omitempty"`
 	Description   string    `json:"description,omitempty"`
 	Path          string    `json:"path,omitempty"`
 	ImgPath       string    `json:"img_path,omitempty"`
-	Status        string    `json:"status,omitempty"`
+	Status        Status    `json:"status,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"`
 	PublishedDate time.Time `json:"published_date,omitempty"`
+	ContentSHA256 string    `json:"content_sha256,omitempty"`
+	DurationMs    int64     `json:"duration_ms,omitempty"`
+	Width         int       `json:"width,omitempty"`
+	Height        int       `json:"height,omitempty"`
+	VideoCodec    string    `json:"video_codec,omitempty"`
+	AudioCodec    string    `json:"audio_codec,omitempty"`
+	Bitrate       int64     `json:"bitrate,omitempty"`
+	Container     string    `json:"container,omitempty"`
+	MimeType      string    `json:"mime_type,omitempty"`
+	DeletedAt     time.Time `json:"deleted_at,omitempty"`
 	CreatedAt     time.Time `json:"-"`
 	UpdatedAt     time.Time `json:"-"`
 	Version       int32     `json:"version"`
 }
 
+// Streamable reports whether the video content has been stored and can be served to viewers.
+func (v *Video) Streamable() bool {
+	return v.Path != "" && (v.Status == StatusReady || v.Status == StatusPublished)
+}
+
+// Blob is stored video content, shared by every video whose content has the same SHA-256. RefCount is the
+// number of videos pointing at it.
+type Blob struct {
+	SHA256   string
+	Key      string
+	Size     int64
+	RefCount int
+}
+
+// Rendition is a transcoded copy of the video content, one per rendition of the ladder. Bitrates are in
+// bits per second. A rendition packaged for HLS has a PlaylistKey, Bandwidth and AverageBandwidth are then
+// the peak and average bitrates of its segments and Codecs their RFC 6381 codecs, if known. A rendition
+// packaged for DASH has its tracks below DashPrefix, an audio track only when DashAudio is set, cut in
+// segments of SegmentDurationMs.
+type Rendition struct {
+	ID                int64     `json:"-"`
+	VideoID           int64     `json:"-"`
+	Name              string    `json:"name"`
+	Key               string    `json:"-"`
+	Width             int       `json:"width"`
+	Height            int       `json:"height"`
+	VideoBitrate      int64     `json:"video_bitrate"`
+	AudioBitrate      int64     `json:"audio_bitrate"`
+	Size              int64     `json:"size"`
+	Codecs            string    `json:"codecs,omitempty"`
+	Bandwidth         int64     `json:"bandwidth,omitempty"`
+	AverageBandwidth  int64     `json:"average_bandwidth,omitempty"`
+	PlaylistKey       string    `json:"-"`
+	DashPrefix        string    `json:"-"`
+	DashAudio         bool      `json:"-"`
+	SegmentDurationMs int64     `json:"-"`
+	CreatedAt         time.Time `json:"-"`
+}
+
+// VideoFilters narrows a video listing. Title is a full text match on the title, Statuses are matched
+// exactly and the published date range is inclusive, zero values disable a filter.
+type VideoFilters struct {
+	Title         string
+	Statuses      []string
+	PublishedFrom time.Time
+	PublishedTo   time.Time
+	datastore.Filters
+}
+
+// SearchFilters holds a full text search query and the page of results to return.
+type SearchFilters struct {
+	Query string
+	datastore.Filters
+}
+
+// SearchResult is a video matching a search, its rank and the matches highlighted with <mark> tags.
+type SearchResult struct {
+	Video      *Video  `json:"video"`
+	Rank       float32 `json:"rank"`
+	Highlights struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"highlights"`
+}
+
+var (
+	trashSortSafelist  = []string{"deleted_date", "-deleted_date"}
+	videoSortSafelist  = []string{"id", "title", "published_date", "-id", "-title", "-published_date"}
+	searchSortSafelist = []string{"relevance", "published_date", "-published_date"}
+)
+
+func ValidateVideoFilters(v *validator.Validator, f VideoFilters) {
+	datastore.ValidateFilters(v, f.Filters)
+
+	v.Check(len(f.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	for _, status := range f.Statuses {
+		v.Check(validator.PermittedValue(status, listableStatuses...), "status", "invalid status value")
+	}
+
+	v.Check(f.PublishedFrom.IsZero() || f.PublishedTo.IsZero() || !f.PublishedTo.Before(f.PublishedFrom), "published_to", "must not be before published_from")
+}
+
+func ValidateSearchFilters(v *validator.Validator, f SearchFilters) {
+	datastore.ValidateFilters(v, f.Filters)
+
+	v.Check(strings.TrimSpace(f.Query) != "", "q", "must be provided")
+	v.Check(len(f.Query) <= 500, "q", "must not be more than 500 bytes long")
+}
+
 type VideoInput struct {
 	Title         *string    `json:"title"`
 	Description   *string    `json:"description"`
@@ -36,17 +213,51 @@ type VideoInput struct {
 }
 
 type Videos interface {
-	UploadVideo(ctx context.Context, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string)
-	uploadVideoBackground(ctx context.Context, video *Video, videoFileReader *io.Reader, fileHeader *multipart.FileHeader)
+	UploadVideo(ctx context.Context, actor Actor, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string)
+	ReserveVideo(ctx context.Context, actor Actor) (*Video, error, map[string]string)
+	UploadReservedVideo(ctx context.Context, actor Actor, videoId int64, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string)
+	DiscardReservedVideo(ctx context.Context, videoId int64) (error, map[string]string)
 	CreateVideo(ctx context.Context, video *Video) (*Video, error, map[string]string)
 	ReadVideo(ctx context.Context, videoId int64) (*Video, error, map[string]string)
-	UpdateVideo(ctx context.Context, videoId int64, videoInput *VideoInput) (*Video, error, map[string]string)
+	ListVideos(ctx context.Context, filters VideoFilters) ([]*Video, datastore.Metadata, error, map[string]string)
+	SearchVideos(ctx context.Context, filters SearchFilters) ([]*SearchResult, datastore.Metadata, error, map[string]string)
+	UpdateVideo(ctx context.Context, actor Actor, videoId int64, videoInput *VideoInput) (*Video, error, map[string]string)
+	UpdateVideoStatus(ctx context.Context, actor Actor, videoId int64, status Status) (*Video, error, map[string]string)
+	DeleteVideo(ctx context.Context, actor Actor, videoId int64) (error, map[string]string)
+	RestoreVideo(ctx context.Context, actor Actor, videoId int64) (*Video, error, map[string]string)
+	ListDeletedVideos(ctx context.Context, actor Actor, filters datastore.Filters) ([]*Video, datastore.Metadata, error, map[string]string)
+	StatVideoContent(ctx context.Context, videoId int64) (*Video, *filestore.ObjectInfo, error, map[string]string)
+	ReadVideoContent(ctx context.Context, video *Video, offset, length int64) (*filestore.Object, error, map[string]string)
+	HLSMasterPlaylist(ctx context.Context, videoId int64) (*Video, []byte, error, map[string]string)
+	StatHLSFile(ctx context.Context, videoId int64, name string) (*Video, *filestore.ObjectInfo, error, map[string]string)
+	DASHManifest(ctx context.Context, videoId int64) (*Video, []byte, error, map[string]string)
+	StatDASHFile(ctx context.Context, videoId int64, name string) (*Video, *filestore.ObjectInfo, error, map[string]string)
+	ReadPackagedFile(ctx context.Context, video *Video, key string, offset, length int64) (*filestore.Object, error, map[string]string)
+	CreateDirectUpload(ctx context.Context, actor Actor, filename, contentType string) (*Video, *filestore.PresignedURL, error, map[string]string)
+	CompleteDirectUpload(ctx context.Context, actor Actor, videoId int64) (*Video, error, map[string]string)
+	AcceptDirectUpload(ctx context.Context, key string) (error, map[string]string)
+	PresignVideoDownload(ctx context.Context, videoId int64) (*Video, *filestore.PresignedURL, error, map[string]string)
+}
+
+type Config struct {
+	SpoolDir       string
+	MaxSize        int64
+	PresignExpiry  time.Duration
+	TrashRetention time.Duration
+	PurgeInterval  time.Duration
+
+	// Renditions is the ladder videos are transcoded to, transcoding is off when it is empty
+	Renditions []transcoder.Rendition
+	// SegmentDuration is the target duration of HLS segments, renditions aren't packaged when it is zero
+	SegmentDuration time.Duration
 }
 
 type Service struct {
 	store      store
 	filestore  filestore.FileStore
 	background background.Routine
+	transcoder transcoder.Transcoder
+	cfg        Config
 }
 
 func ValidateVideo(v *validator.Validator, video *Video) {
@@ -58,123 +269,1452 @@ func ValidateVideo(v *validator.Validator, video *Video) {
 	v.Check(video.PublishedDate.IsZero() || video.PublishedDate.After(time.Now()), "published_date", "must be in the future")
 }
 
-func (vs *Service) UploadVideo(ctx context.Context, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string) {
-	// Upload to S3 Bucket
+// ValidateContent sniffs the container of a video from the leading bytes of its content and checks the
+// extension of filename matches it. It returns the MIME type of the content, the client supplied content
+// type and filename are never trusted for it.
+func ValidateContent(head []byte, filename string) (string, error, map[string]string) {
+	v := validator.New()
+
+	mimeType := mediaprobe.Sniff(head)
+	if mimeType == "" {
+		v.AddError("video", "must be an MP4, QuickTime, WebM, Matroska or MPEG-TS video")
+		return "", ErrUnsupportedVideo, v.Errors
+	}
+
+	v.Check(mediaprobe.MatchesExtension(filename, mimeType), "video", "file extension does not match the video content")
+
+	if !v.Valid() {
+		return "", VideoValidationError, v.Errors
+	}
+
+	return mimeType, nil, nil
+}
+
+// UploadVideo validates the uploaded content and hands it over to the upload job. The video is only
+// created once its content passed validation, and removed again when the content can't be staged.
+func (vs *Service) UploadVideo(ctx context.Context, actor Actor, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string) {
+	r, mimeType, err, validationErrors := vs.sniffUpload(*videoFileReader, fileHeader)
+	if err != nil {
+		return nil, err, validationErrors
+	}
+
+	video := &Video{OwnerID: actor.UserID, MimeType: mimeType}
+
+	err = vs.store.Insert(ctx, video)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	err = vs.stage(ctx, video, r, fileHeader.Filename)
+	if err != nil {
+		// Nothing was handed over to the upload job, the video would wait for its content forever
+		deleteErr := vs.store.Delete(ctx, video.ID)
+		if deleteErr != nil {
+			vs.background.PrintError(deleteErr, map[string]string{"video_id": strconv.FormatInt(video.ID, 10)})
+		}
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
 
-	//TODO: Save to database return ID create background job with ID then update
-	video := &Video{}
+// ReserveVideo creates a video waiting for its content. Resumable uploads record its id before the content
+// is handed over with UploadReservedVideo, a retried completion then finds the same video instead of
+// creating another one.
+func (vs *Service) ReserveVideo(ctx context.Context, actor Actor) (*Video, error, map[string]string) {
+	video := &Video{OwnerID: actor.UserID}
 
 	err := vs.store.Insert(ctx, video)
 	if err != nil {
 		return nil, err, nil
 	}
 
-	vs.uploadVideoBackground(ctx, video, videoFileReader, fileHeader)
+	return video, nil, nil
+}
+
+// UploadReservedVideo validates the content of a reserved video like UploadVideo does and hands it over
+// to the upload job. A video that already left StatusUploading was handed over by a previous call and is
+// returned as is, the content is not read again.
+func (vs *Service) UploadReservedVideo(ctx context.Context, actor Actor, videoId int64, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) (*Video, error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if !actor.owns(video) {
+		return nil, ErrNotOwner, nil
+	}
+
+	if video.Status != StatusUploading {
+		return video, nil, nil
+	}
+
+	// Direct uploads wait for their content in the filestore, not through this call
+	if video.Path != "" {
+		return nil, ErrVideoNotUploading, nil
+	}
+
+	r, mimeType, err, validationErrors := vs.sniffUpload(*videoFileReader, fileHeader)
+	if err != nil {
+		return nil, err, validationErrors
+	}
+
+	if video.MimeType != mimeType {
+		video.MimeType = mimeType
+
+		err = vs.store.Update(ctx, video)
+		if err != nil {
+			return nil, err, nil
+		}
+	}
+
+	err = vs.stage(ctx, video, r, fileHeader.Filename)
+	if err != nil {
+		return nil, err, nil
+	}
 
-	// Return Video
 	return video, nil, nil
 }
 
-func (vs *Service) uploadVideoBackground(ctx context.Context, video *Video, videoFileReader *io.Reader, fileHeader *multipart.FileHeader) {
+// DiscardReservedVideo removes a reserved video whose content was never handed over, it reports
+// ErrRecordNotFound for a video that was.
+func (vs *Service) DiscardReservedVideo(ctx context.Context, videoId int64) (error, map[string]string) {
+	err := vs.store.Delete(ctx, videoId)
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, nil
+}
+
+// sniffUpload checks the size and the container of uploaded content. It returns a reader of the whole
+// content, the sniffed bytes included, and the MIME type of the content.
+func (vs *Service) sniffUpload(videoFileReader io.Reader, fileHeader *multipart.FileHeader) (io.Reader, string, error, map[string]string) {
+	if vs.cfg.MaxSize > 0 && fileHeader.Size > vs.cfg.MaxSize {
+		return nil, "", ErrVideoTooLarge, nil
+	}
+
+	r := bufio.NewReaderSize(videoFileReader, mediaprobe.SniffLen)
+
+	// Content shorter than SniffLen is peeked whole and left to Sniff
+	head, err := r.Peek(mediaprobe.SniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err, nil
+	}
+
+	mimeType, err, validationErrors := ValidateContent(head, fileHeader.Filename)
+	if err != nil {
+		return nil, "", err, validationErrors
+	}
+
+	return r, mimeType, nil, nil
+}
+
+// stage hands the content of a video over to the upload job. The content is spooled to disk first and
+// hashed on the way, so it is written to the filestore once, already at the key of its content, and the
+// job only has to attach it. The request body only lives as long as the request, the job reads nothing
+// from it and can run, and be retried, on any instance. Content over the maximum size is discarded
+// before it reaches the filestore.
+func (vs *Service) stage(ctx context.Context, video *Video, r io.Reader, filename string) error {
+	f, err := os.CreateTemp(vs.spoolDir(), fmt.Sprintf("video-%d-*.upload", video.ID))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if vs.cfg.MaxSize > 0 {
+		r = io.LimitReader(r, vs.cfg.MaxSize+1)
+	}
+
+	hr := &hashingReader{r: r, hash: sha256.New()}
+
+	_, err = io.Copy(f, hr)
+	if err != nil {
+		return err
+	}
+
+	if vs.cfg.MaxSize > 0 && hr.n > vs.cfg.MaxSize {
+		return ErrVideoTooLarge
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	sum := hex.EncodeToString(hr.hash.Sum(nil))
+	key := filestore.VideoKey(video.ID, sum, filename)
+
+	err = vs.filestore.Put(ctx, key, f, hr.n, video.MimeType)
+	if err != nil {
+		vs.filestore.Delete(ctx, key)
+		return err
+	}
+
+	payload := uploadVideoPayload{
+		VideoID:  video.ID,
+		Key:      key,
+		Filename: filename,
+		Size:     hr.n,
+		SHA256:   sum,
+	}
+
+	_, err = vs.background.Enqueue(ctx, JobUploadVideo, payload)
+	if err != nil {
+		vs.filestore.Delete(ctx, key)
+		return err
+	}
+
+	return nil
+}
+
+// hashingReader counts and hashes the bytes read through it.
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	n    int64
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.n += int64(n)
+	h.hash.Write(p[:n])
+
+	return n, err
+}
+
+func (vs *Service) spoolDir() string {
+	if vs.cfg.SpoolDir == "" {
+		return os.TempDir()
+	}
 
-	args := []any{*video, videoFileReader, fileHeader}
+	return vs.cfg.SpoolDir
+}
 
-	//TODO: There should be a way to retry. Maybe should store the jobs and run it with workers.
-	vs.background.Dispatch(func(args []any) {
+// uploadVideoJob attaches the uploaded content to the video and hands the video over to the probe job.
+// Content that is already stored is referenced instead, the uploaded copy is dropped. When the upload
+// cannot succeed, the error is permanent or it was the last attempt, the video is marked as failed.
+func (vs *Service) uploadVideoJob(ctx context.Context, job *background.Job) error {
+	var payload uploadVideoPayload
 
-		//TODO: The Video name should be the id
-		var backgroundVideo = args[0].(Video)
-		var vFileReader = args[1].(*io.Reader)
-		var vFileCloser = io.NopCloser(*vFileReader)
-		var vFileHeader = args[2].(*multipart.FileHeader)
+	err := job.Decode(&payload)
+	if err != nil {
+		return background.Permanent(err)
+	}
 
-		defer vFileCloser.Close()
+	video, err := vs.store.ReadById(ctx, payload.VideoID)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			// A previous attempt may have attached the content and other videos reference it since, the
+			// object is left to the purge of its blob
+			return background.Permanent(err)
+		}
+		return err
+	}
 
-		filepath, backgroundErr := vs.filestore.Set(backgroundVideo.ID, vFileReader, vFileHeader)
-		if backgroundErr != nil {
-			vs.background.PrintError(backgroundErr, nil)
+	err = vs.storeUpload(ctx, video, payload)
+	if err != nil {
+		if background.IsPermanent(err) || job.FinalAttempt() {
+			vs.failUpload(ctx, video, payload, err)
 		}
+		return err
+	}
 
-		vs.background.PrintInfo(filepath, nil)
+	return nil
+}
 
-		backgroundVideo.Path = filepath
-		backgroundVideo.Status = "Uploaded"
+func (vs *Service) storeUpload(ctx context.Context, video *Video, payload uploadVideoPayload) error {
+	switch video.Status {
+	case StatusUploading:
+		err := vs.store.SetStatus(ctx, video, StatusProcessing, actorUploadJob, "")
+		if err != nil {
+			return err
+		}
+	case StatusProcessing:
+		// A previous attempt failed part way
+	default:
+		// A previous attempt already finished
+		return nil
+	}
 
-		backgroundErr = vs.store.Update(ctx, &backgroundVideo)
-		if backgroundErr != nil {
-			vs.background.PrintError(backgroundErr, nil)
+	if video.ContentSHA256 == "" {
+		err := vs.attachContent(ctx, video, payload)
+		if err != nil {
+			return err
 		}
-	}, args)
+	}
+
+	_, err := vs.background.Enqueue(ctx, JobProbeVideo, probeVideoPayload{VideoID: video.ID})
+
+	return err
 }
 
-func (vs *Service) CreateVideo(ctx context.Context, video *Video) (*Video, error, map[string]string) {
+// attachContent points the video at the uploaded content, or at stored content with the same hash when
+// there is some.
+func (vs *Service) attachContent(ctx context.Context, video *Video, payload uploadVideoPayload) error {
+	blob := &Blob{SHA256: payload.SHA256, Key: payload.Key, Size: payload.Size}
 
-	validator := validator.New()
+	err := vs.store.AttachBlob(ctx, video, blob)
+	if err != nil {
+		return err
+	}
 
-	if ValidateVideo(validator, video); !validator.Valid() {
-		return nil, VideoValidationError, validator.Errors
+	// Identical content was stored first, ours is redundant
+	if payload.Key != video.Path {
+		vs.filestore.Delete(ctx, payload.Key)
 	}
 
-	err := vs.store.Insert(ctx, video)
-	if err != nil {
-		return nil, err, nil
+	return nil
+}
+
+// failUpload marks the video as failed with the cause as its failure reason and drops the uploaded
+// content unless the video already references it, the upload is not retried anymore.
+func (vs *Service) failUpload(ctx context.Context, video *Video, payload uploadVideoPayload, cause error) {
+	if video.Path != payload.Key {
+		vs.filestore.Delete(ctx, payload.Key)
 	}
 
-	return video, nil, nil
+	err := vs.store.SetStatus(ctx, video, StatusFailed, actorUploadJob, cause.Error())
+	if err != nil {
+		vs.background.PrintError(err, map[string]string{"video_id": strconv.FormatInt(video.ID, 10)})
+	}
 }
 
-func (vs *Service) ReadVideo(ctx context.Context, videoId int64) (*Video, error, map[string]string) {
+// probeVideoJob reads the technical metadata of the video content and marks the video as ready. Content
+// that can't be probed, or has no video track, marks the video as failed with the reason.
+func (vs *Service) probeVideoJob(ctx context.Context, job *background.Job) error {
+	var payload probeVideoPayload
 
-	video, err := vs.store.ReadById(ctx, videoId)
+	err := job.Decode(&payload)
 	if err != nil {
-		return nil, err, nil
+		return background.Permanent(err)
 	}
 
-	return video, nil, nil
+	video, err := vs.store.ReadById(ctx, payload.VideoID)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return background.Permanent(err)
+		}
+		return err
+	}
+
+	if video.Status != StatusProcessing {
+		// A previous attempt already finished
+		return nil
+	}
+
+	err = vs.probe(ctx, video)
+	if err != nil {
+		if background.IsPermanent(err) || job.FinalAttempt() {
+			vs.failProbe(ctx, video, err)
+		}
+		return err
+	}
+
+	// Enqueued first, a retry after a failed status change finds the video done and wouldn't enqueue it
+	err = vs.enqueueTranscode(ctx, video)
+	if err != nil {
+		return err
+	}
+
+	return vs.store.SetStatus(ctx, video, StatusReady, actorProbeJob, "")
 }
 
-func (vs *Service) UpdateVideo(ctx context.Context, videoId int64, videoInput *VideoInput) (*Video, error, map[string]string) {
+func (vs *Service) probe(ctx context.Context, video *Video) error {
+	if !mediaprobe.CanProbe(video.MimeType) {
+		// The container was accepted at upload but can't be read, the video is served without metadata
+		return nil
+	}
 
-	video, err := vs.store.ReadById(ctx, videoId)
+	stat, err := vs.filestore.Stat(ctx, video.Path)
 	if err != nil {
-		return nil, err, nil
+		if errors.Is(err, filestore.ErrObjectNotFound) {
+			return background.Permanent(err)
+		}
+		return err
 	}
 
-	if videoInput.Title != nil {
-		video.Title = *videoInput.Title
+	info, err := mediaprobe.Probe(filestore.NewReaderAt(ctx, vs.filestore, video.Path), stat.Size)
+	if err != nil {
+		if mediaprobe.IsInvalid(err) {
+			return background.Permanent(err)
+		}
+		return err
 	}
 
-	if videoInput.Description != nil {
-		video.Description = *videoInput.Description
+	if info.VideoCodec == "" {
+		return background.Permanent(ErrNoVideoTrack)
 	}
 
-	if videoInput.PublishedDate != nil {
-		video.PublishedDate = *videoInput.PublishedDate
+	video.DurationMs = info.DurationMs
+	video.Width = info.Width
+	video.Height = info.Height
+	video.VideoCodec = info.VideoCodec
+	video.AudioCodec = info.AudioCodec
+	video.Bitrate = info.Bitrate
+	video.Container = info.Container
+
+	return vs.store.SetMediaInfo(ctx, video)
+}
+
+// failProbe marks the video as failed with the cause as its failure reason.
+func (vs *Service) failProbe(ctx context.Context, video *Video, cause error) {
+	err := vs.store.SetStatus(ctx, video, StatusFailed, actorProbeJob, cause.Error())
+	if err != nil {
+		vs.background.PrintError(err, map[string]string{"video_id": strconv.FormatInt(video.ID, 10)})
 	}
+}
 
-	validate := validator.New()
+// enqueueTranscode hands the video over to the transcode job, which enqueues its renditions, unless
+// transcoding is off.
+func (vs *Service) enqueueTranscode(ctx context.Context, video *Video) error {
+	if vs.transcoder == nil || len(vs.cfg.Renditions) == 0 {
+		return nil
+	}
 
-	if ValidateVideo(validate, video); !validate.Valid() {
-		return nil, VideoValidationError, validate.Errors
+	_, err := vs.background.Enqueue(ctx, JobTranscodeVideo, transcodeVideoPayload{VideoID: video.ID})
+
+	return err
+}
+
+// transcodeVideoJob produces the renditions of the ladder the video doesn't have yet, renditions that
+// would upscale the source are skipped. Each rendition is transcoded by a job of its own so a whole ladder
+// never has to fit in a single job timeout. A failed transcode is retried but never fails the video.
+func (vs *Service) transcodeVideoJob(ctx context.Context, job *background.Job) error {
+	var payload transcodeVideoPayload
+
+	err := job.Decode(&payload)
+	if err != nil {
+		return background.Permanent(err)
 	}
 
-	err = vs.store.Update(ctx, video)
+	video, err := vs.store.ReadById(ctx, payload.VideoID)
 	if err != nil {
-		return nil, err, nil
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return background.Permanent(err)
+		}
+		return err
 	}
 
-	return video, nil, nil
+	if video.Path == "" || video.Status == StatusFailed {
+		return nil
+	}
+
+	pending, err := vs.pendingRenditions(ctx, video)
+	if err != nil {
+		return err
+	}
+
+	if payload.Rendition == "" {
+		for _, r := range pending {
+			_, err = vs.background.Enqueue(ctx, JobTranscodeVideo, transcodeVideoPayload{VideoID: video.ID, Rendition: r.Name})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// A rendition that is done, or left the ladder since the job was enqueued, has nothing left to do
+	for _, r := range pending {
+		if r.Name == payload.Rendition {
+			return vs.transcodeRendition(ctx, video, r)
+		}
+	}
+
+	return nil
 }
 
-func NewService(db *sql.DB, fs filestore.FileStore, bg background.Routine) (Videos, error) {
-	vs, err := newStore(db)
+// pendingRenditions returns the renditions of the ladder worth producing for the video that it doesn't
+// have yet. Renditions transcoded before HLS or DASH packaging was turned on are produced again.
+func (vs *Service) pendingRenditions(ctx context.Context, video *Video) ([]transcoder.Rendition, error) {
+	existing, err := vs.store.ListRenditions(ctx, video.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Service{
-		store:      vs,
-		filestore:  fs,
-		background: bg,
-	}, nil
+	done := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		done[r.Name] = (r.PlaylistKey != "" && r.DashPrefix != "") || vs.cfg.SegmentDuration <= 0
+	}
+
+	var pending []transcoder.Rendition
+	for _, r := range transcoder.Select(vs.cfg.Renditions, video.Width, video.Height) {
+		if !done[r.Name] {
+			pending = append(pending, r)
+		}
+	}
+
+	return pending, nil
+}
+
+// transcodeRendition downloads the source of the video to a temporary directory and transcodes a single
+// rendition from it.
+func (vs *Service) transcodeRendition(ctx context.Context, video *Video, r transcoder.Rendition) error {
+	dir, err := os.MkdirTemp(vs.spoolDir(), fmt.Sprintf("video-%d-*.transcode", video.ID))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+
+	err = vs.download(ctx, video.Path, source)
+	if err != nil {
+		return err
+	}
+
+	return vs.transcode(ctx, video, r, source, dir)
+}
+
+// download copies an object of the filestore to a local file, transcoders need to seek in their input.
+func (vs *Service) download(ctx context.Context, key, dst string) error {
+	obj, err := vs.filestore.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, filestore.ErrObjectNotFound) {
+			return background.Permanent(err)
+		}
+		return err
+	}
+	defer obj.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, obj)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// transcode produces a single rendition from the local source and stores it next to the video content,
+// along with its HLS and DASH packaging when a segment duration is configured. Progress is logged every
+// quarter so long transcodes show they are alive. The codecs are read back from the output, outputs the
+// probe can't read keep them unknown and keep the audio of the source.
+func (vs *Service) transcode(ctx context.Context, video *Video, r transcoder.Rendition, source, dir string) error {
+	output := filepath.Join(dir, r.Name+".mp4")
+
+	logged := 0
+
+	result, err := vs.transcoder.Transcode(ctx, transcoder.Request{
+		Input:            source,
+		Output:           output,
+		Rendition:        r,
+		Width:            video.Width,
+		Height:           video.Height,
+		Duration:         time.Duration(video.DurationMs) * time.Millisecond,
+		KeyframeInterval: vs.cfg.SegmentDuration,
+	}, func(p transcoder.Progress) {
+		if quarter := int(p.Percent / 25); quarter > logged {
+			logged = quarter
+			vs.background.PrintInfo("transcoding video", map[string]string{
+				"video_id":  strconv.FormatInt(video.ID, 10),
+				"rendition": r.Name,
+				"percent":   strconv.Itoa(quarter * 25),
+			})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rendition := &Rendition{
+		VideoID:      video.ID,
+		Name:         r.Name,
+		Key:          filestore.RenditionKey(video.ID, r.Name),
+		Width:        result.Width,
+		Height:       result.Height,
+		VideoBitrate: r.VideoBitrate,
+		AudioBitrate: r.AudioBitrate,
+		Size:         result.Size,
+	}
+
+	audio := video.AudioCodec != ""
+
+	info, err := mediaprobe.Probe(f, result.Size)
+	switch {
+	case err == nil:
+		rendition.Codecs = info.Codecs
+		audio = info.AudioCodec != ""
+	case !mediaprobe.IsInvalid(err):
+		return err
+	}
+
+	err = vs.filestore.Put(ctx, rendition.Key, io.NewSectionReader(f, 0, result.Size), result.Size, mediaprobe.MimeMP4)
+	if err != nil {
+		return err
+	}
+
+	if vs.cfg.SegmentDuration > 0 {
+		err = vs.packageHLS(ctx, video, rendition, output, filepath.Join(dir, r.Name))
+		if err != nil {
+			return err
+		}
+
+		err = vs.packageDASH(ctx, video, rendition, output, filepath.Join(dir, r.Name+"-dash"), audio)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vs.store.InsertRendition(ctx, rendition)
+}
+
+// packageHLS cuts the rendition at output into segments and stores them with their init section and a
+// media playlist. The playlist is written last, a rendition is only served once it is complete.
+func (vs *Service) packageHLS(ctx context.Context, video *Video, rendition *Rendition, output, dir string) error {
+	err := os.Mkdir(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	pkg, err := vs.transcoder.Package(ctx, transcoder.PackageRequest{
+		Input:           output,
+		Dir:             dir,
+		SegmentDuration: vs.cfg.SegmentDuration,
+		Duration:        time.Duration(video.DurationMs) * time.Millisecond,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = vs.putFile(ctx, filepath.Join(dir, pkg.Init), filestore.HLSKey(video.ID, rendition.Name, initSection), mediaprobe.MimeMP4)
+	if err != nil {
+		return err
+	}
+
+	playlist := &hls.MediaPlaylist{Map: initSection}
+	sizes := make([]int64, len(pkg.Segments))
+
+	for i, segment := range pkg.Segments {
+		name := fmt.Sprintf(segmentName, i)
+
+		sizes[i], err = vs.putFile(ctx, filepath.Join(dir, segment.Path), filestore.HLSKey(video.ID, rendition.Name, name), hls.SegmentContentType)
+		if err != nil {
+			return err
+		}
+
+		playlist.Segments = append(playlist.Segments, hls.Segment{URI: name, Duration: segment.Duration.Seconds()})
+	}
+
+	var buf bytes.Buffer
+
+	err = playlist.Encode(&buf)
+	if err != nil {
+		return err
+	}
+
+	key := filestore.HLSKey(video.ID, rendition.Name, hlsPlaylist)
+
+	err = vs.filestore.Put(ctx, key, &buf, int64(buf.Len()), hls.ContentType)
+	if err != nil {
+		return err
+	}
+
+	rendition.PlaylistKey = key
+	rendition.Bandwidth, rendition.AverageBandwidth = playlist.Bandwidth(sizes)
+
+	return nil
+}
+
+// packageDASH cuts the video track, and the audio track if any, of the rendition at output into segments
+// of their own, a DASH adaptation set holds a single media type. The manifest is generated on request.
+func (vs *Service) packageDASH(ctx context.Context, video *Video, rendition *Rendition, output, dir string, audio bool) error {
+	tracks := []transcoder.Track{transcoder.TrackVideo}
+	if audio {
+		tracks = append(tracks, transcoder.TrackAudio)
+	}
+
+	for _, track := range tracks {
+		trackDir := filepath.Join(dir, string(track))
+
+		err := os.MkdirAll(trackDir, 0o755)
+		if err != nil {
+			return err
+		}
+
+		pkg, err := vs.transcoder.Package(ctx, transcoder.PackageRequest{
+			Input:           output,
+			Dir:             trackDir,
+			Track:           track,
+			SegmentDuration: vs.cfg.SegmentDuration,
+			Duration:        time.Duration(video.DurationMs) * time.Millisecond,
+		})
+		if err != nil {
+			return err
+		}
+
+		initType, segmentType := mediaprobe.MimeMP4, hls.SegmentContentType
+		if track == transcoder.TrackAudio {
+			initType, segmentType = mimeAudioMP4, mimeAudioMP4
+		}
+
+		_, err = vs.putFile(ctx, filepath.Join(trackDir, pkg.Init), filestore.DASHKey(video.ID, rendition.Name, string(track), initSection), initType)
+		if err != nil {
+			return err
+		}
+
+		for i, segment := range pkg.Segments {
+			key := filestore.DASHKey(video.ID, rendition.Name, string(track), fmt.Sprintf(segmentName, i))
+
+			_, err = vs.putFile(ctx, filepath.Join(trackDir, segment.Path), key, segmentType)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	rendition.DashPrefix = filestore.DASHPrefix(video.ID) + rendition.Name + "/"
+	rendition.DashAudio = audio
+	rendition.SegmentDurationMs = vs.cfg.SegmentDuration.Milliseconds()
+
+	return nil
+}
+
+// putFile stores a local file and returns its size.
+func (vs *Service) putFile(ctx context.Context, name, key, contentType string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return stat.Size(), vs.filestore.Put(ctx, key, f, stat.Size(), contentType)
+}
+
+func (vs *Service) CreateVideo(ctx context.Context, video *Video) (*Video, error, map[string]string) {
+
+	validator := validator.New()
+
+	if ValidateVideo(validator, video); !validator.Valid() {
+		return nil, VideoValidationError, validator.Errors
+	}
+
+	err := vs.store.Insert(ctx, video)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
+
+func (vs *Service) ReadVideo(ctx context.Context, videoId int64) (*Video, error, map[string]string) {
+
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
+
+// ListVideos returns a page of the videos matching filters, the sort safelist is owned by the service.
+func (vs *Service) ListVideos(ctx context.Context, filters VideoFilters) ([]*Video, datastore.Metadata, error, map[string]string) {
+	filters.SortSafelist = videoSortSafelist
+
+	v := validator.New()
+
+	if ValidateVideoFilters(v, filters); !v.Valid() {
+		return nil, datastore.Metadata{}, VideoValidationError, v.Errors
+	}
+
+	videos, totalRecords, err := vs.store.List(ctx, filters)
+	if err != nil {
+		return nil, datastore.Metadata{}, err, nil
+	}
+
+	return videos, datastore.CalculateMetadata(totalRecords, filters.Page, filters.PageSize), nil, nil
+}
+
+// SearchVideos runs a full text search over titles and descriptions. Queries follow the web search syntax,
+// quoted phrases, "or", "-" to exclude a word, and a trailing "*" for prefix matches.
+func (vs *Service) SearchVideos(ctx context.Context, filters SearchFilters) ([]*SearchResult, datastore.Metadata, error, map[string]string) {
+	filters.SortSafelist = searchSortSafelist
+
+	v := validator.New()
+
+	if ValidateSearchFilters(v, filters); !v.Valid() {
+		return nil, datastore.Metadata{}, VideoValidationError, v.Errors
+	}
+
+	results, totalRecords, err := vs.store.Search(ctx, filters)
+	if err != nil {
+		return nil, datastore.Metadata{}, err, nil
+	}
+
+	return results, datastore.CalculateMetadata(totalRecords, filters.Page, filters.PageSize), nil, nil
+}
+
+// UpdateVideo changes the metadata of a video owned by the actor.
+func (vs *Service) UpdateVideo(ctx context.Context, actor Actor, videoId int64, videoInput *VideoInput) (*Video, error, map[string]string) {
+
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if !actor.owns(video) {
+		return nil, ErrNotOwner, nil
+	}
+
+	if videoInput.Title != nil {
+		video.Title = *videoInput.Title
+	}
+
+	if videoInput.Description != nil {
+		video.Description = *videoInput.Description
+	}
+
+	if videoInput.PublishedDate != nil {
+		video.PublishedDate = *videoInput.PublishedDate
+	}
+
+	validate := validator.New()
+
+	if ValidateVideo(validate, video); !validate.Valid() {
+		return nil, VideoValidationError, validate.Errors
+	}
+
+	err = vs.store.Update(ctx, video)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
+
+// UpdateVideoStatus moves the video to one of the statuses clients manage, published or archived,
+// following the transition table.
+func (vs *Service) UpdateVideoStatus(ctx context.Context, actor Actor, videoId int64, status Status) (*Video, error, map[string]string) {
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(status, manualStatuses...), "status", "must be published or archived")
+
+	if !v.Valid() {
+		return nil, VideoValidationError, v.Errors
+	}
+
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if !actor.owns(video) {
+		return nil, ErrNotOwner, nil
+	}
+
+	if !video.Status.CanTransitionTo(status) {
+		return nil, ErrInvalidTransition, nil
+	}
+
+	err = vs.store.SetStatus(ctx, video, status, actor.String(), "")
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
+
+// DeleteVideo moves the video to the trash. It is hidden from reads, lists and searches and permanently
+// deleted by the purge job once the trash retention has passed, unless it is restored before.
+func (vs *Service) DeleteVideo(ctx context.Context, actor Actor, videoId int64) (error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return err, nil
+	}
+
+	if !actor.owns(video) {
+		return ErrNotOwner, nil
+	}
+
+	err = vs.store.SoftDelete(ctx, video, actor.String())
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, nil
+}
+
+// RestoreVideo takes a video out of the trash. Videos in the trash of other users are reported as not
+// found, the same way they are left out of ListDeletedVideos. A video outside of the trash can't be
+// restored, it is reported as such rather than as not found.
+func (vs *Service) RestoreVideo(ctx context.Context, actor Actor, videoId int64) (*Video, error, map[string]string) {
+	err := vs.store.Restore(ctx, videoId, actor.ownerFilter(), actor.String())
+	if errors.Is(err, datastore.ErrRecordNotFound) {
+		if video, readErr := vs.store.ReadById(ctx, videoId); readErr == nil {
+			err = ErrInvalidTransition
+			if !actor.owns(video) {
+				err = ErrNotOwner
+			}
+		}
+	}
+	if err != nil {
+		return nil, err, nil
+	}
+
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
+
+// ListDeletedVideos returns a page of the trash of the actor, moderators see the trash of every user.
+func (vs *Service) ListDeletedVideos(ctx context.Context, actor Actor, filters datastore.Filters) ([]*Video, datastore.Metadata, error, map[string]string) {
+	filters.SortSafelist = trashSortSafelist
+
+	v := validator.New()
+
+	if datastore.ValidateFilters(v, filters); !v.Valid() {
+		return nil, datastore.Metadata{}, VideoValidationError, v.Errors
+	}
+
+	videos, totalRecords, err := vs.store.ListDeleted(ctx, actor.ownerFilter(), filters)
+	if err != nil {
+		return nil, datastore.Metadata{}, err, nil
+	}
+
+	return videos, datastore.CalculateMetadata(totalRecords, filters.Page, filters.PageSize), nil, nil
+}
+
+// purgeDeletedJob permanently deletes the videos that stayed in the trash longer than the retention, in
+// batches, and removes the objects no other video references. Objects are deleted after their rows, a
+// failed object delete is logged and leaves an orphaned object rather than a video pointing at nothing.
+func (vs *Service) purgeDeletedJob(ctx context.Context, job *background.Job) error {
+	deletedBefore := time.Now().Add(-vs.cfg.TrashRetention)
+
+	for {
+		ids, err := vs.store.ListExpired(ctx, deletedBefore, purgeBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			keys, err := vs.store.Purge(ctx, id)
+			if err != nil {
+				if errors.Is(err, datastore.ErrRecordNotFound) {
+					// Restored or purged by another worker in the meantime
+					continue
+				}
+				return err
+			}
+
+			// HLS and DASH files aren't recorded one by one, they are found by their prefix
+			for _, prefix := range []string{filestore.HLSPrefix(id), filestore.DASHPrefix(id)} {
+				packaged, err := vs.filestore.List(ctx, prefix)
+				if err != nil {
+					vs.background.PrintError(err, map[string]string{"video_id": strconv.FormatInt(id, 10)})
+				}
+				for _, info := range packaged {
+					keys = append(keys, info.Key)
+				}
+			}
+
+			for _, key := range keys {
+				err = vs.filestore.Delete(ctx, key)
+				if err != nil {
+					vs.background.PrintError(err, map[string]string{"key": key, "video_id": strconv.FormatInt(id, 10)})
+				}
+			}
+		}
+
+		if len(ids) < purgeBatchSize {
+			return nil
+		}
+	}
+}
+
+// StatVideoContent returns the video together with the metadata of its stored content. Only streamable
+// videos can be read.
+func (vs *Service) StatVideoContent(ctx context.Context, videoId int64) (*Video, *filestore.ObjectInfo, error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	if !video.Streamable() {
+		return nil, nil, ErrVideoNotStreamable, nil
+	}
+
+	info, err := vs.filestore.Stat(ctx, video.Path)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	return video, info, nil, nil
+}
+
+// ReadVideoContent opens length bytes of the video content starting at offset, a negative length reads
+// to the end.
+func (vs *Service) ReadVideoContent(ctx context.Context, video *Video, offset, length int64) (*filestore.Object, error, map[string]string) {
+	if !video.Streamable() {
+		return nil, ErrVideoNotStreamable, nil
+	}
+
+	obj, err := vs.filestore.GetRange(ctx, video.Path, offset, length)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return obj, nil, nil
+}
+
+// HLSMasterPlaylist returns the master playlist of a streamable video, listing its renditions packaged for
+// HLS from the largest to the smallest. Variant URIs are relative to the master playlist.
+func (vs *Service) HLSMasterPlaylist(ctx context.Context, videoId int64) (*Video, []byte, error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	if !video.Streamable() {
+		return nil, nil, ErrVideoNotStreamable, nil
+	}
+
+	renditions, err := vs.store.ListRenditions(ctx, video.ID)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	master := &hls.MasterPlaylist{}
+
+	for _, r := range renditions {
+		if r.PlaylistKey == "" {
+			continue
+		}
+
+		master.Variants = append(master.Variants, hls.Variant{
+			URI:              r.Name + "/" + hlsPlaylist,
+			Bandwidth:        r.Bandwidth,
+			AverageBandwidth: r.AverageBandwidth,
+			Width:            r.Width,
+			Height:           r.Height,
+			Codecs:           r.Codecs,
+		})
+	}
+
+	if len(master.Variants) == 0 {
+		return nil, nil, ErrNotPackaged, nil
+	}
+
+	var buf bytes.Buffer
+
+	err = master.Encode(&buf)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	return video, buf.Bytes(), nil, nil
+}
+
+var (
+	segmentRX = regexp.MustCompile(`^(?:` + regexp.QuoteMeta(initSection) + `|segment_\d{5}\.m4s)$`)
+)
+
+// StatHLSFile returns the video together with the metadata of a file of one of its packaged renditions,
+// name is the path of the file relative to the master playlist, 720p/index.m3u8 for instance.
+func (vs *Service) StatHLSFile(ctx context.Context, videoId int64, name string) (*Video, *filestore.ObjectInfo, error, map[string]string) {
+	rendition, file, ok := strings.Cut(name, "/")
+	if !ok || (file != hlsPlaylist && !segmentRX.MatchString(file)) {
+		return nil, nil, datastore.ErrRecordNotFound, nil
+	}
+
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	if !video.Streamable() {
+		return nil, nil, ErrVideoNotStreamable, nil
+	}
+
+	renditions, err := vs.store.ListRenditions(ctx, video.ID)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	// Rendition names come from the ladder, so only a name found in the store makes it into a key
+	for _, r := range renditions {
+		if r.Name != rendition || r.PlaylistKey == "" {
+			continue
+		}
+
+		info, err := vs.filestore.Stat(ctx, filestore.HLSKey(video.ID, r.Name, file))
+		if err != nil {
+			return nil, nil, err, nil
+		}
+
+		// Backends guessing the type from the extension rarely know playlists and segments
+		switch file {
+		case hlsPlaylist:
+			info.ContentType = hls.ContentType
+		case initSection:
+			info.ContentType = mediaprobe.MimeMP4
+		default:
+			info.ContentType = hls.SegmentContentType
+		}
+
+		return video, info, nil, nil
+	}
+
+	return nil, nil, datastore.ErrRecordNotFound, nil
+}
+
+// DASHManifest returns the MPD of a streamable video. Its renditions packaged for DASH make the video
+// adaptation set, their audio tracks the audio one. Segment URLs are relative to the manifest.
+func (vs *Service) DASHManifest(ctx context.Context, videoId int64) (*Video, []byte, error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	if !video.Streamable() {
+		return nil, nil, ErrVideoNotStreamable, nil
+	}
+
+	renditions, err := vs.store.ListRenditions(ctx, video.ID)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	videoSet := dash.AdaptationSet{ID: 0, ContentType: "video", MimeType: mediaprobe.MimeMP4, SegmentAlignment: true, StartWithSAP: 1}
+	audioSet := dash.AdaptationSet{ID: 1, ContentType: "audio", MimeType: mimeAudioMP4, SegmentAlignment: true, StartWithSAP: 1}
+
+	// Renditions with the same audio bitrate carry the same audio, it is listed once
+	audioBitrates := make(map[int64]bool)
+
+	for _, r := range renditions {
+		if r.DashPrefix == "" {
+			continue
+		}
+
+		videoCodec, audioCodec, _ := strings.Cut(r.Codecs, ",")
+
+		videoSet.Representations = append(videoSet.Representations, dash.Representation{
+			ID:              r.Name,
+			Bandwidth:       r.VideoBitrate,
+			Codecs:          videoCodec,
+			Width:           r.Width,
+			Height:          r.Height,
+			SegmentTemplate: segmentTemplate(r, transcoder.TrackVideo),
+		})
+		if r.Width > videoSet.MaxWidth {
+			videoSet.MaxWidth = r.Width
+		}
+		if r.Height > videoSet.MaxHeight {
+			videoSet.MaxHeight = r.Height
+		}
+
+		if r.DashAudio && !audioBitrates[r.AudioBitrate] {
+			audioBitrates[r.AudioBitrate] = true
+
+			// Renditions are encoded in stereo
+			audioSet.Representations = append(audioSet.Representations, dash.Representation{
+				ID:                        r.Name + "-audio",
+				Bandwidth:                 r.AudioBitrate,
+				Codecs:                    audioCodec,
+				AudioChannelConfiguration: &dash.AudioChannelConfiguration{SchemeIDURI: dash.ChannelConfiguration, Value: "2"},
+				SegmentTemplate:           segmentTemplate(r, transcoder.TrackAudio),
+			})
+		}
+	}
+
+	if len(videoSet.Representations) == 0 {
+		return nil, nil, ErrNotPackaged, nil
+	}
+
+	period := dash.Period{ID: "0", AdaptationSets: []dash.AdaptationSet{videoSet}}
+	if len(audioSet.Representations) > 0 {
+		period.AdaptationSets = append(period.AdaptationSets, audioSet)
+	}
+
+	mpd := &dash.MPD{
+		Profiles:                  dash.ProfileLive,
+		Type:                      "static",
+		MediaPresentationDuration: dash.Duration(time.Duration(video.DurationMs) * time.Millisecond),
+		MinBufferTime:             dash.Duration(dashMinBufferTime),
+		Periods:                   []dash.Period{period},
+	}
+
+	var buf bytes.Buffer
+
+	err = mpd.Encode(&buf)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	return video, buf.Bytes(), nil, nil
+}
+
+// segmentTemplate addresses the segments of a track of a rendition by number, in milliseconds.
+func segmentTemplate(r *Rendition, track transcoder.Track) *dash.SegmentTemplate {
+	dir := r.Name + "/" + string(track) + "/"
+
+	return &dash.SegmentTemplate{
+		Timescale:      1000,
+		Duration:       r.SegmentDurationMs,
+		StartNumber:    0,
+		Initialization: dir + initSection,
+		Media:          dir + dashMedia,
+	}
+}
+
+// StatDASHFile returns the video together with the metadata of an init section or a segment of one of
+// its packaged renditions, name is the path of the file relative to the manifest, 720p/audio/init.mp4 for
+// instance.
+func (vs *Service) StatDASHFile(ctx context.Context, videoId int64, name string) (*Video, *filestore.ObjectInfo, error, map[string]string) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || !segmentRX.MatchString(parts[2]) {
+		return nil, nil, datastore.ErrRecordNotFound, nil
+	}
+
+	rendition, track, file := parts[0], transcoder.Track(parts[1]), parts[2]
+	if track != transcoder.TrackVideo && track != transcoder.TrackAudio {
+		return nil, nil, datastore.ErrRecordNotFound, nil
+	}
+
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	if !video.Streamable() {
+		return nil, nil, ErrVideoNotStreamable, nil
+	}
+
+	renditions, err := vs.store.ListRenditions(ctx, video.ID)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	for _, r := range renditions {
+		if r.Name != rendition || r.DashPrefix == "" || (track == transcoder.TrackAudio && !r.DashAudio) {
+			continue
+		}
+
+		info, err := vs.filestore.Stat(ctx, filestore.DASHKey(video.ID, r.Name, string(track), file))
+		if err != nil {
+			return nil, nil, err, nil
+		}
+
+		switch {
+		case track == transcoder.TrackAudio:
+			info.ContentType = mimeAudioMP4
+		case file == initSection:
+			info.ContentType = mediaprobe.MimeMP4
+		default:
+			info.ContentType = hls.SegmentContentType
+		}
+
+		return video, info, nil, nil
+	}
+
+	return nil, nil, datastore.ErrRecordNotFound, nil
+}
+
+// ReadPackagedFile opens length bytes of a file found by StatHLSFile or StatDASHFile starting at offset, a
+// negative length reads to the end.
+func (vs *Service) ReadPackagedFile(ctx context.Context, video *Video, key string, offset, length int64) (*filestore.Object, error, map[string]string) {
+	if !video.Streamable() {
+		return nil, ErrVideoNotStreamable, nil
+	}
+
+	if !strings.HasPrefix(key, filestore.HLSPrefix(video.ID)) && !strings.HasPrefix(key, filestore.DASHPrefix(video.ID)) {
+		return nil, datastore.ErrRecordNotFound, nil
+	}
+
+	obj, err := vs.filestore.GetRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return obj, nil, nil
+}
+
+// CreateDirectUpload creates a video waiting for its content and a presigned URL the client uploads the
+// content to, bypassing the API server. The client calls CompleteDirectUpload once the upload finished.
+func (vs *Service) CreateDirectUpload(ctx context.Context, actor Actor, filename, contentType string) (*Video, *filestore.PresignedURL, error, map[string]string) {
+	v := validator.New()
+
+	v.Check(filename != "", "filename", "must be provided")
+	v.Check(len(filename) <= 500, "filename", "must not be more than 500 bytes long")
+
+	if !v.Valid() {
+		return nil, nil, VideoValidationError, v.Errors
+	}
+
+	video := &Video{OwnerID: actor.UserID}
+
+	// The content hash is unknown until the client uploaded it, direct uploads use a fixed name instead.
+	// The key is recorded with the video so completion knows where to look, the video only becomes
+	// streamable once its status changes.
+	err := vs.store.InsertWithPath(ctx, video, func(id int64) string {
+		return filestore.VideoKey(id, "source", filename)
+	})
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	presigned, err := vs.filestore.PresignPut(ctx, video.Path, contentType, vs.cfg.PresignExpiry)
+	if err != nil {
+		// Nothing can be uploaded for the video without its URL
+		deleteErr := vs.store.Delete(ctx, video.ID)
+		if deleteErr != nil {
+			vs.background.PrintError(deleteErr, map[string]string{"video_id": strconv.FormatInt(video.ID, 10)})
+		}
+		return nil, nil, err, nil
+	}
+
+	return video, presigned, nil, nil
+}
+
+// CompleteDirectUpload verifies the content of a direct upload reached the filestore and hands the video
+// over to the probe job, it stays processing until the content was probed.
+func (vs *Service) CompleteDirectUpload(ctx context.Context, actor Actor, videoId int64) (*Video, error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if !actor.owns(video) {
+		return nil, ErrNotOwner, nil
+	}
+
+	if video.Status != StatusUploading || video.Path == "" {
+		return nil, ErrVideoNotUploading, nil
+	}
+
+	_, err = vs.filestore.Stat(ctx, video.Path)
+	if err != nil {
+		if errors.Is(err, filestore.ErrObjectNotFound) {
+			return nil, ErrUploadIncomplete, nil
+		}
+		return nil, err, nil
+	}
+
+	// The content never went through the API server, it is validated in place. Invalid content leaves the
+	// video waiting for another upload.
+	head := make([]byte, mediaprobe.SniffLen)
+
+	n, err := filestore.NewReaderAt(ctx, vs.filestore, video.Path).ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err, nil
+	}
+
+	mimeType, err, validationErrors := ValidateContent(head[:n], video.Path)
+	if err != nil {
+		return nil, err, validationErrors
+	}
+
+	video.MimeType = mimeType
+
+	err = vs.store.Update(ctx, video)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	err = vs.store.SetStatus(ctx, video, StatusProcessing, actor.String(), "")
+	if err != nil {
+		return nil, err, nil
+	}
+
+	_, err = vs.background.Enqueue(ctx, JobProbeVideo, probeVideoPayload{VideoID: video.ID})
+	if err != nil {
+		return nil, err, nil
+	}
+
+	return video, nil, nil
+}
+
+// AcceptDirectUpload reports whether content may still be written to key through its presigned URL. Only
+// the key of a video waiting for its direct upload accepts content, completing the upload expires the URL
+// so the sniffed and probed content can't be replaced. URLs presigned natively by the backend can't be
+// revoked, they stay usable until they expire.
+func (vs *Service) AcceptDirectUpload(ctx context.Context, key string) (error, map[string]string) {
+	id, ok := filestore.VideoIDFromKey(key)
+	if !ok {
+		return ErrVideoNotUploading, nil
+	}
+
+	video, err := vs.store.ReadById(ctx, id)
+	if err != nil {
+		if errors.Is(err, datastore.ErrRecordNotFound) {
+			return ErrVideoNotUploading, nil
+		}
+		return err, nil
+	}
+
+	if video.Status != StatusUploading || video.Path != key {
+		return ErrVideoNotUploading, nil
+	}
+
+	return nil, nil
+}
+
+// PresignVideoDownload returns a presigned URL players can fetch the video content from directly.
+func (vs *Service) PresignVideoDownload(ctx context.Context, videoId int64) (*Video, *filestore.PresignedURL, error, map[string]string) {
+	video, err := vs.store.ReadById(ctx, videoId)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	if !video.Streamable() {
+		return nil, nil, ErrVideoNotStreamable, nil
+	}
+
+	presigned, err := vs.filestore.PresignGet(ctx, video.Path, vs.cfg.PresignExpiry)
+	if err != nil {
+		return nil, nil, err, nil
+	}
+
+	return video, presigned, nil, nil
+}
+
+func (vs *Service) registerJobs() {
+	vs.background.Register(JobUploadVideo, vs.uploadVideoJob)
+	vs.background.Register(JobProbeVideo, vs.probeVideoJob)
+	vs.background.Register(JobTranscodeVideo, vs.transcodeVideoJob)
+	vs.background.Register(JobPurgeDeleted, vs.purgeDeletedJob)
+
+	if vs.cfg.PurgeInterval > 0 {
+		vs.background.Schedule(JobPurgeDeleted, vs.cfg.PurgeInterval, nil)
+	}
+}
+
+// NewService builds the videos service, a nil transcoder turns transcoding off.
+func NewService(db *sql.DB, fs filestore.FileStore, bg background.Routine, tc transcoder.Transcoder, cfg Config) (Videos, error) {
+	vs, err := newStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &Service{
+		store:      vs,
+		filestore:  fs,
+		background: bg,
+		transcoder: tc,
+		cfg:        cfg,
+	}
+
+	service.registerJobs()
+
+	return service, nil
 }
@@ -2,6 +2,10 @@ package videos
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
 	"luismatosgarcia.dev/video-sharing-go/internal/tests"
 	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
 	"testing"
@@ -29,7 +33,7 @@ func TestVideos_InsertVideo(t *testing.T) {
 				Description:   "Video Description",
 				Path:          "/videos/path",
 				ImgPath:       "/videos/path",
-				Status:        "Published",
+				Status:        StatusPublished,
 				PublishedDate: time.Time{},
 				CreatedAt:     time.Time{},
 				UpdatedAt:     time.Time{},
@@ -46,7 +50,7 @@ func TestVideos_InsertVideo(t *testing.T) {
 
 			err := store.Insert(context.Background(), tt.video)
 
-			assert.Equal(t, tt.video.Status, "Uploading")
+			assert.Equal(t, tt.video.Status, StatusUploading)
 
 			assert.NilError(t, err)
 
@@ -72,6 +76,29 @@ func TestVideos_InsertVideo(t *testing.T) {
 
 }
 
+func TestVideoStore_InsertWithPath(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	db := tests.NewTestDB(t)
+	store := videoStore{db: db}
+
+	video := &Video{OwnerID: 0}
+
+	err := store.InsertWithPath(context.Background(), video, func(id int64) string {
+		return fmt.Sprintf("videos/%d/source.mp4", id)
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, video.Path, fmt.Sprintf("videos/%d/source.mp4", video.ID))
+
+	stored, err := store.ReadById(context.Background(), video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, stored.Path, video.Path)
+	assert.Equal(t, stored.Status, StatusUploading)
+	assert.Equal(t, stored.Version, video.Version)
+}
+
 func TestVideos_UpdateVideo(t *testing.T) {
 	if testing.Short() {
 		t.Skip("store: skipping integration test")
@@ -168,7 +195,7 @@ func TestVideoStore_ReadByIdVideo(t *testing.T) {
 				Description: "Video Description",
 				Path:        "No Path",
 				ImgPath:     "No Thumbnail",
-				Status:      "No Status",
+				Status:      StatusReady,
 			},
 		},
 	}
@@ -192,3 +219,289 @@ func TestVideoStore_ReadByIdVideo(t *testing.T) {
 		})
 	}
 }
+
+func TestVideoStore_SetStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	db := tests.NewTestDB(t)
+	store := videoStore{db: db}
+	ctx := context.Background()
+
+	actor := Actor{UserID: 1, Moderator: true}
+
+	video := &Video{}
+	assert.NilError(t, store.Insert(ctx, video))
+
+	err := store.SetStatus(ctx, video, StatusPublished, actor.String(), "")
+	assert.Equal(t, errors.Is(err, ErrInvalidTransition), true)
+
+	stale := *video
+
+	assert.NilError(t, store.SetStatus(ctx, video, StatusProcessing, actorUploadJob, ""))
+	assert.Equal(t, video.Status, StatusProcessing)
+
+	err = store.SetStatus(ctx, &stale, StatusFailed, actorUploadJob, "")
+	assert.Equal(t, errors.Is(err, datastore.ErrEditConflict), true)
+
+	assert.NilError(t, store.SetStatus(ctx, video, StatusFailed, actorUploadJob, "upload failed"))
+
+	read, err := store.ReadById(ctx, video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, read.Status, StatusFailed)
+	assert.Equal(t, read.FailureReason, "upload failed")
+
+	assert.NilError(t, store.SoftDelete(ctx, read, actor.String()))
+
+	err = store.Restore(ctx, video.ID, 2, actor.String())
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+
+	assert.NilError(t, store.Restore(ctx, video.ID, 0, actor.String()))
+
+	read, err = store.ReadById(ctx, video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, read.Status, StatusFailed)
+
+	var changes int
+
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM video_status_history WHERE video_id = $1`, video.ID).Scan(&changes)
+	assert.NilError(t, err)
+	assert.Equal(t, changes, 4)
+}
+
+func TestVideoStore_Delete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	db := tests.NewTestDB(t)
+	store := videoStore{db: db}
+	ctx := context.Background()
+
+	video := &Video{}
+	assert.NilError(t, store.Insert(ctx, video))
+	assert.NilError(t, store.Delete(ctx, video.ID))
+
+	_, err := store.ReadById(ctx, video.ID)
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+
+	// Videos that received their content are never removed
+	processing := &Video{}
+	assert.NilError(t, store.Insert(ctx, processing))
+	assert.NilError(t, store.SetStatus(ctx, processing, StatusProcessing, actorUploadJob, ""))
+
+	err = store.Delete(ctx, processing.ID)
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+}
+
+func TestVideoStore_Blobs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	db := tests.NewTestDB(t)
+	store := videoStore{db: db}
+	ctx := context.Background()
+
+	first := &Video{}
+	assert.NilError(t, store.Insert(ctx, first))
+
+	// Nothing is stored under the hash yet
+	err := store.AttachBlob(ctx, first, &Blob{SHA256: "b5d5"})
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+
+	assert.NilError(t, store.AttachBlob(ctx, first, &Blob{SHA256: "b5d5", Key: "videos/01/00/1/b5d5.mp4", Size: 5}))
+	assert.Equal(t, first.Path, "videos/01/00/1/b5d5.mp4")
+
+	second := &Video{}
+	assert.NilError(t, store.Insert(ctx, second))
+
+	blob := &Blob{SHA256: "b5d5"}
+	assert.NilError(t, store.AttachBlob(ctx, second, blob))
+	assert.Equal(t, second.Path, "videos/01/00/1/b5d5.mp4")
+	assert.Equal(t, blob.RefCount, 2)
+
+	// The content is only released with its last reference
+	for i, video := range []*Video{first, second} {
+		assert.NilError(t, store.SetStatus(ctx, video, StatusProcessing, actorUploadJob, ""))
+		assert.NilError(t, store.SoftDelete(ctx, video, actorUploadJob))
+
+		keys, err := store.Purge(ctx, video.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, len(keys), i)
+	}
+
+	// An unpublished video keeps no published date
+	var published sql.NullTime
+	third := &Video{}
+	assert.NilError(t, store.Insert(ctx, third))
+	assert.NilError(t, store.Update(ctx, third))
+	assert.NilError(t, db.QueryRowContext(ctx, `SELECT published_at FROM videos WHERE id = $1`, third.ID).Scan(&published))
+	assert.Equal(t, published.Valid, false)
+}
+
+func TestVideoStore_SetMediaInfo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	db := tests.NewTestDB(t)
+	store := videoStore{db: db}
+	ctx := context.Background()
+
+	video := &Video{}
+	assert.NilError(t, store.Insert(ctx, video))
+
+	video.DurationMs = 10000
+	video.Width = 1280
+	video.Height = 720
+	video.VideoCodec = "h264"
+	video.Bitrate = 1500000
+	video.Container = "mp4"
+
+	assert.NilError(t, store.SetMediaInfo(ctx, video))
+	assert.Equal(t, video.Version, int32(2))
+
+	read, err := store.ReadById(ctx, video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, read.DurationMs, int64(10000))
+	assert.Equal(t, read.Width, 1280)
+	assert.Equal(t, read.Height, 720)
+	assert.Equal(t, read.VideoCodec, "h264")
+	assert.Equal(t, read.AudioCodec, "")
+	assert.Equal(t, read.Bitrate, int64(1500000))
+	assert.Equal(t, read.Container, "mp4")
+
+	err = store.SetMediaInfo(ctx, &Video{ID: video.ID + 100})
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+}
+
+func TestVideoStore_Renditions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	db := tests.NewTestDB(t)
+	store := videoStore{db: db}
+	ctx := context.Background()
+
+	video := &Video{}
+	assert.NilError(t, store.Insert(ctx, video))
+
+	for _, r := range []*Rendition{
+		{VideoID: video.ID, Name: "480p", Key: "renditions/480p.mp4", Width: 854, Height: 480, VideoBitrate: 1400000, AudioBitrate: 128000, Size: 10},
+		{VideoID: video.ID, Name: "720p", Key: "renditions/720p.mp4", Width: 1280, Height: 720, VideoBitrate: 2800000, AudioBitrate: 128000, Size: 20},
+		{VideoID: video.ID, Name: "720p", Key: "renditions/720p-retry.mp4", Width: 1280, Height: 720, VideoBitrate: 2800000, AudioBitrate: 128000, Size: 30,
+			Codecs: "avc1.64001f,mp4a.40.2", Bandwidth: 3100000, AverageBandwidth: 2900000, PlaylistKey: "hls/720p/index.m3u8",
+			DashPrefix: "dash/720p/", DashAudio: true, SegmentDurationMs: 6000},
+	} {
+		assert.NilError(t, store.InsertRendition(ctx, r))
+	}
+
+	renditions, err := store.ListRenditions(ctx, video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(renditions), 2)
+	assert.Equal(t, renditions[0].Name, "720p")
+	assert.Equal(t, renditions[0].Key, "renditions/720p-retry.mp4")
+	assert.Equal(t, renditions[0].Size, int64(30))
+	assert.Equal(t, renditions[0].Codecs, "avc1.64001f,mp4a.40.2")
+	assert.Equal(t, renditions[0].Bandwidth, int64(3100000))
+	assert.Equal(t, renditions[0].AverageBandwidth, int64(2900000))
+	assert.Equal(t, renditions[0].PlaylistKey, "hls/720p/index.m3u8")
+	assert.Equal(t, renditions[0].DashPrefix, "dash/720p/")
+	assert.Equal(t, renditions[0].DashAudio, true)
+	assert.Equal(t, renditions[0].SegmentDurationMs, int64(6000))
+	assert.Equal(t, renditions[1].Name, "480p")
+	assert.Equal(t, renditions[1].PlaylistKey, "")
+	assert.Equal(t, renditions[1].DashPrefix, "")
+
+	_, err = db.Exec(`UPDATE videos SET deleted_at = now() WHERE id = $1`, video.ID)
+	assert.NilError(t, err)
+
+	keys, err := store.Purge(ctx, video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(keys), 2)
+
+	renditions, err = store.ListRenditions(ctx, video.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(renditions), 0)
+}
+
+func TestVideoStore_List(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	testsMap := []struct {
+		name         string
+		filters      VideoFilters
+		totalRecords int
+	}{
+		{
+			name:         "Can List",
+			filters:      VideoFilters{Filters: datastore.Filters{Page: 1, PageSize: 20, Sort: "-id", SortSafelist: videoSortSafelist}},
+			totalRecords: 1,
+		},
+		{
+			name:         "Title Filter",
+			filters:      VideoFilters{Title: "missing", Filters: datastore.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: videoSortSafelist}},
+			totalRecords: 0,
+		},
+		{
+			name:         "Status Filter",
+			filters:      VideoFilters{Statuses: []string{"ready"}, Filters: datastore.Filters{Page: 1, PageSize: 20, Sort: "published_date", SortSafelist: videoSortSafelist}},
+			totalRecords: 1,
+		},
+	}
+
+	db := tests.NewTestDB(t)
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			store := videoStore{db: db}
+
+			videos, totalRecords, err := store.List(context.Background(), tt.filters)
+
+			assert.NilError(t, err)
+			assert.Equal(t, totalRecords, tt.totalRecords)
+			assert.Equal(t, len(videos), tt.totalRecords)
+		})
+	}
+}
+
+func TestVideoStore_Search(t *testing.T) {
+	if testing.Short() {
+		t.Skip("store: skipping integration test")
+	}
+
+	testsMap := []struct {
+		name         string
+		query        string
+		totalRecords int
+	}{
+		{name: "Matches Description", query: "descriptions", totalRecords: 1},
+		{name: "Prefix Match", query: "descr*", totalRecords: 1},
+		{name: "Excluded Word", query: "video -description", totalRecords: 0},
+		{name: "No Match", query: "missing", totalRecords: 0},
+	}
+
+	db := tests.NewTestDB(t)
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			store := videoStore{db: db}
+
+			results, totalRecords, err := store.Search(context.Background(), SearchFilters{
+				Query:   tt.query,
+				Filters: datastore.Filters{Page: 1, PageSize: 20, Sort: "relevance", SortSafelist: searchSortSafelist},
+			})
+
+			assert.NilError(t, err)
+			assert.Equal(t, totalRecords, tt.totalRecords)
+			assert.Equal(t, len(results), tt.totalRecords)
+
+			if tt.totalRecords > 0 {
+				assert.StringContains(t, results[0].Highlights.Description, "<mark>")
+			}
+		})
+	}
+}
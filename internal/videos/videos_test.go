@@ -3,12 +3,21 @@ package videos
 import (
 	"bytes"
 	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"luismatosgarcia.dev/video-sharing-go/internal/background"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/dash"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/transcoder"
 	"luismatosgarcia.dev/video-sharing-go/internal/tests/assert"
 	"mime/multipart"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -20,7 +29,22 @@ type testResult struct {
 	validateFields bool
 }
 
+// moderator may manage every video, ownership is covered by TestService_Ownership.
+var moderator = Actor{UserID: 1, Moderator: true}
+
+// sampleMP4 reads a small MP4 the probe job accepts, an H.264 and AAC movie of 1280x720 and 10 seconds.
+func sampleMP4(t *testing.T) []byte {
+	data, err := os.ReadFile("../tests/testdata/sample.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
 func TestService_UploadVideo(t *testing.T) {
+	sample := sampleMP4(t)
+
 	testsMap := []struct {
 		name           string
 		videoFile      io.Reader
@@ -29,64 +53,196 @@ func TestService_UploadVideo(t *testing.T) {
 		storeMock      store
 		filestoreMock  filestore.FileStore
 		backgroundMock background.Routine
+		maxSize        int64
+		wantsErr       error
 	}{
 		{
 			name:      "Can Upload",
-			videoFile: &bytes.Buffer{},
+			videoFile: bytes.NewReader(sample),
 			fileHeader: multipart.FileHeader{
 				Filename: "Video.mp4",
 				Header:   nil,
-				Size:     0,
+				Size:     int64(len(sample)),
 			},
 			storeMock: storeMock{
 				fnCalls: make(map[string]int),
-				video:   &Video{},
+				video:   &Video{Status: StatusUploading},
 				err:     nil,
 			},
 			filestoreMock: filestore.Mock{
 				FnCalls: make(map[string]int),
-				Str:     "/videos/Video.mp4",
+				Body:    sample,
 				Err:     nil,
 			},
 			backgroundMock: &background.RoutineMock{},
 			wants: testResult{
-				video: Video{},
+				video: Video{Status: StatusReady},
 				fnCalls: map[string]int{
-					"vsInsert": 1,
-					"fsSet":    1,
+					"vsInsert":       1,
+					"vsAttachBlob":   1,
+					"vsSetStatus":    2,
+					"vsSetMediaInfo": 1,
+					"fsPut":          1,
+					"fsDelete":       0,
 				},
 				shouldError:    false,
 				validateFields: false,
 			},
 		},
+		{
+			name:      "Identical Content Reuses Blob",
+			videoFile: bytes.NewReader(sample),
+			fileHeader: multipart.FileHeader{
+				Filename: "Video.mp4",
+				Header:   nil,
+				Size:     int64(len(sample)),
+			},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 2, Status: StatusUploading},
+				blob:    &Blob{SHA256: "b5d5", Key: "videos/01/00/1/b5d5.mp4", Size: 5, RefCount: 1},
+				err:     nil,
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Body:    sample,
+				Err:     nil,
+			},
+			backgroundMock: &background.RoutineMock{},
+			wants: testResult{
+				video: Video{Status: StatusReady},
+				fnCalls: map[string]int{
+					"vsInsert":       1,
+					"vsAttachBlob":   1,
+					"vsSetStatus":    2,
+					"vsSetMediaInfo": 1,
+					"fsPut":          1,
+					"fsDelete":       1,
+				},
+				shouldError: false,
+			},
+		},
+		{
+			name:      "Staging Failure Removes Video",
+			videoFile: bytes.NewReader(sample),
+			fileHeader: multipart.FileHeader{
+				Filename: "Video.mp4",
+				Header:   nil,
+				Size:     int64(len(sample)),
+			},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 3, Status: StatusUploading},
+				err:     nil,
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Err:     errors.New("bucket unavailable"),
+			},
+			backgroundMock: &background.RoutineMock{},
+			wants: testResult{
+				video: Video{Status: StatusUploading},
+				fnCalls: map[string]int{
+					"vsInsert":     1,
+					"vsDelete":     1,
+					"vsAttachBlob": 0,
+					"vsSetStatus":  0,
+					"fsPut":        1,
+					"fsDelete":     1,
+				},
+				shouldError: true,
+			},
+		},
 		{
 			name:      "Store Returns Error",
-			videoFile: &bytes.Buffer{},
+			videoFile: bytes.NewReader(sample),
 			fileHeader: multipart.FileHeader{
 				Filename: "Video.mp4",
 				Header:   nil,
-				Size:     0,
+				Size:     int64(len(sample)),
 			},
 			storeMock: storeMock{
 				fnCalls: make(map[string]int),
-				video:   &Video{},
+				video:   &Video{Status: StatusUploading},
 				err:     map[string]error{"Insert": datastore.ErrEditConflict},
 			},
 			filestoreMock: filestore.Mock{
 				FnCalls: make(map[string]int),
-				Str:     "/videos/Video.mp4",
 				Err:     nil,
 			},
 			backgroundMock: &background.RoutineMock{},
 			wants: testResult{
-				video: Video{},
+				video: Video{Status: StatusUploading},
 				fnCalls: map[string]int{
-					"vsInsert": 1,
-					"fsSet":    0,
+					"vsInsert":     1,
+					"vsAttachBlob": 0,
+					"vsSetStatus":  0,
+					"fsPut":        0,
 				},
 				shouldError: true,
 			},
 		},
+		{
+			name:      "Rejects Non Video Content",
+			videoFile: bytes.NewBufferString("#!/bin/sh\necho not a video\n"),
+			fileHeader: multipart.FileHeader{
+				Filename: "Video.mp4",
+				Size:     27,
+			},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{Status: StatusUploading},
+			},
+			filestoreMock:  filestore.Mock{FnCalls: make(map[string]int)},
+			backgroundMock: &background.RoutineMock{},
+			wantsErr:       ErrUnsupportedVideo,
+			wants: testResult{
+				video:       Video{Status: StatusUploading},
+				fnCalls:     map[string]int{"vsInsert": 0},
+				shouldError: true,
+			},
+		},
+		{
+			name:      "Rejects Mismatched Extension",
+			videoFile: bytes.NewReader(sample),
+			fileHeader: multipart.FileHeader{
+				Filename: "Video.webm",
+				Size:     int64(len(sample)),
+			},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{Status: StatusUploading},
+			},
+			filestoreMock:  filestore.Mock{FnCalls: make(map[string]int)},
+			backgroundMock: &background.RoutineMock{},
+			wantsErr:       VideoValidationError,
+			wants: testResult{
+				video:       Video{Status: StatusUploading},
+				fnCalls:     map[string]int{"vsInsert": 0},
+				shouldError: true,
+			},
+		},
+		{
+			name:      "Rejects Too Large",
+			videoFile: bytes.NewReader(sample),
+			fileHeader: multipart.FileHeader{
+				Filename: "Video.mp4",
+				Size:     int64(len(sample)),
+			},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{Status: StatusUploading},
+			},
+			filestoreMock:  filestore.Mock{FnCalls: make(map[string]int)},
+			backgroundMock: &background.RoutineMock{},
+			maxSize:        1024,
+			wantsErr:       ErrVideoTooLarge,
+			wants: testResult{
+				video:       Video{Status: StatusUploading},
+				fnCalls:     map[string]int{"vsInsert": 0},
+				shouldError: true,
+			},
+		},
 	}
 
 	for _, tt := range testsMap {
@@ -95,9 +251,11 @@ func TestService_UploadVideo(t *testing.T) {
 				store:      tt.storeMock,
 				filestore:  tt.filestoreMock,
 				background: tt.backgroundMock,
+				cfg:        Config{SpoolDir: t.TempDir(), MaxSize: tt.maxSize},
 			}
+			service.registerJobs()
 
-			_, err, _ := service.UploadVideo(context.Background(), &tt.videoFile, &tt.fileHeader)
+			_, err, _ := service.UploadVideo(context.Background(), moderator, &tt.videoFile, &tt.fileHeader)
 			tt.backgroundMock.Wait()
 
 			if !tt.wants.shouldError {
@@ -106,14 +264,198 @@ func TestService_UploadVideo(t *testing.T) {
 				assert.Error(t, err)
 			}
 
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
 			vs := tt.storeMock.(storeMock)
 			assert.Equal(t, vs.GetFnCalls("Insert"), tt.wants.fnCalls["vsInsert"])
+			assert.Equal(t, vs.GetFnCalls("Delete"), tt.wants.fnCalls["vsDelete"])
+
+			assert.Equal(t, vs.GetFnCalls("AttachBlob"), tt.wants.fnCalls["vsAttachBlob"])
+			assert.Equal(t, vs.GetFnCalls("SetStatus"), tt.wants.fnCalls["vsSetStatus"])
+			assert.Equal(t, vs.GetFnCalls("SetMediaInfo"), tt.wants.fnCalls["vsSetMediaInfo"])
+			assert.Equal(t, vs.video.Status, tt.wants.video.Status)
+			assert.Equal(t, vs.video.FailureReason, tt.wants.video.FailureReason)
 
 			fs := tt.filestoreMock.(filestore.Mock)
-			assert.Equal(t, fs.GetFnCalls("Set"), tt.wants.fnCalls["fsSet"])
+			assert.Equal(t, fs.GetFnCalls("Put"), tt.wants.fnCalls["fsPut"])
+			assert.Equal(t, fs.GetFnCalls("Delete"), tt.wants.fnCalls["fsDelete"])
+		})
+	}
+
+}
+
+func TestService_UploadVideoJob(t *testing.T) {
+	key := filestore.VideoKey(1, "b5d5", "video.mp4")
+
+	testMaps := []struct {
+		name        string
+		storeMock   storeMock
+		shouldError bool
+		wantsVideo  Video
+		fnCalls     map[string]int
+	}{
+		{
+			name:       "Attaches Uploaded Content",
+			storeMock:  storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusUploading}},
+			wantsVideo: Video{Status: StatusProcessing, Path: key},
+			fnCalls:    map[string]int{"vsAttachBlob": 1, "fsDelete": 0},
+		},
+		{
+			name: "Identical Content Drops Upload",
+			storeMock: storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusUploading},
+				blob: &Blob{SHA256: "b5d5", Key: "videos/02/00/2/b5d5.mp4", Size: 5, RefCount: 2}},
+			wantsVideo: Video{Status: StatusProcessing, Path: "videos/02/00/2/b5d5.mp4"},
+			fnCalls:    map[string]int{"vsAttachBlob": 1, "fsDelete": 1},
+		},
+		{
+			name: "Failed Attach Marks Video Failed",
+			storeMock: storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusUploading},
+				err: map[string]error{"AttachBlob": errors.New("database unavailable")}},
+			shouldError: true,
+			wantsVideo:  Video{Status: StatusFailed, FailureReason: "database unavailable"},
+			fnCalls:     map[string]int{"vsAttachBlob": 1, "fsDelete": 1},
+		},
+		{
+			name: "Removed Video Leaves Content",
+			storeMock: storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusUploading},
+				err: map[string]error{"ReadById": datastore.ErrRecordNotFound}},
+			shouldError: true,
+			wantsVideo:  Video{Status: StatusUploading},
+			fnCalls:     map[string]int{"vsAttachBlob": 0, "fsDelete": 0},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := filestore.Mock{FnCalls: make(map[string]int)}
+
+			// The probe job does nothing, the video stays processing
+			service := Service{
+				store:      tt.storeMock,
+				filestore:  fs,
+				background: &background.RoutineMock{},
+			}
+			service.background.Register(JobProbeVideo, func(ctx context.Context, job *background.Job) error { return nil })
+
+			payload := fmt.Sprintf(`{"video_id":1,"key":%q,"filename":"video.mp4","size":5,"sha256":"b5d5"}`, key)
+			job := &background.Job{Kind: JobUploadVideo, Payload: []byte(payload), Attempts: 1, MaxAttempts: 1}
+
+			err := service.uploadVideoJob(context.Background(), job)
+			service.background.Wait()
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			assert.Equal(t, tt.storeMock.video.Status, tt.wantsVideo.Status)
+			assert.Equal(t, tt.storeMock.video.Path, tt.wantsVideo.Path)
+			assert.Equal(t, tt.storeMock.video.FailureReason, tt.wantsVideo.FailureReason)
+			assert.Equal(t, tt.storeMock.GetFnCalls("AttachBlob"), tt.fnCalls["vsAttachBlob"])
+			assert.Equal(t, fs.GetFnCalls("Put"), 0)
+			assert.Equal(t, fs.GetFnCalls("Delete"), tt.fnCalls["fsDelete"])
 		})
 	}
+}
+
+func TestService_UploadReservedVideo(t *testing.T) {
+	sample := sampleMP4(t)
+
+	testMaps := []struct {
+		name        string
+		video       Video
+		actor       Actor
+		content     []byte
+		wantsErr    error
+		shouldError bool
+		fnCalls     map[string]int
+	}{
+		{
+			name:    "Stages Content",
+			video:   Video{ID: 1, OwnerID: 2, Status: StatusUploading},
+			actor:   Actor{UserID: 2},
+			content: sample,
+			fnCalls: map[string]int{"vsUpdate": 1, "fsPut": 1, "bgEnqueue": 1},
+		},
+		{
+			name:    "Handed Over Video Is Returned As Is",
+			video:   Video{ID: 1, OwnerID: 2, Status: StatusProcessing, MimeType: "video/mp4"},
+			actor:   Actor{UserID: 2},
+			content: sample,
+			fnCalls: map[string]int{"vsUpdate": 0, "fsPut": 0, "bgEnqueue": 0},
+		},
+		{
+			name:        "Refuses Other Owners",
+			video:       Video{ID: 1, OwnerID: 2, Status: StatusUploading},
+			actor:       Actor{UserID: 3},
+			content:     sample,
+			wantsErr:    ErrNotOwner,
+			shouldError: true,
+			fnCalls:     map[string]int{"vsUpdate": 0, "fsPut": 0, "bgEnqueue": 0},
+		},
+		{
+			name:        "Refuses Direct Uploads",
+			video:       Video{ID: 1, OwnerID: 2, Status: StatusUploading, Path: "videos/01/00/1/upload"},
+			actor:       Actor{UserID: 2},
+			content:     sample,
+			wantsErr:    ErrVideoNotUploading,
+			shouldError: true,
+			fnCalls:     map[string]int{"vsUpdate": 0, "fsPut": 0, "bgEnqueue": 0},
+		},
+		{
+			name:        "Rejects Non Video Content",
+			video:       Video{ID: 1, OwnerID: 2, Status: StatusUploading},
+			actor:       Actor{UserID: 2},
+			content:     []byte("#!/bin/sh\necho not a video\n"),
+			wantsErr:    ErrUnsupportedVideo,
+			shouldError: true,
+			fnCalls:     map[string]int{"vsUpdate": 0, "fsPut": 0, "bgEnqueue": 0},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			video := tt.video
+			sm := storeMock{fnCalls: make(map[string]int), video: &video}
+			fs := filestore.Mock{FnCalls: make(map[string]int)}
+
+			// The upload job does nothing, the staged content stays in place
+			enqueued := 0
+			service := Service{
+				store:      sm,
+				filestore:  fs,
+				background: &background.RoutineMock{},
+			}
+			service.background.Register(JobUploadVideo, func(ctx context.Context, job *background.Job) error {
+				enqueued++
+				return nil
+			})
+
+			var r io.Reader = bytes.NewReader(tt.content)
+			header := multipart.FileHeader{Filename: "video.mp4", Size: int64(len(tt.content))}
+
+			v, err, _ := service.UploadReservedVideo(context.Background(), tt.actor, 1, &r, &header)
+			service.background.Wait()
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+				assert.Equal(t, v.ID, tt.video.ID)
+			} else {
+				assert.Error(t, err)
+			}
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
 
+			assert.Equal(t, sm.GetFnCalls("Update"), tt.fnCalls["vsUpdate"])
+			assert.Equal(t, fs.GetFnCalls("Put"), tt.fnCalls["fsPut"])
+			assert.Equal(t, enqueued, tt.fnCalls["bgEnqueue"])
+		})
+	}
 }
 
 func TestService_CreateVideo(t *testing.T) {
@@ -292,7 +634,7 @@ func TestService_CreateVideo(t *testing.T) {
 				store: tt.storeMock,
 			}
 
-			v, err, _ := service.UpdateVideo(context.Background(), tt.id, tt.videoInput)
+			v, err, _ := service.UpdateVideo(context.Background(), moderator, tt.id, tt.videoInput)
 
 			if !tt.wants.shouldError {
 				assert.NilError(t, err)
@@ -331,7 +673,7 @@ func TestService_ReadVideo(t *testing.T) {
 					Description:   "Video Description",
 					Path:          "/videos/1",
 					ImgPath:       "/videosImg/1",
-					Status:        "Published",
+					Status:        StatusPublished,
 					PublishedDate: time.Now(),
 					CreatedAt:     time.Now(),
 					UpdatedAt:     time.Now(),
@@ -346,7 +688,7 @@ func TestService_ReadVideo(t *testing.T) {
 					Description:   "Video Description",
 					Path:          "/videos/1",
 					ImgPath:       "/videosImg/1",
-					Status:        "Published",
+					Status:        StatusPublished,
 					PublishedDate: time.Now(),
 					CreatedAt:     time.Now(),
 					UpdatedAt:     time.Now(),
@@ -370,7 +712,7 @@ func TestService_ReadVideo(t *testing.T) {
 					Description:   "Video Description",
 					Path:          "/videos/1",
 					ImgPath:       "/videosImg/1",
-					Status:        "Published",
+					Status:        StatusPublished,
 					PublishedDate: time.Now(),
 					CreatedAt:     time.Now(),
 					UpdatedAt:     time.Now(),
@@ -420,3 +762,1203 @@ func TestService_ReadVideo(t *testing.T) {
 		})
 	}
 }
+
+func TestService_StatVideoContent(t *testing.T) {
+	testMaps := []struct {
+		name          string
+		id            int64
+		wantsErr      error
+		fnCalls       map[string]int
+		storeMock     store
+		filestoreMock filestore.Mock
+	}{
+		{
+			name: "Can Stat Uploaded Video",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Body:    []byte("video"),
+			},
+			fnCalls: map[string]int{
+				"vsReadById": 1,
+				"fsStat":     1,
+			},
+		},
+		{
+			name: "Uploading Video Is Not Streamable",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Status: StatusUploading},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+			},
+			wantsErr: ErrVideoNotStreamable,
+			fnCalls: map[string]int{
+				"vsReadById": 1,
+				"fsStat":     0,
+			},
+		},
+		{
+			name: "Missing Object",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Err:     filestore.ErrObjectNotFound,
+			},
+			wantsErr: filestore.ErrObjectNotFound,
+			fnCalls: map[string]int{
+				"vsReadById": 1,
+				"fsStat":     1,
+			},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{
+				store:     tt.storeMock,
+				filestore: tt.filestoreMock,
+			}
+
+			_, info, err, _ := service.StatVideoContent(context.Background(), tt.id)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, info.Size, int64(len(tt.filestoreMock.Body)))
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			vs := tt.storeMock.(storeMock)
+			assert.Equal(t, vs.GetFnCalls("ReadById"), tt.fnCalls["vsReadById"])
+			assert.Equal(t, tt.filestoreMock.GetFnCalls("Stat"), tt.fnCalls["fsStat"])
+		})
+	}
+}
+
+func TestService_CreateDirectUpload(t *testing.T) {
+	testMaps := []struct {
+		name     string
+		filename string
+		storeErr map[string]error
+		fsErr    error
+		wantsErr error
+		fnCalls  map[string]int
+	}{
+		{
+			name:     "Can Create Direct Upload",
+			filename: "video.mp4",
+			fnCalls:  map[string]int{"vsInsertWithPath": 1, "vsDelete": 0, "fsPresignPut": 1},
+		},
+		{
+			name:     "Requires Filename",
+			wantsErr: VideoValidationError,
+			fnCalls:  map[string]int{"vsInsertWithPath": 0, "vsDelete": 0, "fsPresignPut": 0},
+		},
+		{
+			name:     "Insert Fails",
+			filename: "video.mp4",
+			storeErr: map[string]error{"InsertWithPath": errors.New("database unavailable")},
+			fnCalls:  map[string]int{"vsInsertWithPath": 1, "vsDelete": 0, "fsPresignPut": 0},
+		},
+		{
+			name:     "Presign Failure Removes Video",
+			filename: "video.mp4",
+			fsErr:    errors.New("signing unavailable"),
+			fnCalls:  map[string]int{"vsInsertWithPath": 1, "vsDelete": 1, "fsPresignPut": 1},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := storeMock{fnCalls: make(map[string]int), err: tt.storeErr}
+			fs := filestore.Mock{FnCalls: make(map[string]int), Err: tt.fsErr, URL: &filestore.PresignedURL{URL: "http://localhost/upload"}}
+
+			service := Service{store: sm, filestore: fs, background: &background.RoutineMock{}}
+
+			video, presigned, err, _ := service.CreateDirectUpload(context.Background(), Actor{UserID: 2}, tt.filename, "video/mp4")
+
+			shouldError := tt.wantsErr != nil || tt.storeErr != nil || tt.fsErr != nil
+			if !shouldError {
+				assert.NilError(t, err)
+				assert.Equal(t, video.Path, filestore.VideoKey(video.ID, "source", tt.filename))
+				assert.Equal(t, presigned.URL, "http://localhost/upload")
+			} else {
+				assert.Error(t, err)
+			}
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			assert.Equal(t, sm.GetFnCalls("InsertWithPath"), tt.fnCalls["vsInsertWithPath"])
+			assert.Equal(t, sm.GetFnCalls("Delete"), tt.fnCalls["vsDelete"])
+			assert.Equal(t, fs.GetFnCalls("PresignPut"), tt.fnCalls["fsPresignPut"])
+		})
+	}
+}
+
+func TestService_CompleteDirectUpload(t *testing.T) {
+	testMaps := []struct {
+		name          string
+		id            int64
+		wantsErr      error
+		fnCalls       map[string]int
+		storeMock     store
+		filestoreMock filestore.Mock
+	}{
+		{
+			name: "Can Complete Direct Upload",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusUploading},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Body:    sampleMP4(t),
+			},
+			fnCalls: map[string]int{
+				"vsReadById":  2,
+				"vsUpdate":    1,
+				"vsSetStatus": 2,
+				"fsStat":      2,
+			},
+		},
+		{
+			name: "Rejects Non Video Content",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusUploading},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Body:    []byte("<html><body>not a video</body></html>"),
+			},
+			wantsErr: ErrUnsupportedVideo,
+			fnCalls: map[string]int{
+				"vsReadById":  1,
+				"vsUpdate":    0,
+				"vsSetStatus": 0,
+				"fsStat":      1,
+			},
+		},
+		{
+			name: "Rejects Mismatched Extension",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.ts", Status: StatusUploading},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Body:    sampleMP4(t),
+			},
+			wantsErr: VideoValidationError,
+			fnCalls: map[string]int{
+				"vsReadById":  1,
+				"vsUpdate":    0,
+				"vsSetStatus": 0,
+				"fsStat":      1,
+			},
+		},
+		{
+			name: "Object Not Uploaded Yet",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusUploading},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+				Err:     filestore.ErrObjectNotFound,
+			},
+			wantsErr: ErrUploadIncomplete,
+			fnCalls: map[string]int{
+				"vsReadById":  1,
+				"vsSetStatus": 0,
+				"fsStat":      1,
+			},
+		},
+		{
+			name: "Video Already Uploaded",
+			id:   1,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+			},
+			filestoreMock: filestore.Mock{
+				FnCalls: make(map[string]int),
+			},
+			wantsErr: ErrVideoNotUploading,
+			fnCalls: map[string]int{
+				"vsReadById":  1,
+				"vsSetStatus": 0,
+				"fsStat":      0,
+			},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			bg := &background.RoutineMock{}
+
+			service := Service{
+				store:      tt.storeMock,
+				filestore:  tt.filestoreMock,
+				background: bg,
+			}
+			service.registerJobs()
+
+			video, err, _ := service.CompleteDirectUpload(context.Background(), moderator, tt.id)
+			bg.Wait()
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, video.Status, StatusReady)
+				assert.Equal(t, video.Width, 1280)
+				assert.Equal(t, video.MimeType, "video/mp4")
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			vs := tt.storeMock.(storeMock)
+			assert.Equal(t, vs.GetFnCalls("ReadById"), tt.fnCalls["vsReadById"])
+			assert.Equal(t, vs.GetFnCalls("Update"), tt.fnCalls["vsUpdate"])
+			assert.Equal(t, vs.GetFnCalls("SetStatus"), tt.fnCalls["vsSetStatus"])
+			assert.Equal(t, tt.filestoreMock.GetFnCalls("Stat"), tt.fnCalls["fsStat"])
+		})
+	}
+}
+
+func TestService_AcceptDirectUpload(t *testing.T) {
+	key := filestore.VideoKey(1, "source", "video.mp4")
+
+	testMaps := []struct {
+		name     string
+		key      string
+		video    *Video
+		storeErr map[string]error
+		wantsErr error
+	}{
+		{name: "Accepts Waiting Upload", key: key, video: &Video{ID: 1, Path: key, Status: StatusUploading}},
+		{name: "Expires Once Completed", key: key, video: &Video{ID: 1, Path: key, Status: StatusProcessing}, wantsErr: ErrVideoNotUploading},
+		{name: "Refuses Other Keys Of The Video", key: filestore.VideoKey(1, "b5d5", "video.mp4"), video: &Video{ID: 1, Path: key, Status: StatusUploading}, wantsErr: ErrVideoNotUploading},
+		{name: "Refuses Keys Of No Video", key: filestore.RenditionKey(1, "720p"), video: &Video{ID: 1, Path: key, Status: StatusUploading}, wantsErr: ErrVideoNotUploading},
+		{name: "Refuses Removed Videos", key: key, video: &Video{}, storeErr: map[string]error{"ReadById": datastore.ErrRecordNotFound}, wantsErr: ErrVideoNotUploading},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{store: storeMock{fnCalls: make(map[string]int), video: tt.video, err: tt.storeErr}}
+
+			err, _ := service.AcceptDirectUpload(context.Background(), tt.key)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+		})
+	}
+}
+
+func TestStatus_CanTransitionTo(t *testing.T) {
+	assert.Equal(t, StatusUploading.CanTransitionTo(StatusProcessing), true)
+	assert.Equal(t, StatusProcessing.CanTransitionTo(StatusFailed), true)
+	assert.Equal(t, StatusReady.CanTransitionTo(StatusPublished), true)
+	assert.Equal(t, StatusPublished.CanTransitionTo(StatusArchived), true)
+	assert.Equal(t, StatusDeleted.CanTransitionTo(StatusPublished), true)
+
+	assert.Equal(t, StatusUploading.CanTransitionTo(StatusPublished), false)
+	assert.Equal(t, StatusUploading.CanTransitionTo(StatusReady), false)
+	assert.Equal(t, StatusFailed.CanTransitionTo(StatusReady), false)
+	assert.Equal(t, StatusDeleted.CanTransitionTo(StatusDeleted), false)
+	assert.Equal(t, Status("").CanTransitionTo(StatusReady), false)
+}
+
+func TestService_UpdateVideoStatus(t *testing.T) {
+	testMaps := []struct {
+		name        string
+		status      Status
+		wantsErr    error
+		wantsStatus Status
+		storeMock   storeMock
+		setStatus   int
+	}{
+		{
+			name:        "Can Publish",
+			status:      StatusPublished,
+			storeMock:   storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusReady}},
+			wantsStatus: StatusPublished,
+			setStatus:   1,
+		},
+		{
+			name:        "Can Archive",
+			status:      StatusArchived,
+			storeMock:   storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusPublished}},
+			wantsStatus: StatusArchived,
+			setStatus:   1,
+		},
+		{
+			name:      "Cannot Publish While Processing",
+			status:    StatusPublished,
+			storeMock: storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusProcessing}},
+			wantsErr:  ErrInvalidTransition,
+		},
+		{
+			name:      "Ready Is Set By The Pipeline",
+			status:    StatusReady,
+			storeMock: storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusPublished}},
+			wantsErr:  VideoValidationError,
+		},
+		{
+			name:      "Pipeline Status Is Not Permitted",
+			status:    StatusFailed,
+			storeMock: storeMock{fnCalls: make(map[string]int), video: &Video{ID: 1, Status: StatusProcessing}},
+			wantsErr:  VideoValidationError,
+		},
+		{
+			name:   "Status Changed Concurrently",
+			status: StatusPublished,
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Status: StatusReady},
+				err:     map[string]error{"SetStatus": datastore.ErrEditConflict},
+			},
+			wantsErr:  datastore.ErrEditConflict,
+			setStatus: 1,
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{store: tt.storeMock}
+
+			video, err, _ := service.UpdateVideoStatus(context.Background(), moderator, 1, tt.status)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, video.Status, tt.wantsStatus)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+
+			assert.Equal(t, tt.storeMock.GetFnCalls("SetStatus"), tt.setStatus)
+		})
+	}
+}
+
+func TestService_Ownership(t *testing.T) {
+	title := "New Title"
+	input := &VideoInput{Title: &title}
+
+	testMaps := []struct {
+		name     string
+		actor    Actor
+		wantsErr error
+		calls    int
+	}{
+		{name: "Owner", actor: Actor{UserID: 1}, calls: 1},
+		{name: "Moderator", actor: Actor{UserID: 2, Moderator: true}, calls: 1},
+		{name: "Other User", actor: Actor{UserID: 2}, wantsErr: ErrNotOwner},
+		{name: "Unknown User", actor: Actor{}, wantsErr: ErrNotOwner},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, OwnerID: 1, Title: "Title", Description: "Description", Status: StatusReady},
+			}
+			service := Service{store: sm}
+
+			_, err, _ := service.UpdateVideo(context.Background(), tt.actor, 1, input)
+			assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+
+			_, err, _ = service.UpdateVideoStatus(context.Background(), tt.actor, 1, StatusPublished)
+			assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+
+			err, _ = service.DeleteVideo(context.Background(), tt.actor, 1)
+			assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+
+			assert.Equal(t, sm.GetFnCalls("Update"), tt.calls)
+			assert.Equal(t, sm.GetFnCalls("SetStatus"), tt.calls)
+			assert.Equal(t, sm.GetFnCalls("SoftDelete"), tt.calls)
+		})
+	}
+}
+
+func TestService_RestoreVideo(t *testing.T) {
+	testMaps := []struct {
+		name     string
+		actor    Actor
+		storeErr map[string]error
+		wantsErr error
+	}{
+		{name: "Restores Deleted Video", actor: Actor{UserID: 1}},
+		{name: "Not In Trash", actor: Actor{UserID: 1}, storeErr: map[string]error{"Restore": datastore.ErrRecordNotFound}, wantsErr: ErrInvalidTransition},
+		{name: "Not In Trash Of Other User", actor: Actor{UserID: 2}, storeErr: map[string]error{"Restore": datastore.ErrRecordNotFound}, wantsErr: ErrNotOwner},
+		{
+			name:     "Unknown Video",
+			actor:    Actor{UserID: 1},
+			storeErr: map[string]error{"Restore": datastore.ErrRecordNotFound, "ReadById": datastore.ErrRecordNotFound},
+			wantsErr: datastore.ErrRecordNotFound,
+		},
+		{name: "Edit Conflict", actor: Actor{UserID: 1}, storeErr: map[string]error{"Restore": datastore.ErrEditConflict}, wantsErr: datastore.ErrEditConflict},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, OwnerID: 1, Status: StatusReady},
+				err:     tt.storeErr,
+			}
+			service := Service{store: sm}
+
+			video, err, _ := service.RestoreVideo(context.Background(), tt.actor, 1)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, video.ID, int64(1))
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+			}
+		})
+	}
+}
+
+func TestService_ListVideos(t *testing.T) {
+	testMaps := []struct {
+		name      string
+		filters   VideoFilters
+		wantsErr  error
+		errorKey  string
+		storeMock storeMock
+		metadata  datastore.Metadata
+	}{
+		{
+			name:    "Can List",
+			filters: VideoFilters{Filters: datastore.Filters{Page: 1, PageSize: 1, Sort: "-published_date"}},
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				videos:  []*Video{{ID: 1}, {ID: 2}},
+			},
+			metadata: datastore.Metadata{CurrentPage: 1, PageSize: 1, FirstPage: 1, LastPage: 2, TotalRecords: 2},
+		},
+		{
+			name:      "Invalid Sort",
+			filters:   VideoFilters{Filters: datastore.Filters{Page: 1, PageSize: 20, Sort: "description"}},
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  VideoValidationError,
+			errorKey:  "sort",
+		},
+		{
+			name:      "Invalid Status",
+			filters:   VideoFilters{Statuses: []string{"deleted"}, Filters: datastore.Filters{Page: 1, PageSize: 20, Sort: "id"}},
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  VideoValidationError,
+			errorKey:  "status",
+		},
+		{
+			name: "Inverted Date Range",
+			filters: VideoFilters{
+				PublishedFrom: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+				PublishedTo:   time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				Filters:       datastore.Filters{Page: 1, PageSize: 20, Sort: "id"},
+			},
+			storeMock: storeMock{fnCalls: make(map[string]int)},
+			wantsErr:  VideoValidationError,
+			errorKey:  "published_to",
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{store: tt.storeMock}
+
+			videos, metadata, err, validationErrors := service.ListVideos(context.Background(), tt.filters)
+
+			if tt.wantsErr == nil {
+				assert.NilError(t, err)
+				assert.Equal(t, len(videos), len(tt.storeMock.videos))
+				assert.Equal(t, metadata, tt.metadata)
+				assert.Equal(t, tt.storeMock.GetFnCalls("List"), 1)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				_, exists := validationErrors[tt.errorKey]
+				assert.Equal(t, exists, true)
+				assert.Equal(t, tt.storeMock.GetFnCalls("List"), 0)
+			}
+		})
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	testsMap := []struct {
+		name   string
+		query  string
+		web    string
+		prefix string
+	}{
+		{name: "Plain Words", query: "cat videos", web: "cat videos"},
+		{name: "Phrase", query: `"funny cat" -dog`, web: `"funny cat" -dog`},
+		{name: "Prefix", query: "cat vid*", web: "cat", prefix: "vid:*"},
+		{name: "Negated Prefix", query: "cat -dog*", web: "cat", prefix: "!dog:*"},
+		{name: "Prefix Is Sanitized", query: "a'b:c* & x*", web: "&", prefix: "a:* & b:* & c:* & x:*"},
+		{name: "Star Inside Phrase", query: `"cat vid*"`, web: `"cat vid*"`},
+	}
+
+	for _, tt := range testsMap {
+		t.Run(tt.name, func(t *testing.T) {
+			web, prefix := parseSearchQuery(tt.query)
+
+			assert.Equal(t, web, tt.web)
+			assert.Equal(t, prefix, tt.prefix)
+		})
+	}
+}
+
+func TestService_PurgeDeletedJob(t *testing.T) {
+	testMaps := []struct {
+		name        string
+		storeMock   storeMock
+		packaged    []*filestore.ObjectInfo
+		shouldError bool
+		fnCalls     map[string]int
+	}{
+		{
+			name: "Purges Expired Videos",
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				expired: []int64{1, 2},
+				purged:  []string{"videos/01/00/1/abc.mp4"},
+			},
+			fnCalls: map[string]int{
+				"vsPurge":  2,
+				"fsList":   4,
+				"fsDelete": 2,
+			},
+		},
+		{
+			// The mock lists the same files below the HLS and the DASH prefix
+			name: "Purges Packaged Files",
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				expired: []int64{1},
+				purged:  []string{"videos/01/00/1/abc.mp4"},
+			},
+			packaged: []*filestore.ObjectInfo{
+				{Key: "videos/01/00/1/hls/720p/index.m3u8"},
+				{Key: "videos/01/00/1/hls/720p/init.mp4"},
+				{Key: "videos/01/00/1/hls/720p/segment_00000.m4s"},
+			},
+			fnCalls: map[string]int{
+				"vsPurge":  1,
+				"fsList":   2,
+				"fsDelete": 7,
+			},
+		},
+		{
+			name: "Skips Restored Videos",
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				expired: []int64{1},
+				err:     map[string]error{"Purge": datastore.ErrRecordNotFound},
+			},
+			fnCalls: map[string]int{
+				"vsPurge":  1,
+				"fsDelete": 0,
+			},
+		},
+		{
+			name: "Store Error",
+			storeMock: storeMock{
+				fnCalls: make(map[string]int),
+				err:     map[string]error{"ListExpired": errors.New("connection refused")},
+			},
+			shouldError: true,
+			fnCalls: map[string]int{
+				"vsPurge":  0,
+				"fsDelete": 0,
+			},
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := filestore.Mock{FnCalls: make(map[string]int), Objects: tt.packaged}
+
+			service := Service{
+				store:      tt.storeMock,
+				filestore:  fs,
+				background: &background.RoutineMock{},
+				cfg:        Config{TrashRetention: time.Hour},
+			}
+
+			err := service.purgeDeletedJob(context.Background(), &background.Job{Kind: JobPurgeDeleted})
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			assert.Equal(t, tt.storeMock.GetFnCalls("Purge"), tt.fnCalls["vsPurge"])
+			assert.Equal(t, fs.GetFnCalls("List"), tt.fnCalls["fsList"])
+			assert.Equal(t, fs.GetFnCalls("Delete"), tt.fnCalls["fsDelete"])
+		})
+	}
+}
+
+func TestService_ProbeVideoJob(t *testing.T) {
+	testMaps := []struct {
+		name          string
+		status        Status
+		body          []byte
+		fsErr         error
+		attempts      int
+		shouldError   bool
+		wantsStatus   Status
+		wantsReason   string
+		wantsSetMedia int
+	}{
+		{name: "Probes Video", status: StatusProcessing, body: sampleMP4(t), attempts: 1, wantsStatus: StatusReady, wantsSetMedia: 1},
+		{name: "Already Probed", status: StatusReady, body: sampleMP4(t), attempts: 1, wantsStatus: StatusReady},
+		{name: "Unparseable File", status: StatusProcessing, body: []byte("not a video at all"), attempts: 1, shouldError: true, wantsStatus: StatusFailed, wantsReason: "unsupported media container"},
+		{name: "Missing Object", status: StatusProcessing, fsErr: filestore.ErrObjectNotFound, attempts: 1, shouldError: true, wantsStatus: StatusFailed, wantsReason: "object not found"},
+		{name: "Filestore Down Retries", status: StatusProcessing, fsErr: errors.New("connection refused"), attempts: 1, shouldError: true, wantsStatus: StatusProcessing},
+		{name: "Filestore Down Last Attempt", status: StatusProcessing, fsErr: errors.New("connection refused"), attempts: 3, shouldError: true, wantsStatus: StatusFailed, wantsReason: "connection refused"},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := storeMock{
+				fnCalls: make(map[string]int),
+				video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: tt.status},
+			}
+
+			service := Service{
+				store:      vs,
+				filestore:  filestore.Mock{FnCalls: make(map[string]int), Body: tt.body, Err: tt.fsErr},
+				background: &background.RoutineMock{},
+			}
+
+			job := &background.Job{Kind: JobProbeVideo, Payload: []byte(`{"video_id":1}`), Attempts: tt.attempts, MaxAttempts: 3}
+
+			err := service.probeVideoJob(context.Background(), job)
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			assert.Equal(t, vs.video.Status, tt.wantsStatus)
+			assert.Equal(t, vs.video.FailureReason, tt.wantsReason)
+			assert.Equal(t, vs.GetFnCalls("SetMediaInfo"), tt.wantsSetMedia)
+
+			if tt.wantsSetMedia > 0 {
+				assert.Equal(t, vs.video.DurationMs, int64(10000))
+				assert.Equal(t, vs.video.Height, 720)
+				assert.Equal(t, vs.video.VideoCodec, "h264")
+				assert.Equal(t, vs.video.AudioCodec, "aac")
+				assert.Equal(t, vs.video.Container, "mp4")
+			}
+		})
+	}
+}
+
+func TestService_TranscodeVideoJob(t *testing.T) {
+	testMaps := []struct {
+		name            string
+		rendition       string
+		existing        []*Rendition
+		segmentDuration time.Duration
+		fsErr           error
+		transcodeErr    error
+		shouldError     bool
+		wantsRenditions []string
+		wantsGet        int
+		wantsPut        int
+	}{
+		{name: "Transcodes Rendition", rendition: "720p", wantsRenditions: []string{"720p"}, wantsGet: 1, wantsPut: 1},
+		{name: "Skips Existing Rendition", rendition: "720p", existing: []*Rendition{{Name: "720p"}}},
+		{name: "Skips Upscaling Rendition", rendition: "1080p"},
+		{name: "Skips Rendition Left The Ladder", rendition: "4k"},
+		{
+			// The rendition is stored with an init section, three segments and a playlist for HLS, and an init
+			// section and three segments for each of its DASH tracks
+			name:            "Packages For HLS And DASH",
+			rendition:       "720p",
+			segmentDuration: 4 * time.Second,
+			wantsRenditions: []string{"720p"},
+			wantsGet:        1,
+			wantsPut:        14,
+		},
+		{
+			name:            "Skips Packaged Rendition",
+			rendition:       "720p",
+			existing:        []*Rendition{{Name: "720p", PlaylistKey: "videos/01/00/1/hls/720p/index.m3u8", DashPrefix: "videos/01/00/1/dash/720p/"}},
+			segmentDuration: 4 * time.Second,
+		},
+		{
+			name:            "Packages Rendition Without Manifest",
+			rendition:       "720p",
+			existing:        []*Rendition{{Name: "720p", PlaylistKey: "videos/01/00/1/hls/720p/index.m3u8"}},
+			segmentDuration: 4 * time.Second,
+			wantsRenditions: []string{"720p"},
+			wantsGet:        1,
+			wantsPut:        14,
+		},
+		{name: "Transcoder Fails", rendition: "720p", transcodeErr: errors.New("encoder crashed"), shouldError: true, wantsRenditions: []string{"720p"}, wantsGet: 1},
+		{name: "Missing Source", rendition: "720p", fsErr: filestore.ErrObjectNotFound, shouldError: true, wantsGet: 1},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := storeMock{
+				fnCalls:    make(map[string]int),
+				video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady, Width: 1280, Height: 720, DurationMs: 10000, AudioCodec: "aac"},
+				renditions: tt.existing,
+			}
+			fs := filestore.Mock{FnCalls: make(map[string]int), Body: sampleMP4(t), Err: tt.fsErr}
+
+			tc := transcoder.NewFake()
+			tc.Fail(tt.transcodeErr)
+
+			service := Service{
+				store:      vs,
+				filestore:  fs,
+				background: &background.RoutineMock{},
+				transcoder: tc,
+				cfg:        Config{SpoolDir: t.TempDir(), Renditions: transcoder.DefaultLadder, SegmentDuration: tt.segmentDuration},
+			}
+
+			payload := fmt.Sprintf(`{"video_id":1,"rendition":%q}`, tt.rendition)
+			job := &background.Job{Kind: JobTranscodeVideo, Payload: []byte(payload), Attempts: 1, MaxAttempts: 3}
+
+			err := service.transcodeVideoJob(context.Background(), job)
+
+			if !tt.shouldError {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			if errors.Is(tt.fsErr, filestore.ErrObjectNotFound) {
+				assert.Equal(t, background.IsPermanent(err), true)
+			}
+
+			requests := tc.Requests()
+			assert.Equal(t, len(requests), len(tt.wantsRenditions))
+			for i, req := range requests {
+				assert.Equal(t, req.Rendition.Name, tt.wantsRenditions[i])
+				assert.Equal(t, req.Duration, 10*time.Second)
+				assert.Equal(t, req.KeyframeInterval, tt.segmentDuration)
+			}
+
+			inserted := len(tt.wantsRenditions)
+			if tt.transcodeErr != nil {
+				inserted = 0
+			}
+
+			assert.Equal(t, fs.GetFnCalls("Get"), tt.wantsGet)
+			assert.Equal(t, fs.GetFnCalls("Put"), tt.wantsPut)
+			assert.Equal(t, vs.GetFnCalls("InsertRendition"), inserted)
+			assert.Equal(t, vs.video.Status, StatusReady)
+		})
+	}
+}
+
+func TestService_TranscodeVideoJob_EnqueuesRenditions(t *testing.T) {
+	testMaps := []struct {
+		name            string
+		existing        []*Rendition
+		wantsRenditions []string
+	}{
+		{name: "Enqueues Ladder Without Upscaling", wantsRenditions: []string{"720p", "480p"}},
+		{name: "Skips Existing Renditions", existing: []*Rendition{{Name: "720p"}}, wantsRenditions: []string{"480p"}},
+		{name: "Nothing Left To Do", existing: []*Rendition{{Name: "720p"}, {Name: "480p"}}},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := storeMock{
+				fnCalls:    make(map[string]int),
+				video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady, Width: 1280, Height: 720},
+				renditions: tt.existing,
+			}
+
+			var mu sync.Mutex
+			var enqueued []string
+
+			bg := &background.RoutineMock{}
+			bg.Register(JobTranscodeVideo, func(ctx context.Context, job *background.Job) error {
+				var payload transcodeVideoPayload
+				err := job.Decode(&payload)
+
+				mu.Lock()
+				enqueued = append(enqueued, payload.Rendition)
+				mu.Unlock()
+
+				return err
+			})
+
+			fs := filestore.Mock{FnCalls: make(map[string]int)}
+
+			service := Service{
+				store:      vs,
+				filestore:  fs,
+				background: bg,
+				transcoder: transcoder.NewFake(),
+				cfg:        Config{Renditions: transcoder.DefaultLadder},
+			}
+
+			job := &background.Job{Kind: JobTranscodeVideo, Payload: []byte(`{"video_id":1}`), Attempts: 1, MaxAttempts: 3}
+
+			err := service.transcodeVideoJob(context.Background(), job)
+			bg.Wait()
+
+			assert.NilError(t, err)
+
+			sort.Strings(enqueued)
+			wants := append([]string{}, tt.wantsRenditions...)
+			sort.Strings(wants)
+
+			assert.Equal(t, strings.Join(enqueued, ","), strings.Join(wants, ","))
+
+			// The source is only downloaded by the rendition jobs
+			assert.Equal(t, fs.GetFnCalls("Get"), 0)
+		})
+	}
+}
+
+func TestService_HLSMasterPlaylist(t *testing.T) {
+	packaged := []*Rendition{
+		{Name: "720p", Width: 1280, Height: 720, Codecs: "avc1.64001f,mp4a.40.2", Bandwidth: 3_104_000, AverageBandwidth: 2_911_000,
+			PlaylistKey: "videos/01/00/1/hls/720p/index.m3u8"},
+		{Name: "480p", Width: 854, Height: 480},
+	}
+
+	testMaps := []struct {
+		name          string
+		video         *Video
+		renditions    []*Rendition
+		wantsErr      error
+		wantsPlaylist string
+	}{
+		{
+			name:       "Lists Packaged Renditions",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+			renditions: packaged,
+			wantsPlaylist: "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=3104000,AVERAGE-BANDWIDTH=2911000,CODECS=\"avc1.64001f,mp4a.40.2\",RESOLUTION=1280x720\n" +
+				"720p/index.m3u8\n",
+		},
+		{
+			name:       "Nothing Packaged",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+			renditions: packaged[1:],
+			wantsErr:   ErrNotPackaged,
+		},
+		{
+			name:       "Not Streamable",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusProcessing},
+			renditions: packaged,
+			wantsErr:   ErrVideoNotStreamable,
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{
+				store:     storeMock{fnCalls: make(map[string]int), video: tt.video, renditions: tt.renditions},
+				filestore: filestore.Mock{FnCalls: make(map[string]int)},
+			}
+
+			_, playlist, err, _ := service.HLSMasterPlaylist(context.Background(), 1)
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, string(playlist), tt.wantsPlaylist)
+		})
+	}
+}
+
+func TestService_StatHLSFile(t *testing.T) {
+	renditions := []*Rendition{
+		{Name: "720p", PlaylistKey: "videos/01/00/1/hls/720p/index.m3u8"},
+		{Name: "480p"},
+	}
+
+	testMaps := []struct {
+		name             string
+		file             string
+		wantsErr         error
+		wantsContentType string
+		wantsStat        int
+	}{
+		{name: "Playlist", file: "720p/index.m3u8", wantsContentType: "application/vnd.apple.mpegurl", wantsStat: 1},
+		{name: "Init Section", file: "720p/init.mp4", wantsContentType: "video/mp4", wantsStat: 1},
+		{name: "Segment", file: "720p/segment_00012.m4s", wantsContentType: "video/iso.segment", wantsStat: 1},
+		{name: "Rendition Not Packaged", file: "480p/index.m3u8", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Unknown Rendition", file: "1080p/index.m3u8", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Unknown File", file: "720p/source.mp4", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Path Traversal", file: "720p/../../video.mp4", wantsErr: datastore.ErrRecordNotFound},
+		{name: "No Rendition", file: "index.m3u8", wantsErr: datastore.ErrRecordNotFound},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := filestore.Mock{FnCalls: make(map[string]int), Body: []byte("#EXTM3U\n"), Info: filestore.ObjectInfo{ContentType: "application/octet-stream"}}
+
+			service := Service{
+				store: storeMock{
+					fnCalls:    make(map[string]int),
+					video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+					renditions: renditions,
+				},
+				filestore: fs,
+			}
+
+			_, info, err, _ := service.StatHLSFile(context.Background(), 1, tt.file)
+
+			assert.Equal(t, fs.GetFnCalls("Stat"), tt.wantsStat)
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, info.ContentType, tt.wantsContentType)
+		})
+	}
+}
+
+func TestService_DASHManifest(t *testing.T) {
+	packaged := []*Rendition{
+		{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2_800_000, AudioBitrate: 128_000, Codecs: "avc1.64001f,mp4a.40.2",
+			DashPrefix: "videos/01/00/1/dash/720p/", DashAudio: true, SegmentDurationMs: 6000},
+		{Name: "480p", Width: 854, Height: 480, VideoBitrate: 1_400_000, AudioBitrate: 128_000, Codecs: "avc1.64001e,mp4a.40.2",
+			DashPrefix: "videos/01/00/1/dash/480p/", DashAudio: true, SegmentDurationMs: 6000},
+		{Name: "360p", Width: 640, Height: 360},
+	}
+
+	testMaps := []struct {
+		name        string
+		video       *Video
+		renditions  []*Rendition
+		wantsErr    error
+		wantsVideo  []string
+		wantsAudio  []string
+		wantsString []string
+	}{
+		{
+			name:       "Lists Packaged Renditions",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady, DurationMs: 10500},
+			renditions: packaged,
+			wantsVideo: []string{"720p", "480p"},
+			// Both renditions carry the same audio
+			wantsAudio: []string{"720p-audio"},
+			wantsString: []string{
+				`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="static" mediaPresentationDuration="PT10.5S" minBufferTime="PT2S">`,
+				`<SegmentTemplate timescale="1000" duration="6000" startNumber="0" initialization="720p/video/init.mp4" media="720p/video/segment_$Number%05d$.m4s">`,
+				`<SegmentTemplate timescale="1000" duration="6000" startNumber="0" initialization="720p/audio/init.mp4" media="720p/audio/segment_$Number%05d$.m4s">`,
+			},
+		},
+		{
+			name:       "Without Audio",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady, DurationMs: 10500},
+			renditions: []*Rendition{{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2_800_000, Codecs: "avc1.64001f", DashPrefix: "videos/01/00/1/dash/720p/", SegmentDurationMs: 6000}},
+			wantsVideo: []string{"720p"},
+		},
+		{
+			name:       "Nothing Packaged",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+			renditions: packaged[2:],
+			wantsErr:   ErrNotPackaged,
+		},
+		{
+			name:       "Not Streamable",
+			video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusProcessing},
+			renditions: packaged,
+			wantsErr:   ErrVideoNotStreamable,
+		},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			service := Service{
+				store:     storeMock{fnCalls: make(map[string]int), video: tt.video, renditions: tt.renditions},
+				filestore: filestore.Mock{FnCalls: make(map[string]int)},
+			}
+
+			_, manifest, err, _ := service.DASHManifest(context.Background(), 1)
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			for _, want := range tt.wantsString {
+				assert.StringContains(t, string(manifest), want)
+			}
+
+			var mpd dash.MPD
+			err = xml.Unmarshal(manifest, &mpd)
+			assert.NilError(t, err)
+
+			var sets [][]string
+			for _, set := range mpd.Periods[0].AdaptationSets {
+				var ids []string
+				for _, r := range set.Representations {
+					ids = append(ids, r.ID)
+				}
+				sets = append(sets, ids)
+			}
+
+			wantsSets := 1
+			if tt.wantsAudio != nil {
+				wantsSets = 2
+			}
+
+			assert.Equal(t, len(sets), wantsSets)
+			assert.Equal(t, strings.Join(sets[0], ","), strings.Join(tt.wantsVideo, ","))
+			if tt.wantsAudio != nil {
+				assert.Equal(t, strings.Join(sets[1], ","), strings.Join(tt.wantsAudio, ","))
+				assert.Equal(t, mpd.Periods[0].AdaptationSets[1].Representations[0].Codecs, "mp4a.40.2")
+			}
+
+			videoSet := mpd.Periods[0].AdaptationSets[0]
+			assert.Equal(t, videoSet.Representations[0].Codecs, "avc1.64001f")
+			assert.Equal(t, videoSet.MaxWidth, 1280)
+			assert.Equal(t, videoSet.MaxHeight, 720)
+		})
+	}
+}
+
+func TestService_StatDASHFile(t *testing.T) {
+	renditions := []*Rendition{
+		{Name: "720p", DashPrefix: "videos/01/00/1/dash/720p/", DashAudio: true},
+		{Name: "480p", DashPrefix: "videos/01/00/1/dash/480p/"},
+		{Name: "360p"},
+	}
+
+	testMaps := []struct {
+		name             string
+		file             string
+		wantsErr         error
+		wantsContentType string
+		wantsStat        int
+	}{
+		{name: "Video Init Section", file: "720p/video/init.mp4", wantsContentType: "video/mp4", wantsStat: 1},
+		{name: "Video Segment", file: "720p/video/segment_00012.m4s", wantsContentType: "video/iso.segment", wantsStat: 1},
+		{name: "Audio Segment", file: "720p/audio/segment_00012.m4s", wantsContentType: "audio/mp4", wantsStat: 1},
+		{name: "Rendition Without Audio", file: "480p/audio/init.mp4", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Rendition Not Packaged", file: "360p/video/init.mp4", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Unknown Track", file: "720p/text/init.mp4", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Unknown File", file: "720p/video/index.m3u8", wantsErr: datastore.ErrRecordNotFound},
+		{name: "Path Traversal", file: "720p/../../video.mp4", wantsErr: datastore.ErrRecordNotFound},
+		{name: "No Track", file: "720p/init.mp4", wantsErr: datastore.ErrRecordNotFound},
+	}
+
+	for _, tt := range testMaps {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := filestore.Mock{FnCalls: make(map[string]int), Body: []byte("segment"), Info: filestore.ObjectInfo{ContentType: "application/octet-stream"}}
+
+			service := Service{
+				store: storeMock{
+					fnCalls:    make(map[string]int),
+					video:      &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady},
+					renditions: renditions,
+				},
+				filestore: fs,
+			}
+
+			_, info, err, _ := service.StatDASHFile(context.Background(), 1, tt.file)
+
+			assert.Equal(t, fs.GetFnCalls("Stat"), tt.wantsStat)
+
+			if tt.wantsErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantsErr), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, info.ContentType, tt.wantsContentType)
+		})
+	}
+}
+
+func TestService_ReadPackagedFile(t *testing.T) {
+	service := Service{filestore: filestore.Mock{FnCalls: make(map[string]int), Body: []byte("segment")}}
+	video := &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusReady}
+
+	obj, err, _ := service.ReadPackagedFile(context.Background(), video, "videos/01/00/1/hls/720p/segment_00000.m4s", 0, -1)
+	assert.NilError(t, err)
+	obj.Close()
+
+	obj, err, _ = service.ReadPackagedFile(context.Background(), video, "videos/01/00/1/dash/720p/audio/segment_00000.m4s", 0, -1)
+	assert.NilError(t, err)
+	obj.Close()
+
+	_, err, _ = service.ReadPackagedFile(context.Background(), video, "videos/02/00/2/hls/720p/segment_00000.m4s", 0, -1)
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+
+	_, err, _ = service.ReadPackagedFile(context.Background(), video, "videos/01/00/1/video.mp4", 0, -1)
+	assert.Equal(t, errors.Is(err, datastore.ErrRecordNotFound), true)
+}
+
+func TestService_ProbeVideoJob_EnqueuesTranscode(t *testing.T) {
+	vs := storeMock{
+		fnCalls: make(map[string]int),
+		video:   &Video{ID: 1, Path: "videos/1/video.mp4", Status: StatusProcessing},
+	}
+
+	bg := &background.RoutineMock{}
+
+	enqueued := make(chan int64, 1)
+	bg.Register(JobTranscodeVideo, func(ctx context.Context, job *background.Job) error {
+		var payload transcodeVideoPayload
+		err := job.Decode(&payload)
+		enqueued <- payload.VideoID
+		return err
+	})
+
+	service := Service{
+		store:      vs,
+		filestore:  filestore.Mock{FnCalls: make(map[string]int), Body: sampleMP4(t)},
+		background: bg,
+		transcoder: transcoder.NewFake(),
+		cfg:        Config{Renditions: transcoder.DefaultLadder},
+	}
+
+	job := &background.Job{Kind: JobProbeVideo, Payload: []byte(`{"video_id":1}`), Attempts: 1, MaxAttempts: 3}
+
+	err := service.probeVideoJob(context.Background(), job)
+	bg.Wait()
+
+	assert.NilError(t, err)
+	assert.Equal(t, vs.video.Status, StatusReady)
+	assert.Equal(t, <-enqueued, int64(1))
+}
@@ -8,11 +8,19 @@ import (
 	"luismatosgarcia.dev/video-sharing-go/internal/background"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/datastore"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/filestore"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/health"
 	"luismatosgarcia.dev/video-sharing-go/internal/pkg/jsonlog"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/mailer"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/metrics"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/ratelimit"
+	"luismatosgarcia.dev/video-sharing-go/internal/pkg/transcoder"
 	"luismatosgarcia.dev/video-sharing-go/internal/server/http"
+	"luismatosgarcia.dev/video-sharing-go/internal/uploads"
+	"luismatosgarcia.dev/video-sharing-go/internal/users"
 	"luismatosgarcia.dev/video-sharing-go/internal/videos"
 	"os"
 	"strings"
+	"time"
 )
 
 var (
@@ -21,12 +29,24 @@ var (
 
 func main() {
 	var httpConfig http.Config
+	var filestoreType string
 	var filestoreConfig filestore.Config
 	var dbConfig datastore.Config
+	var bgConfig background.Config
+	var videosConfig videos.Config
+	var uploadsConfig uploads.Config
+	var mailerType string
+	var mailerConfig mailer.Config
+	var usersConfig users.Config
+	var limiterType string
+	var transcoderType string
+	var transcoderConfig transcoder.Config
+	var healthTimeout time.Duration
 	// Environment flags ---------------------------------------------------------------------------
 
 	flag.IntVar(&httpConfig.Port, "port", 4000, "API server port")
 	flag.StringVar(&httpConfig.Env, "env", "development", "Environment (development|staging|production)")
+	flag.DurationVar(&healthTimeout, "healthcheck-timeout", health.DefaultTimeout, "Timeout of each dependency check of the readiness endpoint")
 
 	flag.StringVar(&dbConfig.Dsn, "db-dsn", "", "PostgreSQL DSN")
 	flag.IntVar(&dbConfig.MaxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
@@ -36,18 +56,79 @@ func main() {
 	flag.Float64Var(&httpConfig.Limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&httpConfig.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&httpConfig.Limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&limiterType, "limiter-store", "memory", fmt.Sprintf("Rate limiter store %v", ratelimit.Backends()))
+	flag.DurationVar(&httpConfig.Limiter.IdleTimeout, "limiter-idle-timeout", 3*time.Minute, "Time before the rate limit of an idle client is forgotten")
 
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+	flag.Func("trusted-proxies", "Proxy addresses and CIDR ranges allowed to set X-Forwarded-For (space separated)", func(val string) error {
+		httpConfig.TrustedProxies = strings.Fields(val)
+		return nil
+	})
+
+	flag.Func("cors-trusted-origins", "Trusted CORS origins, https://*.example.com trusts every subdomain (space separated)", func(val string) error {
 		httpConfig.Cors.TrustedOrigins = strings.Fields(val)
 		return nil
 	})
 
+	flag.StringVar(&filestoreType, "filestore-type", "s3", fmt.Sprintf("Filestore backend %v", filestore.Backends()))
+	flag.StringVar(&filestoreConfig.LocalRoot, "filestore-local-root", "./data/filestore", "Root directory for the local filestore backend")
+	flag.StringVar(&filestoreConfig.SigningSecret, "filestore-signing-secret", "", "Secret used to sign presigned URLs of the local and memory filestore backends")
+	flag.StringVar(&filestoreConfig.PublicURL, "filestore-public-url", "http://localhost:4000/v1/files", "Base URL presigned URLs of the local and memory filestore backends point to")
 	flag.StringVar(&filestoreConfig.AwsAccessKeyId, "filestore-access-key-id", "123", "S3 Bucket Key ID")
 	flag.StringVar(&filestoreConfig.AwsSecretKey, "filestore-secret-key", "xyz", "S3 Bucket Secret Key")
 	flag.StringVar(&filestoreConfig.AwsBucketName, "filestore-bucket-name", "video-sharing-app-bucket", "S3 Bucket Name")
 	flag.StringVar(&filestoreConfig.AwsRegion, "filestore-region", "us-east-1", "S3 Region")
 	flag.StringVar(&filestoreConfig.AwsEndpoint, "filestore-endpoint", "http://localhost:4566", "S3 Endpoint")
 
+	flag.Int64Var(&filestoreConfig.AwsMultipartThreshold, "filestore-multipart-threshold", 64<<20, "Object size in bytes from which S3 uploads use multipart uploads")
+	flag.Int64Var(&filestoreConfig.AwsPartSize, "filestore-part-size", 16<<20, "S3 multipart upload part size in bytes (min 5MiB)")
+	flag.IntVar(&filestoreConfig.AwsPartConcurrency, "filestore-part-concurrency", 4, "S3 multipart upload parts uploaded in parallel")
+	flag.IntVar(&filestoreConfig.AwsPartRetries, "filestore-part-retries", 3, "S3 multipart upload retries per part")
+
+	flag.IntVar(&bgConfig.Workers, "jobs-workers", 4, "Background job workers")
+	flag.IntVar(&bgConfig.MaxAttempts, "jobs-max-attempts", 5, "Background job max attempts before dead-lettering")
+	flag.DurationVar(&bgConfig.PollInterval, "jobs-poll-interval", time.Second, "Background job queue poll interval")
+	flag.DurationVar(&bgConfig.BaseBackoff, "jobs-base-backoff", 5*time.Second, "Background job retry base backoff")
+	flag.DurationVar(&bgConfig.MaxBackoff, "jobs-max-backoff", 30*time.Minute, "Background job retry max backoff")
+	flag.DurationVar(&bgConfig.LockTimeout, "jobs-lock-timeout", 15*time.Minute, "Time before a running job is considered abandoned")
+	flag.DurationVar(&bgConfig.JobTimeout, "jobs-timeout", 10*time.Minute, "Background job execution timeout")
+
+	flag.StringVar(&videosConfig.SpoolDir, "upload-spool-dir", os.TempDir(), "Directory for the temporary files of resumable upload chunks and transcodes")
+
+	flag.DurationVar(&videosConfig.TrashRetention, "trash-retention", 30*24*time.Hour, "Time deleted videos stay in the trash before they are purged")
+	flag.DurationVar(&videosConfig.PurgeInterval, "trash-purge-interval", time.Hour, "Interval between trash purges")
+	flag.DurationVar(&videosConfig.PresignExpiry, "presign-expiry", 15*time.Minute, "Time before presigned upload and download URLs expire")
+
+	flag.StringVar(&transcoderType, "transcoder-type", "ffmpeg", fmt.Sprintf("Transcoder backend %v, none turns transcoding off", transcoder.Backends()))
+	flag.StringVar(&transcoderConfig.FFmpegPath, "ffmpeg-path", "ffmpeg", "Path of the ffmpeg executable used by the ffmpeg transcoder")
+	flag.StringVar(&transcoderConfig.Preset, "ffmpeg-preset", "veryfast", "x264 preset used by the ffmpeg transcoder")
+
+	videosConfig.Renditions = transcoder.DefaultLadder
+	flag.Func("transcode-renditions", fmt.Sprintf("Rendition ladder as name=WIDTHxHEIGHT@VIDEO[/AUDIO] (space separated, default %q)", transcoder.FormatLadder(transcoder.DefaultLadder)), func(val string) error {
+		ladder, err := transcoder.ParseLadder(val)
+		if err != nil {
+			return err
+		}
+		videosConfig.Renditions = ladder
+		return nil
+	})
+	flag.DurationVar(&videosConfig.SegmentDuration, "hls-segment-duration", 6*time.Second, "Target duration of HLS and DASH segments, 0 turns packaging off")
+
+	flag.Int64Var(&uploadsConfig.MaxSize, "upload-max-size", 20<<30, "Maximum size of an uploaded video in bytes")
+	flag.DurationVar(&uploadsConfig.Expiration, "upload-expiration", 24*time.Hour, "Time before an unfinished resumable upload expires")
+	flag.DurationVar(&uploadsConfig.ExpireInterval, "upload-expire-interval", time.Hour, "Interval between discards of expired resumable uploads")
+
+	flag.StringVar(&mailerType, "mailer-type", "smtp", fmt.Sprintf("Mailer backend %v", mailer.Backends()))
+	flag.StringVar(&mailerConfig.Sender, "mailer-sender", "Video Sharing <no-reply@video-sharing.local>", "Sender of the emails")
+	flag.StringVar(&mailerConfig.Host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&mailerConfig.Port, "smtp-port", 1025, "SMTP port")
+	flag.StringVar(&mailerConfig.Username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&mailerConfig.Password, "smtp-password", "", "SMTP password")
+	flag.DurationVar(&mailerConfig.Timeout, "smtp-timeout", 10*time.Second, "SMTP delivery timeout")
+	flag.StringVar(&mailerConfig.Dir, "mailer-dir", "./data/mail", "Directory the file mailer backend writes emails to")
+
+	flag.DurationVar(&usersConfig.ActivationTTL, "activation-token-ttl", 3*24*time.Hour, "Time before account activation tokens expire")
+	flag.DurationVar(&usersConfig.AuthenticationTTL, "authentication-token-ttl", 24*time.Hour, "Time before authentication tokens expire")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -56,10 +137,14 @@ func main() {
 		fmt.Printf("Version\t%s\n", version)
 	}
 
+	httpConfig.Version = version
+
 	// Dependencies -------------------------------------------------------------------------------
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	reg := metrics.NewRegistry()
+
 	db, err := datastore.NewService(&dbConfig)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -69,31 +154,80 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
-	fs, err := filestore.NewFileStore("s3", filestoreConfig)
+	datastore.RegisterMetrics(reg, db)
+
+	fs, err := filestore.NewFileStore(filestoreType, filestoreConfig)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	fs = filestore.Instrument(fs, reg, filestoreType)
+
+	bg, err := background.NewService(logger, db, bgConfig)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	bg.RegisterMetrics(reg)
+
+	mail, err := mailer.New(mailerType, mailerConfig)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 
-	bg, err := background.NewService(logger)
+	limiter, err := ratelimit.New(limiterType, db)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 
+	var tc transcoder.Transcoder
+
+	if transcoderType != "none" {
+		tc, err = transcoder.New(transcoderType, transcoderConfig)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
 	// Services ------------------------------------------------------------------------------------
-	videoService, err := videos.NewService(db, fs, bg)
+	// Multipart and resumable uploads share the limit
+	videosConfig.MaxSize = uploadsConfig.MaxSize
+
+	videoService, err := videos.NewService(db, fs, bg, tc, videosConfig)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+		return
+	}
+
+	userService, err := users.NewService(db, mail, bg, usersConfig)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+		return
+	}
+
+	uploadsConfig.SpoolDir = videosConfig.SpoolDir
+
+	uploadService, err := uploads.NewService(db, fs, bg, videoService, uploadsConfig)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 		return
 	}
 
+	bg.Start()
+
 	// API -----------------------------------------------------------------------------------------
-	api, err := api2.NewService(logger, bg, videoService)
+	api, err := api2.NewService(logger, bg, fs, videoService, uploadService, userService)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 
 	// Server
-	h, err := http.NewService(&httpConfig, api)
+	checks := []health.Check{
+		{Name: "database", Checker: datastore.NewChecker(db), Timeout: healthTimeout, Critical: true},
+		{Name: "filestore", Checker: fs, Timeout: healthTimeout, Critical: true},
+	}
+
+	h, err := http.NewService(&httpConfig, api, limiter, reg, checks)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
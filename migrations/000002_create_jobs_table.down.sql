@@ -0,0 +1 @@
+drop table if exists jobs;
\ No newline at end of file
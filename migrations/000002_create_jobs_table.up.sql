@@ -0,0 +1,16 @@
+create table if not exists jobs (
+    id bigserial primary key,
+    kind text not null,
+    payload jsonb not null default '{}',
+    status text not null default 'pending',
+    attempts integer not null default 0,
+    max_attempts integer not null default 5,
+    run_at timestamp(0) with time zone not null default now(),
+    locked_at timestamp(0) with time zone,
+    last_error text,
+    created_at timestamp(0) with time zone not null default now(),
+    updated_at timestamp(0) with time zone not null default now(),
+    constraint jobs_status_check check (status in ('pending', 'running', 'completed', 'dead'))
+);
+
+create index if not exists jobs_runnable_idx on jobs (kind, run_at) where status in ('pending', 'running');
@@ -0,0 +1,2 @@
+drop table if exists upload_chunks;
+drop table if exists uploads;
\ No newline at end of file
@@ -0,0 +1,20 @@
+create table if not exists uploads (
+    id text primary key,
+    upload_length bigint not null,
+    upload_offset bigint not null default 0,
+    metadata jsonb not null default '{}',
+    video_id bigint references videos (id) on delete set null,
+    expires_at timestamp(0) with time zone not null,
+    completed_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone not null default now(),
+    updated_at timestamp(0) with time zone not null default now(),
+    constraint uploads_offset_check check (upload_offset between 0 and upload_length)
+);
+
+create table if not exists upload_chunks (
+    upload_id text not null references uploads (id) on delete cascade,
+    chunk_offset bigint not null,
+    size bigint not null,
+    storage_key text not null,
+    primary key (upload_id, chunk_offset)
+);
@@ -0,0 +1,3 @@
+drop index if exists videos_content_sha256_idx;
+alter table videos drop column if exists content_sha256;
+drop table if exists blobs;
\ No newline at end of file
@@ -0,0 +1,13 @@
+create table if not exists blobs (
+    sha256 text primary key,
+    storage_key text not null unique,
+    size bigint not null,
+    ref_count integer not null default 0,
+    created_at timestamp(0) with time zone not null default now(),
+    updated_at timestamp(0) with time zone not null default now(),
+    constraint blobs_ref_count_check check (ref_count >= 0)
+);
+
+alter table videos add column if not exists content_sha256 text references blobs (sha256);
+
+create index if not exists videos_content_sha256_idx on videos (content_sha256);
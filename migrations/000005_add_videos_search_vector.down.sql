@@ -0,0 +1,2 @@
+drop index if exists videos_search_vector_idx;
+alter table videos drop column if exists search_vector;
\ No newline at end of file
@@ -0,0 +1,7 @@
+alter table videos add column if not exists search_vector tsvector
+    generated always as (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) stored;
+
+create index if not exists videos_search_vector_idx on videos using gin (search_vector);
@@ -0,0 +1,2 @@
+drop index if exists videos_deleted_at_idx;
+alter table videos drop column if exists deleted_at;
\ No newline at end of file
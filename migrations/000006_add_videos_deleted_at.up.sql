@@ -0,0 +1,3 @@
+alter table videos add column if not exists deleted_at timestamp(0) with time zone;
+
+create index if not exists videos_deleted_at_idx on videos (deleted_at) where deleted_at is not null;
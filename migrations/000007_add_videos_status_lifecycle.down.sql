@@ -0,0 +1,25 @@
+alter table videos drop constraint if exists videos_status_check;
+
+update videos set status = case status
+    when 'uploading' then 'Uploading'
+    when 'processing' then 'Uploading'
+    when 'ready' then 'Uploaded'
+    when 'published' then 'Published'
+    when 'archived' then 'Uploaded'
+    else status
+end;
+
+update videos v set status = case h.from_status
+        when 'uploading' then 'Uploading'
+        when 'published' then 'Published'
+        else 'Uploaded'
+    end
+    from (
+        select distinct on (video_id) video_id, from_status from video_status_history
+        where to_status = 'deleted'
+        order by video_id, id desc
+    ) h
+    where v.id = h.video_id and v.status = 'deleted';
+
+drop table if exists video_status_history;
+alter table videos drop column if exists failure_reason;
@@ -0,0 +1,33 @@
+alter table videos add column if not exists failure_reason text;
+
+create table if not exists video_status_history (
+    id bigserial primary key,
+    video_id bigint not null references videos (id) on delete cascade,
+    from_status text,
+    to_status text not null,
+    actor text not null,
+    reason text,
+    created_at timestamp(0) with time zone not null default now()
+);
+
+create index if not exists video_status_history_video_id_idx on video_status_history (video_id, id);
+
+update videos set status = case status
+    when 'Uploading' then 'uploading'
+    when 'Uploaded' then 'ready'
+    when 'Published' then 'published'
+    else status
+end;
+
+update videos set failure_reason = 'unknown status ' || status, status = 'failed'
+    where status not in ('uploading', 'processing', 'ready', 'failed', 'published', 'archived', 'deleted');
+
+-- Restores return a video to the status it had before it was deleted, which is read from the history
+insert into video_status_history (video_id, from_status, to_status, actor, reason)
+    select id, status, 'deleted', 'migration', 'deleted before the status history existed'
+    from videos where deleted_at is not null;
+
+update videos set status = 'deleted' where deleted_at is not null;
+
+alter table videos add constraint videos_status_check
+    check (status in ('uploading', 'processing', 'ready', 'failed', 'published', 'archived', 'deleted'));
@@ -0,0 +1,11 @@
+create extension if not exists citext;
+
+create table if not exists users (
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    name text not null,
+    email citext unique not null,
+    password_hash bytea not null,
+    activated bool not null,
+    version integer not null default 1
+);
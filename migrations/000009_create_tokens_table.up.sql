@@ -0,0 +1,8 @@
+create table if not exists tokens (
+    hash bytea primary key,
+    user_id bigint not null references users (id) on delete cascade,
+    expiry timestamp(0) with time zone not null,
+    scope text not null
+);
+
+create index if not exists tokens_user_id_scope_idx on tokens (user_id, scope);
@@ -0,0 +1,5 @@
+drop index if exists videos_owner_id_idx;
+alter table uploads drop column if exists owner_id;
+alter table videos drop column if exists owner_id;
+drop table if exists users_permissions;
+drop table if exists permissions;
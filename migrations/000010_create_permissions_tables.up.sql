@@ -0,0 +1,26 @@
+create table if not exists permissions (
+    id bigserial primary key,
+    code text unique not null
+);
+
+create table if not exists users_permissions (
+    user_id bigint not null references users (id) on delete cascade,
+    permission_id bigint not null references permissions (id) on delete cascade,
+    primary key (user_id, permission_id)
+);
+
+insert into permissions (code)
+    values ('videos:read'), ('videos:write'), ('videos:moderate')
+    on conflict (code) do nothing;
+
+-- Users registered before permissions existed keep the access they had
+insert into users_permissions (user_id, permission_id)
+    select users.id, permissions.id from users, permissions
+    where permissions.code in ('videos:read', 'videos:write')
+    on conflict do nothing;
+
+-- Videos uploaded before ownership existed have no owner and can only be managed by moderators
+alter table videos add column if not exists owner_id bigint references users (id) on delete set null;
+alter table uploads add column if not exists owner_id bigint references users (id) on delete set null;
+
+create index if not exists videos_owner_id_idx on videos (owner_id);
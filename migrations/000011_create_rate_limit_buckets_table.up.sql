@@ -0,0 +1,7 @@
+create unlogged table if not exists rate_limit_buckets (
+    key text primary key,
+    tokens double precision not null,
+    updated_at timestamp with time zone not null
+);
+
+create index if not exists rate_limit_buckets_updated_at_idx on rate_limit_buckets (updated_at);
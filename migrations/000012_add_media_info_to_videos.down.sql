@@ -0,0 +1,7 @@
+alter table videos drop column if exists container;
+alter table videos drop column if exists bitrate;
+alter table videos drop column if exists audio_codec;
+alter table videos drop column if exists video_codec;
+alter table videos drop column if exists height;
+alter table videos drop column if exists width;
+alter table videos drop column if exists duration_ms;
@@ -0,0 +1,8 @@
+-- Technical metadata read from the video content by the probe job, unknown until it ran
+alter table videos add column if not exists duration_ms bigint;
+alter table videos add column if not exists width integer;
+alter table videos add column if not exists height integer;
+alter table videos add column if not exists video_codec text;
+alter table videos add column if not exists audio_codec text;
+alter table videos add column if not exists bitrate bigint;
+alter table videos add column if not exists container text;
@@ -0,0 +1 @@
+alter table videos drop column if exists mime_type;
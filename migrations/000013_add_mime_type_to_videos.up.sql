@@ -0,0 +1,2 @@
+-- Content type sniffed from the uploaded bytes, served as the Content-Type of the stream
+alter table videos add column if not exists mime_type text;
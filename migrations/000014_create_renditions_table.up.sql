@@ -0,0 +1,14 @@
+-- Transcoded outputs of a video, one per rendition of the ladder
+create table if not exists renditions (
+    id bigserial primary key,
+    video_id bigint not null references videos (id) on delete cascade,
+    name text not null,
+    storage_key text not null unique,
+    width integer not null,
+    height integer not null,
+    video_bitrate bigint not null,
+    audio_bitrate bigint not null,
+    size bigint not null,
+    created_at timestamp(0) with time zone not null default now(),
+    constraint renditions_video_id_name_key unique (video_id, name)
+);
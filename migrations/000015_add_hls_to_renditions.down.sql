@@ -0,0 +1,4 @@
+alter table renditions drop column if exists playlist_key;
+alter table renditions drop column if exists average_bandwidth;
+alter table renditions drop column if exists bandwidth;
+alter table renditions drop column if exists codecs;
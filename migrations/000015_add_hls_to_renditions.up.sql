@@ -0,0 +1,5 @@
+-- HLS packaging of a rendition, null until it has been packaged
+alter table renditions add column if not exists codecs text;
+alter table renditions add column if not exists bandwidth bigint;
+alter table renditions add column if not exists average_bandwidth bigint;
+alter table renditions add column if not exists playlist_key text;
@@ -0,0 +1,3 @@
+alter table renditions drop column if exists segment_duration_ms;
+alter table renditions drop column if exists dash_audio;
+alter table renditions drop column if exists dash_prefix;
@@ -0,0 +1,4 @@
+-- DASH packaging of a rendition, its video and audio tracks are segmented apart below dash_prefix
+alter table renditions add column if not exists dash_prefix text;
+alter table renditions add column if not exists dash_audio boolean not null default false;
+alter table renditions add column if not exists segment_duration_ms integer;
@@ -0,0 +1 @@
+-- The zero time is not restored, NULL is what unpublished videos should have had
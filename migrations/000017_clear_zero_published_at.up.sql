@@ -0,0 +1,2 @@
+-- Unpublished videos were stored with the zero time instead of NULL
+update videos set published_at = null where published_at <= '0001-01-02 00:00:00+00';